@@ -6,19 +6,21 @@ import (
 	"github.com/slavik22/blogRestApi"
 	"github.com/slavik22/blogRestApi/controller"
 	"github.com/slavik22/blogRestApi/lib/validator"
+	"github.com/slavik22/blogRestApi/model"
 	"github.com/slavik22/blogRestApi/repository"
 	"github.com/slavik22/blogRestApi/service"
 	echoSwagger "github.com/swaggo/echo-swagger"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"log"
 
-	_ "github.com/swaggo/echo-swagger/example/docs" // docs is generated by Swag CLI, you have to import it
+	_ "github.com/slavik22/blogRestApi/docs" // docs is generated by Swag CLI, you have to import it
 )
 
 //	@title			Swagger Example API
@@ -45,6 +47,9 @@ func run() error {
 	ctx := context.Background()
 
 	cfg, err := blogRestApi.Get(".")
+	if err != nil {
+		return errors.Wrap(err, "blogRestApi.Get failed")
+	}
 
 	db, err := gorm.Open(mysql.Open(cfg.DBSource))
 
@@ -58,17 +63,69 @@ func run() error {
 		return errors.Wrap(err, "repository.New failed")
 	}
 
-	serviceManager, err := service.NewManager(ctx, store)
+	if err := repository.Migrate(db, repository.MigrateOptions{DeleteOrphanComments: cfg.DeleteOrphanComments}); err != nil {
+		return errors.Wrap(err, "repository.Migrate failed")
+	}
+
+	switch cfg.SearchDriver {
+	case "sql":
+	case "memory":
+		store.Search = repository.NewSearchMemoryIndex()
+	default:
+		return errors.Errorf("unknown SEARCH_DRIVER %q", cfg.SearchDriver)
+	}
+
+	serviceManager, err := service.NewManager(ctx, store, cfg)
 	if err != nil {
 		return errors.Wrap(err, "manager.New failed")
 	}
 
+	if cfg.SearchDriver == "memory" {
+		if err := serviceManager.SearchService.Reindex(); err != nil {
+			return errors.Wrap(err, "search reindex failed")
+		}
+	}
+
+	scheduler := service.NewScheduler(
+		service.Job{
+			Name:     "publishing scheduled posts",
+			Interval: cfg.PublishInterval,
+			Run:      serviceManager.PostService.PublishScheduled,
+		},
+		service.Job{
+			Name:     "purging the trash",
+			Interval: cfg.TrashPurgeInterval,
+			Run:      serviceManager.TrashService.PurgeExpired,
+		},
+		service.Job{
+			Name:     "deleting media no post embeds",
+			Interval: cfg.MediaCleanupInterval,
+			Run:      serviceManager.MediaService.DeleteOrphans,
+		},
+		service.Job{
+			Name:     "queueing pending images",
+			Interval: cfg.MediaRequeueInterval,
+			Run:      serviceManager.MediaService.QueuePending,
+		},
+	)
+	serviceManager.MediaService.StartWorkers(ctx)
+	scheduler.Start(ctx)
+
 	userController := controller.NewUserController(ctx, serviceManager)
 	postController := controller.NewUPostController(ctx, serviceManager)
 	commentController := controller.NewUCommentController(ctx, serviceManager)
+	searchController := controller.NewSearchController(ctx, serviceManager)
+	taxonomyController := controller.NewTaxonomyController(ctx, serviceManager)
+	trashController := controller.NewTrashController(ctx, serviceManager)
+	mediaController := controller.NewMediaController(ctx, serviceManager)
 
 	e := echo.New()
+	e.IPExtractor, err = controller.IPExtractor(cfg.TrustedProxies)
+	if err != nil {
+		return errors.Wrap(err, "TRUSTED_PROXIES")
+	}
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
+	e.GET("/.well-known/jwks.json", userController.JWKS)
 
 	e.Validator = validator.NewValidator()
 
@@ -77,28 +134,114 @@ func run() error {
 
 	v1 := e.Group("api/v1")
 
+	authorized := controller.UserIdentity(serviceManager)
+	// Account management is off limits for personal access tokens
+	sessionOnly := controller.RequireSession
+
 	auth := v1.Group("/auth")
 	{
 		auth.POST("/sign-up", userController.SignUp)
 		auth.POST("/sign-in", userController.SignIn)
+		auth.POST("/refresh", userController.Refresh)
+		auth.POST("/logout", userController.Logout, authorized, sessionOnly)
+		auth.POST("/password/forgot", userController.ForgotPassword)
+		auth.POST("/password/reset", userController.ResetPassword)
+		auth.GET("/verify", userController.VerifyEmail)
+		auth.POST("/verify/resend", userController.ResendVerification, authorized, sessionOnly)
+		auth.POST("/mfa/verify", userController.VerifyMFA)
+		auth.GET("/oidc/login", userController.OIDCLogin)
+		auth.GET("/oidc/callback", userController.OIDCCallback)
+	}
+
+	users := v1.Group("/users")
+	{
+		users.GET("/:id", userController.GetProfile)
+		users.GET("/email/confirm", userController.ConfirmEmailChange)
+		users.GET("/me", userController.GetMe, authorized, sessionOnly)
+		users.PUT("/me", userController.UpdateMe, authorized, sessionOnly)
+		users.DELETE("/me", userController.DeleteMe, authorized, sessionOnly)
+		users.PUT("/me/password", userController.ChangePassword, authorized, sessionOnly)
+		users.POST("/me/email", userController.RequestEmailChange, authorized, sessionOnly)
+		users.POST("/me/mfa/totp", userController.EnrollTOTP, authorized, sessionOnly)
+		users.POST("/me/mfa/totp/confirm", userController.ConfirmTOTP, authorized, sessionOnly)
+		users.DELETE("/me/mfa/totp", userController.DisableTOTP, authorized, sessionOnly)
+		users.POST("/me/tokens", userController.CreatePersonalToken, authorized, sessionOnly)
+		users.GET("/me/tokens", userController.GetPersonalTokens, authorized, sessionOnly)
+		users.DELETE("/me/tokens/:id", userController.RevokePersonalToken, authorized, sessionOnly)
+		users.GET("/me/trash", trashController.GetTrash, authorized, sessionOnly)
+		users.GET("/me/media", mediaController.GetUserMedia, authorized, controller.RequirePermission(model.PermPostsWrite))
 	}
 
-	posts := v1.Group("/posts", controller.UserIdentity)
+	posts := v1.Group("/posts", authorized)
 	{
-		posts.GET("/", postController.GetAllPosts)
-		posts.GET("/:id", postController.GetPostById)
-		posts.POST("/", postController.CreatePost)
-		posts.DELETE("/:id", postController.DeletePost)
-		posts.PUT("/:id", postController.UpdatePost)
+		posts.GET("/", postController.GetAllPosts, controller.RequirePermission(model.PermPostsRead))
+		posts.GET("/:id", postController.GetPostById, controller.RequirePermission(model.PermPostsRead))
+		posts.GET("/by-slug/:slug", postController.GetPostBySlug, controller.RequirePermission(model.PermPostsRead))
+		posts.POST("/", postController.CreatePost, controller.RequirePermission(model.PermPostsWrite))
+		posts.DELETE("/:id", postController.DeletePost, controller.RequirePermission(model.PermPostsWrite))
+		posts.PUT("/:id/comment-mode", postController.SetCommentMode, controller.RequirePermission(model.PermPostsWrite))
+		posts.GET("/:id/comments", commentController.GetPostComments, controller.RequirePermission(model.PermCommentsRead))
+		posts.POST("/:id/comments", commentController.CreatePostComment, controller.RequirePermission(model.PermCommentsWrite))
+		posts.GET("/:id/comments/tree", commentController.GetCommentTree, controller.RequirePermission(model.PermCommentsRead))
+		posts.GET("/:id/comments/flat", commentController.GetCommentThread, controller.RequirePermission(model.PermCommentsRead))
+		posts.POST("/:id/restore", trashController.RestorePost, controller.RequirePermission(model.PermPostsWrite))
+		posts.PUT("/:id", postController.UpdatePost, controller.RequirePermission(model.PermPostsWrite))
+		posts.POST("/:id/submit", postController.SubmitPost, controller.RequirePermission(model.PermPostsWrite))
+		posts.POST("/:id/draft", postController.RejectPost, controller.RequirePermission(model.PermPostsWrite))
+		posts.POST("/:id/schedule", postController.SchedulePost, controller.RequirePermission(model.PermPostsPublish))
+		posts.POST("/:id/publish", postController.PublishPost, controller.RequirePermission(model.PermPostsPublish))
+		posts.POST("/:id/archive", postController.ArchivePost, controller.RequirePermission(model.PermPostsWrite))
+		posts.GET("/:id/revisions", postController.GetRevisions, controller.RequirePermission(model.PermPostsWrite))
+		posts.GET("/:id/revisions/diff", postController.DiffRevisions, controller.RequirePermission(model.PermPostsWrite))
+		posts.GET("/:id/revisions/:number", postController.GetRevision, controller.RequirePermission(model.PermPostsWrite))
+		posts.POST("/:id/revisions/:number/restore", postController.RestoreRevision, controller.RequirePermission(model.PermPostsWrite))
 	}
 
-	comments := v1.Group("/comments", controller.UserIdentity)
+	comments := v1.Group("/comments", authorized)
+	{
+		comments.GET("/", commentController.GetAllComments, controller.RequirePermission(model.PermCommentsModerate))
+		comments.GET("/queue", commentController.GetCommentQueue, controller.RequirePermission(model.PermCommentsModerate))
+		comments.POST("/queue/approve", commentController.ApproveComments, controller.RequirePermission(model.PermCommentsModerate))
+		comments.POST("/queue/reject", commentController.RejectComments, controller.RequirePermission(model.PermCommentsModerate))
+		comments.GET("/:id", commentController.GetCommentById, controller.RequirePermission(model.PermCommentsRead))
+		comments.POST("/", commentController.CreateComment, controller.RequirePermission(model.PermCommentsWrite))
+		comments.DELETE("/:id", commentController.DeleteComment, controller.RequirePermission(model.PermCommentsWrite))
+		comments.POST("/:id/restore", trashController.RestoreComment, controller.RequirePermission(model.PermCommentsWrite))
+		comments.PUT("/:id", commentController.UpdateComment, controller.RequirePermission(model.PermCommentsWrite))
+	}
+
+	// Media are served without authorization so posts can embed them, the
+	// multipart body may exceed the file size limit by its headers
+	v1.GET("/media/:key", mediaController.GetMedia)
+	media := v1.Group("/media", authorized)
+	{
+		media.POST("", mediaController.Upload, controller.RequirePermission(model.PermPostsWrite),
+			middleware.BodyLimit(strconv.FormatInt(cfg.MediaMaxSize+1<<20, 10)))
+		media.DELETE("/:id", mediaController.DeleteMedia, controller.RequirePermission(model.PermPostsWrite))
+	}
+
+	tags := v1.Group("/tags", authorized)
+	{
+		tags.GET("/", taxonomyController.GetTags, controller.RequirePermission(model.PermPostsRead))
+		tags.GET("/:slug/posts", taxonomyController.GetTagPosts, controller.RequirePermission(model.PermPostsRead))
+	}
+
+	v1.GET("/categories", taxonomyController.GetCategories, authorized, controller.RequirePermission(model.PermPostsRead))
+
+	v1.GET("/search", searchController.Search, authorized,
+		controller.RequirePermission(model.PermPostsRead), controller.RequirePermission(model.PermCommentsRead))
+
+	admin := v1.Group("/admin", authorized)
 	{
-		comments.GET("/", commentController.GetAllComments)
-		comments.GET("/:id", commentController.GetCommentById)
-		comments.POST("/", commentController.CreateComment)
-		comments.DELETE("/:id", commentController.DeleteComment)
-		comments.PUT("/:id", commentController.UpdateComment)
+		admin.PUT("/users/:id/role", userController.SetRole, controller.RequirePermission(model.PermUsersManage))
+		admin.POST("/users/:id/restore", trashController.RestoreUser, controller.RequirePermission(model.PermUsersManage))
+		admin.GET("/lockouts", userController.GetLockouts, controller.RequirePermission(model.PermUsersManage))
+		admin.DELETE("/lockouts/:id", userController.ClearLockout, controller.RequirePermission(model.PermUsersManage))
+		admin.PUT("/tags/:slug", taxonomyController.RenameTag, controller.RequirePermission(model.PermTaxonomyManage))
+		admin.POST("/tags/:slug/merge", taxonomyController.MergeTag, controller.RequirePermission(model.PermTaxonomyManage))
+		admin.POST("/categories", taxonomyController.CreateCategory, controller.RequirePermission(model.PermTaxonomyManage))
+		admin.DELETE("/categories/:slug", taxonomyController.DeleteCategory, controller.RequirePermission(model.PermTaxonomyManage))
+		admin.DELETE("/trash", trashController.Purge, controller.RequirePermission(model.PermTrashPurge))
 	}
 
 	s := &http.Server{
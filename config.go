@@ -2,6 +2,7 @@ package blogRestApi
 
 import (
 	"github.com/spf13/viper"
+	"time"
 )
 
 // Config is a config :)
@@ -9,10 +10,236 @@ type Config struct {
 	HTTPAddr string `mapstructure:"HTTP_ADDRESS"`
 	LogLevel string `mapstructure:"LOG_LEVEL"`
 	DBSource string `mapstructure:"DB_SOURCE"`
+	// DeleteOrphanComments lets the migration adding the foreign keys on
+	// comments delete the ones whose post or author is gone
+	DeleteOrphanComments bool `mapstructure:"DELETE_ORPHAN_COMMENTS"`
+
+	// TrustedProxies are the comma separated CIDR ranges of the reverse
+	// proxies whose X-Forwarded-For header is believed. Without any, the
+	// client IP is the address of the connection.
+	TrustedProxies string `mapstructure:"TRUSTED_PROXIES"`
+
+	// JWTAlgorithm is one of HS256, RS256, ES256 or EdDSA
+	JWTAlgorithm string `mapstructure:"JWT_ALGORITHM"`
+	// JWTSecret is the HMAC secret used with HS256
+	JWTSecret string `mapstructure:"JWT_SECRET"`
+	// JWTPreviousSecrets are comma separated HMAC secrets still accepted for verification
+	JWTPreviousSecrets string `mapstructure:"JWT_PREVIOUS_SECRETS"`
+	// JWTPrivateKey is the PEM encoded signing key, JWTPrivateKeyFile points to one on disk
+	JWTPrivateKey     string `mapstructure:"JWT_PRIVATE_KEY"`
+	JWTPrivateKeyFile string `mapstructure:"JWT_PRIVATE_KEY_FILE"`
+	// JWTVerificationKeyFiles are comma separated PEM public keys still accepted for verification
+	JWTVerificationKeyFiles string `mapstructure:"JWT_VERIFICATION_KEY_FILES"`
+	// JWTKeyId overrides the kid derived from the signing key
+	JWTKeyId  string `mapstructure:"JWT_KEY_ID"`
+	JWTIssuer string `mapstructure:"JWT_ISSUER"`
+
+	// AppBaseURL is the public URL used in links sent to users
+	AppBaseURL string `mapstructure:"APP_BASE_URL"`
+
+	// MailDriver is one of log, smtp or file
+	MailDriver   string `mapstructure:"MAIL_DRIVER"`
+	MailFrom     string `mapstructure:"MAIL_FROM"`
+	MailDir      string `mapstructure:"MAIL_DIR"`
+	SMTPHost     string `mapstructure:"SMTP_HOST"`
+	SMTPPort     int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
+
+	// PasswordResetURL is the frontend page password reset links open, with
+	// the token added as a query parameter. It asks for the new password and
+	// posts both to /api/v1/auth/password/reset.
+	PasswordResetURL string        `mapstructure:"PASSWORD_RESET_URL"`
+	PasswordResetTTL time.Duration `mapstructure:"PASSWORD_RESET_TTL"`
+
+	// LinkSecret signs the links mailed to users, e.g. for email verification
+	LinkSecret                 string        `mapstructure:"LINK_SECRET"`
+	EmailVerificationTTL       time.Duration `mapstructure:"EMAIL_VERIFICATION_TTL"`
+	VerificationResendInterval time.Duration `mapstructure:"VERIFICATION_RESEND_INTERVAL"`
+	// RequireVerifiedEmail blocks unverified users from creating posts and
+	// comments. Accounts older than email verification were marked verified
+	// when the migration added it.
+	RequireVerifiedEmail bool `mapstructure:"REQUIRE_VERIFIED_EMAIL"`
+
+	// Failed sign-ins at an account back off exponentially from LoginBackoff.
+	// Reaching the limit within LoginLockout locks the account or client IP
+	// for LoginLockout, client IPs are not backed off.
+	LoginMaxAttempts   int           `mapstructure:"LOGIN_MAX_ATTEMPTS"`
+	LoginMaxIPAttempts int           `mapstructure:"LOGIN_MAX_IP_ATTEMPTS"`
+	LoginBackoff       time.Duration `mapstructure:"LOGIN_BACKOFF"`
+	LoginLockout       time.Duration `mapstructure:"LOGIN_LOCKOUT"`
+
+	// TOTPIssuer is the name authenticator apps show next to the account
+	TOTPIssuer string `mapstructure:"TOTP_ISSUER"`
+
+	// OIDCIssuer enables sign-in with an OpenID Connect provider when set
+	OIDCIssuer       string `mapstructure:"OIDC_ISSUER"`
+	OIDCClientID     string `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string `mapstructure:"OIDC_CLIENT_SECRET"`
+	// OIDCRedirectURL must point to /api/v1/auth/oidc/callback
+	OIDCRedirectURL string `mapstructure:"OIDC_REDIRECT_URL"`
+	// OIDCScopes are space separated, openid is always required
+	OIDCScopes string `mapstructure:"OIDC_SCOPES"`
+
+	// Listings return DefaultPageSize items unless asked for more, never more than MaxPageSize
+	DefaultPageSize int `mapstructure:"DEFAULT_PAGE_SIZE"`
+	MaxPageSize     int `mapstructure:"MAX_PAGE_SIZE"`
+
+	// SearchDriver is sql to use the database's full-text index or memory
+	// for an in-process index rebuilt on start up
+	SearchDriver string `mapstructure:"SEARCH_DRIVER"`
+
+	// PublishInterval is how often scheduled posts are checked for publishing
+	PublishInterval time.Duration `mapstructure:"PUBLISH_INTERVAL"`
+
+	// CommentMaxDepth is how deep replies may nest, 0 allows no replies
+	CommentMaxDepth int `mapstructure:"COMMENT_MAX_DEPTH"`
+	// CommentMode is how new comments are moderated on posts that don't set
+	// their own mode: open, premoderated, closed or first_premoderated
+	CommentMode string `mapstructure:"COMMENT_MODE"`
+	// SpamChecks are the comma separated checks new comments go through:
+	// links, blocklist, honeypot, rate and bayes
+	SpamChecks string `mapstructure:"SPAM_CHECKS"`
+	// Comments with more than SpamLinkLimit links wait for a moderator, with
+	// more than SpamLinkSpamLimit they are spam
+	SpamLinkLimit     int `mapstructure:"SPAM_LINK_LIMIT"`
+	SpamLinkSpamLimit int `mapstructure:"SPAM_LINK_SPAM_LIMIT"`
+	// SpamBlocklist holds comma separated words and /regular expressions/
+	// that mark comments as spam, SpamBlocklistFile has one of them per line
+	SpamBlocklist     string `mapstructure:"SPAM_BLOCKLIST"`
+	SpamBlocklistFile string `mapstructure:"SPAM_BLOCKLIST_FILE"`
+	// A user or client IP writing more than SpamRateLimit comments within
+	// SpamRateWindow is spamming
+	SpamRateWindow time.Duration `mapstructure:"SPAM_RATE_WINDOW"`
+	SpamRateLimit  int           `mapstructure:"SPAM_RATE_LIMIT"`
+	// Comments the classifier scores SpamBayesThreshold or more are spam. It
+	// only classifies once moderators decided on SpamBayesMinTraining spam
+	// and as many ham comments.
+	SpamBayesThreshold   float64 `mapstructure:"SPAM_BAYES_THRESHOLD"`
+	SpamBayesMinTraining int64   `mapstructure:"SPAM_BAYES_MIN_TRAINING"`
+
+	// Deleted posts, comments and users stay in the trash for TrashRetention,
+	// the trash is emptied of older ones every TrashPurgeInterval
+	TrashRetention     time.Duration `mapstructure:"TRASH_RETENTION"`
+	TrashPurgeInterval time.Duration `mapstructure:"TRASH_PURGE_INTERVAL"`
+
+	// MediaDriver is one of local, s3 or memory
+	MediaDriver string `mapstructure:"MEDIA_DRIVER"`
+	MediaDir    string `mapstructure:"MEDIA_DIR"`
+	// MediaMaxSize and MediaUserQuota are in bytes, MediaTypes are the comma
+	// separated content types uploads are sniffed as. The quota counts the
+	// variants of images too, they are made after the upload is accepted.
+	MediaMaxSize   int64  `mapstructure:"MEDIA_MAX_SIZE"`
+	MediaUserQuota int64  `mapstructure:"MEDIA_USER_QUOTA"`
+	MediaTypes     string `mapstructure:"MEDIA_TYPES"`
+	// Media no post embeds are deleted once older than MediaOrphanTTL, they
+	// are looked for every MediaCleanupInterval
+	MediaOrphanTTL       time.Duration `mapstructure:"MEDIA_ORPHAN_TTL"`
+	MediaCleanupInterval time.Duration `mapstructure:"MEDIA_CLEANUP_INTERVAL"`
+	// MediaVariants are the comma separated name:size renditions made of
+	// uploaded images, each fits in a size by size square. MediaVariantFormat
+	// is jpeg, webp or auto, which is webp for images with transparency and
+	// jpeg for the rest. WebP variants are lossless, MediaJPEGQuality only
+	// applies to JPEG ones, so they can be a lot larger than JPEG variants
+	// of the same image.
+	MediaVariants      string `mapstructure:"MEDIA_VARIANTS"`
+	MediaVariantFormat string `mapstructure:"MEDIA_VARIANT_FORMAT"`
+	MediaJPEGQuality   int    `mapstructure:"MEDIA_JPEG_QUALITY"`
+	// MediaMaxPixels is the largest width times height of an uploaded image
+	MediaMaxPixels int `mapstructure:"MEDIA_MAX_PIXELS"`
+	// MediaWorkers process uploaded images from a queue of MediaQueueSize,
+	// images left pending are queued again every MediaRequeueInterval
+	MediaWorkers         int           `mapstructure:"MEDIA_WORKERS"`
+	MediaQueueSize       int           `mapstructure:"MEDIA_QUEUE_SIZE"`
+	MediaRequeueInterval time.Duration `mapstructure:"MEDIA_REQUEUE_INTERVAL"`
+	// S3Endpoint is the base URL of the S3-compatible service used by the s3 driver
+	S3Endpoint  string `mapstructure:"S3_ENDPOINT"`
+	S3Region    string `mapstructure:"S3_REGION"`
+	S3Bucket    string `mapstructure:"S3_BUCKET"`
+	S3AccessKey string `mapstructure:"S3_ACCESS_KEY"`
+	S3SecretKey string `mapstructure:"S3_SECRET_KEY"`
+	S3PathStyle bool   `mapstructure:"S3_PATH_STYLE"`
 }
 
 var (
 	config Config
+
+	defaults = map[string]interface{}{
+		"HTTP_ADDRESS":                 ":8080",
+		"TRUSTED_PROXIES":              "",
+		"LOG_LEVEL":                    "info",
+		"DB_SOURCE":                    "",
+		"DELETE_ORPHAN_COMMENTS":       false,
+		"JWT_ALGORITHM":                "HS256",
+		"JWT_SECRET":                   "",
+		"JWT_PREVIOUS_SECRETS":         "",
+		"JWT_PRIVATE_KEY":              "",
+		"JWT_PRIVATE_KEY_FILE":         "",
+		"JWT_VERIFICATION_KEY_FILES":   "",
+		"JWT_KEY_ID":                   "",
+		"JWT_ISSUER":                   "blogRestApi",
+		"APP_BASE_URL":                 "http://localhost:8080",
+		"MAIL_DRIVER":                  "log",
+		"MAIL_FROM":                    "blog <no-reply@localhost>",
+		"MAIL_DIR":                     "mail",
+		"SMTP_HOST":                    "localhost",
+		"SMTP_PORT":                    587,
+		"SMTP_USERNAME":                "",
+		"SMTP_PASSWORD":                "",
+		"PASSWORD_RESET_URL":           "http://localhost:3000/password/reset",
+		"PASSWORD_RESET_TTL":           "1h",
+		"LINK_SECRET":                  "",
+		"EMAIL_VERIFICATION_TTL":       "48h",
+		"VERIFICATION_RESEND_INTERVAL": "1m",
+		"REQUIRE_VERIFIED_EMAIL":       false,
+		"LOGIN_MAX_ATTEMPTS":           5,
+		"LOGIN_MAX_IP_ATTEMPTS":        50,
+		"LOGIN_BACKOFF":                "1s",
+		"LOGIN_LOCKOUT":                "15m",
+		"TOTP_ISSUER":                  "blogRestApi",
+		"OIDC_ISSUER":                  "",
+		"OIDC_CLIENT_ID":               "",
+		"OIDC_CLIENT_SECRET":           "",
+		"OIDC_REDIRECT_URL":            "http://localhost:8080/api/v1/auth/oidc/callback",
+		"OIDC_SCOPES":                  "openid email profile",
+		"DEFAULT_PAGE_SIZE":            20,
+		"MAX_PAGE_SIZE":                100,
+		"SEARCH_DRIVER":                "sql",
+		"PUBLISH_INTERVAL":             "1m",
+		"COMMENT_MAX_DEPTH":            8,
+		"COMMENT_MODE":                 "open",
+		"SPAM_CHECKS":                  "links,blocklist,honeypot,rate,bayes",
+		"SPAM_LINK_LIMIT":              2,
+		"SPAM_LINK_SPAM_LIMIT":         6,
+		"SPAM_BLOCKLIST":               "",
+		"SPAM_BLOCKLIST_FILE":          "",
+		"SPAM_RATE_WINDOW":             "10m",
+		"SPAM_RATE_LIMIT":              5,
+		"SPAM_BAYES_THRESHOLD":         0.95,
+		"SPAM_BAYES_MIN_TRAINING":      20,
+		"TRASH_RETENTION":              "720h",
+		"TRASH_PURGE_INTERVAL":         "1h",
+		"MEDIA_DRIVER":                 "local",
+		"MEDIA_DIR":                    "media",
+		"MEDIA_MAX_SIZE":               10 << 20,
+		"MEDIA_USER_QUOTA":             100 << 20,
+		"MEDIA_TYPES":                  "image/jpeg,image/png,image/gif,image/webp",
+		"MEDIA_ORPHAN_TTL":             "24h",
+		"MEDIA_CLEANUP_INTERVAL":       "1h",
+		"MEDIA_VARIANTS":               "thumbnail:320,medium:800,large:1600",
+		"MEDIA_VARIANT_FORMAT":         "auto",
+		"MEDIA_JPEG_QUALITY":           82,
+		"MEDIA_MAX_PIXELS":             40000000,
+		"MEDIA_WORKERS":                2,
+		"MEDIA_QUEUE_SIZE":             100,
+		"MEDIA_REQUEUE_INTERVAL":       "5m",
+		"S3_ENDPOINT":                  "https://s3.amazonaws.com",
+		"S3_REGION":                    "us-east-1",
+		"S3_BUCKET":                    "",
+		"S3_ACCESS_KEY":                "",
+		"S3_SECRET_KEY":                "",
+		"S3_PATH_STYLE":                false,
+	}
 )
 
 // Get reads config from environment. Once.
@@ -21,6 +248,10 @@ func Get(path string) (*Config, error) {
 	viper.SetConfigName("app")
 	viper.SetConfigType("env")
 
+	for key, value := range defaults {
+		viper.SetDefault(key, value)
+	}
+
 	viper.AutomaticEnv()
 
 	err := viper.ReadInConfig()
@@ -31,3 +262,15 @@ func Get(path string) (*Config, error) {
 	err = viper.Unmarshal(&config)
 	return &config, nil
 }
+
+// Default returns the config with all default values set
+func Default() *Config {
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+
+	var cfg Config
+	_ = v.Unmarshal(&cfg)
+	return &cfg
+}
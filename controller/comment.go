@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
 	"github.com/slavik22/blogRestApi/model"
 	"github.com/slavik22/blogRestApi/service"
 	"net/http"
@@ -20,21 +21,220 @@ type CommentController struct {
 //	@Summary		Get All Comments
 //	@Security		ApiKeyAuth
 //	@Tags			Comments
-//	@Description	get all Comments
+//	@Description	get the comments of the whole blog, for moderators
 //	@ID				get-all-Comments
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	[]model.Comment
+//	@Param			author			query		int		false	"author id"
+//	@Param			post			query		int		false	"post id"
+//	@Param			status			query		string	false	"pending, approved, rejected or spam"
+//	@Param			created_after	query		string	false	"date or RFC 3339 timestamp, inclusive"
+//	@Param			created_before	query		string	false	"date or RFC 3339 timestamp, exclusive"
+//	@Param			sort			query		string	false	"comma separated created_at, title or id, prefix - to sort descending"
+//	@Param			limit			query		int		false	"page size when walking by cursor"
+//	@Param			cursor			query		string	false	"next_cursor of the previous page"
+//	@Param			page			query		int		false	"page number, switches to offset pagination"
+//	@Param			per_page		query		int		false	"page size when paging by number"
+//	@Success		200				{object}	model.Page[model.Comment]
 //	@Router			/api/v1/Comments [get]
 func (h *CommentController) GetAllComments(c echo.Context) error {
-	Comments, err := h.services.CommentService.GetComments()
+	actor, err := getActor(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	query, err := bindCommentQuery(c, commentFilters)
+	if err != nil {
+		return err
 	}
 
+	Comments, err := h.services.CommentService.GetComments(query, actor)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	setPageLinks(c, Comments)
 	return c.JSON(http.StatusOK, Comments)
 }
 
+// GetPostComments godoc
+//
+//	@Summary		Get Post Comments
+//	@Security		ApiKeyAuth
+//	@Tags			Comments
+//	@Description	get the comments on a post
+//	@Description	only approved comments are listed, besides the user's own, moderators see all
+//	@ID				get-post-Comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				path		int		true	"post id"
+//	@Param			author			query		int		false	"author id"
+//	@Param			status			query		string	false	"pending, approved, rejected or spam"
+//	@Param			created_after	query		string	false	"date or RFC 3339 timestamp, inclusive"
+//	@Param			created_before	query		string	false	"date or RFC 3339 timestamp, exclusive"
+//	@Param			sort			query		string	false	"comma separated created_at, title or id, prefix - to sort descending"
+//	@Param			limit			query		int		false	"page size when walking by cursor"
+//	@Param			cursor			query		string	false	"next_cursor of the previous page"
+//	@Param			page			query		int		false	"page number, switches to offset pagination"
+//	@Param			per_page		query		int		false	"page size when paging by number"
+//	@Success		200				{object}	model.Page[model.Comment]
+//	@Router			/api/v1/posts/{id}/comments [get]
+func (h *CommentController) GetPostComments(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	postId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
+	}
+
+	query, err := bindCommentQuery(c, postCommentFilters)
+	if err != nil {
+		return err
+	}
+
+	comments, err := h.services.CommentService.GetPostComments(uint(postId), query, actor)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	setPageLinks(c, comments)
+	return c.JSON(http.StatusOK, comments)
+}
+
+// GetCommentQueue godoc
+//
+//	@Summary		Get Comment Queue
+//	@Security		ApiKeyAuth
+//	@Tags			Comments
+//	@Description	get the comments waiting for a moderator, oldest first
+//	@Description	status picks another queue, such as rejected or spam
+//	@ID				get-Comment-queue
+//	@Accept			json
+//	@Produce		json
+//	@Param			author			query		int		false	"author id"
+//	@Param			post			query		int		false	"post id"
+//	@Param			status			query		string	false	"pending by default, approved, rejected or spam"
+//	@Param			created_after	query		string	false	"date or RFC 3339 timestamp, inclusive"
+//	@Param			created_before	query		string	false	"date or RFC 3339 timestamp, exclusive"
+//	@Param			sort			query		string	false	"comma separated created_at, title or id, prefix - to sort descending"
+//	@Param			limit			query		int		false	"page size when walking by cursor"
+//	@Param			cursor			query		string	false	"next_cursor of the previous page"
+//	@Param			page			query		int		false	"page number, switches to offset pagination"
+//	@Param			per_page		query		int		false	"page size when paging by number"
+//	@Success		200				{object}	model.Page[model.Comment]
+//	@Router			/api/v1/comments/queue [get]
+func (h *CommentController) GetCommentQueue(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	query, err := bindCommentQuery(c, commentFilters)
+	if err != nil {
+		return err
+	}
+
+	comments, err := h.services.CommentService.GetQueue(query, actor)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	setPageLinks(c, comments)
+	return c.JSON(http.StatusOK, comments)
+}
+
+type moderateCommentsInput struct {
+	Ids []uint `json:"ids"`
+	// Spam marks rejected comments as spam
+	Spam bool `json:"spam"`
+}
+
+// ApproveComments godoc
+//
+//	@Summary		Approve Comments
+//	@Security		ApiKeyAuth
+//	@Tags			Comments
+//	@Description	approve the comments with the ids, ids not found are skipped
+//	@ID				approve-Comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		moderateCommentsInput	true	"comment ids"
+//	@Success		200		{array}		model.Comment
+//	@Router			/api/v1/comments/queue/approve [post]
+func (h *CommentController) ApproveComments(c echo.Context) error {
+	return h.moderateComments(c, model.CommentApproved)
+}
+
+// RejectComments godoc
+//
+//	@Summary		Reject Comments
+//	@Security		ApiKeyAuth
+//	@Tags			Comments
+//	@Description	reject the comments with the ids, or mark them spam, ids not found are skipped
+//	@ID				reject-Comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		moderateCommentsInput	true	"comment ids"
+//	@Success		200		{array}		model.Comment
+//	@Router			/api/v1/comments/queue/reject [post]
+func (h *CommentController) RejectComments(c echo.Context) error {
+	return h.moderateComments(c, model.CommentRejected)
+}
+
+func (h *CommentController) moderateComments(c echo.Context, status model.CommentStatus) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	var input moderateCommentsInput
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if input.Spam && status == model.CommentRejected {
+		status = model.CommentSpam
+	}
+
+	comments, err := h.services.CommentService.ModerateComments(input.Ids, status, actor)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	if comments == nil {
+		comments = []model.Comment{}
+	}
+	return c.JSON(http.StatusOK, comments)
+}
+
 // GetCommentById godoc
 //
 //	@Summary		Get Comment By ID
@@ -47,16 +247,26 @@ func (h *CommentController) GetAllComments(c echo.Context) error {
 //	@Success		200	{object}	model.Comment
 //	@Router			/api/v1/Comments/:id [get]
 func (h *CommentController) GetCommentById(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
 	CommentId, err := strconv.Atoi(c.Param("id"))
 
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "Comment id is incorrect"))
 	}
 
-	Comment, err := h.services.CommentService.GetComment(uint(CommentId))
+	Comment, err := h.services.CommentService.GetComment(uint(CommentId), actor)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
 
 	return c.JSON(http.StatusOK, Comment)
@@ -68,34 +278,160 @@ func (h *CommentController) GetCommentById(c echo.Context) error {
 //	@Security		ApiKeyAuth
 //	@Tags			Comment
 //	@Description	create model.Comment
+//	@Description	body is Markdown, it is returned rendered as bodyHtml without images or raw HTML
+//	@Description	parentId makes the comment a reply, postId may then be left out
+//	@Description	the post has to exist, be published and not have comments closed
+//	@Description	201 means the comment is public, 202 that it waits for a moderator
+//	@Description	comments are checked for spam, website is a honeypot form fields should hide
 //	@ID				create-Comment
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{uint}	id
+//	@Success		201	{uint}	id
+//	@Success		202	{uint}	id
 //	@Router			/api/v1/Comments [Post]
 func (h *CommentController) CreateComment(c echo.Context) error {
-	userId, err := getUserId(c)
+	return h.createComment(c, 0)
+}
+
+// CreatePostComment godoc
+//
+//	@Summary		Create Post Comment
+//	@Security		ApiKeyAuth
+//	@Tags			Comment
+//	@Description	create model.Comment on the post in the path, as POST /comments does
+//	@ID				create-post-Comment
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	int	true	"post id"
+//	@Success		201	{uint}	id
+//	@Success		202	{uint}	id
+//	@Router			/api/v1/posts/{id}/comments [post]
+func (h *CommentController) CreatePostComment(c echo.Context) error {
+	postId, err := strconv.Atoi(c.Param("id"))
+	if err != nil || postId <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "post id is incorrect")
+	}
+
+	return h.createComment(c, uint(postId))
+}
+
+// commentInput is a comment with the honeypot field only bots fill in
+type commentInput struct {
+	model.Comment
+	Website string `json:"website"`
+}
+
+// createComment creates the comment in the request body, on the post if it
+// is given
+func (h *CommentController) createComment(c echo.Context, postId uint) error {
+	actor, err := getActor(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
 	}
 
-	var comment model.Comment
+	var input commentInput
 
-	if err := c.Bind(&comment); err != nil {
+	if err := c.Bind(&input); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err)
 	}
 
-	if comment.PostId == 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
+	comment := input.Comment
+	comment.IP = clientIP(c)
+	comment.Honeypot = input.Website
+
+	if postId != 0 {
+		if comment.PostId != 0 && comment.PostId != postId {
+			return echo.NewHTTPError(http.StatusBadRequest, "post id in the body differs from the path")
+		}
+		comment.PostId = postId
 	}
 
-	id, err := h.services.CommentService.CreateComment(comment, userId)
+	if comment.PostId == 0 && comment.ParentId == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "post id is incorrect")
+	}
+
+	created, err := h.services.CommentService.CreateComment(comment, actor)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		switch {
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, "email address is not verified")
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case errors.Cause(err) == types.ErrNotAllowed:
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	if created.Status != model.CommentApproved {
+		return c.JSON(http.StatusAccepted, created.ID)
 	}
+	return c.JSON(http.StatusCreated, created.ID)
+}
+
+// GetCommentTree godoc
+//
+//	@Summary		Get Comment Tree
+//	@Security		ApiKeyAuth
+//	@Tags			Comments
+//	@Description	get the post's top-level comments with their replies nested
+//	@Description	deleted comments with replies are kept as "[deleted]" tombstones
+//	@ID				get-Comment-tree
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"post id"
+//	@Success		200	{array}		model.CommentNode
+//	@Router			/api/v1/posts/{id}/comments/tree [get]
+func (h *CommentController) GetCommentTree(c echo.Context) error {
+	return h.getThread(c, h.services.CommentService.GetTree)
+}
 
-	return c.JSON(http.StatusCreated, id)
+// GetCommentThread godoc
+//
+//	@Summary		Get Comment Thread
+//	@Security		ApiKeyAuth
+//	@Tags			Comments
+//	@Description	get the post's comments as a flat list in thread order, with depth, path and reply count
+//	@Description	deleted comments with replies are kept as "[deleted]" tombstones
+//	@ID				get-Comment-thread
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"post id"
+//	@Success		200	{array}		model.CommentNode
+//	@Router			/api/v1/posts/{id}/comments/flat [get]
+func (h *CommentController) GetCommentThread(c echo.Context) error {
+	return h.getThread(c, h.services.CommentService.GetThread)
+}
+
+func (h *CommentController) getThread(c echo.Context, get func(uint, service.Actor) ([]*model.CommentNode, error)) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	postId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
+	}
+
+	nodes, err := get(uint(postId), actor)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	if nodes == nil {
+		nodes = []*model.CommentNode{}
+	}
+	return c.JSON(http.StatusOK, nodes)
 }
 
 // UpdateComment godoc
@@ -110,7 +446,7 @@ func (h *CommentController) CreateComment(c echo.Context) error {
 //	@Success		200	{object}	model.Comment
 //	@Router			/api/v1/Comments [put]
 func (h *CommentController) UpdateComment(c echo.Context) error {
-	userId, err := getUserId(c)
+	actor, err := getActor(c)
 
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
@@ -129,12 +465,20 @@ func (h *CommentController) UpdateComment(c echo.Context) error {
 	}
 
 	Comment.ID = uint(CommentId)
-	Comment.UserId = userId
 
-	updatedComment, err := h.services.CommentService.UpdateComment(Comment)
+	updatedComment, err := h.services.CommentService.UpdateComment(Comment, actor)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, err)
+		case errors.Cause(err) == types.ErrNotAllowed:
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
 
 	return c.JSON(http.StatusOK, *updatedComment)
@@ -146,13 +490,14 @@ func (h *CommentController) UpdateComment(c echo.Context) error {
 //	@Security		ApiKeyAuth
 //	@Tags			Comment
 //	@Description	delete model.Comment
+//	@Description	the comment goes to the trash, it can be restored until TRASH_RETENTION has passed
 //	@ID				delete-Comment
 //	@Accept			json
 //	@Produce		json
 //	@Success		200
 //	@Router			/api/v1/Comments [delete]
 func (h *CommentController) DeleteComment(c echo.Context) error {
-	userId, err := getUserId(c)
+	actor, err := getActor(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
 	}
@@ -163,10 +508,17 @@ func (h *CommentController) DeleteComment(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "Comment id is incorrect"))
 	}
 
-	err = h.services.CommentService.DeleteComment(uint(CommentId), userId)
+	err = h.services.CommentService.DeleteComment(uint(CommentId), actor)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
 
 	return c.JSON(http.StatusOK, "Comment deleted")
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/types"
 	util2 "github.com/slavik22/blogRestApi/lib/util"
 	"github.com/slavik22/blogRestApi/lib/validator"
 	"github.com/slavik22/blogRestApi/model"
@@ -23,18 +25,24 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateCommentAPI(t *testing.T) {
 	user, _ := randomUser(t)
 	post := randomPost(t, user.ID)
 	comment := randomComment(user.ID, post.ID)
+	parent := randomComment(user.ID, post.ID)
+	parent.ID = 7
+	parent.Depth = 1
+	parent.Path = "0000000006/0000000007"
 
 	testCases := []struct {
 		name          string
 		body          map[string]interface{}
-		buildStubs    func(store *mock_repository.MockCommentRepo)
-		checkResponse func(recoder *httptest.ResponseRecorder)
+		postId        uint
+		buildStubs    func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
 	}{
 		{
 			name: "OK",
@@ -43,13 +51,17 @@ func TestCreateCommentAPI(t *testing.T) {
 				"title":  comment.Title,
 				"postId": comment.PostId,
 			},
-			buildStubs: func(store *mock_repository.MockCommentRepo) {
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
 				store.EXPECT().
 					CreateComment(gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(comment.ID, nil)
 			},
-			checkResponse: func(recorder *httptest.ResponseRecorder) {
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
 				require.Equal(t, http.StatusCreated, recorder.Code)
 
 				str := recorder.Body.String()
@@ -62,6 +74,416 @@ func TestCreateCommentAPI(t *testing.T) {
 				assert.Equal(t, uint(id), comment.ID)
 			},
 		},
+		{
+			name: "Markdown",
+			body: map[string]interface{}{
+				"body":   "**Nice** ![cat](https://example.com/cat.png) <script>alert(1)</script>",
+				"title":  comment.Title,
+				"postId": comment.PostId,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, created *model.Comment) (uint, error) {
+						require.Equal(t, "<p><strong>Nice</strong>  alert(1)</p>\n", created.BodyHTML)
+						return comment.ID, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "Reply",
+			body: map[string]interface{}{
+				"body":     comment.Body,
+				"parentId": parent.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(parent.ID)).
+					Times(1).
+					Return(&parent, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(2).
+					Return(&post, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, created *model.Comment) (uint, error) {
+						require.Equal(t, parent.PostId, created.PostId)
+						require.Equal(t, parent.ID, *created.ParentId)
+						return comment.ID, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "ReplyToUnknownComment",
+			body: map[string]interface{}{
+				"body":     comment.Body,
+				"parentId": 99,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(uint(99))).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name: "ReplyOnOthersDraft",
+			body: map[string]interface{}{
+				"body":     comment.Body,
+				"parentId": parent.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				draft := post
+				draft.Status = model.PostDraft
+				draft.UserId = user.ID + 1
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(parent.ID)).
+					Times(1).
+					Return(&parent, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&draft, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name: "ReplyOnOtherPost",
+			body: map[string]interface{}{
+				"body":     comment.Body,
+				"postId":   post.ID + 1,
+				"parentId": parent.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(parent.ID)).
+					Times(1).
+					Return(&parent, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name: "ReplyTooDeep",
+			body: map[string]interface{}{
+				"body":     comment.Body,
+				"parentId": parent.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				deep := parent
+				deep.Depth = blogRestApi.Default().CommentMaxDepth
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(parent.ID)).
+					Times(1).
+					Return(&deep, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name: "NoPost",
+			body: map[string]interface{}{
+				"body": comment.Body,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name: "PostNotFound",
+			body: map[string]interface{}{
+				"body":   comment.Body,
+				"postId": post.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name: "OthersDraft",
+			body: map[string]interface{}{
+				"body":   comment.Body,
+				"postId": post.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				draft := post
+				draft.Status = model.PostDraft
+				draft.UserId = user.ID + 1
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&draft, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name: "ArchivedPost",
+			body: map[string]interface{}{
+				"body":   comment.Body,
+				"postId": post.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				archived := post
+				archived.Status = model.PostArchived
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&archived, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusConflict)
+			},
+		},
+		{
+			name: "PostPurgedMeanwhile",
+			body: map[string]interface{}{
+				"body":   comment.Body,
+				"postId": post.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(uint(0), types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name:   "PostInPath",
+			postId: post.ID,
+			body: map[string]interface{}{
+				"body": comment.Body,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, created *model.Comment) (uint, error) {
+						require.Equal(t, post.ID, created.PostId)
+						return comment.ID, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:   "PostInPathDiffers",
+			postId: post.ID,
+			body: map[string]interface{}{
+				"body":   comment.Body,
+				"postId": post.ID + 1,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name: "Premoderated",
+			body: map[string]interface{}{
+				"body":   comment.Body,
+				"postId": post.ID,
+				"status": model.CommentApproved,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				moderated := post
+				moderated.CommentMode = model.CommentsPremoderated
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&moderated, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, created *model.Comment) (uint, error) {
+						require.Equal(t, model.CommentPending, created.Status)
+						return comment.ID, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
+		{
+			name: "CommentsClosed",
+			body: map[string]interface{}{
+				"body":   comment.Body,
+				"postId": post.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				closed := post
+				closed.CommentMode = model.CommentsClosed
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&closed, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusConflict)
+			},
+		},
+		{
+			name: "FirstComment",
+			body: map[string]interface{}{
+				"body":   comment.Body,
+				"postId": post.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				moderated := post
+				moderated.CommentMode = model.CommentsFirstPremoderated
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&moderated, nil)
+				store.EXPECT().
+					CountComments(gomock.Any(), gomock.Eq(model.CommentQuery{AuthorId: user.ID, Status: model.CommentApproved, AnyStatus: true})).
+					Times(1).
+					Return(int64(0), nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(comment.ID, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
+		{
+			name: "KnownCommenter",
+			body: map[string]interface{}{
+				"body":   comment.Body,
+				"postId": post.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				moderated := post
+				moderated.CommentMode = model.CommentsFirstPremoderated
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&moderated, nil)
+				store.EXPECT().
+					CountComments(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(2), nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(comment.ID, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "ReplyToPendingComment",
+			body: map[string]interface{}{
+				"body":     comment.Body,
+				"parentId": parent.ID,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				pending := parent
+				pending.Status = model.CommentPending
+				pending.UserId = user.ID + 1
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(parent.ID)).
+					Times(1).
+					Return(&pending, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+				store.EXPECT().
+					CreateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -75,7 +497,7 @@ func TestCreateCommentAPI(t *testing.T) {
 			postRepo := mock_repository.NewMockPostRepo(ctrl)
 			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
 
-			tc.buildStubs(commentRepo)
+			tc.buildStubs(postRepo, commentRepo)
 
 			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
 
@@ -97,18 +519,25 @@ func TestCreateCommentAPI(t *testing.T) {
 
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
-			c.Set("userId", comment.UserId)
+			c.Set("userId", user.ID)
+			c.Set("role", model.RoleReader)
 
-			serviceManager, err := service.NewManager(context.Background(), store)
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
 			if err != nil {
 				t.Error(err)
 			}
 			commentController := NewUCommentController(context.Background(), serviceManager)
-			err = commentController.CreateComment(c)
+			if tc.postId != 0 {
+				c.SetParamNames("id")
+				c.SetParamValues(strconv.Itoa(int(tc.postId)))
+				err = commentController.CreatePostComment(c)
+			} else {
+				err = commentController.CreateComment(c)
+			}
 
 			log.Info(err)
 
-			tc.checkResponse(rec)
+			tc.checkResponse(rec, err)
 		})
 	}
 }
@@ -119,104 +548,742 @@ func TestUpdateCommentAPI(t *testing.T) {
 
 	testCases := []struct {
 		name          string
+		userId        uint
+		role          model.Role
 		body          map[string]interface{}
-		buildStubs    func(store *mock_repository.MockCommentRepo)
-		checkResponse func(recoder *httptest.ResponseRecorder)
+		buildStubs    func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
 	}{
 		{
-			name: "OK",
+			name:   "OK",
+			userId: user.ID,
+			role:   model.RoleReader,
 			body: map[string]interface{}{
 				"body":   comment.Body,
 				"title":  comment.Title,
 				"postId": comment.PostId,
 			},
-			buildStubs: func(store *mock_repository.MockCommentRepo) {
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				existing := comment
+				existing.UserId = user.ID
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&existing, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
 				store.EXPECT().
 					UpdateComment(gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(&comment, nil)
 			},
-			checkResponse: func(recorder *httptest.ResponseRecorder) {
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
 				require.Equal(t, http.StatusOK, recorder.Code)
 				requireBodyMatchComment(t, recorder.Body, comment)
 			},
 		},
-	}
-
-	for i := range testCases {
-		tc := testCases[i]
-
-		t.Run(tc.name, func(t *testing.T) {
-
-			ctrl := gomock.NewController(t)
-
-			userRepo := mock_repository.NewMockUserRepo(ctrl)
-			postRepo := mock_repository.NewMockPostRepo(ctrl)
-			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
-
-			tc.buildStubs(commentRepo)
-
-			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
-
-			if err != nil {
-				t.Error(err)
-			}
-
-			e := echo.New()
-			e.Validator = validator.NewValidator()
-			marshal, err := json.Marshal(tc.body)
+		{
+			name:   "Forbidden",
+			userId: user.ID + 1,
+			role:   model.RoleAuthor,
+			body: map[string]interface{}{
+				"body":  comment.Body,
+				"title": comment.Title,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				existing := comment
+				existing.UserId = user.ID
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&existing, nil)
+				store.EXPECT().
+					UpdateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
+		{
+			name:   "ModeratorEditsAnyComment",
+			userId: user.ID + 1,
+			role:   model.RoleModerator,
+			body: map[string]interface{}{
+				"body":  comment.Body,
+				"title": comment.Title,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				existing := comment
+				existing.UserId = user.ID
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&existing, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+				store.EXPECT().
+					UpdateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&comment, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "PremoderatedEditIsPending",
+			userId: user.ID,
+			role:   model.RoleReader,
+			body: map[string]interface{}{
+				"body":  comment.Body,
+				"title": comment.Title,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				existing := comment
+				existing.UserId = user.ID
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&existing, nil)
+				premoderated := post
+				premoderated.CommentMode = model.CommentsPremoderated
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&premoderated, nil)
+				store.EXPECT().
+					UpdateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, updated *model.Comment) (*model.Comment, error) {
+						require.Equal(t, model.CommentPending, updated.Status)
+						return updated, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "FirstPremoderatedEditOfFirstCommentIsPending",
+			userId: user.ID,
+			role:   model.RoleReader,
+			body: map[string]interface{}{
+				"body":  comment.Body,
+				"title": comment.Title,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				existing := comment
+				existing.UserId = user.ID
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&existing, nil)
+				firstPremoderated := post
+				firstPremoderated.CommentMode = model.CommentsFirstPremoderated
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&firstPremoderated, nil)
+				// The only approved comment is the one edited
+				store.EXPECT().
+					CountComments(gomock.Any(), gomock.Eq(model.CommentQuery{AuthorId: user.ID, Status: model.CommentApproved, AnyStatus: true})).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().
+					UpdateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, updated *model.Comment) (*model.Comment, error) {
+						require.Equal(t, model.CommentPending, updated.Status)
+						return updated, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "FirstPremoderatedEditByApprovedAuthor",
+			userId: user.ID,
+			role:   model.RoleReader,
+			body: map[string]interface{}{
+				"body":  comment.Body,
+				"title": comment.Title,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				existing := comment
+				existing.UserId = user.ID
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&existing, nil)
+				firstPremoderated := post
+				firstPremoderated.CommentMode = model.CommentsFirstPremoderated
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&firstPremoderated, nil)
+				store.EXPECT().
+					CountComments(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(2), nil)
+				store.EXPECT().
+					UpdateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, updated *model.Comment) (*model.Comment, error) {
+						require.Equal(t, model.CommentApproved, updated.Status)
+						return updated, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "SpamEdit",
+			userId: user.ID,
+			role:   model.RoleReader,
+			body: map[string]interface{}{
+				"body":  strings.Repeat("buy now https://spam.example ", 10),
+				"title": comment.Title,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				existing := comment
+				existing.UserId = user.ID
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&existing, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+				store.EXPECT().
+					UpdateComment(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, updated *model.Comment) (*model.Comment, error) {
+						require.Equal(t, model.CommentSpam, updated.Status)
+						return updated, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "CommentsClosed",
+			userId: user.ID,
+			role:   model.RoleReader,
+			body: map[string]interface{}{
+				"body":  comment.Body,
+				"title": comment.Title,
+			},
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				existing := comment
+				existing.UserId = user.ID
+				store.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&existing, nil)
+				closed := post
+				closed.CommentMode = model.CommentsClosed
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&closed, nil)
+				store.EXPECT().
+					UpdateComment(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusConflict)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+			tc.buildStubs(postRepo, commentRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+
+			if err != nil {
+				t.Error(err)
+			}
+
+			e := echo.New()
+			e.Validator = validator.NewValidator()
+			marshal, err := json.Marshal(tc.body)
+
+			if err != nil {
+				t.Error(err)
+			}
+
+			url := fmt.Sprintf("/v1/api/comments/%d", comment.ID)
+			req := httptest.NewRequest(http.MethodPut, url, strings.NewReader(string(marshal)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userId", tc.userId)
+			c.Set("role", tc.role)
+			c.SetParamNames("id")
+			c.SetParamValues(strconv.Itoa(int(comment.ID)))
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			if err != nil {
+				t.Error(err)
+			}
+
+			commentController := NewUCommentController(context.Background(), serviceManager)
+			err = commentController.UpdateComment(c)
+
+			log.Info(err)
+
+			tc.checkResponse(rec, err)
+		})
+	}
+}
+func TestGetCommentAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	post := randomPost(t, user.ID)
+	comment := randomComment(user.ID, post.ID)
+
+	testCases := []struct {
+		name          string
+		commentId     uint
+		buildStubs    func(posts *mock_repository.MockPostRepo, comments *mock_repository.MockCommentRepo)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name:      "OK",
+			commentId: comment.ID,
+			buildStubs: func(posts *mock_repository.MockPostRepo, comments *mock_repository.MockCommentRepo) {
+				comments.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&comment, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchComment(t, recorder.Body, comment)
+			},
+		},
+		{
+			name:      "OthersPendingComment",
+			commentId: comment.ID,
+			buildStubs: func(posts *mock_repository.MockPostRepo, comments *mock_repository.MockCommentRepo) {
+				pending := comment
+				pending.Status = model.CommentPending
+				pending.UserId = comment.UserId + 1
+				comments.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&pending, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			// The actor's own approved comment on a post they can't see
+			name:      "CommentOnOthersDraft",
+			commentId: comment.ID,
+			buildStubs: func(posts *mock_repository.MockPostRepo, comments *mock_repository.MockCommentRepo) {
+				draft := post
+				draft.Status = model.PostDraft
+				draft.UserId = user.ID + 1
+				comments.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&comment, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&draft, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name:      "PostNotFound",
+			commentId: comment.ID,
+			buildStubs: func(posts *mock_repository.MockPostRepo, comments *mock_repository.MockCommentRepo) {
+				comments.EXPECT().
+					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					Times(1).
+					Return(&comment, nil)
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+			tc.buildStubs(postRepo, commentRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+
+			e := echo.New()
+			e.Validator = validator.NewValidator()
+
+			url := fmt.Sprintf("/v1/api/comments/%d", tc.commentId)
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.Set("userId", comment.UserId)
+			c.Set("role", model.RoleReader)
+			c.SetParamNames("id")
+			c.SetParamValues(strconv.Itoa(int(comment.ID)))
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+
+			if err != nil {
+				t.Error(err)
+			}
+
+			commentController := NewUCommentController(context.Background(), serviceManager)
+			err = commentController.GetCommentById(c)
+
+			tc.checkResponse(rec, err)
+		})
+	}
+}
+func TestGetCommentsAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	post := randomPost(t, user.ID)
+
+	n := 10
+	comments := make([]model.Comment, n)
+
+	for i := 0; i < n; i++ {
+		comments[i] = randomComment(user.ID, post.ID)
+	}
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mock_repository.MockCommentRepo)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mock_repository.MockCommentRepo) {
+				store.EXPECT().
+					CountComments(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(n), nil)
+				store.EXPECT().
+					GetComments(gomock.Any(), gomock.Eq(model.CommentQuery{ViewerId: user.ID, AnyStatus: true, Page: model.PageRequest{Limit: 6}})).
+					Times(1).
+					Return(comments[:6], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				page := requireBodyMatchComments(t, recorder.Body, comments[:5])
+				require.Equal(t, int64(n), page.Total)
+				require.NotEmpty(t, page.NextCursor)
+				require.Contains(t, recorder.Header().Get("Link"), `rel="next"`)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+			tc.buildStubs(commentRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+
+			e := echo.New()
+			e.Validator = validator.NewValidator()
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/api/comments?limit=5", nil)
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.Set("userId", user.ID)
+			c.Set("role", model.RoleModerator)
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+
+			if err != nil {
+				t.Error(err)
+			}
+
+			commentController := NewUCommentController(context.Background(), serviceManager)
+			err = commentController.GetAllComments(c)
+
+			if err != nil {
+				t.Error(err)
+			}
+
+			tc.checkResponse(rec)
+		})
+	}
+}
+
+func TestGetPostCommentsAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	post := randomPost(t, user.ID)
+
+	n := 3
+	comments := make([]model.Comment, n)
+
+	for i := 0; i < n; i++ {
+		comments[i] = randomComment(user.ID, post.ID)
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name:  "OK",
+			query: "limit=5",
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				query := model.CommentQuery{PostId: post.ID, ViewerId: user.ID, Page: model.PageRequest{Limit: 6}}
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&post, nil)
+				store.EXPECT().
+					CountComments(gomock.Any(), gomock.Eq(model.CommentQuery{PostId: post.ID, ViewerId: user.ID, Page: model.PageRequest{Limit: 5}})).
+					Times(1).
+					Return(int64(n), nil)
+				store.EXPECT().
+					GetComments(gomock.Any(), gomock.Eq(query)).
+					Times(1).
+					Return(comments, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+				page := requireBodyMatchComments(t, recorder.Body, comments)
+				require.Equal(t, int64(n), page.Total)
+			},
+		},
+		{
+			name: "PostNotFound",
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				posts.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+				store.EXPECT().
+					GetComments(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name:  "PostFilter",
+			query: fmt.Sprintf("post=%d", post.ID+1),
+			buildStubs: func(posts *mock_repository.MockPostRepo, store *mock_repository.MockCommentRepo) {
+				store.EXPECT().
+					GetComments(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
 
-			if err != nil {
-				t.Error(err)
-			}
+			tc.buildStubs(postRepo, commentRepo)
 
-			url := fmt.Sprintf("/v1/api/comments/%d", comment.ID)
-			req := httptest.NewRequest(http.MethodPut, url, strings.NewReader(string(marshal)))
-			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
 
+			e := echo.New()
+			url := fmt.Sprintf("/api/v1/posts/%d/comments?%s", post.ID, tc.query)
+			req := httptest.NewRequest(http.MethodGet, url, nil)
 			rec := httptest.NewRecorder()
+
 			c := e.NewContext(req, rec)
-			c.Set("userId", comment.UserId)
+			c.Set("userId", user.ID)
+			c.Set("role", model.RoleReader)
 			c.SetParamNames("id")
-			c.SetParamValues(strconv.Itoa(int(comment.ID)))
+			c.SetParamValues(strconv.Itoa(int(post.ID)))
 
-			serviceManager, err := service.NewManager(context.Background(), store)
-			if err != nil {
-				t.Error(err)
-			}
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
 
 			commentController := NewUCommentController(context.Background(), serviceManager)
-			err = commentController.UpdateComment(c)
-
-			log.Info(err)
+			err = commentController.GetPostComments(c)
 
-			tc.checkResponse(rec)
+			tc.checkResponse(rec, err)
 		})
 	}
 }
-func TestGetCommentAPI(t *testing.T) {
+
+func TestModerateCommentsAPI(t *testing.T) {
 	user, _ := randomUser(t)
 	post := randomPost(t, user.ID)
 	comment := randomComment(user.ID, post.ID)
 
 	testCases := []struct {
 		name          string
-		commentId     uint
-		buildStubs    func(store *mock_repository.MockCommentRepo)
-		checkResponse func(recoder *httptest.ResponseRecorder)
+		role          model.Role
+		reject        bool
+		body          map[string]interface{}
+		buildStubs    func(store *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
 	}{
 		{
-			name:      "OK",
-			commentId: comment.ID,
-			buildStubs: func(store *mock_repository.MockCommentRepo) {
+			name: "Approve",
+			role: model.RoleModerator,
+			body: map[string]interface{}{"ids": []uint{comment.ID, 99}},
+			buildStubs: func(store *mock_repository.MockCommentRepo, spamRepo *mock_repository.MockSpamRepo) {
+				approved := comment
 				store.EXPECT().
-					GetComment(gomock.Any(), gomock.Eq(comment.ID)).
+					ModerateComments(gomock.Any(), gomock.Eq([]uint{comment.ID, 99}), gomock.Eq(model.CommentApproved), gomock.Eq(user.ID)).
 					Times(1).
-					Return(&comment, nil)
+					Return([]model.Comment{approved}, nil)
+				spamRepo.EXPECT().
+					TrainSpam(gomock.Any(), gomock.Eq(comment.ID), gomock.Any(), gomock.Eq(false)).
+					Times(1).
+					Return(nil)
 			},
-			checkResponse: func(recorder *httptest.ResponseRecorder) {
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
 				require.Equal(t, http.StatusOK, recorder.Code)
-				requireBodyMatchComment(t, recorder.Body, comment)
+
+				var comments []model.Comment
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &comments))
+				require.Len(t, comments, 1)
+				require.Equal(t, comment.ID, comments[0].ID)
+			},
+		},
+		{
+			name:   "Reject",
+			role:   model.RoleModerator,
+			reject: true,
+			body:   map[string]interface{}{"ids": []uint{comment.ID}},
+			buildStubs: func(store *mock_repository.MockCommentRepo, spamRepo *mock_repository.MockSpamRepo) {
+				store.EXPECT().
+					ModerateComments(gomock.Any(), gomock.Any(), gomock.Eq(model.CommentRejected), gomock.Any()).
+					Times(1).
+					Return(nil, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "[]", strings.TrimSpace(recorder.Body.String()))
+			},
+		},
+		{
+			name:   "Spam",
+			role:   model.RoleModerator,
+			reject: true,
+			body:   map[string]interface{}{"ids": []uint{comment.ID}, "spam": true},
+			buildStubs: func(store *mock_repository.MockCommentRepo, spamRepo *mock_repository.MockSpamRepo) {
+				spam := comment
+				spam.Status = model.CommentSpam
+				store.EXPECT().
+					ModerateComments(gomock.Any(), gomock.Any(), gomock.Eq(model.CommentSpam), gomock.Any()).
+					Times(1).
+					Return([]model.Comment{spam}, nil)
+				spamRepo.EXPECT().
+					TrainSpam(gomock.Any(), gomock.Eq(comment.ID), gomock.Any(), gomock.Eq(true)).
+					Times(1).
+					Return(fmt.Errorf("training failed"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "NoIds",
+			role: model.RoleModerator,
+			body: map[string]interface{}{"ids": []uint{}},
+			buildStubs: func(store *mock_repository.MockCommentRepo, spamRepo *mock_repository.MockSpamRepo) {
+				store.EXPECT().
+					ModerateComments(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name: "NotModerator",
+			role: model.RoleAuthor,
+			body: map[string]interface{}{"ids": []uint{comment.ID}},
+			buildStubs: func(store *mock_repository.MockCommentRepo, spamRepo *mock_repository.MockSpamRepo) {
+				store.EXPECT().
+					ModerateComments(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
 			},
 		},
 	}
@@ -225,75 +1292,207 @@ func TestGetCommentAPI(t *testing.T) {
 		tc := testCases[i]
 
 		t.Run(tc.name, func(t *testing.T) {
-
 			ctrl := gomock.NewController(t)
 
 			userRepo := mock_repository.NewMockUserRepo(ctrl)
 			postRepo := mock_repository.NewMockPostRepo(ctrl)
 			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			spamRepo := mock_repository.NewMockSpamRepo(ctrl)
 
-			tc.buildStubs(commentRepo)
+			tc.buildStubs(commentRepo, spamRepo)
 
 			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Spam = spamRepo
 
-			e := echo.New()
-			e.Validator = validator.NewValidator()
+			marshal, err := json.Marshal(tc.body)
+			require.NoError(t, err)
 
-			url := fmt.Sprintf("/v1/api/comments/%d", tc.commentId)
-			req := httptest.NewRequest(http.MethodGet, url, nil)
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/comments/queue/approve", bytes.NewReader(marshal))
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-
 			rec := httptest.NewRecorder()
 
 			c := e.NewContext(req, rec)
-			c.Set("userId", comment.UserId)
-			c.SetParamNames("id")
-			c.SetParamValues(strconv.Itoa(int(comment.ID)))
-
-			serviceManager, err := service.NewManager(context.Background(), store)
+			c.Set("userId", user.ID)
+			c.Set("role", tc.role)
 
-			if err != nil {
-				t.Error(err)
-			}
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
 
 			commentController := NewUCommentController(context.Background(), serviceManager)
-			err = commentController.GetCommentById(c)
-
-			if err != nil {
-				t.Error(err)
+			if tc.reject {
+				err = commentController.RejectComments(c)
+			} else {
+				err = commentController.ApproveComments(c)
 			}
 
-			tc.checkResponse(rec)
+			tc.checkResponse(rec, err)
 		})
 	}
 }
-func TestGetCommentsAPI(t *testing.T) {
+
+func TestCommentQueueAPI(t *testing.T) {
 	user, _ := randomUser(t)
 	post := randomPost(t, user.ID)
+	comment := randomComment(user.ID, post.ID)
+	comment.Status = model.CommentPending
 
-	n := 10
-	comments := make([]model.Comment, n)
+	ctrl := gomock.NewController(t)
 
-	for i := 0; i < n; i++ {
-		comments[i] = randomComment(user.ID, post.ID)
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+	query := model.CommentQuery{
+		Status:    model.CommentPending,
+		ViewerId:  user.ID,
+		AnyStatus: true,
+		Sort:      []model.SortField{{Field: "created_at"}},
+	}
+	commentRepo.EXPECT().
+		CountComments(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(int64(1), nil)
+	query.Page = model.PageRequest{Limit: blogRestApi.Default().DefaultPageSize + 1}
+	commentRepo.EXPECT().
+		GetComments(gomock.Any(), gomock.Eq(query)).
+		Times(1).
+		Return([]model.Comment{comment}, nil)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/comments/queue", nil)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	c.Set("userId", user.ID)
+	c.Set("role", model.RoleModerator)
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+
+	commentController := NewUCommentController(context.Background(), serviceManager)
+	require.NoError(t, commentController.GetCommentQueue(c))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	page := requireBodyMatchComments(t, rec.Body, []model.Comment{comment})
+	require.Equal(t, int64(1), page.Total)
+}
+
+func TestCommentThreadAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	post := randomPost(t, user.ID)
+
+	// 1 has a reply 2, which has a reply 4. 3 was deleted and its reply 5
+	// is kept under a tombstone.
+	reply := func(id uint, parentId uint, path string) model.Comment {
+		comment := randomComment(user.ID, post.ID)
+		comment.ID = id
+		comment.Path = path
+		comment.Depth = strings.Count(path, "/")
+		if parentId != 0 {
+			comment.ParentId = &parentId
+		}
+		return comment
 	}
+	thread := []model.Comment{
+		reply(1, 0, "0000000001"),
+		reply(2, 1, "0000000001/0000000002"),
+		reply(4, 2, "0000000001/0000000002/0000000004"),
+		reply(5, 3, "0000000003/0000000005"),
+	}
+
+	draft := post
+	draft.Status = model.PostDraft
+	draft.UserId = user.ID + 1
 
 	testCases := []struct {
 		name          string
-		buildStubs    func(store *mock_repository.MockCommentRepo)
-		checkResponse func(recoder *httptest.ResponseRecorder)
+		flat          bool
+		buildStubs    func(posts *mock_repository.MockPostRepo, comments *mock_repository.MockCommentRepo)
+		checkResponse func(recorder *httptest.ResponseRecorder, err error)
 	}{
 		{
-			name: "OK",
-			buildStubs: func(store *mock_repository.MockCommentRepo) {
-				store.EXPECT().
-					GetComments(gomock.Any()).
-					Times(1).
-					Return(comments, nil)
+			name: "Tree",
+			buildStubs: func(posts *mock_repository.MockPostRepo, comments *mock_repository.MockCommentRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				comments.EXPECT().GetThread(gomock.Any(), gomock.Eq(model.CommentQuery{PostId: post.ID, ViewerId: user.ID})).Times(1).Return(thread, nil)
 			},
-			checkResponse: func(recorder *httptest.ResponseRecorder) {
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var roots []model.CommentNode
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &roots))
+				require.Len(t, roots, 2)
+
+				require.Equal(t, uint(1), roots[0].ID)
+				require.Equal(t, 2, roots[0].ReplyCount)
+				require.Len(t, roots[0].Replies, 1)
+				require.Equal(t, uint(2), roots[0].Replies[0].ID)
+				require.Equal(t, 1, roots[0].Replies[0].ReplyCount)
+				require.Equal(t, uint(4), roots[0].Replies[0].Replies[0].ID)
+				require.Empty(t, roots[0].Replies[0].Replies[0].Replies)
+
+				require.Equal(t, uint(3), roots[1].ID)
+				require.True(t, roots[1].Deleted)
+				require.Equal(t, model.CommentTombstone, roots[1].Body)
+				require.Equal(t, 1, roots[1].ReplyCount)
+				require.Len(t, roots[1].Replies, 1)
+				require.Equal(t, uint(5), roots[1].Replies[0].ID)
+				require.False(t, roots[1].Replies[0].Deleted)
+			},
+		},
+		{
+			name: "Flat",
+			flat: true,
+			buildStubs: func(posts *mock_repository.MockPostRepo, comments *mock_repository.MockCommentRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				comments.EXPECT().GetThread(gomock.Any(), gomock.Eq(model.CommentQuery{PostId: post.ID, ViewerId: user.ID})).Times(1).Return(thread, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
 				require.Equal(t, http.StatusOK, recorder.Code)
-				requireBodyMatchComments(t, recorder.Body, comments)
+
+				var nodes []model.CommentNode
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &nodes))
+
+				var ids []uint
+				var depths []int
+				for _, node := range nodes {
+					ids = append(ids, node.ID)
+					depths = append(depths, node.Depth)
+					require.Empty(t, node.Replies)
+				}
+				require.Equal(t, []uint{1, 2, 4, 3, 5}, ids)
+				require.Equal(t, []int{0, 1, 2, 0, 1}, depths)
+				require.True(t, nodes[3].Deleted)
+				require.Equal(t, "0000000003", nodes[3].Path)
+			},
+		},
+		{
+			name: "NoComments",
+			flat: true,
+			buildStubs: func(posts *mock_repository.MockPostRepo, comments *mock_repository.MockCommentRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				comments.EXPECT().GetThread(gomock.Any(), gomock.Eq(model.CommentQuery{PostId: post.ID, ViewerId: user.ID})).Times(1).Return(nil, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "[]", strings.TrimSpace(recorder.Body.String()))
+			},
+		},
+		{
+			name: "UnpublishedPost",
+			buildStubs: func(posts *mock_repository.MockPostRepo, comments *mock_repository.MockCommentRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&draft, nil)
+				comments.EXPECT().GetThread(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
 			},
 		},
 	}
@@ -302,42 +1501,38 @@ func TestGetCommentsAPI(t *testing.T) {
 		tc := testCases[i]
 
 		t.Run(tc.name, func(t *testing.T) {
-
 			ctrl := gomock.NewController(t)
 
 			userRepo := mock_repository.NewMockUserRepo(ctrl)
 			postRepo := mock_repository.NewMockPostRepo(ctrl)
 			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
 
-			tc.buildStubs(commentRepo)
+			tc.buildStubs(postRepo, commentRepo)
 
 			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
 
 			e := echo.New()
-			e.Validator = validator.NewValidator()
-
-			req := httptest.NewRequest(http.MethodGet, "/v1/api/comments", nil)
-			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/posts/%d/comments", post.ID), nil)
 			rec := httptest.NewRecorder()
 
 			c := e.NewContext(req, rec)
 			c.Set("userId", user.ID)
+			c.Set("role", model.RoleReader)
+			c.SetParamNames("id")
+			c.SetParamValues(strconv.Itoa(int(post.ID)))
 
-			serviceManager, err := service.NewManager(context.Background(), store)
-
-			if err != nil {
-				t.Error(err)
-			}
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
 
 			commentController := NewUCommentController(context.Background(), serviceManager)
-			err = commentController.GetAllComments(c)
-
-			if err != nil {
-				t.Error(err)
+			if tc.flat {
+				err = commentController.GetCommentThread(c)
+			} else {
+				err = commentController.GetCommentTree(c)
 			}
 
-			tc.checkResponse(rec)
+			tc.checkResponse(rec, err)
 		})
 	}
 }
@@ -348,6 +1543,7 @@ func randomComment(userId uint, postId uint) (comment model.Comment) {
 		PostId: postId,
 		Title:  util2.RandomString(10),
 		Body:   util2.RandomString(100),
+		Status: model.CommentApproved,
 	}
 	return
 }
@@ -367,12 +1563,314 @@ func requireBodyMatchComment(t *testing.T, body *bytes.Buffer, comment model.Com
 	require.Equal(t, comment.UserId, gotComment.UserId)
 }
 
-func requireBodyMatchComments(t *testing.T, body *bytes.Buffer, comments []model.Comment) {
+func requireBodyMatchComments(t *testing.T, body *bytes.Buffer, comments []model.Comment) model.Page[model.Comment] {
 	data, err := io.ReadAll(body)
 	require.NoError(t, err)
 
-	var gotComments []model.Comment
+	var gotComments model.Page[model.Comment]
 	err = json.Unmarshal(data, &gotComments)
 	require.NoError(t, err)
-	require.Equal(t, comments, gotComments)
+	require.Equal(t, comments, gotComments.Data)
+	return gotComments
+}
+
+func TestCommentSpamAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	post := randomPost(t, user.ID)
+	comment := randomComment(user.ID, post.ID)
+	ip := "203.0.113.7"
+
+	created := func(store *mock_repository.MockCommentRepo, status model.CommentStatus) {
+		store.EXPECT().
+			CreateComment(gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(_ context.Context, created *model.Comment) (uint, error) {
+				require.Equal(t, status, created.Status)
+				require.Equal(t, ip, created.IP)
+				return comment.ID, nil
+			})
+	}
+	tokens := func(spam, ham int64) func(context.Context, []string) (map[string]model.SpamToken, error) {
+		return func(_ context.Context, tokens []string) (map[string]model.SpamToken, error) {
+			counts := map[string]model.SpamToken{}
+			for _, token := range tokens {
+				counts[token] = model.SpamToken{Token: token, Spam: spam, Ham: ham}
+			}
+			return counts, nil
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		role          model.Role
+		checks        string
+		body          string
+		website       string
+		buildStubs    func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name: "Ham",
+			body: comment.Body,
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				created(comments, model.CommentApproved)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:    "Honeypot",
+			body:    comment.Body,
+			website: "https://example.com",
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				created(comments, model.CommentSpam)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
+		{
+			name: "SomeLinks",
+			body: "See https://a.example, [this](https://b.example/x) and www.c.example",
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				created(comments, model.CommentPending)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
+		{
+			name: "ManyLinks",
+			body: strings.Repeat("https://shop.example/deal ", 7),
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				created(comments, model.CommentSpam)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
+		{
+			name: "BlockedWord",
+			body: "Best CASINO bonus in town",
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				created(comments, model.CommentSpam)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
+		{
+			name: "BlockedWordWithin",
+			body: "The casinos of Monte Carlo in the 1920s",
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				created(comments, model.CommentApproved)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "BlockedExpression",
+			body: "Cheap   pills here",
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				created(comments, model.CommentSpam)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
+		{
+			name:   "UserRate",
+			checks: "rate",
+			body:   comment.Body,
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				comments.EXPECT().
+					CountComments(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, query model.CommentQuery) (int64, error) {
+						require.Equal(t, user.ID, query.AuthorId)
+						require.True(t, query.AnyStatus)
+						require.NotNil(t, query.CreatedAfter)
+						require.WithinDuration(t, time.Now().Add(-10*time.Minute), *query.CreatedAfter, time.Minute)
+						return 5, nil
+					})
+				created(comments, model.CommentPending)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
+		{
+			name:   "IPRate",
+			checks: "rate",
+			body:   comment.Body,
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				gomock.InOrder(
+					comments.EXPECT().
+						CountComments(gomock.Any(), gomock.Any()).
+						Times(1).
+						Return(int64(1), nil),
+					comments.EXPECT().
+						CountComments(gomock.Any(), gomock.Any()).
+						Times(1).
+						DoAndReturn(func(_ context.Context, query model.CommentQuery) (int64, error) {
+							require.Equal(t, ip, query.IP)
+							require.Zero(t, query.AuthorId)
+							return 5, nil
+						}),
+				)
+				created(comments, model.CommentPending)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
+		{
+			name:   "CheckFails",
+			checks: "rate",
+			body:   comment.Body,
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				comments.EXPECT().
+					CountComments(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(0), fmt.Errorf("database is down"))
+				created(comments, model.CommentApproved)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:   "BayesSpam",
+			checks: "bayes",
+			body:   "buy cheap replica watches now",
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				spam.EXPECT().GetSpamTotals(gomock.Any()).Times(1).Return(int64(30), int64(30), nil)
+				spam.EXPECT().
+					GetSpamTokens(gomock.Any(), gomock.Eq([]string{strings.ToLower(comment.Title), "buy", "cheap", "replica", "watches", "now"})).
+					Times(1).
+					DoAndReturn(tokens(30, 0))
+				created(comments, model.CommentSpam)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
+		{
+			name:   "BayesHam",
+			checks: "bayes",
+			body:   comment.Body,
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				spam.EXPECT().GetSpamTotals(gomock.Any()).Times(1).Return(int64(30), int64(30), nil)
+				spam.EXPECT().GetSpamTokens(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(tokens(1, 25))
+				created(comments, model.CommentApproved)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:   "BayesUntrained",
+			checks: "bayes",
+			body:   "buy cheap replica watches now",
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				spam.EXPECT().GetSpamTotals(gomock.Any()).Times(1).Return(int64(30), int64(19), nil)
+				spam.EXPECT().GetSpamTokens(gomock.Any(), gomock.Any()).Times(0)
+				created(comments, model.CommentApproved)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:    "Moderator",
+			role:    model.RoleModerator,
+			checks:  "links,blocklist,honeypot,rate,bayes",
+			body:    "Best casino bonus",
+			website: "https://example.com",
+			buildStubs: func(comments *mock_repository.MockCommentRepo, spam *mock_repository.MockSpamRepo) {
+				created(comments, model.CommentApproved)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			spamRepo := mock_repository.NewMockSpamRepo(ctrl)
+
+			postRepo.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).AnyTimes().Return(&post, nil)
+			tc.buildStubs(commentRepo, spamRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Spam = spamRepo
+
+			cfg := testConfig()
+			cfg.SpamBlocklist = `casino,/cheap\s+pills/`
+			if tc.checks != "" {
+				cfg.SpamChecks = tc.checks
+			}
+
+			role := tc.role
+			if role == "" {
+				role = model.RoleReader
+			}
+
+			marshal, err := json.Marshal(map[string]interface{}{
+				"title":   comment.Title,
+				"body":    tc.body,
+				"postId":  post.ID,
+				"website": tc.website,
+			})
+			require.NoError(t, err)
+
+			e := echo.New()
+			e.IPExtractor, err = IPExtractor("")
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/comments", bytes.NewReader(marshal))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.RemoteAddr = ip + ":1234"
+			// The IP stored and rate limited is the connection's, clients
+			// can't pick one
+			req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.7")
+			req.Header.Set(echo.HeaderXRealIP, "198.51.100.8")
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.Set("userId", user.ID)
+			c.Set("role", role)
+
+			serviceManager, err := service.NewManager(context.Background(), store, cfg)
+			require.NoError(t, err)
+
+			commentController := NewUCommentController(context.Background(), serviceManager)
+			tc.checkResponse(rec, commentController.CreateComment(c))
+		})
+	}
 }
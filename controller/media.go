@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/service"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+type MediaController struct {
+	ctx      context.Context
+	services *service.Manager
+}
+
+func NewMediaController(ctx context.Context, services *service.Manager) *MediaController {
+	return &MediaController{
+		ctx:      ctx,
+		services: services,
+	}
+}
+
+// mediaError maps the errors of the media service to HTTP errors
+func mediaError(err error) error {
+	switch {
+	case errors.Cause(err) == types.ErrNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, "media not found")
+	case errors.Cause(err) == types.ErrBadRequest:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Cause(err) == types.ErrForbidden:
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Cause(err) == types.ErrConflict:
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Cause(err) == types.ErrTooLarge:
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Cause(err) == types.ErrUnprocessableEntity:
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+}
+
+// Upload godoc
+//
+//	@Summary		Upload Media
+//	@Security		ApiKeyAuth
+//	@Tags			Media
+//	@Description	upload a file as the multipart form field "file"
+//	@Description	the content type is sniffed from the file, only MEDIA_TYPES are accepted
+//	@Description	files over MEDIA_MAX_SIZE or past the user's MEDIA_USER_QUOTA, which counts image variants too, are refused with 413
+//	@Description	embed the returned url in a post body, media no post embeds are deleted after MEDIA_ORPHAN_TTL
+//	@Description	EXIF, XMP and text metadata are stripped from images before they are stored
+//	@Description	images are pending until their MEDIA_VARIANTS, blurHash and color are made in the background
+//	@ID				upload-media
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"the file"
+//	@Success		201		{object}	model.Media
+//	@Router			/api/v1/media [post]
+func (h *MediaController) Upload(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "file is missing"))
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	defer file.Close()
+
+	media, err := h.services.MediaService.Upload(file, header.Size, header.Filename, userId)
+	if err != nil {
+		return mediaError(err)
+	}
+
+	return c.JSON(http.StatusCreated, media)
+}
+
+// GetMedia godoc
+//
+//	@Summary		Get Media
+//	@Tags			Media
+//	@Description	serve an uploaded file or one of its variants, no authorization is needed so posts can embed it
+//	@ID				get-media
+//	@Param			key	path	string	true	"media key"
+//	@Success		200
+//	@Router			/api/v1/media/{key} [get]
+func (h *MediaController) GetMedia(c echo.Context) error {
+	media, blob, err := h.services.MediaService.OpenMedia(c.Param("key"))
+	if err != nil {
+		return mediaError(err)
+	}
+	defer blob.Close()
+
+	header := c.Response().Header()
+	// Keys are never reused, the bytes under one never change
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	header.Set("Content-Security-Policy", "default-src 'none'")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(media.Size, 10))
+	if media.Filename != "" {
+		header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("inline", map[string]string{"filename": media.Filename}))
+	}
+
+	return c.Stream(http.StatusOK, media.ContentType, blob)
+}
+
+// GetUserMedia godoc
+//
+//	@Summary		Get User Media
+//	@Security		ApiKeyAuth
+//	@Tags			Media
+//	@Description	list the user's uploads, newest first
+//	@ID				get-user-media
+//	@Produce		json
+//	@Success		200	{array}	model.Media
+//	@Router			/api/v1/users/me/media [get]
+func (h *MediaController) GetUserMedia(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	media, err := h.services.MediaService.GetUserMedia(userId)
+	if err != nil {
+		return mediaError(err)
+	}
+
+	return c.JSON(http.StatusOK, media)
+}
+
+// DeleteMedia godoc
+//
+//	@Summary		Delete Media
+//	@Security		ApiKeyAuth
+//	@Tags			Media
+//	@Description	delete an upload no post embeds, its uploader or editors managing posts may
+//	@ID				delete-media
+//	@Produce		json
+//	@Param			id	path	int	true	"media id"
+//	@Success		200	{string}	string
+//	@Router			/api/v1/media/{id} [delete]
+func (h *MediaController) DeleteMedia(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	mediaId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "media id is incorrect"))
+	}
+
+	if err := h.services.MediaService.DeleteMedia(uint(mediaId), actor); err != nil {
+		return mediaError(err)
+	}
+
+	return c.JSON(http.StatusOK, "media deleted")
+}
@@ -0,0 +1,727 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/imaging"
+	"github.com/slavik22/blogRestApi/lib/storage"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	mock_repository "github.com/slavik22/blogRestApi/repository/mock"
+	"github.com/slavik22/blogRestApi/service"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/image/webp"
+	"gorm.io/gorm"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pngFile is a small PNG without metadata
+var pngFile = encodeImage(image.NewNRGBA(image.Rect(0, 0, 4, 3)), png.Encode)
+
+const (
+	mediaKey   = "0123456789abcdef0123456789abcdef.png"
+	variantKey = "0123456789abcdef0123456789abcdef-thumbnail.jpg"
+)
+
+func TestMediaAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	media := model.Media{
+		ID: 3, UserId: user.ID, Key: mediaKey, Filename: "cat.png", ContentType: "image/png", Size: int64(len(pngFile)),
+		Variants: []model.MediaVariant{{Name: "thumbnail", Key: variantKey}},
+	}
+
+	testCases := []struct {
+		name          string
+		userId        uint
+		role          model.Role
+		configure     func(cfg *blogRestApi.Config)
+		request       func() *http.Request
+		params        []string
+		action        func(h *MediaController) echo.HandlerFunc
+		buildStubs    func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore)
+		checkResponse func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore)
+	}{
+		{
+			name:    "Upload",
+			userId:  user.ID,
+			request: func() *http.Request { return uploadRequest(t, `C:\pictures\cat.png`, pngFile) },
+			action:  func(h *MediaController) echo.HandlerFunc { return h.Upload },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				repo.EXPECT().UsedSpace(gomock.Any(), gomock.Eq(user.ID)).Times(1).Return(int64(0), nil)
+				repo.EXPECT().CreateMedia(gomock.Any(), gomock.Any(), gomock.Eq(testConfig().MediaUserQuota)).
+					Times(1).
+					DoAndReturn(func(_ context.Context, created *model.Media, _ int64) error {
+						require.Equal(t, user.ID, created.UserId)
+						require.Equal(t, "image/png", created.ContentType)
+						require.Equal(t, "cat.png", created.Filename)
+						require.Equal(t, int64(len(pngFile)), created.Size)
+						require.Regexp(t, `^[0-9a-f]{32}\.png$`, created.Key)
+						require.Equal(t, model.MediaPending, created.Status)
+						require.Equal(t, 4, created.Width)
+						require.Equal(t, 3, created.Height)
+						created.ID = 3
+						return nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+
+				var uploaded model.Media
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &uploaded))
+				require.Equal(t, "http://localhost:8080/api/v1/media/"+uploaded.Key, uploaded.URL)
+				require.Equal(t, []string{uploaded.Key}, blobs.Keys())
+			},
+		},
+		{
+			name:    "UploadSniffsType",
+			userId:  user.ID,
+			request: func() *http.Request { return uploadRequest(t, "cat.png", []byte("<html><script>alert(1)</script>")) },
+			action:  func(h *MediaController) echo.HandlerFunc { return h.Upload },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				repo.EXPECT().CreateMedia(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				requireHTTPError(t, err, http.StatusUnsupportedMediaType)
+				require.Empty(t, blobs.Keys())
+			},
+		},
+		{
+			name:      "UploadTooLarge",
+			userId:    user.ID,
+			configure: func(cfg *blogRestApi.Config) { cfg.MediaMaxSize = 16 },
+			request:   func() *http.Request { return uploadRequest(t, "cat.png", pngFile) },
+			action:    func(h *MediaController) echo.HandlerFunc { return h.Upload },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				repo.EXPECT().CreateMedia(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				requireHTTPError(t, err, http.StatusRequestEntityTooLarge)
+			},
+		},
+		{
+			name:      "UploadOverQuota",
+			userId:    user.ID,
+			configure: func(cfg *blogRestApi.Config) { cfg.MediaUserQuota = 1000 },
+			request:   func() *http.Request { return uploadRequest(t, "cat.png", pngFile) },
+			action:    func(h *MediaController) echo.HandlerFunc { return h.Upload },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				repo.EXPECT().UsedSpace(gomock.Any(), gomock.Eq(user.ID)).Times(1).Return(int64(990), nil)
+				repo.EXPECT().CreateMedia(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				requireHTTPError(t, err, http.StatusRequestEntityTooLarge)
+				require.Empty(t, blobs.Keys())
+			},
+		},
+		{
+			// A parallel upload took the space after the first check
+			name:      "UploadOverQuotaConcurrently",
+			userId:    user.ID,
+			configure: func(cfg *blogRestApi.Config) { cfg.MediaUserQuota = 1000 },
+			request:   func() *http.Request { return uploadRequest(t, "cat.png", pngFile) },
+			action:    func(h *MediaController) echo.HandlerFunc { return h.Upload },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				gomock.InOrder(
+					repo.EXPECT().UsedSpace(gomock.Any(), gomock.Eq(user.ID)).Times(1).Return(int64(0), nil),
+					repo.EXPECT().CreateMedia(gomock.Any(), gomock.Any(), gomock.Eq(int64(1000))).
+						Times(1).
+						Return(types.ErrTooLarge),
+					repo.EXPECT().UsedSpace(gomock.Any(), gomock.Eq(user.ID)).Times(1).Return(int64(990), nil),
+				)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				requireHTTPError(t, err, http.StatusRequestEntityTooLarge)
+				require.Empty(t, blobs.Keys())
+			},
+		},
+		{
+			name:   "UploadWithoutFile",
+			userId: user.ID,
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/api/v1/media", strings.NewReader("{}"))
+			},
+			action:     func(h *MediaController) echo.HandlerFunc { return h.Upload },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:    "UploadStripsMetadata",
+			userId:  user.ID,
+			request: func() *http.Request { return uploadRequest(t, "beach.jpg", exifJPEG(t, 40, 20)) },
+			action:  func(h *MediaController) echo.HandlerFunc { return h.Upload },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				repo.EXPECT().UsedSpace(gomock.Any(), gomock.Eq(user.ID)).Times(1).Return(int64(0), nil)
+				repo.EXPECT().CreateMedia(gomock.Any(), gomock.Any(), gomock.Eq(testConfig().MediaUserQuota)).
+					Times(1).
+					DoAndReturn(func(_ context.Context, created *model.Media, _ int64) error {
+						require.Equal(t, "image/jpeg", created.ContentType)
+						require.Equal(t, model.MediaPending, created.Status)
+						// Turned upright by the orientation
+						require.Equal(t, 20, created.Width)
+						require.Equal(t, 40, created.Height)
+						require.Less(t, created.Size, int64(len(exifJPEG(t, 40, 20))))
+						return nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+
+				var uploaded model.Media
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &uploaded))
+
+				stored := readBlob(t, blobs, uploaded.Key)
+				require.Equal(t, uploaded.Size, int64(len(stored)))
+				require.NotContains(t, string(stored), gpsPosition)
+				require.Equal(t, 6, imaging.Orientation(stored))
+			},
+		},
+		{
+			name:      "UploadTooManyPixels",
+			userId:    user.ID,
+			configure: func(cfg *blogRestApi.Config) { cfg.MediaMaxPixels = 10 },
+			request:   func() *http.Request { return uploadRequest(t, "cat.png", pngFile) },
+			action:    func(h *MediaController) echo.HandlerFunc { return h.Upload },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				repo.EXPECT().CreateMedia(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				requireHTTPError(t, err, http.StatusRequestEntityTooLarge)
+				require.Empty(t, blobs.Keys())
+			},
+		},
+		{
+			name:   "UploadCorrupt",
+			userId: user.ID,
+			request: func() *http.Request {
+				return uploadRequest(t, "cat.png", append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 24)...))
+			},
+			action: func(h *MediaController) echo.HandlerFunc { return h.Upload },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				repo.EXPECT().CreateMedia(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				requireHTTPError(t, err, http.StatusUnsupportedMediaType)
+			},
+		},
+		{
+			name:    "Get",
+			request: func() *http.Request { return httptest.NewRequest(http.MethodGet, "/api/v1/media/"+mediaKey, nil) },
+			params:  []string{"key", mediaKey},
+			action:  func(h *MediaController) echo.HandlerFunc { return h.GetMedia },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				require.NoError(t, blobs.Put(context.Background(), mediaKey, bytes.NewReader(pngFile), int64(len(pngFile)), "image/png"))
+				repo.EXPECT().GetMedia(gomock.Any(), gomock.Eq(mediaKey)).Times(1).Return(&media, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "image/png", recorder.Header().Get(echo.HeaderContentType))
+				require.Equal(t, "nosniff", recorder.Header().Get("X-Content-Type-Options"))
+				require.Equal(t, `inline; filename=cat.png`, recorder.Header().Get(echo.HeaderContentDisposition))
+				require.Equal(t, pngFile, recorder.Body.Bytes())
+			},
+		},
+		{
+			name:    "GetUnknown",
+			request: func() *http.Request { return httptest.NewRequest(http.MethodGet, "/api/v1/media/"+mediaKey, nil) },
+			params:  []string{"key", mediaKey},
+			action:  func(h *MediaController) echo.HandlerFunc { return h.GetMedia },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				repo.EXPECT().GetMedia(gomock.Any(), gomock.Eq(mediaKey)).Times(1).Return(nil, types.ErrNotFound)
+				repo.EXPECT().GetMediaVariant(gomock.Any(), gomock.Eq(mediaKey)).Times(1).Return(nil, types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name:    "GetVariant",
+			request: func() *http.Request { return httptest.NewRequest(http.MethodGet, "/api/v1/media/"+variantKey, nil) },
+			params:  []string{"key", variantKey},
+			action:  func(h *MediaController) echo.HandlerFunc { return h.GetMedia },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				require.NoError(t, blobs.Put(context.Background(), variantKey, strings.NewReader("jpeg"), 4, "image/jpeg"))
+				repo.EXPECT().GetMedia(gomock.Any(), gomock.Eq(variantKey)).Times(1).Return(nil, types.ErrNotFound)
+				repo.EXPECT().GetMediaVariant(gomock.Any(), gomock.Eq(variantKey)).
+					Times(1).
+					Return(&model.MediaVariant{Name: "thumbnail", Key: variantKey, ContentType: "image/jpeg", Size: 4}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+				require.Equal(t, "image/jpeg", recorder.Header().Get(echo.HeaderContentType))
+				require.Empty(t, recorder.Header().Get(echo.HeaderContentDisposition))
+				require.Equal(t, "jpeg", recorder.Body.String())
+			},
+		},
+		{
+			name:    "Delete",
+			userId:  user.ID,
+			role:    model.RoleAuthor,
+			request: func() *http.Request { return httptest.NewRequest(http.MethodDelete, "/api/v1/media/3", nil) },
+			params:  []string{"id", "3"},
+			action:  func(h *MediaController) echo.HandlerFunc { return h.DeleteMedia },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				require.NoError(t, blobs.Put(context.Background(), mediaKey, bytes.NewReader(pngFile), int64(len(pngFile)), "image/png"))
+				require.NoError(t, blobs.Put(context.Background(), variantKey, strings.NewReader("jpeg"), 4, "image/jpeg"))
+				repo.EXPECT().GetMediaById(gomock.Any(), gomock.Eq(uint(3))).Times(1).Return(&media, nil)
+				repo.EXPECT().DeleteMedia(gomock.Any(), gomock.Eq(uint(3))).Times(1).Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+				require.Empty(t, blobs.Keys())
+			},
+		},
+		{
+			name:    "DeleteEmbedded",
+			userId:  user.ID,
+			role:    model.RoleAuthor,
+			request: func() *http.Request { return httptest.NewRequest(http.MethodDelete, "/api/v1/media/3", nil) },
+			params:  []string{"id", "3"},
+			action:  func(h *MediaController) echo.HandlerFunc { return h.DeleteMedia },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				require.NoError(t, blobs.Put(context.Background(), mediaKey, bytes.NewReader(pngFile), int64(len(pngFile)), "image/png"))
+				repo.EXPECT().GetMediaById(gomock.Any(), gomock.Eq(uint(3))).Times(1).Return(&media, nil)
+				repo.EXPECT().DeleteMedia(gomock.Any(), gomock.Eq(uint(3))).Times(1).Return(types.ErrConflict)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				requireHTTPError(t, err, http.StatusConflict)
+				require.Equal(t, []string{mediaKey}, blobs.Keys())
+			},
+		},
+		{
+			name:    "DeleteOthers",
+			userId:  user.ID + 1,
+			role:    model.RoleModerator,
+			request: func() *http.Request { return httptest.NewRequest(http.MethodDelete, "/api/v1/media/3", nil) },
+			params:  []string{"id", "3"},
+			action:  func(h *MediaController) echo.HandlerFunc { return h.DeleteMedia },
+			buildStubs: func(repo *mock_repository.MockMediaRepo, blobs *storage.MemoryStore) {
+				repo.EXPECT().GetMediaById(gomock.Any(), gomock.Eq(uint(3))).Times(1).Return(&media, nil)
+				repo.EXPECT().DeleteMedia(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error, blobs *storage.MemoryStore) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			mediaRepo := mock_repository.NewMockMediaRepo(ctrl)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Media = mediaRepo
+
+			cfg := testConfig()
+			if tc.configure != nil {
+				tc.configure(cfg)
+			}
+
+			serviceManager, err := service.NewManager(context.Background(), store, cfg)
+			require.NoError(t, err)
+			blobs := serviceManager.Blobs.(*storage.MemoryStore)
+
+			tc.buildStubs(mediaRepo, blobs)
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(tc.request(), rec)
+			c.Set("userId", tc.userId)
+			c.Set("role", tc.role)
+			if len(tc.params) > 0 {
+				c.SetParamNames(tc.params[0])
+				c.SetParamValues(tc.params[1])
+			}
+
+			err = tc.action(NewMediaController(context.Background(), serviceManager))(c)
+
+			tc.checkResponse(rec, err, blobs)
+		})
+	}
+}
+
+func TestPostMediaLinks(t *testing.T) {
+	user, _ := randomUser(t)
+	post := randomPost(t, user.ID)
+
+	ctrl := gomock.NewController(t)
+
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+	mediaRepo := mock_repository.NewMockMediaRepo(ctrl)
+
+	existing := post
+	existing.Body = "Look: ![cat](/api/v1/media/" + mediaKey + ")"
+	postRepo.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&existing, nil)
+	postRepo.EXPECT().UpdatePost(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, updated *model.Post, _ model.PostRevision) (*model.Post, error) {
+			return updated, nil
+		})
+
+	// The new body embeds another file twice and drops the old one
+	other := "fedcba9876543210fedcba9876543210.gif"
+	mediaRepo.EXPECT().LinkPostMedia(gomock.Any(), gomock.Eq(post.ID), gomock.Eq([]string{other})).Times(1).Return(nil)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+	store.Media = mediaRepo
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+
+	body := map[string]interface{}{
+		"title": post.Title,
+		"body":  "![a](http://localhost:8080/api/v1/media/" + other + ") ![b](/api/v1/media/" + other + ")",
+	}
+	marshal, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/posts/1", bytes.NewReader(marshal))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := echo.New().NewContext(req, rec)
+	c.Set("userId", user.ID)
+	c.Set("role", model.RoleAuthor)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	require.NoError(t, NewUPostController(context.Background(), serviceManager).UpdatePost(c))
+}
+
+func TestDeleteOrphanedMedia(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mediaRepo := mock_repository.NewMockMediaRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, nil, nil, nil)
+	require.NoError(t, err)
+	store.Media = mediaRepo
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+	blobs := serviceManager.Blobs.(*storage.MemoryStore)
+
+	orphans := []model.Media{{ID: 1, Key: "a.png"}, {ID: 2, Key: "b.png"}}
+	for _, media := range orphans {
+		require.NoError(t, blobs.Put(context.Background(), media.Key, strings.NewReader("x"), 1, "image/png"))
+	}
+
+	mediaRepo.EXPECT().GetOrphanedMedia(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(orphans, nil)
+	mediaRepo.EXPECT().DeleteMedia(gomock.Any(), gomock.Eq(uint(1))).Times(1).Return(nil)
+	// Embedded while the cleanup ran
+	mediaRepo.EXPECT().DeleteMedia(gomock.Any(), gomock.Eq(uint(2))).Times(1).Return(types.ErrConflict)
+
+	require.NoError(t, serviceManager.MediaService.DeleteOrphans())
+	require.Equal(t, []string{"b.png"}, blobs.Keys())
+}
+
+func TestProcessMedia(t *testing.T) {
+	photo := gradient(2000, 1000, 0xff)
+	jpegKey := "00112233445566778899aabbccddeeff.jpg"
+
+	testCases := []struct {
+		name       string
+		media      model.Media
+		data       []byte
+		buildStubs func(repo *mock_repository.MockMediaRepo, media *model.Media)
+		check      func(t *testing.T, err error, blobs *storage.MemoryStore)
+	}{
+		{
+			name:  "Variants",
+			media: model.Media{ID: 1, Key: jpegKey, ContentType: "image/jpeg", Status: model.MediaPending},
+			data:  encodeImage(photo, func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) }),
+			buildStubs: func(repo *mock_repository.MockMediaRepo, media *model.Media) {
+				repo.EXPECT().FinishMedia(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, finished *model.Media) error {
+						require.Equal(t, model.MediaReady, finished.Status)
+						require.Equal(t, 2000, finished.Width)
+						require.Equal(t, 1000, finished.Height)
+						require.Len(t, finished.BlurHash, 28)
+						require.Regexp(t, `^#[0-9a-f]{6}$`, finished.Color)
+
+						require.Len(t, finished.Variants, 3)
+						for i, want := range []struct {
+							name          string
+							width, height int
+						}{{"thumbnail", 320, 160}, {"medium", 800, 400}, {"large", 1600, 800}} {
+							variant := finished.Variants[i]
+							require.Equal(t, want.name, variant.Name)
+							require.Equal(t, "00112233445566778899aabbccddeeff-"+want.name+".jpg", variant.Key)
+							require.Equal(t, "image/jpeg", variant.ContentType)
+							require.Equal(t, want.width, variant.Width)
+							require.Equal(t, want.height, variant.Height)
+						}
+						return nil
+					})
+			},
+			check: func(t *testing.T, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+				require.Len(t, blobs.Keys(), 4)
+
+				cfg, format, err := image.DecodeConfig(bytes.NewReader(readBlob(t, blobs, "00112233445566778899aabbccddeeff-medium.jpg")))
+				require.NoError(t, err)
+				require.Equal(t, "jpeg", format)
+				require.Equal(t, 800, cfg.Width)
+			},
+		},
+		{
+			name:  "SmallImage",
+			media: model.Media{ID: 1, Key: mediaKey, ContentType: "image/png", Status: model.MediaPending},
+			data:  encodeImage(gradient(500, 300, 0xff), png.Encode),
+			buildStubs: func(repo *mock_repository.MockMediaRepo, media *model.Media) {
+				repo.EXPECT().FinishMedia(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, finished *model.Media) error {
+						// Variants are never larger than the image
+						require.Len(t, finished.Variants, 1)
+						require.Equal(t, "thumbnail", finished.Variants[0].Name)
+						require.Equal(t, 320, finished.Variants[0].Width)
+						require.Equal(t, 192, finished.Variants[0].Height)
+						return nil
+					})
+			},
+			check: func(t *testing.T, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:  "Transparent",
+			media: model.Media{ID: 1, Key: mediaKey, ContentType: "image/png", Status: model.MediaPending},
+			data:  encodeImage(gradient(1000, 400, 0x80), png.Encode),
+			buildStubs: func(repo *mock_repository.MockMediaRepo, media *model.Media) {
+				repo.EXPECT().FinishMedia(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, finished *model.Media) error {
+						require.Len(t, finished.Variants, 2)
+						for _, variant := range finished.Variants {
+							require.Equal(t, "image/webp", variant.ContentType)
+							require.True(t, strings.HasSuffix(variant.Key, ".webp"))
+						}
+						return nil
+					})
+			},
+			check: func(t *testing.T, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+
+				thumbnail, err := webp.Decode(bytes.NewReader(readBlob(t, blobs, "0123456789abcdef0123456789abcdef-thumbnail.webp")))
+				require.NoError(t, err)
+				require.Equal(t, image.Rect(0, 0, 320, 128), thumbnail.Bounds())
+				_, _, _, a := thumbnail.At(10, 10).RGBA()
+				require.Equal(t, uint32(0x8080), a)
+			},
+		},
+		{
+			name:  "Corrupt",
+			media: model.Media{ID: 1, Key: mediaKey, ContentType: "image/png", Status: model.MediaPending},
+			data:  []byte("\x89PNG\r\n\x1a\nbroken"),
+			buildStubs: func(repo *mock_repository.MockMediaRepo, media *model.Media) {
+				repo.EXPECT().FinishMedia(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, finished *model.Media) error {
+						require.Equal(t, model.MediaFailed, finished.Status)
+						require.Empty(t, finished.Variants)
+						return nil
+					})
+			},
+			check: func(t *testing.T, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+				require.Equal(t, []string{mediaKey}, blobs.Keys())
+			},
+		},
+		{
+			name:  "DeletedMeanwhile",
+			media: model.Media{ID: 1, Key: mediaKey, ContentType: "image/png", Status: model.MediaPending},
+			data:  encodeImage(gradient(500, 300, 0xff), png.Encode),
+			buildStubs: func(repo *mock_repository.MockMediaRepo, media *model.Media) {
+				repo.EXPECT().FinishMedia(gomock.Any(), gomock.Any()).Times(1).Return(types.ErrNotFound)
+			},
+			check: func(t *testing.T, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+				// The variants made meanwhile are deleted
+				require.Equal(t, []string{mediaKey}, blobs.Keys())
+			},
+		},
+		{
+			name:  "AlreadyProcessed",
+			media: model.Media{ID: 1, Key: mediaKey, ContentType: "image/png", Status: model.MediaReady},
+			data:  pngFile,
+			buildStubs: func(repo *mock_repository.MockMediaRepo, media *model.Media) {
+				repo.EXPECT().FinishMedia(gomock.Any(), gomock.Any()).Times(0)
+			},
+			check: func(t *testing.T, err error, blobs *storage.MemoryStore) {
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mediaRepo := mock_repository.NewMockMediaRepo(ctrl)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, nil, nil, nil)
+			require.NoError(t, err)
+			store.Media = mediaRepo
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+			blobs := serviceManager.Blobs.(*storage.MemoryStore)
+
+			media := tc.media
+			require.NoError(t, blobs.Put(context.Background(), media.Key, bytes.NewReader(tc.data), int64(len(tc.data)), media.ContentType))
+			mediaRepo.EXPECT().GetMediaById(gomock.Any(), gomock.Eq(media.ID)).Times(1).Return(&media, nil)
+			tc.buildStubs(mediaRepo, &media)
+
+			err = serviceManager.MediaService.ProcessMedia(media.ID)
+			tc.check(t, err, blobs)
+		})
+	}
+}
+
+func TestMediaWorkers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mediaRepo := mock_repository.NewMockMediaRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, nil, nil, nil)
+	require.NoError(t, err)
+	store.Media = mediaRepo
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serviceManager.MediaService.StartWorkers(ctx)
+
+	var uploaded model.Media
+	mediaRepo.EXPECT().UsedSpace(gomock.Any(), gomock.Any()).Return(int64(0), nil)
+	mediaRepo.EXPECT().CreateMedia(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, media *model.Media, _ int64) error {
+		media.ID = 7
+		uploaded = *media
+		return nil
+	})
+
+	finished := make(chan *model.Media, 1)
+	mediaRepo.EXPECT().GetMediaById(gomock.Any(), gomock.Eq(uint(7))).DoAndReturn(func(context.Context, uint) (*model.Media, error) {
+		media := uploaded
+		return &media, nil
+	})
+	mediaRepo.EXPECT().FinishMedia(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, media *model.Media) error {
+		finished <- media
+		return nil
+	})
+
+	// The upload returns pending, a worker finishes it
+	data := encodeImage(gradient(600, 400, 0xff), png.Encode)
+	media, err := serviceManager.MediaService.Upload(bytes.NewReader(data), int64(len(data)), "cat.png", 1)
+	require.NoError(t, err)
+	require.Equal(t, model.MediaPending, media.Status)
+
+	select {
+	case media := <-finished:
+		require.Equal(t, model.MediaReady, media.Status)
+		require.Len(t, media.Variants, 1)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the image was not processed")
+	}
+}
+
+// gpsPosition is the secret exifJPEG hides in its metadata
+const gpsPosition = "48.858370N 2.294481E"
+
+// exifJPEG encodes a width by height JPEG with EXIF holding an orientation
+// of 6, rotated clockwise, and a GPS position
+func exifJPEG(t *testing.T, width, height int) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2a, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x02,
+		// Orientation
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, 0x06, 0x00, 0x00,
+		// GPS info, its IFD follows
+		0x88, 0x25, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x26,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	tiff = append(tiff, gpsPosition...)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	img := encodeImage(gradient(width, height, 0xff), func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) })
+	require.Equal(t, []byte{0xff, 0xd8}, img[:2])
+
+	data := []byte{0xff, 0xd8, 0xff, 0xe1, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)}
+	data = append(data, segment...)
+	return append(data, img[2:]...)
+}
+
+// gradient is a width by height image with the alpha
+func gradient(width, height int, alpha uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 0x80, A: alpha})
+		}
+	}
+	return img
+}
+
+func encodeImage(img image.Image, encode func(io.Writer, image.Image) error) []byte {
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func readBlob(t *testing.T, blobs storage.BlobStore, key string) []byte {
+	blob, err := blobs.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer blob.Close()
+
+	data, err := io.ReadAll(blob)
+	require.NoError(t, err)
+	return data
+}
+
+// uploadRequest builds a multipart upload of the file
+func uploadRequest(t *testing.T, filename string, data []byte) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	part, err := form.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/media", &body)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	return req
+}
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/service"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type mfaChallengeOutput struct {
+	MFARequired bool      `json:"mfaRequired"`
+	MFAToken    string    `json:"mfaToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type verifyMFAInput struct {
+	MFAToken string `json:"mfaToken" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// VerifyMFA godoc
+//
+//	@Summary		Verify second factor
+//	@Tags			User
+//	@Description	Exchanges the MFA token from sign-in and a TOTP or recovery code for a token pair
+//	@ID				VerifyMFA
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	signInOutput
+//	@Router			/api/v1/auth/mfa/verify [post]
+func (u *UserController) VerifyMFA(c echo.Context) error {
+	var input verifyMFAInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	tokens, err := u.services.UserService.VerifyMFA(input.MFAToken, input.Code)
+	if err != nil {
+		var throttled *service.ThrottleError
+		switch {
+		case errors.As(err, &throttled):
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			return echo.NewHTTPError(http.StatusTooManyRequests, "too many failed attempts, try again later")
+		case errors.Cause(err) == types.ErrUnauthorized:
+			return echo.NewHTTPError(http.StatusUnauthorized, "mfa token or code is invalid")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not sign in"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, newSignInOutput(tokens))
+}
+
+type totpEnrollmentOutput struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// EnrollTOTP godoc
+//
+//	@Summary		Start TOTP enrollment
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Generates a TOTP secret and otpauth URI for the current user
+//	@ID				EnrollTOTP
+//	@Produce		json
+//	@Success		200	{object}	totpEnrollmentOutput
+//	@Router			/api/v1/users/me/mfa/totp [post]
+func (u *UserController) EnrollTOTP(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	enrollment, err := u.services.UserService.EnrollTOTP(userId)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrConflict:
+			return echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled")
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not start enrollment"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, totpEnrollmentOutput{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	})
+}
+
+type confirmTOTPInput struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type recoveryCodesOutput struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// ConfirmTOTP godoc
+//
+//	@Summary		Confirm TOTP enrollment
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Enables two-factor authentication with a code from the authenticator and returns one-time recovery codes
+//	@ID				ConfirmTOTP
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	recoveryCodesOutput
+//	@Router			/api/v1/users/me/mfa/totp/confirm [post]
+func (u *UserController) ConfirmTOTP(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	var input confirmTOTPInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	codes, err := u.services.UserService.ConfirmTOTP(userId, input.Code)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrConflict:
+			return echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled")
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, "two-factor enrollment has not been started")
+		case errors.Cause(err) == types.ErrUnprocessableEntity:
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, "code is invalid")
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not confirm enrollment"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, recoveryCodesOutput{RecoveryCodes: codes})
+}
+
+type disableTOTPInput struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// DisableTOTP godoc
+//
+//	@Summary		Disable TOTP
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Turns two-factor authentication off for the current user
+//	@ID				DisableTOTP
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Router			/api/v1/users/me/mfa/totp [delete]
+func (u *UserController) DisableTOTP(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	var input disableTOTPInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	err = u.services.UserService.DisableTOTP(userId, input.Password)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, "password is incorrect")
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not disable two-factor authentication"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, "two-factor authentication disabled")
+}
@@ -0,0 +1,280 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	util2 "github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/lib/validator"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	mock_repository "github.com/slavik22/blogRestApi/repository/mock"
+	"github.com/slavik22/blogRestApi/service"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPEnrollmentAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+	recoveryRepo := mock_repository.NewMockRecoveryCodeRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+	store.Recovery = recoveryRepo
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+
+	userController := NewUserController(context.Background(), serviceManager)
+
+	e := echo.New()
+	e.Validator = validator.NewValidator()
+
+	call := func(body string, handler echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("userId", user.ID)
+		return rec, handler(c)
+	}
+
+	// Enrollment stores a pending secret
+	stored := user
+	userRepo.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+		AnyTimes().
+		DoAndReturn(func(_ context.Context, _ uint) (*model.User, error) {
+			current := stored
+			return &current, nil
+		})
+	userRepo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(_ context.Context, updated *model.User) (*model.User, error) {
+			stored = *updated
+			return updated, nil
+		})
+
+	rec, err := call("", userController.EnrollTOTP)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var enrollment totpEnrollmentOutput
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &enrollment))
+	require.NotEmpty(t, enrollment.Secret)
+	require.Equal(t, enrollment.Secret, stored.TOTPSecret)
+	require.False(t, stored.TOTPEnabled)
+
+	uri, err := url.Parse(enrollment.URI)
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", uri.Scheme)
+	require.Equal(t, "totp", uri.Host)
+	require.Equal(t, enrollment.Secret, uri.Query().Get("secret"))
+	require.Contains(t, uri.Path, user.Email)
+
+	// A wrong code does not enable anything
+	_, err = call(`{"code": "000000x"}`, userController.ConfirmTOTP)
+	requireHTTPError(t, err, http.StatusUnprocessableEntity)
+	require.False(t, stored.TOTPEnabled)
+
+	code, err := util2.TOTPCode(enrollment.Secret, util2.TOTPStep(time.Now()))
+	require.NoError(t, err)
+
+	var hashes []string
+	recoveryRepo.EXPECT().ReplaceRecoveryCodes(gomock.Any(), gomock.Eq(user.ID), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, _ uint, codes []model.RecoveryCode) error {
+			for _, code := range codes {
+				hashes = append(hashes, code.CodeHash)
+			}
+			return nil
+		})
+
+	rec, err = call(fmt.Sprintf(`{"code": %q}`, code), userController.ConfirmTOTP)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, stored.TOTPEnabled)
+
+	// Recovery codes are shown once and only their hashes are stored
+	var output recoveryCodesOutput
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &output))
+	require.Len(t, output.RecoveryCodes, 10)
+	require.Len(t, hashes, 10)
+	for _, code := range output.RecoveryCodes {
+		require.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+		require.Contains(t, hashes, util2.HashToken(strings.ReplaceAll(code, "-", "")))
+	}
+
+	_, err = call("", userController.EnrollTOTP)
+	requireHTTPError(t, err, http.StatusConflict)
+}
+
+func TestMFASignInAPI(t *testing.T) {
+	user, password := randomUser(t)
+	secret, err := util2.NewTOTPSecret()
+	require.NoError(t, err)
+	user.TOTPSecret = secret
+	user.TOTPEnabled = true
+
+	ctrl := gomock.NewController(t)
+
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+	sessionRepo := mock_repository.NewMockSessionRepo(ctrl)
+	loginRepo := mock_repository.NewMockLoginThrottleRepo(ctrl)
+	recoveryRepo := mock_repository.NewMockRecoveryCodeRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+	store.Session = sessionRepo
+	store.Login = loginRepo
+	store.Recovery = recoveryRepo
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+
+	userController := NewUserController(context.Background(), serviceManager)
+
+	e := echo.New()
+	e.Validator = validator.NewValidator()
+
+	post := func(body string, handler echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, handler(e.NewContext(req, rec))
+	}
+
+	stored := user
+	userRepo.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Email)).
+		AnyTimes().
+		Return(&stored, nil)
+	userRepo.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+		AnyTimes().
+		DoAndReturn(func(_ context.Context, _ uint) (*model.User, error) {
+			current := stored
+			return &current, nil
+		})
+	userRepo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(_ context.Context, updated *model.User) (*model.User, error) {
+			stored = *updated
+			return updated, nil
+		})
+	// Like the conditional update, only a later step is recorded
+	userRepo.EXPECT().UseTOTPStep(gomock.Any(), gomock.Eq(user.ID), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(_ context.Context, _ uint, step int64) (bool, error) {
+			if step <= stored.TOTPLastStep {
+				return false, nil
+			}
+			stored.TOTPLastStep = step
+			return true, nil
+		})
+	attempts := map[string]int{}
+	loginRepo.EXPECT().CountAttempt(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(_ context.Context, subject string, _ model.ThrottlePolicy, _ time.Time) (time.Duration, error) {
+			attempts[subject]++
+			return 0, nil
+		})
+	loginRepo.EXPECT().ForgiveAttempt(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+	loginRepo.EXPECT().ResetThrottle(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	// The password alone only yields a challenge, no session is opened
+	sessionRepo.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	rec, err := post(fmt.Sprintf(`{"email": %q, "password": %q}`, user.Email, password), userController.SignIn)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var challenge mfaChallengeOutput
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &challenge))
+	require.True(t, challenge.MFARequired)
+	require.NotEmpty(t, challenge.MFAToken)
+
+	// The challenge token is not an access token
+	_, err = serviceManager.UserService.Authenticate(challenge.MFAToken)
+	require.Error(t, err)
+
+	verify := func(code string) (*httptest.ResponseRecorder, error) {
+		return post(fmt.Sprintf(`{"mfaToken": %q, "code": %q}`, challenge.MFAToken, code), userController.VerifyMFA)
+	}
+
+	openSession := func() {
+		sessionRepo.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(nil)
+		sessionRepo.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(nil)
+	}
+
+	code, err := util2.TOTPCode(secret, util2.TOTPStep(time.Now()))
+	require.NoError(t, err)
+
+	openSession()
+	rec, err = verify(code)
+	require.NoError(t, err)
+
+	var output signInOutput
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &output))
+	require.NotEmpty(t, output.Token)
+	require.NotEmpty(t, output.RefreshToken)
+
+	sessionRepo.EXPECT().GetSession(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, id string) (*model.Session, error) {
+			return &model.Session{ID: id, UserId: user.ID, ExpiresAt: time.Now().Add(time.Hour)}, nil
+		})
+
+	identity, err := serviceManager.UserService.Authenticate(output.Token)
+	require.NoError(t, err)
+	require.Equal(t, user.ID, identity.UserId)
+
+	// A TOTP code works only once, every attempt is counted
+	subject := fmt.Sprintf("mfa:%d", user.ID)
+	require.Equal(t, 1, attempts[subject])
+	recoveryRepo.EXPECT().UseRecoveryCode(gomock.Any(), gomock.Eq(user.ID), gomock.Any()).
+		Times(1).
+		Return(false, nil)
+
+	_, err = verify(code)
+	requireHTTPError(t, err, http.StatusUnauthorized)
+
+	_, err = verify("abcde-fghij")
+	requireHTTPError(t, err, http.StatusUnauthorized)
+	require.Equal(t, 3, attempts[subject])
+
+	// Recovery codes are accepted in any case and with or without the dash
+	recoveryRepo.EXPECT().UseRecoveryCode(gomock.Any(), gomock.Eq(user.ID), gomock.Eq(util2.HashToken("abcdefghij"))).
+		Times(1).
+		Return(true, nil)
+	openSession()
+
+	_, err = verify("ABCDE-FGHIJ")
+	require.NoError(t, err)
+
+	// Access tokens cannot stand in for the challenge
+	_, err = post(fmt.Sprintf(`{"mfaToken": %q, "code": %q}`, output.Token, code), userController.VerifyMFA)
+	requireHTTPError(t, err, http.StatusUnauthorized)
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
-	"github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/service"
+	"net"
 	"net/http"
 	"strings"
 )
@@ -12,36 +15,126 @@ import (
 const (
 	authorizationHeader = "Authorization"
 	userCtx             = "userId"
+	roleCtx             = "role"
+	sessionCtx          = "sessionId"
+	scopesCtx           = "scopes"
 )
 
-func UserIdentity(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		header := c.Request().Header.Get(authorizationHeader)
-		fmt.Println(header)
-		if header == "" {
-			return echo.NewHTTPError(http.StatusUnauthorized, "empty auth header")
+// IPExtractor returns how c.RealIP() finds the client IP. Headers sent by
+// clients are not believed, only the X-Forwarded-For entries added by the
+// trusted proxies in the comma separated CIDR ranges.
+func IPExtractor(trustedProxies string) (echo.IPExtractor, error) {
+	var options []echo.TrustOption
+	for _, cidr := range strings.Split(trustedProxies, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
 		}
-
-		headerParts := strings.Split(header, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			return echo.NewHTTPError(http.StatusUnauthorized, "invalid auth header")
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range %q: %w", cidr, err)
 		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+
+	if len(options) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options = append(options, echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false))
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// clientIP returns the client IP found by the server's IPExtractor, or the
+// connection's address when it has none. Echo's fallback believes the
+// X-Forwarded-For and X-Real-IP headers clients send.
+func clientIP(c echo.Context) string {
+	if c.Echo().IPExtractor == nil {
+		return echo.ExtractIPDirect()(c.Request())
+	}
+	return c.RealIP()
+}
+
+// UserIdentity authenticates the bearer access token or personal access token
+// and rejects tokens whose session has been revoked
+func UserIdentity(services *service.Manager) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(authorizationHeader)
+			if header == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "empty auth header")
+			}
 
-		if len(headerParts[1]) == 0 {
-			return echo.NewHTTPError(http.StatusUnauthorized, "token is empty")
+			headerParts := strings.Split(header, " ")
+			if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid auth header")
+			}
+
+			if len(headerParts[1]) == 0 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "token is empty")
+			}
+
+			identity, err := services.UserService.Authenticate(headerParts[1])
+			if err != nil {
+				switch {
+				case errors.Cause(err) == types.ErrUnauthorized:
+					return echo.NewHTTPError(http.StatusUnauthorized, "token is incorrect")
+				default:
+					return echo.NewHTTPError(http.StatusInternalServerError, err)
+				}
+			}
+
+			c.Set(userCtx, identity.UserId)
+			c.Set(roleCtx, identity.Role)
+			c.Set(sessionCtx, identity.SessionId)
+			if identity.Scopes != nil {
+				c.Set(scopesCtx, identity.Scopes)
+			}
+
+			return next(c)
 		}
+	}
+}
 
-		userId, err := util.ParseToken(headerParts[1])
-		if err != nil {
-			return echo.NewHTTPError(http.StatusUnauthorized, "token is incorrect")
+// RequirePermission rejects requests of users whose role does not grant the
+// permission, or whose personal access token is not scoped for it.
+// It must run after UserIdentity.
+func RequirePermission(perm model.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get(roleCtx).(model.Role)
+			if !role.Can(perm) {
+				return echo.NewHTTPError(http.StatusForbidden, types.ErrForbidden.Error())
+			}
+
+			if scopes, ok := c.Get(scopesCtx).([]model.Permission); ok && !hasScope(scopes, perm) {
+				return echo.NewHTTPError(http.StatusForbidden, "token is not scoped for "+string(perm))
+			}
+
+			return next(c)
 		}
+	}
+}
 
-		c.Set(userCtx, userId)
+// RequireSession rejects personal access tokens on routes that manage the
+// account itself. It must run after UserIdentity.
+func RequireSession(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, err := getSessionId(c); err != nil {
+			return echo.NewHTTPError(http.StatusForbidden, "personal access tokens cannot be used here")
+		}
 
 		return next(c)
 	}
 }
 
+func hasScope(scopes []model.Permission, perm model.Permission) bool {
+	for _, scope := range scopes {
+		if scope == perm {
+			return true
+		}
+	}
+	return false
+}
+
 func getUserId(c echo.Context) (uint, error) {
 	id, ok := c.Get(userCtx).(uint)
 
@@ -51,3 +144,27 @@ func getUserId(c echo.Context) (uint, error) {
 
 	return id, nil
 }
+
+func getSessionId(c echo.Context) (string, error) {
+	id, ok := c.Get(sessionCtx).(string)
+
+	if !ok || id == "" {
+		return "", errors.New("session id is missing")
+	}
+
+	return id, nil
+}
+
+func getActor(c echo.Context) (service.Actor, error) {
+	userId, err := getUserId(c)
+	if err != nil {
+		return service.Actor{}, err
+	}
+
+	role, ok := c.Get(roleCtx).(model.Role)
+	if !ok {
+		return service.Actor{}, errors.New("role is of invalid type")
+	}
+
+	return service.Actor{UserId: userId, Role: role}, nil
+}
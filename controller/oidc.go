@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/service"
+	"net/http"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/api/v1/auth/oidc"
+)
+
+// OIDCLogin godoc
+//
+//	@Summary		Sign in with the identity provider
+//	@Tags			User
+//	@Description	Redirects to the configured OpenID Connect provider
+//	@ID				OIDCLogin
+//	@Success		302
+//	@Router			/api/v1/auth/oidc/login [get]
+func (u *UserController) OIDCLogin(c echo.Context) error {
+	login, err := u.services.UserService.StartOIDC()
+	if err != nil {
+		switch {
+		case errors.Cause(err) == service.ErrOIDCNotConfigured:
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusBadGateway, errors.Wrap(err, "could not reach identity provider"))
+		}
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    login.State,
+		Path:     oidcCookiePath,
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		// Lax lets the cookie through on the provider's top-level redirect back
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return c.Redirect(http.StatusFound, login.URL)
+}
+
+// OIDCCallback godoc
+//
+//	@Summary		Identity provider callback
+//	@Tags			User
+//	@Description	Finishes the sign-in at the identity provider and returns tokens like sign-in does
+//	@ID				OIDCCallback
+//	@Produce		json
+//	@Param			code	query	string	true	"authorization code"
+//	@Param			state	query	string	true	"state"
+//	@Success		200	{object}	signInOutput
+//	@Router			/api/v1/auth/oidc/callback [get]
+func (u *UserController) OIDCCallback(c echo.Context) error {
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "sign-in state is missing")
+	}
+
+	// The state is single-use
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if reason := c.QueryParam("error"); reason != "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "identity provider refused sign-in: "+reason)
+	}
+
+	code := c.QueryParam("code")
+	if code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "code is empty")
+	}
+
+	tokens, err := u.services.UserService.FinishOIDC(code, c.QueryParam("state"), cookie.Value)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Cause(err) == types.ErrUnauthorized:
+			return echo.NewHTTPError(http.StatusUnauthorized, "identity provider sign-in failed")
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		case errors.Cause(err) == types.ErrConflict:
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case errors.Cause(err) == service.ErrOIDCNotConfigured:
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not sign in"))
+		}
+	}
+
+	return signInResponse(c, tokens)
+}
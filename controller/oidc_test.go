@@ -0,0 +1,448 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/slavik22/blogRestApi/lib/types"
+	util2 "github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	mock_repository "github.com/slavik22/blogRestApi/repository/mock"
+	"github.com/slavik22/blogRestApi/service"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOIDCProvider is a minimal OpenID Connect provider that signs in whoever
+// is configured as its user
+type fakeOIDCProvider struct {
+	*httptest.Server
+	t        *testing.T
+	key      *util2.Key
+	clientID string
+	secret   string
+
+	mu    sync.Mutex
+	user  fakeOIDCUser
+	codes map[string]fakeOIDCCode
+}
+
+type fakeOIDCUser struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type fakeOIDCCode struct {
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+func newFakeOIDCProvider(t *testing.T, clientID, secret string) *fakeOIDCProvider {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := util2.NewPrivateKey("fake-key", "RS256", private)
+	require.NoError(t, err)
+
+	p := &fakeOIDCProvider{t: t, key: key, clientID: clientID, secret: secret, codes: map[string]fakeOIDCCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, err := util2.NewJWK(p.key)
+		require.NoError(t, err)
+		_ = json.NewEncoder(w).Encode(util2.JWKSet{Keys: []util2.JWK{*jwk}})
+	})
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func (p *fakeOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != p.clientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	code := util2.RandomString(20)
+	p.mu.Lock()
+	p.codes[code] = fakeOIDCCode{
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		redirectURI: query.Get("redirect_uri"),
+	}
+	p.mu.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *fakeOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(reason string) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": reason})
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != p.clientID || secret != p.secret {
+		fail("invalid_client")
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	user := p.user
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || code.redirectURI != r.FormValue("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	token := jwt.NewWithClaims(p.key.Method, jwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            []string{p.clientID},
+		"sub":            user.Subject,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          code.nonce,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"name":           user.Name,
+	})
+	token.Header["kid"] = p.key.ID
+	idToken, err := token.SignedString(p.key.Sign)
+	require.NoError(p.t, err)
+
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"access_token": util2.RandomString(20),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func TestOIDCLoginAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	subject := util2.RandomString(12)
+
+	provider := newFakeOIDCProvider(t, "blog", "client-secret")
+
+	// openSession expects the calls made when tokens are issued
+	openSession := func(sessions *mock_repository.MockSessionRepo) {
+		sessions.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(nil)
+		sessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(nil)
+	}
+	signedIn := func(t *testing.T, recorder *httptest.ResponseRecorder, err error) {
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var output signInOutput
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &output))
+		require.NotEmpty(t, output.Token)
+		require.NotEmpty(t, output.RefreshToken)
+	}
+
+	testCases := []struct {
+		name          string
+		identity      fakeOIDCUser
+		callback      func(query url.Values, cookie *http.Cookie)
+		buildStubs    func(users *mock_repository.MockUserRepo, external *mock_repository.MockExternalIdentityRepo, sessions *mock_repository.MockSessionRepo)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name:     "Provision",
+			identity: fakeOIDCUser{Subject: subject, Email: user.Email, EmailVerified: true, Name: user.Name},
+			buildStubs: func(users *mock_repository.MockUserRepo, external *mock_repository.MockExternalIdentityRepo, sessions *mock_repository.MockSessionRepo) {
+				external.EXPECT().GetExternalIdentity(gomock.Any(), gomock.Eq(provider.URL), gomock.Eq(subject)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+				users.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+				users.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, created *model.User) (uint, error) {
+						require.Equal(t, user.Email, created.Email)
+						require.Equal(t, user.Name, created.Name)
+						require.Equal(t, model.RoleAuthor, created.Role)
+						require.NotNil(t, created.EmailVerifiedAt)
+						require.NotEmpty(t, created.Password)
+						return user.ID, nil
+					})
+				external.EXPECT().CreateExternalIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, identity *model.ExternalIdentity) error {
+						require.Equal(t, user.ID, identity.UserId)
+						require.Equal(t, provider.URL, identity.Issuer)
+						require.Equal(t, subject, identity.Subject)
+						return nil
+					})
+				openSession(sessions)
+			},
+			checkResponse: signedIn,
+		},
+		{
+			name:     "Linked",
+			identity: fakeOIDCUser{Subject: subject, Email: "changed@email.com"},
+			buildStubs: func(users *mock_repository.MockUserRepo, external *mock_repository.MockExternalIdentityRepo, sessions *mock_repository.MockSessionRepo) {
+				external.EXPECT().GetExternalIdentity(gomock.Any(), gomock.Eq(provider.URL), gomock.Eq(subject)).
+					Times(1).
+					Return(&model.ExternalIdentity{ID: 1, UserId: user.ID, Issuer: provider.URL, Subject: subject}, nil)
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&user, nil)
+				openSession(sessions)
+			},
+			checkResponse: signedIn,
+		},
+		{
+			name:     "LinkedAccountTrashed",
+			identity: fakeOIDCUser{Subject: subject, Email: user.Email, EmailVerified: true},
+			buildStubs: func(users *mock_repository.MockUserRepo, external *mock_repository.MockExternalIdentityRepo, sessions *mock_repository.MockSessionRepo) {
+				external.EXPECT().GetExternalIdentity(gomock.Any(), gomock.Eq(provider.URL), gomock.Eq(subject)).
+					Times(1).
+					Return(&model.ExternalIdentity{ID: 1, UserId: user.ID, Issuer: provider.URL, Subject: subject}, nil)
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+				users.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				sessions.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
+		{
+			name:     "LinkVerifiedEmail",
+			identity: fakeOIDCUser{Subject: subject, Email: user.Email, EmailVerified: true},
+			buildStubs: func(users *mock_repository.MockUserRepo, external *mock_repository.MockExternalIdentityRepo, sessions *mock_repository.MockSessionRepo) {
+				existing := user
+				external.EXPECT().GetExternalIdentity(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+				users.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(&existing, nil)
+				users.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, updated *model.User) (*model.User, error) {
+						require.NotNil(t, updated.EmailVerifiedAt)
+						return updated, nil
+					})
+				external.EXPECT().CreateExternalIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+				openSession(sessions)
+			},
+			checkResponse: signedIn,
+		},
+		{
+			name:     "UnverifiedEmailTaken",
+			identity: fakeOIDCUser{Subject: subject, Email: user.Email},
+			buildStubs: func(users *mock_repository.MockUserRepo, external *mock_repository.MockExternalIdentityRepo, sessions *mock_repository.MockSessionRepo) {
+				external.EXPECT().GetExternalIdentity(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+				users.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(&user, nil)
+				external.EXPECT().CreateExternalIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusConflict)
+			},
+		},
+		{
+			name:     "MFA",
+			identity: fakeOIDCUser{Subject: subject, Email: user.Email},
+			buildStubs: func(users *mock_repository.MockUserRepo, external *mock_repository.MockExternalIdentityRepo, sessions *mock_repository.MockSessionRepo) {
+				enrolled := user
+				enrolled.TOTPEnabled = true
+				external.EXPECT().GetExternalIdentity(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&model.ExternalIdentity{ID: 1, UserId: user.ID}, nil)
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&enrolled, nil)
+				sessions.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+
+				var output mfaChallengeOutput
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &output))
+				require.True(t, output.MFARequired)
+				require.NotEmpty(t, output.MFAToken)
+			},
+		},
+		{
+			name:     "StateMismatch",
+			identity: fakeOIDCUser{Subject: subject, Email: user.Email},
+			callback: func(query url.Values, cookie *http.Cookie) {
+				query.Set("state", "forged")
+			},
+			buildStubs: func(users *mock_repository.MockUserRepo, external *mock_repository.MockExternalIdentityRepo, sessions *mock_repository.MockSessionRepo) {
+				external.EXPECT().GetExternalIdentity(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:     "TamperedState",
+			identity: fakeOIDCUser{Subject: subject, Email: user.Email},
+			callback: func(query url.Values, cookie *http.Cookie) {
+				cookie.Value += "x"
+			},
+			buildStubs: func(users *mock_repository.MockUserRepo, external *mock_repository.MockExternalIdentityRepo, sessions *mock_repository.MockSessionRepo) {
+				external.EXPECT().GetExternalIdentity(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:     "InvalidCode",
+			identity: fakeOIDCUser{Subject: subject, Email: user.Email},
+			callback: func(query url.Values, cookie *http.Cookie) {
+				query.Set("code", "stolen")
+			},
+			buildStubs: func(users *mock_repository.MockUserRepo, external *mock_repository.MockExternalIdentityRepo, sessions *mock_repository.MockSessionRepo) {
+				external.EXPECT().GetExternalIdentity(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusUnauthorized)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			sessionRepo := mock_repository.NewMockSessionRepo(ctrl)
+			externalRepo := mock_repository.NewMockExternalIdentityRepo(ctrl)
+
+			tc.buildStubs(userRepo, externalRepo, sessionRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Session = sessionRepo
+			store.External = externalRepo
+
+			provider.mu.Lock()
+			provider.user = tc.identity
+			provider.mu.Unlock()
+
+			cfg := testConfig()
+			cfg.OIDCIssuer = provider.URL
+			cfg.OIDCClientID = provider.clientID
+			cfg.OIDCClientSecret = provider.secret
+			cfg.OIDCRedirectURL = "http://blog.test/api/v1/auth/oidc/callback"
+
+			serviceManager, err := service.NewManager(context.Background(), store, cfg)
+			require.NoError(t, err)
+
+			userController := NewUserController(context.Background(), serviceManager)
+			e := echo.New()
+
+			// Start the flow and follow the redirect to the provider
+			rec := httptest.NewRecorder()
+			require.NoError(t, userController.OIDCLogin(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil), rec)))
+			require.Equal(t, http.StatusFound, rec.Code)
+
+			cookies := rec.Result().Cookies()
+			require.Len(t, cookies, 1)
+			cookie := cookies[0]
+			require.True(t, cookie.HttpOnly)
+
+			client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}
+			resp, err := client.Get(rec.Header().Get(echo.HeaderLocation))
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusFound, resp.StatusCode)
+
+			callback, err := url.Parse(resp.Header.Get("Location"))
+			require.NoError(t, err)
+			query := callback.Query()
+			if tc.callback != nil {
+				tc.callback(query, cookie)
+			}
+
+			// Come back from the provider with the state cookie
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?"+query.Encode(), nil)
+			req.AddCookie(cookie)
+			rec = httptest.NewRecorder()
+			err = userController.OIDCCallback(e.NewContext(req, rec))
+
+			tc.checkResponse(t, rec, err)
+		})
+	}
+}
+
+func TestOIDCLoginNotConfigured(t *testing.T) {
+	serviceManager, err := service.NewManager(context.Background(), &repository.Store{}, testConfig())
+	require.NoError(t, err)
+
+	userController := NewUserController(context.Background(), serviceManager)
+	e := echo.New()
+
+	err = userController.OIDCLogin(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+	requireHTTPError(t, err, http.StatusNotFound)
+
+	req := httptest.NewRequest(http.MethodGet, "/?code=code&state=state", nil)
+	req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: "state"})
+	err = userController.OIDCCallback(e.NewContext(req, httptest.NewRecorder()))
+	requireHTTPError(t, err, http.StatusNotFound)
+}
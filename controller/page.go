@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/slavik22/blogRestApi/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// bindPage reads the page request from the query string. limit and cursor
+// walk the listing by keyset, page and per_page jump to an offset. The
+// numbers are checked against their bounds by the service.
+func bindPage(c echo.Context) (model.PageRequest, error) {
+	var page model.PageRequest
+
+	number := func(name string) (int, error) {
+		value := c.QueryParam(name)
+		if value == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a number", name))
+		}
+		return n, nil
+	}
+
+	var err error
+	if page.Limit, err = number("limit"); err != nil {
+		return page, err
+	}
+	if page.Page, err = number("page"); err != nil {
+		return page, err
+	}
+	perPage, err := number("per_page")
+	if err != nil {
+		return page, err
+	}
+
+	if perPage != 0 {
+		if page.Limit != 0 {
+			return page, echo.NewHTTPError(http.StatusBadRequest, "use either limit or per_page")
+		}
+		page.Limit = perPage
+	}
+
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		if page.Offset() {
+			return page, echo.NewHTTPError(http.StatusBadRequest, "use either cursor or page")
+		}
+		page.Cursor, err = model.ParseCursor(cursor)
+		if err != nil {
+			return page, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	return page, nil
+}
+
+// setPageLinks adds the RFC 8288 Link header pointing at the neighbouring pages
+func setPageLinks[T any](c echo.Context, page *model.Page[T]) {
+	link := func(rel string, set map[string]string) string {
+		u := *c.Request().URL
+		u.Scheme = c.Scheme()
+		u.Host = c.Request().Host
+
+		query := u.Query()
+		for _, name := range []string{"limit", "cursor", "page", "per_page"} {
+			query.Del(name)
+		}
+		for name, value := range set {
+			query.Set(name, value)
+		}
+		u.RawQuery = query.Encode()
+
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+	}
+
+	var links []string
+	if page.Page > 0 {
+		paged := func(n int) map[string]string {
+			return map[string]string{"page": strconv.Itoa(n), "per_page": strconv.Itoa(page.PerPage)}
+		}
+
+		lastPage := page.TotalPages
+		if lastPage < 1 {
+			lastPage = 1
+		}
+
+		links = append(links, link("first", paged(1)))
+		if page.Page > 1 {
+			links = append(links, link("prev", paged(minInt(page.Page-1, lastPage))))
+		}
+		if page.Page < page.TotalPages {
+			links = append(links, link("next", paged(page.Page+1)))
+		}
+		links = append(links, link("last", paged(lastPage)))
+	} else {
+		limit := strconv.Itoa(page.PerPage)
+
+		links = append(links, link("first", map[string]string{"limit": limit}))
+		if page.NextCursor != "" {
+			links = append(links, link("next", map[string]string{"limit": limit, "cursor": page.NextCursor}))
+		}
+	}
+
+	c.Response().Header().Set("Link", strings.Join(links, ", "))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
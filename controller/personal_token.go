@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/service"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type createPersonalTokenInput struct {
+	Name      string             `json:"name" validate:"required,max=100"`
+	Scopes    []model.Permission `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time         `json:"expiresAt"`
+}
+
+type personalTokenOutput struct {
+	ID         uint               `json:"id"`
+	Name       string             `json:"name"`
+	Prefix     string             `json:"prefix"`
+	Scopes     []model.Permission `json:"scopes"`
+	ExpiresAt  *time.Time         `json:"expiresAt"`
+	LastUsedAt *time.Time         `json:"lastUsedAt"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	// Token is only set in the response to the creation
+	Token string `json:"token,omitempty"`
+}
+
+func newPersonalTokenOutput(token *model.PersonalAccessToken) personalTokenOutput {
+	return personalTokenOutput{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.ScopeList(),
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+// CreatePersonalToken godoc
+//
+//	@Summary		Create personal access token
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Creates a scoped API token for scripts and CI. The token is only shown in this response.
+//	@ID				CreatePersonalToken
+//	@Accept			json
+//	@Produce		json
+//	@Success		201	{object}	personalTokenOutput
+//	@Router			/api/v1/users/me/tokens [post]
+func (u *UserController) CreatePersonalToken(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	var input createPersonalTokenInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	record, token, err := u.services.UserService.CreatePersonalToken(userId, service.PersonalTokenInput{
+		Name:      input.Name,
+		Scopes:    input.Scopes,
+		ExpiresAt: input.ExpiresAt,
+	})
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not create token"))
+		}
+	}
+
+	output := newPersonalTokenOutput(record)
+	output.Token = token
+
+	return c.JSON(http.StatusCreated, output)
+}
+
+// GetPersonalTokens godoc
+//
+//	@Summary		List personal access tokens
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Lists the personal access tokens of the current user
+//	@ID				GetPersonalTokens
+//	@Produce		json
+//	@Success		200	{object}	[]personalTokenOutput
+//	@Router			/api/v1/users/me/tokens [get]
+func (u *UserController) GetPersonalTokens(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	tokens, err := u.services.UserService.GetPersonalTokens(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not get tokens"))
+	}
+
+	output := make([]personalTokenOutput, len(tokens))
+	for i := range tokens {
+		output[i] = newPersonalTokenOutput(&tokens[i])
+	}
+
+	return c.JSON(http.StatusOK, output)
+}
+
+// RevokePersonalToken godoc
+//
+//	@Summary		Revoke personal access token
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Deletes a personal access token of the current user
+//	@ID				RevokePersonalToken
+//	@Produce		json
+//	@Success		200
+//	@Router			/api/v1/users/me/tokens/:id [delete]
+func (u *UserController) RevokePersonalToken(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	tokenId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "token id is incorrect"))
+	}
+
+	err = u.services.UserService.RevokePersonalToken(userId, uint(tokenId))
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, "token not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not revoke token"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, "token revoked")
+}
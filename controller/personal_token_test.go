@@ -0,0 +1,325 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/slavik22/blogRestApi/lib/types"
+	util2 "github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/lib/validator"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	mock_repository "github.com/slavik22/blogRestApi/repository/mock"
+	"github.com/slavik22/blogRestApi/service"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreatePersonalTokenAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	user.Role = model.RoleAuthor
+
+	testCases := []struct {
+		name          string
+		body          string
+		buildStubs    func(tokens *mock_repository.MockPersonalAccessTokenRepo)
+		checkResponse func(recorder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name: "OK",
+			body: `{"name": "ci", "scopes": ["posts:write", "posts:read", "posts:write"], "expiresAt": "2100-01-01T00:00:00Z"}`,
+			buildStubs: func(tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				tokens.EXPECT().CreatePersonalToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, token *model.PersonalAccessToken) error {
+						require.Equal(t, user.ID, token.UserId)
+						require.Equal(t, "posts:write posts:read", token.Scopes)
+						require.Len(t, token.TokenHash, 64)
+						token.ID = 7
+						return nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+
+				var output personalTokenOutput
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &output))
+				require.Equal(t, uint(7), output.ID)
+				require.True(t, strings.HasPrefix(output.Token, service.PersonalTokenPrefix))
+				require.True(t, strings.HasPrefix(output.Token, output.Prefix))
+				require.Equal(t, []model.Permission{model.PermPostsWrite, model.PermPostsRead}, output.Scopes)
+			},
+		},
+		{
+			name: "UnknownScope",
+			body: `{"name": "ci", "scopes": ["posts:everything"]}`,
+			buildStubs: func(tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				tokens.EXPECT().CreatePersonalToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name: "ScopeBeyondRole",
+			body: `{"name": "ci", "scopes": ["users:manage"]}`,
+			buildStubs: func(tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				tokens.EXPECT().CreatePersonalToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
+		{
+			name: "Expired",
+			body: `{"name": "ci", "scopes": ["posts:read"], "expiresAt": "2000-01-01T00:00:00Z"}`,
+			buildStubs: func(tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				tokens.EXPECT().CreatePersonalToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name: "NoScopes",
+			body: `{"name": "ci", "scopes": []}`,
+			buildStubs: func(tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				tokens.EXPECT().CreatePersonalToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusUnprocessableEntity)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			tokenRepo := mock_repository.NewMockPersonalAccessTokenRepo(ctrl)
+
+			userRepo.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+				AnyTimes().
+				Return(&user, nil)
+			tc.buildStubs(tokenRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Personal = tokenRepo
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			e := echo.New()
+			e.Validator = validator.NewValidator()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/users/me/tokens", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userId", user.ID)
+
+			userController := NewUserController(context.Background(), serviceManager)
+			err = userController.CreatePersonalToken(c)
+
+			tc.checkResponse(rec, err)
+		})
+	}
+}
+
+func TestPersonalTokenIdentity(t *testing.T) {
+	user, _ := randomUser(t)
+	user.Role = model.RoleAuthor
+	token := service.PersonalTokenPrefix + util2.RandomString(43)
+	record := model.PersonalAccessToken{
+		ID:        3,
+		UserId:    user.ID,
+		Name:      "ci",
+		TokenHash: util2.HashToken(token),
+		Scopes:    "posts:read posts:write",
+	}
+	expiredAt := time.Now().Add(-time.Minute)
+	recentlyUsed := time.Now().Add(-time.Second)
+
+	testCases := []struct {
+		name       string
+		perm       model.Permission
+		session    bool
+		buildStubs func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockPersonalAccessTokenRepo)
+		code       int
+	}{
+		{
+			name: "OK",
+			perm: model.PermPostsWrite,
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				tokens.EXPECT().GetPersonalToken(gomock.Any(), gomock.Eq(record.TokenHash)).
+					Times(1).
+					Return(&record, nil)
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&user, nil)
+				tokens.EXPECT().TouchPersonalToken(gomock.Any(), gomock.Eq(record.ID), gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			code: http.StatusOK,
+		},
+		{
+			name: "RecentlyUsed",
+			perm: model.PermPostsRead,
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				used := record
+				used.LastUsedAt = &recentlyUsed
+				tokens.EXPECT().GetPersonalToken(gomock.Any(), gomock.Eq(record.TokenHash)).
+					Times(1).
+					Return(&used, nil)
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&user, nil)
+				tokens.EXPECT().TouchPersonalToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			code: http.StatusOK,
+		},
+		{
+			name: "OutOfScope",
+			perm: model.PermCommentsWrite,
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				tokens.EXPECT().GetPersonalToken(gomock.Any(), gomock.Eq(record.TokenHash)).
+					Times(1).
+					Return(&record, nil)
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&user, nil)
+				tokens.EXPECT().TouchPersonalToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			code: http.StatusForbidden,
+		},
+		{
+			name: "RoleDemoted",
+			perm: model.PermPostsWrite,
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				reader := user
+				reader.Role = model.RoleReader
+				tokens.EXPECT().GetPersonalToken(gomock.Any(), gomock.Eq(record.TokenHash)).
+					Times(1).
+					Return(&record, nil)
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&reader, nil)
+				tokens.EXPECT().TouchPersonalToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			code: http.StatusForbidden,
+		},
+		{
+			name:    "AccountRoute",
+			session: true,
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				tokens.EXPECT().GetPersonalToken(gomock.Any(), gomock.Eq(record.TokenHash)).
+					Times(1).
+					Return(&record, nil)
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&user, nil)
+				tokens.EXPECT().TouchPersonalToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			code: http.StatusForbidden,
+		},
+		{
+			name: "Expired",
+			perm: model.PermPostsRead,
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				expired := record
+				expired.ExpiresAt = &expiredAt
+				tokens.EXPECT().GetPersonalToken(gomock.Any(), gomock.Eq(record.TokenHash)).
+					Times(1).
+					Return(&expired, nil)
+			},
+			code: http.StatusUnauthorized,
+		},
+		{
+			name: "Revoked",
+			perm: model.PermPostsRead,
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockPersonalAccessTokenRepo) {
+				tokens.EXPECT().GetPersonalToken(gomock.Any(), gomock.Eq(record.TokenHash)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+			},
+			code: http.StatusUnauthorized,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			sessionRepo := mock_repository.NewMockSessionRepo(ctrl)
+			tokenRepo := mock_repository.NewMockPersonalAccessTokenRepo(ctrl)
+
+			tc.buildStubs(userRepo, tokenRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Session = sessionRepo
+			store.Personal = tokenRepo
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			e := echo.New()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(authorizationHeader, "Bearer "+token)
+
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			guard := RequirePermission(tc.perm)
+			if tc.session {
+				guard = RequireSession
+			}
+			handler := UserIdentity(serviceManager)(guard(func(c echo.Context) error {
+				userId, err := getUserId(c)
+				require.NoError(t, err)
+				require.Equal(t, user.ID, userId)
+				return c.NoContent(http.StatusOK)
+			}))
+			err = handler(c)
+
+			if tc.code == http.StatusOK {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, rec.Code)
+				return
+			}
+			requireHTTPError(t, err, tc.code)
+		})
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
 	"github.com/slavik22/blogRestApi/model"
 	"github.com/slavik22/blogRestApi/service"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
+	"time"
 )
 
 type PostController struct {
@@ -31,14 +35,41 @@ func NewUPostController(ctx context.Context, services *service.Manager) *PostCon
 //	@ID				get-all-Posts
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	[]model.Post
+//	@Param			author			query		int		false	"author id"
+//	@Param			status			query		string	false	"draft, in_review, scheduled, published or archived, others only see their published posts"
+//	@Param			tag				query		string	false	"comma separated tag slugs, posts must have all of them"
+//	@Param			category		query		string	false	"category slug, includes its subcategories"
+//	@Param			created_after	query		string	false	"date or RFC 3339 timestamp, inclusive"
+//	@Param			created_before	query		string	false	"date or RFC 3339 timestamp, exclusive"
+//	@Param			sort			query		string	false	"comma separated created_at, title or id, prefix - to sort descending"
+//	@Param			limit			query		int		false	"page size when walking by cursor"
+//	@Param			cursor			query		string	false	"next_cursor of the previous page"
+//	@Param			page			query		int		false	"page number, switches to offset pagination"
+//	@Param			per_page		query		int		false	"page size when paging by number"
+//	@Success		200				{object}	model.Page[model.Post]
 //	@Router			/api/v1/posts [get]
 func (h *PostController) GetAllPosts(c echo.Context) error {
-	posts, err := h.services.PostService.GetPosts()
+	actor, err := getActor(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	query, err := bindPostQuery(c)
+	if err != nil {
+		return err
 	}
 
+	posts, err := h.services.PostService.GetPosts(query, actor)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	setPageLinks(c, posts)
 	return c.JSON(http.StatusOK, posts)
 }
 
@@ -48,13 +79,14 @@ func (h *PostController) GetAllPosts(c echo.Context) error {
 //	@Security		ApiKeyAuth
 //	@Tags			Posts
 //	@Description	get model.Post by id
+//	@Description	posts that aren't published are only found by their author and editors
 //	@ID				get-Post-by-id
 //	@Accept			json
 //	@Produce		json
 //	@Success		200	{object}	model.Post
 //	@Router			/api/v1/posts/:id [get]
 func (h *PostController) GetPostById(c echo.Context) error {
-	userId, err := getUserId(c)
+	actor, err := getActor(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
 	}
@@ -65,10 +97,58 @@ func (h *PostController) GetPostById(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
 	}
 
-	post, err := h.services.PostService.GetPost(uint(postId), userId)
+	post, err := h.services.PostService.GetPost(uint(postId), actor)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, post)
+}
+
+// GetPostBySlug godoc
+//
+//	@Summary		Get Post By Slug
+//	@Security		ApiKeyAuth
+//	@Tags			Posts
+//	@Description	get model.Post by its slug
+//	@Description	slugs the post had before a title change redirect to the current one
+//	@ID				get-Post-by-slug
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	model.Post
+//	@Success		301
+//	@Router			/api/v1/posts/by-slug/:slug [get]
+func (h *PostController) GetPostBySlug(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	slug, err := url.PathUnescape(c.Param("slug"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post slug is incorrect"))
+	}
+
+	post, err := h.services.PostService.GetPostBySlug(slug, actor)
+
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	if post.Slug != slug {
+		location := path.Join(path.Dir(c.Request().URL.Path), url.PathEscape(post.Slug))
+		return c.Redirect(http.StatusMovedPermanently, location)
 	}
 
 	return c.JSON(http.StatusOK, post)
@@ -81,6 +161,9 @@ func (h *PostController) GetPostById(c echo.Context) error {
 //	@Tags			Post
 //	@Description	create Post
 //	@Description	create model.Post
+//	@Description	tags are given by name, e.g. ["go", "web"], categoryId must exist
+//	@Description	body is Markdown, it is returned rendered and sanitized as bodyHtml
+//	@Description	new posts are drafts, submit them for review to get them published
 //	@ID				create-Post
 //	@Accept			json
 //	@Produce		json
@@ -101,7 +184,14 @@ func (h *PostController) CreatePost(c echo.Context) error {
 	id, err := h.services.PostService.CreatePost(post, userId)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, "email address is not verified")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
 
 	return c.JSON(http.StatusCreated, id)
@@ -119,7 +209,7 @@ func (h *PostController) CreatePost(c echo.Context) error {
 //	@Success		200	{object}	model.Post
 //	@Router			/api/v1/posts [put]
 func (h *PostController) UpdatePost(c echo.Context) error {
-	userId, err := getUserId(c)
+	actor, err := getActor(c)
 
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
@@ -138,12 +228,20 @@ func (h *PostController) UpdatePost(c echo.Context) error {
 	}
 
 	post.ID = uint(postId)
-	post.UserId = userId
 
-	updatedPost, err := h.services.PostService.UpdatePost(post)
+	updatedPost, err := h.services.PostService.UpdatePost(post, actor)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
 
 	return c.JSON(http.StatusOK, *updatedPost)
@@ -155,13 +253,14 @@ func (h *PostController) UpdatePost(c echo.Context) error {
 //	@Security		ApiKeyAuth
 //	@Tags			Post
 //	@Description	delete model.Post
+//	@Description	the post and its comments go to the trash, they can be restored until TRASH_RETENTION has passed
 //	@ID				delete-Post
 //	@Accept			json
 //	@Produce		json
 //	@Success		200
 //	@Router			/api/v1/posts [delete]
 func (h *PostController) DeletePost(c echo.Context) error {
-	userId, err := getUserId(c)
+	actor, err := getActor(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
 	}
@@ -172,11 +271,196 @@ func (h *PostController) DeletePost(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
 	}
 
-	err = h.services.PostService.DeletePost(uint(postId), userId)
+	err = h.services.PostService.DeletePost(uint(postId), actor)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
 
 	return c.JSON(http.StatusOK, "post deleted")
 }
+
+type schedulePostInput struct {
+	PublishAt time.Time `json:"publishAt" validate:"required"`
+}
+
+// SubmitPost godoc
+//
+//	@Summary		Submit Post
+//	@Security		ApiKeyAuth
+//	@Tags			Post
+//	@Description	send a draft for review, only its author may
+//	@ID				submit-Post
+//	@Produce		json
+//	@Param			id	path		int	true	"post id"
+//	@Success		200	{object}	model.Post
+//	@Router			/api/v1/posts/{id}/submit [post]
+func (h *PostController) SubmitPost(c echo.Context) error {
+	return h.transitionPost(c, model.PostInReview, nil)
+}
+
+// RejectPost godoc
+//
+//	@Summary		Reject Post
+//	@Security		ApiKeyAuth
+//	@Tags			Post
+//	@Description	send a post in review or scheduled back to draft, its author withdraws it or an editor rejects it
+//	@ID				reject-Post
+//	@Produce		json
+//	@Param			id	path		int	true	"post id"
+//	@Success		200	{object}	model.Post
+//	@Router			/api/v1/posts/{id}/draft [post]
+func (h *PostController) RejectPost(c echo.Context) error {
+	return h.transitionPost(c, model.PostDraft, nil)
+}
+
+// SchedulePost godoc
+//
+//	@Summary		Schedule Post
+//	@Security		ApiKeyAuth
+//	@Tags			Post
+//	@Description	approve a post in review to be published at publishAt, needs posts:publish
+//	@ID				schedule-Post
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"post id"
+//	@Param			input	body		schedulePostInput	true	"publish time in the future"
+//	@Success		200		{object}	model.Post
+//	@Router			/api/v1/posts/{id}/schedule [post]
+func (h *PostController) SchedulePost(c echo.Context) error {
+	var input schedulePostInput
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if err := c.Validate(input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return h.transitionPost(c, model.PostScheduled, &input.PublishAt)
+}
+
+// PublishPost godoc
+//
+//	@Summary		Publish Post
+//	@Security		ApiKeyAuth
+//	@Tags			Post
+//	@Description	publish a post in review or scheduled right away, needs posts:publish
+//	@ID				publish-Post
+//	@Produce		json
+//	@Param			id	path		int	true	"post id"
+//	@Success		200	{object}	model.Post
+//	@Router			/api/v1/posts/{id}/publish [post]
+func (h *PostController) PublishPost(c echo.Context) error {
+	return h.transitionPost(c, model.PostPublished, nil)
+}
+
+// ArchivePost godoc
+//
+//	@Summary		Archive Post
+//	@Security		ApiKeyAuth
+//	@Tags			Post
+//	@Description	take a published post off the listings, its author and editors still find it
+//	@ID				archive-Post
+//	@Produce		json
+//	@Param			id	path		int	true	"post id"
+//	@Success		200	{object}	model.Post
+//	@Router			/api/v1/posts/{id}/archive [post]
+func (h *PostController) ArchivePost(c echo.Context) error {
+	return h.transitionPost(c, model.PostArchived, nil)
+}
+
+type commentModeInput struct {
+	// Mode is open, premoderated, closed or first_premoderated, empty follows
+	// COMMENT_MODE
+	Mode model.CommentMode `json:"mode"`
+}
+
+// SetCommentMode godoc
+//
+//	@Summary		Set Comment Mode
+//	@Security		ApiKeyAuth
+//	@Tags			Post
+//	@Description	set how new comments on the post are moderated, for its author and moderators
+//	@ID				set-comment-mode-Post
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"post id"
+//	@Param			input	body		commentModeInput	true	"comment mode"
+//	@Success		200		{object}	model.Post
+//	@Router			/api/v1/posts/{id}/comment-mode [put]
+func (h *PostController) SetCommentMode(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	postId, err := strconv.Atoi(c.Param("id"))
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
+	}
+
+	var input commentModeInput
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	post, err := h.services.PostService.SetCommentMode(uint(postId), input.Mode, actor)
+
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, post)
+}
+
+// transitionPost moves the post in the path to the status
+func (h *PostController) transitionPost(c echo.Context, to model.PostStatus, publishAt *time.Time) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	postId, err := strconv.Atoi(c.Param("id"))
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
+	}
+
+	post, err := h.services.PostService.TransitionPost(uint(postId), to, publishAt, actor)
+
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, err)
+		case errors.Cause(err) == types.ErrNotAllowed:
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case errors.Cause(err) == types.ErrConflict:
+			return echo.NewHTTPError(http.StatusConflict, "post status changed meanwhile, try again")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, post)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
+	"github.com/slavik22/blogRestApi/lib/types"
 	util2 "github.com/slavik22/blogRestApi/lib/util"
 	"github.com/slavik22/blogRestApi/lib/validator"
 	"github.com/slavik22/blogRestApi/model"
@@ -23,16 +24,20 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreatePostAPI(t *testing.T) {
 	post := randomPost(t, uint(util2.RandomInt(0, 100)))
 
+	verifiedAt := time.Now()
+
 	testCases := []struct {
-		name          string
-		body          map[string]interface{}
-		buildStubs    func(store *mock_repository.MockPostRepo)
-		checkResponse func(recoder *httptest.ResponseRecorder)
+		name            string
+		requireVerified bool
+		body            map[string]interface{}
+		buildStubs      func(userRepo *mock_repository.MockUserRepo, store *mock_repository.MockPostRepo)
+		checkResponse   func(recoder *httptest.ResponseRecorder, err error)
 	}{
 		{
 			name: "OK",
@@ -40,13 +45,13 @@ func TestCreatePostAPI(t *testing.T) {
 				"body":  post.Body,
 				"title": post.Title,
 			},
-			buildStubs: func(store *mock_repository.MockPostRepo) {
+			buildStubs: func(userRepo *mock_repository.MockUserRepo, store *mock_repository.MockPostRepo) {
 				store.EXPECT().
 					CreatePost(gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(post.ID, nil)
 			},
-			checkResponse: func(recorder *httptest.ResponseRecorder) {
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
 				require.Equal(t, http.StatusCreated, recorder.Code)
 
 				str := recorder.Body.String()
@@ -59,6 +64,68 @@ func TestCreatePostAPI(t *testing.T) {
 				assert.Equal(t, uint(id), post.ID)
 			},
 		},
+		{
+			name: "Markdown",
+			body: map[string]interface{}{
+				"body":  "![cat](https://example.com/cat.png)\n\n<a href=\"javascript:alert(1)\" onclick=\"alert(1)\">hi</a>\n\n- [x] done",
+				"title": post.Title,
+			},
+			buildStubs: func(userRepo *mock_repository.MockUserRepo, store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					CreatePost(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, created *model.Post) (uint, error) {
+						require.Equal(t, "<p><img src=\"https://example.com/cat.png\" alt=\"cat\"></p>\n"+
+							"<p>hi</p>\n"+
+							"<ul>\n<li><input checked=\"\" disabled=\"\" type=\"checkbox\"> done</li>\n</ul>\n", created.BodyHTML)
+						return post.ID, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:            "Verified",
+			requireVerified: true,
+			body: map[string]interface{}{
+				"body":  post.Body,
+				"title": post.Title,
+			},
+			buildStubs: func(userRepo *mock_repository.MockUserRepo, store *mock_repository.MockPostRepo) {
+				userRepo.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(post.UserId)).
+					Times(1).
+					Return(&model.User{ID: post.UserId, EmailVerifiedAt: &verifiedAt}, nil)
+				store.EXPECT().
+					CreatePost(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(post.ID, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:            "Unverified",
+			requireVerified: true,
+			body: map[string]interface{}{
+				"body":  post.Body,
+				"title": post.Title,
+			},
+			buildStubs: func(userRepo *mock_repository.MockUserRepo, store *mock_repository.MockPostRepo) {
+				userRepo.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(post.UserId)).
+					Times(1).
+					Return(&model.User{ID: post.UserId}, nil)
+				store.EXPECT().
+					CreatePost(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -72,7 +139,7 @@ func TestCreatePostAPI(t *testing.T) {
 			postRepo := mock_repository.NewMockPostRepo(ctrl)
 			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
 
-			tc.buildStubs(postRepo)
+			tc.buildStubs(userRepo, postRepo)
 
 			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
 
@@ -96,7 +163,10 @@ func TestCreatePostAPI(t *testing.T) {
 			c := e.NewContext(req, rec)
 			c.Set("userId", post.UserId)
 
-			serviceManager, err := service.NewManager(context.Background(), store)
+			cfg := testConfig()
+			cfg.RequireVerifiedEmail = tc.requireVerified
+
+			serviceManager, err := service.NewManager(context.Background(), store, cfg)
 			if err != nil {
 				t.Error(err)
 			}
@@ -109,36 +179,108 @@ func TestCreatePostAPI(t *testing.T) {
 
 			log.Info(err)
 
-			tc.checkResponse(rec)
+			tc.checkResponse(rec, err)
 		})
 	}
 }
 func TestUpdatePostAPI(t *testing.T) {
-	post := randomPost(t, uint(util2.RandomInt(0, 100)))
+	post := randomPost(t, uint(util2.RandomInt(1, 100)))
 
 	testCases := []struct {
 		name          string
+		userId        uint
+		role          model.Role
 		body          map[string]interface{}
 		buildStubs    func(store *mock_repository.MockPostRepo)
-		checkResponse func(recoder *httptest.ResponseRecorder)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
 	}{
 		{
-			name: "OK",
+			name:   "OK",
+			userId: post.UserId,
+			role:   model.RoleAuthor,
 			body: map[string]interface{}{
 				"body":  post.Body,
 				"title": post.Title,
 			},
 			buildStubs: func(store *mock_repository.MockPostRepo) {
+				existing := post
+				store.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&existing, nil)
 				store.EXPECT().
-					UpdatePost(gomock.Any(), gomock.Any()).
+					UpdatePost(gomock.Any(), gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(&post, nil)
 			},
-			checkResponse: func(recorder *httptest.ResponseRecorder) {
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
 				require.Equal(t, http.StatusOK, recorder.Code)
 				requireBodyMatchPost(t, recorder.Body, post)
 			},
 		},
+		{
+			name:   "Forbidden",
+			userId: post.UserId + 1,
+			role:   model.RoleAuthor,
+			body: map[string]interface{}{
+				"body":  post.Body,
+				"title": post.Title,
+			},
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				existing := post
+				store.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&existing, nil)
+				store.EXPECT().
+					UpdatePost(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
+		{
+			name:   "AdminManagesAnyPost",
+			userId: post.UserId + 1,
+			role:   model.RoleAdmin,
+			body: map[string]interface{}{
+				"body":  post.Body,
+				"title": post.Title,
+			},
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				existing := post
+				store.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&existing, nil)
+				store.EXPECT().
+					UpdatePost(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&post, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "NotFound",
+			userId: post.UserId,
+			role:   model.RoleAuthor,
+			body: map[string]interface{}{
+				"body":  post.Body,
+				"title": post.Title,
+			},
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -174,11 +316,12 @@ func TestUpdatePostAPI(t *testing.T) {
 
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
-			c.Set("userId", post.UserId)
+			c.Set("userId", tc.userId)
+			c.Set("role", tc.role)
 			c.SetParamNames("id")
 			c.SetParamValues(strconv.Itoa(int(post.ID)))
 
-			serviceManager, err := service.NewManager(context.Background(), store)
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
 			if err != nil {
 				t.Error(err)
 			}
@@ -188,7 +331,7 @@ func TestUpdatePostAPI(t *testing.T) {
 
 			log.Info(err)
 
-			tc.checkResponse(rec)
+			tc.checkResponse(rec, err)
 		})
 	}
 }
@@ -196,26 +339,76 @@ func TestGetPostAPI(t *testing.T) {
 	user, _ := randomUser(t)
 	post := randomPost(t, user.ID)
 
+	draft := post
+	draft.Status = model.PostDraft
+
 	testCases := []struct {
 		name          string
-		postId        uint
+		userId        uint
+		role          model.Role
 		buildStubs    func(store *mock_repository.MockPostRepo)
-		checkResponse func(recoder *httptest.ResponseRecorder)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
 	}{
 		{
 			name:   "OK",
-			postId: post.ID,
+			userId: user.ID + 1,
+			role:   model.RoleReader,
 			buildStubs: func(store *mock_repository.MockPostRepo) {
 				store.EXPECT().
-					GetPost(gomock.Any(), gomock.Eq(post.UserId), gomock.Eq(post.ID)).
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
 					Times(1).
 					Return(&post, nil)
 			},
-			checkResponse: func(recorder *httptest.ResponseRecorder) {
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
 				require.Equal(t, http.StatusOK, recorder.Code)
 				requireBodyMatchPost(t, recorder.Body, post)
 			},
 		},
+		{
+			name:   "OwnDraft",
+			userId: user.ID,
+			role:   model.RoleAuthor,
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&draft, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				requireBodyMatchPost(t, recorder.Body, draft)
+			},
+		},
+		{
+			name:   "EditorDraft",
+			userId: user.ID + 1,
+			role:   model.RoleModerator,
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&draft, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				requireBodyMatchPost(t, recorder.Body, draft)
+			},
+		},
+		{
+			name:   "OthersDraft",
+			userId: user.ID + 1,
+			role:   model.RoleAuthor,
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPost(gomock.Any(), gomock.Eq(post.ID)).
+					Times(1).
+					Return(&draft, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -236,18 +429,19 @@ func TestGetPostAPI(t *testing.T) {
 			e := echo.New()
 			e.Validator = validator.NewValidator()
 
-			url := fmt.Sprintf("/v1/api/posts/%d", tc.postId)
+			url := fmt.Sprintf("/v1/api/posts/%d", post.ID)
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
 			rec := httptest.NewRecorder()
 
 			c := e.NewContext(req, rec)
-			c.Set("userId", post.UserId)
+			c.Set("userId", tc.userId)
+			c.Set("role", tc.role)
 			c.SetParamNames("id")
 			c.SetParamValues(strconv.Itoa(int(post.ID)))
 
-			serviceManager, err := service.NewManager(context.Background(), store)
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
 
 			if err != nil {
 				t.Error(err)
@@ -256,40 +450,411 @@ func TestGetPostAPI(t *testing.T) {
 			postController := NewUPostController(context.Background(), serviceManager)
 			err = postController.GetPostById(c)
 
-			if err != nil {
-				t.Error(err)
-			}
+			tc.checkResponse(rec, err)
+		})
+	}
+}
+
+func TestGetPostBySlugAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	post := randomPost(t, user.ID)
+	post.Slug = "hello-world-2"
+
+	draft := post
+	draft.Status = model.PostDraft
+
+	testCases := []struct {
+		name          string
+		slug          string
+		buildStubs    func(store *mock_repository.MockPostRepo)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name: "OK",
+			slug: "hello-world-2",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPostBySlug(gomock.Any(), gomock.Eq("hello-world-2")).
+					Times(1).
+					Return(&post, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchPost(t, recorder.Body, post)
+			},
+		},
+		{
+			name: "OldSlug",
+			slug: "hello",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPostBySlug(gomock.Any(), gomock.Eq("hello")).
+					Times(1).
+					Return(&post, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusMovedPermanently, recorder.Code)
+				require.Equal(t, "/api/v1/posts/by-slug/hello-world-2", recorder.Header().Get(echo.HeaderLocation))
+			},
+		},
+		{
+			name: "OthersDraft",
+			slug: "hello-world-2",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPostBySlug(gomock.Any(), gomock.Eq("hello-world-2")).
+					Times(1).
+					Return(&draft, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name: "NotFound",
+			slug: "missing",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPostBySlug(gomock.Any(), gomock.Eq("missing")).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+	}
 
-			tc.checkResponse(rec)
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+			tc.buildStubs(postRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+
+			url := "/api/v1/posts/by-slug/" + tc.slug
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			rec := httptest.NewRecorder()
+
+			c := echo.New().NewContext(req, rec)
+			c.Set("userId", user.ID+1)
+			c.Set("role", model.RoleReader)
+			c.SetParamNames("slug")
+			c.SetParamValues(tc.slug)
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			postController := NewUPostController(context.Background(), serviceManager)
+			err = postController.GetPostBySlug(c)
+
+			tc.checkResponse(rec, err)
 		})
 	}
 }
+
 func TestGetPostsAPI(t *testing.T) {
 	user, _ := randomUser(t)
 
 	n := 10
 	posts := make([]model.Post, n)
 
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 	for i := 0; i < n; i++ {
 		posts[i] = randomPost(t, user.ID)
+		posts[i].ID = uint(n - i)
+		posts[i].CreatedAt = created.Add(-time.Duration(i) * time.Minute)
 	}
+	cursor := model.Cursor{CreatedAt: posts[2].CreatedAt, ID: posts[2].ID}
 
 	testCases := []struct {
 		name          string
+		query         string
 		buildStubs    func(store *mock_repository.MockPostRepo)
-		checkResponse func(recoder *httptest.ResponseRecorder)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
 	}{
 		{
 			name: "OK",
 			buildStubs: func(store *mock_repository.MockPostRepo) {
 				store.EXPECT().
-					GetPosts(gomock.Any()).
+					CountPosts(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(n), nil)
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Eq(model.PostQuery{ViewerId: user.ID, Page: model.PageRequest{Limit: 21}})).
 					Times(1).
 					Return(posts, nil)
 			},
-			checkResponse: func(recorder *httptest.ResponseRecorder) {
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
 				require.Equal(t, http.StatusOK, recorder.Code)
-				requireBodyMatchAPosts(t, recorder.Body, posts)
+				page := requireBodyMatchAPosts(t, recorder.Body, posts)
+				require.Equal(t, int64(n), page.Total)
+				require.Equal(t, 20, page.PerPage)
+				require.Empty(t, page.NextCursor)
+				require.Equal(t, `<http://example.com/v1/api/posts?limit=20>; rel="first"`, recorder.Header().Get("Link"))
+			},
+		},
+		{
+			name:  "FirstCursorPage",
+			query: "limit=3",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					CountPosts(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(n), nil)
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Eq(model.PostQuery{ViewerId: user.ID, Page: model.PageRequest{Limit: 4}})).
+					Times(1).
+					Return(posts[:4], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				page := requireBodyMatchAPosts(t, recorder.Body, posts[:3])
+				require.Equal(t, cursor.String(), page.NextCursor)
+				require.Equal(t, 3, page.PerPage)
+				require.Contains(t, recorder.Header().Get("Link"),
+					fmt.Sprintf(`<http://example.com/v1/api/posts?cursor=%s&limit=3>; rel="next"`, cursor.String()))
+			},
+		},
+		{
+			name:  "NextCursorPage",
+			query: "limit=3&cursor=" + cursor.String(),
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					CountPosts(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(n), nil)
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Eq(model.PostQuery{ViewerId: user.ID, Page: model.PageRequest{Limit: 4, Cursor: &cursor}})).
+					Times(1).
+					Return(posts[3:7], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				page := requireBodyMatchAPosts(t, recorder.Body, posts[3:6])
+				require.Equal(t, model.Cursor{CreatedAt: posts[5].CreatedAt, ID: posts[5].ID}.String(), page.NextCursor)
+			},
+		},
+		{
+			name:  "OffsetPage",
+			query: "page=2&per_page=4",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					CountPosts(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(n), nil)
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Eq(model.PostQuery{ViewerId: user.ID, Page: model.PageRequest{Limit: 5, Page: 2}})).
+					Times(1).
+					Return(posts[4:9], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				page := requireBodyMatchAPosts(t, recorder.Body, posts[4:8])
+				require.Equal(t, 2, page.Page)
+				require.Equal(t, 3, page.TotalPages)
+				require.Empty(t, page.NextCursor)
+
+				links := strings.Split(recorder.Header().Get("Link"), ", ")
+				require.Equal(t, []string{
+					`<http://example.com/v1/api/posts?page=1&per_page=4>; rel="first"`,
+					`<http://example.com/v1/api/posts?page=1&per_page=4>; rel="prev"`,
+					`<http://example.com/v1/api/posts?page=3&per_page=4>; rel="next"`,
+					`<http://example.com/v1/api/posts?page=3&per_page=4>; rel="last"`,
+				}, links)
+			},
+		},
+		{
+			name:  "MaxPageSize",
+			query: "limit=1000",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					CountPosts(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(n), nil)
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Eq(model.PostQuery{ViewerId: user.ID, Page: model.PageRequest{Limit: 101}})).
+					Times(1).
+					Return(posts, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				page := requireBodyMatchAPosts(t, recorder.Body, posts)
+				require.Equal(t, 100, page.PerPage)
+			},
+		},
+		{
+			name:  "Filtered",
+			query: "author=7&created_after=2023-12-31&created_before=2024-01-01T00:00:00Z&sort=-created_at,title&limit=3",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				after := time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)
+				query := model.PostQuery{
+					AuthorId:      7,
+					ViewerId:      user.ID,
+					CreatedAfter:  &after,
+					CreatedBefore: &created,
+					Sort:          []model.SortField{{Field: "created_at", Desc: true}, {Field: "title"}},
+					Page:          model.PageRequest{Limit: 3},
+				}
+
+				store.EXPECT().
+					CountPosts(gomock.Any(), gomock.Eq(query)).
+					Times(1).
+					Return(int64(4), nil)
+
+				query.Page = model.PageRequest{Limit: 4, Page: 1}
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Eq(query)).
+					Times(1).
+					Return(posts[:4], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				page := requireBodyMatchAPosts(t, recorder.Body, posts[:3])
+				require.Equal(t, 1, page.Page)
+				require.Equal(t, 2, page.TotalPages)
+				require.Empty(t, page.NextCursor)
+				require.Contains(t, recorder.Header().Get("Link"),
+					`<http://example.com/v1/api/posts?author=7&created_after=2023-12-31&created_before=2024-01-01T00%3A00%3A00Z&page=2&per_page=3&sort=-created_at%2Ctitle>; rel="next"`)
+			},
+		},
+		{
+			name:  "SortedCursor",
+			query: "sort=title&cursor=" + cursor.String(),
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "UnknownParameter",
+			query: "colour=red",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "Status",
+			query: "status=draft",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				query := model.PostQuery{Status: model.PostDraft, ViewerId: user.ID}
+				store.EXPECT().
+					CountPosts(gomock.Any(), gomock.Eq(query)).
+					Times(1).
+					Return(int64(0), nil)
+
+				query.Page = model.PageRequest{Limit: 21}
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Eq(query)).
+					Times(1).
+					Return(nil, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:  "UnknownStatus",
+			query: "status=deleted",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "UnknownSortField",
+			query: "sort=-password",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "InvalidDate",
+			query: "created_after=yesterday",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "InvalidLimit",
+			query: "limit=-1",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "InvalidCursor",
+			query: "cursor=garbage",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "PageTooDeep",
+			query: "page=100000000000000000&per_page=100",
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "CursorWithPage",
+			query: "page=2&cursor=" + cursor.String(),
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().
+					GetPosts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
 			},
 		},
 	}
@@ -312,15 +877,16 @@ func TestGetPostsAPI(t *testing.T) {
 			e := echo.New()
 			e.Validator = validator.NewValidator()
 
-			req := httptest.NewRequest(http.MethodGet, "/v1/api/posts", nil)
+			req := httptest.NewRequest(http.MethodGet, "/v1/api/posts?"+tc.query, nil)
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
 			rec := httptest.NewRecorder()
 
 			c := e.NewContext(req, rec)
 			c.Set("userId", user.ID)
+			c.Set("role", model.RoleReader)
 
-			serviceManager, err := service.NewManager(context.Background(), store)
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
 
 			if err != nil {
 				t.Error(err)
@@ -329,21 +895,337 @@ func TestGetPostsAPI(t *testing.T) {
 			postController := NewUPostController(context.Background(), serviceManager)
 			err = postController.GetAllPosts(c)
 
-			if err != nil {
-				t.Error(err)
-			}
+			tc.checkResponse(rec, err)
+		})
+	}
+}
+
+func TestPostWorkflowAPI(t *testing.T) {
+	author, _ := randomUser(t)
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	withStatus := func(status model.PostStatus) *model.Post {
+		post := randomPost(t, author.ID)
+		post.Status = status
+		return &post
+	}
+	expectTransition := func(store *mock_repository.MockPostRepo, from model.PostStatus) {
+		store.EXPECT().
+			GetPost(gomock.Any(), gomock.Eq(uint(1))).
+			Times(1).
+			Return(withStatus(from), nil)
+		store.EXPECT().
+			SetPostStatus(gomock.Any(), gomock.Any(), gomock.Eq(from)).
+			Times(1).
+			Return(nil)
+	}
 
-			tc.checkResponse(rec)
+	testCases := []struct {
+		name          string
+		userId        uint
+		role          model.Role
+		action        func(h *PostController) echo.HandlerFunc
+		body          string
+		buildStubs    func(store *mock_repository.MockPostRepo)
+		checkResponse func(recorder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name:   "Submit",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			action: func(h *PostController) echo.HandlerFunc { return h.SubmitPost },
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				expectTransition(store, model.PostDraft)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				post := requireBodyPost(t, recorder.Body)
+				require.Equal(t, model.PostInReview, post.Status)
+				require.Nil(t, post.PublishedAt)
+			},
+		},
+		{
+			name:   "SubmitOthersDraft",
+			userId: author.ID + 1,
+			role:   model.RoleAuthor,
+			action: func(h *PostController) echo.HandlerFunc { return h.SubmitPost },
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().GetPost(gomock.Any(), gomock.Any()).Times(1).Return(withStatus(model.PostDraft), nil)
+				store.EXPECT().SetPostStatus(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name:   "PublishOwnPost",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			action: func(h *PostController) echo.HandlerFunc { return h.PublishPost },
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().GetPost(gomock.Any(), gomock.Any()).Times(1).Return(withStatus(model.PostInReview), nil)
+				store.EXPECT().SetPostStatus(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
+		{
+			name:   "Publish",
+			userId: author.ID + 1,
+			role:   model.RoleModerator,
+			action: func(h *PostController) echo.HandlerFunc { return h.PublishPost },
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				expectTransition(store, model.PostInReview)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				post := requireBodyPost(t, recorder.Body)
+				require.Equal(t, model.PostPublished, post.Status)
+				require.NotNil(t, post.PublishedAt)
+				require.WithinDuration(t, time.Now(), *post.PublishedAt, time.Minute)
+			},
+		},
+		{
+			name:   "Schedule",
+			userId: author.ID + 1,
+			role:   model.RoleAdmin,
+			action: func(h *PostController) echo.HandlerFunc { return h.SchedulePost },
+			body:   fmt.Sprintf(`{"publishAt":%q}`, future.Format(time.RFC3339)),
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				expectTransition(store, model.PostInReview)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				post := requireBodyPost(t, recorder.Body)
+				require.Equal(t, model.PostScheduled, post.Status)
+				require.True(t, future.Equal(*post.PublishedAt))
+			},
+		},
+		{
+			name:   "ScheduleInPast",
+			userId: author.ID + 1,
+			role:   model.RoleModerator,
+			action: func(h *PostController) echo.HandlerFunc { return h.SchedulePost },
+			body:   `{"publishAt":"2020-01-01T00:00:00Z"}`,
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().GetPost(gomock.Any(), gomock.Any()).Times(1).Return(withStatus(model.PostInReview), nil)
+				store.EXPECT().SetPostStatus(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "RejectScheduled",
+			userId: author.ID + 1,
+			role:   model.RoleModerator,
+			action: func(h *PostController) echo.HandlerFunc { return h.RejectPost },
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				expectTransition(store, model.PostScheduled)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				post := requireBodyPost(t, recorder.Body)
+				require.Equal(t, model.PostDraft, post.Status)
+				require.Nil(t, post.PublishedAt)
+			},
+		},
+		{
+			name:   "Archive",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			action: func(h *PostController) echo.HandlerFunc { return h.ArchivePost },
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				expectTransition(store, model.PostPublished)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, model.PostArchived, requireBodyPost(t, recorder.Body).Status)
+			},
+		},
+		{
+			name:   "IllegalTransition",
+			userId: author.ID,
+			role:   model.RoleAdmin,
+			action: func(h *PostController) echo.HandlerFunc { return h.ArchivePost },
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().GetPost(gomock.Any(), gomock.Any()).Times(1).Return(withStatus(model.PostDraft), nil)
+				store.EXPECT().SetPostStatus(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusConflict)
+			},
+		},
+		{
+			name:   "SetCommentMode",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			action: func(h *PostController) echo.HandlerFunc { return h.SetCommentMode },
+			body:   `{"mode":"premoderated"}`,
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().GetPost(gomock.Any(), gomock.Any()).Times(1).Return(withStatus(model.PostPublished), nil)
+				store.EXPECT().SetCommentMode(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, post *model.Post) error {
+						require.Equal(t, model.CommentsPremoderated, post.CommentMode)
+						return nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				post := requireBodyPost(t, recorder.Body)
+				require.Equal(t, model.CommentsPremoderated, post.CommentMode)
+			},
+		},
+		{
+			name:   "ModeratorClosesComments",
+			userId: author.ID + 1,
+			role:   model.RoleModerator,
+			action: func(h *PostController) echo.HandlerFunc { return h.SetCommentMode },
+			body:   `{"mode":"closed"}`,
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().GetPost(gomock.Any(), gomock.Any()).Times(1).Return(withStatus(model.PostPublished), nil)
+				store.EXPECT().SetCommentMode(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, model.CommentsClosed, requireBodyPost(t, recorder.Body).CommentMode)
+			},
+		},
+		{
+			name:   "SetCommentModeOthersPost",
+			userId: author.ID + 1,
+			role:   model.RoleAuthor,
+			action: func(h *PostController) echo.HandlerFunc { return h.SetCommentMode },
+			body:   `{"mode":"open"}`,
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().GetPost(gomock.Any(), gomock.Any()).Times(1).Return(withStatus(model.PostPublished), nil)
+				store.EXPECT().SetCommentMode(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
+		{
+			name:   "UnknownCommentMode",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			action: func(h *PostController) echo.HandlerFunc { return h.SetCommentMode },
+			body:   `{"mode":"whenever"}`,
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().SetCommentMode(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "ChangedMeanwhile",
+			userId: author.ID + 1,
+			role:   model.RoleModerator,
+			action: func(h *PostController) echo.HandlerFunc { return h.PublishPost },
+			buildStubs: func(store *mock_repository.MockPostRepo) {
+				store.EXPECT().GetPost(gomock.Any(), gomock.Any()).Times(1).Return(withStatus(model.PostScheduled), nil)
+				store.EXPECT().SetPostStatus(gomock.Any(), gomock.Any(), gomock.Eq(model.PostScheduled)).
+					Times(1).
+					Return(types.ErrConflict)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusConflict)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+			tc.buildStubs(postRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			e := echo.New()
+			e.Validator = validator.NewValidator()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/posts/1", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userId", tc.userId)
+			c.Set("role", tc.role)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			err = tc.action(NewUPostController(context.Background(), serviceManager))(c)
+
+			tc.checkResponse(rec, err)
 		})
 	}
 }
 
+func TestPublishScheduled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+	index := repository.NewSearchMemoryIndex()
+	store.Search = index
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+
+	due := time.Now().Add(-time.Minute)
+	posts := []model.Post{
+		{ID: 1, Title: "launch notes", Status: model.PostScheduled, PublishedAt: &due},
+		{ID: 2, Title: "launch recap", Status: model.PostScheduled, PublishedAt: &due},
+	}
+
+	postRepo.EXPECT().GetDuePosts(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(posts, nil)
+	postRepo.EXPECT().SetPostStatus(gomock.Any(), gomock.Any(), gomock.Eq(model.PostScheduled)).
+		Times(2).
+		DoAndReturn(func(_ context.Context, post *model.Post, _ model.PostStatus) error {
+			require.Equal(t, model.PostPublished, post.Status)
+			require.Equal(t, &due, post.PublishedAt)
+			// Another instance published the second post first
+			if post.ID == 2 {
+				return types.ErrConflict
+			}
+			return nil
+		})
+
+	require.NoError(t, serviceManager.PostService.PublishScheduled())
+
+	hits, total, err := index.Search(context.Background(), model.SearchQuery{Text: "launch", Page: model.PageRequest{Limit: 10, Page: 1}})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, uint(1), hits[0].ID)
+}
+
 func randomPost(t *testing.T, userId uint) (post model.Post) {
 	post = model.Post{
 		ID:     1,
 		Title:  util2.RandomString(10),
 		Body:   util2.RandomString(100),
 		UserId: userId,
+		Status: model.PostPublished,
 	}
 	return
 }
@@ -358,12 +1240,19 @@ func requireBodyMatchPost(t *testing.T, body *bytes.Buffer, post model.Post) {
 	require.Equal(t, post, gotPost)
 }
 
-func requireBodyMatchAPosts(t *testing.T, body *bytes.Buffer, posts []model.Post) {
+func requireBodyPost(t *testing.T, body *bytes.Buffer) model.Post {
+	var post model.Post
+	require.NoError(t, json.Unmarshal(body.Bytes(), &post))
+	return post
+}
+
+func requireBodyMatchAPosts(t *testing.T, body *bytes.Buffer, posts []model.Post) model.Page[model.Post] {
 	data, err := io.ReadAll(body)
 	require.NoError(t, err)
 
-	var gotPosts []model.Post
+	var gotPosts model.Page[model.Post]
 	err = json.Unmarshal(data, &gotPosts)
 	require.NoError(t, err)
-	require.Equal(t, posts, gotPosts)
+	require.Equal(t, posts, gotPosts.Data)
+	return gotPosts
 }
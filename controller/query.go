@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/slavik22/blogRestApi/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pageParams are accepted by every listing next to its own filters
+var pageParams = []string{"limit", "cursor", "page", "per_page", "sort"}
+
+var (
+	postFilters    = []string{"author", "status", "tag", "category", "created_after", "created_before"}
+	postSorts      = []string{"created_at", "title", "id"}
+	commentFilters = []string{"author", "post", "status", "created_after", "created_before"}
+	commentSorts   = []string{"created_at", "title", "id"}
+
+	// postCommentFilters leave out the post, it is in the path
+	postCommentFilters = []string{"author", "status", "created_after", "created_before"}
+)
+
+// bindPostQuery reads the post listing's filters, sort and page from the query string
+func bindPostQuery(c echo.Context) (model.PostQuery, error) {
+	var query model.PostQuery
+
+	if err := checkParams(c, pageParams, postFilters); err != nil {
+		return query, err
+	}
+
+	var err error
+	if query.Page, err = bindPage(c); err != nil {
+		return query, err
+	}
+	if query.Sort, err = bindSort(c, postSorts); err != nil {
+		return query, err
+	}
+	if query.AuthorId, err = bindID(c, "author"); err != nil {
+		return query, err
+	}
+	if query.CreatedAfter, err = bindTime(c, "created_after"); err != nil {
+		return query, err
+	}
+	if query.CreatedBefore, err = bindTime(c, "created_before"); err != nil {
+		return query, err
+	}
+
+	if status := model.PostStatus(c.QueryParam("status")); status != "" {
+		if !status.Valid() {
+			return query, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown status %q", status))
+		}
+		query.Status = status
+	}
+	if tags := c.QueryParam("tag"); tags != "" {
+		query.Tags = strings.Split(tags, ",")
+	}
+	query.Category = c.QueryParam("category")
+
+	return query, nil
+}
+
+// bindCommentQuery reads the comment listing's filters, sort and page from the query string
+func bindCommentQuery(c echo.Context, filters []string) (model.CommentQuery, error) {
+	var query model.CommentQuery
+
+	if err := checkParams(c, pageParams, filters); err != nil {
+		return query, err
+	}
+
+	var err error
+	if query.Page, err = bindPage(c); err != nil {
+		return query, err
+	}
+	if query.Sort, err = bindSort(c, commentSorts); err != nil {
+		return query, err
+	}
+	if query.AuthorId, err = bindID(c, "author"); err != nil {
+		return query, err
+	}
+	if query.PostId, err = bindID(c, "post"); err != nil {
+		return query, err
+	}
+	if query.CreatedAfter, err = bindTime(c, "created_after"); err != nil {
+		return query, err
+	}
+	if query.CreatedBefore, err = bindTime(c, "created_before"); err != nil {
+		return query, err
+	}
+
+	if status := model.CommentStatus(c.QueryParam("status")); status != "" {
+		if !status.Valid() {
+			return query, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown status %q", status))
+		}
+		query.Status = status
+	}
+
+	return query, nil
+}
+
+// checkParams rejects query parameters the endpoint doesn't know about
+func checkParams(c echo.Context, allowed ...[]string) error {
+	for name := range c.QueryParams() {
+		known := false
+		for _, params := range allowed {
+			known = known || contains(params, name)
+		}
+		if !known {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown query parameter %q", name))
+		}
+	}
+
+	return nil
+}
+
+// bindSort parses a comma separated sort, e.g. -created_at,title. A leading
+// minus sorts the field descending.
+func bindSort(c echo.Context, fields []string) ([]model.SortField, error) {
+	value := c.QueryParam("sort")
+	if value == "" {
+		return nil, nil
+	}
+
+	var sort []model.SortField
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		field := model.SortField{Field: strings.TrimSpace(name)}
+		if strings.HasPrefix(field.Field, "-") {
+			field.Field, field.Desc = field.Field[1:], true
+		}
+
+		if !contains(fields, field.Field) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("can't sort by %q", field.Field))
+		}
+		if seen[field.Field] {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%q is sorted twice", field.Field))
+		}
+		seen[field.Field] = true
+
+		sort = append(sort, field)
+	}
+
+	return sort, nil
+}
+
+// bindID parses an optional id filter
+func bindID(c echo.Context, name string) (uint, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || id == 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be an id", name))
+	}
+
+	return uint(id), nil
+}
+
+// bindTime parses an optional RFC 3339 timestamp or a plain date in UTC
+func bindTime(c echo.Context, name string) (*time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+
+	return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a date or an RFC 3339 timestamp", name))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
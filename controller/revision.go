@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"net/http"
+	"strconv"
+)
+
+// GetRevisions godoc
+//
+//	@Summary		Get Post Revisions
+//	@Security		ApiKeyAuth
+//	@Tags			Post
+//	@Description	list the revisions of a post, newest first. Only its author and editors may.
+//	@ID				get-Post-revisions
+//	@Produce		json
+//	@Param			id	path		int	true	"post id"
+//	@Success		200	{array}		model.PostRevision
+//	@Router			/api/v1/posts/{id}/revisions [get]
+func (h *PostController) GetRevisions(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	postId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
+	}
+
+	revisions, err := h.services.PostService.GetRevisions(uint(postId), actor)
+	if err != nil {
+		return revisionError(err)
+	}
+
+	return c.JSON(http.StatusOK, revisions)
+}
+
+// GetRevision godoc
+//
+//	@Summary		Get Post Revision
+//	@Security		ApiKeyAuth
+//	@Tags			Post
+//	@Description	get one revision of a post by its number
+//	@ID				get-Post-revision
+//	@Produce		json
+//	@Param			id		path		int	true	"post id"
+//	@Param			number	path		int	true	"revision number"
+//	@Success		200		{object}	model.PostRevision
+//	@Router			/api/v1/posts/{id}/revisions/{number} [get]
+func (h *PostController) GetRevision(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	postId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
+	}
+
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "revision number is incorrect"))
+	}
+
+	revision, err := h.services.PostService.GetRevision(uint(postId), number, actor)
+	if err != nil {
+		return revisionError(err)
+	}
+
+	return c.JSON(http.StatusOK, revision)
+}
+
+// DiffRevisions godoc
+//
+//	@Summary		Diff Post Revisions
+//	@Security		ApiKeyAuth
+//	@Tags			Post
+//	@Description	get a unified diff from one revision of a post to another, the title is its first line
+//	@ID				diff-Post-revisions
+//	@Produce		json
+//	@Param			id		path		int	true	"post id"
+//	@Param			from	query		int	true	"revision number to diff from"
+//	@Param			to		query		int	true	"revision number to diff to"
+//	@Success		200		{object}	model.RevisionDiff
+//	@Router			/api/v1/posts/{id}/revisions/diff [get]
+func (h *PostController) DiffRevisions(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	postId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
+	}
+
+	from, err := strconv.Atoi(c.QueryParam("from"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "from must be a revision number")
+	}
+	to, err := strconv.Atoi(c.QueryParam("to"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "to must be a revision number")
+	}
+
+	diff, err := h.services.PostService.DiffRevisions(uint(postId), from, to, actor)
+	if err != nil {
+		return revisionError(err)
+	}
+
+	return c.JSON(http.StatusOK, diff)
+}
+
+// RestoreRevision godoc
+//
+//	@Summary		Restore Post Revision
+//	@Security		ApiKeyAuth
+//	@Tags			Post
+//	@Description	bring back the title and body of a revision, they are saved as a new revision
+//	@ID				restore-Post-revision
+//	@Produce		json
+//	@Param			id		path		int	true	"post id"
+//	@Param			number	path		int	true	"revision number"
+//	@Success		200		{object}	model.Post
+//	@Router			/api/v1/posts/{id}/revisions/{number}/restore [post]
+func (h *PostController) RestoreRevision(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	postId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
+	}
+
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "revision number is incorrect"))
+	}
+
+	post, err := h.services.PostService.RestoreRevision(uint(postId), number, actor)
+	if err != nil {
+		return revisionError(err)
+	}
+
+	return c.JSON(http.StatusOK, post)
+}
+
+// revisionError maps service errors of the revision endpoints to HTTP errors
+func revisionError(err error) error {
+	switch {
+	case errors.Cause(err) == types.ErrNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	case errors.Cause(err) == types.ErrForbidden:
+		return echo.NewHTTPError(http.StatusForbidden, err)
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+}
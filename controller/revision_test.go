@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	mock_repository "github.com/slavik22/blogRestApi/repository/mock"
+	"github.com/slavik22/blogRestApi/service"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostRevisionsAPI(t *testing.T) {
+	author, _ := randomUser(t)
+	post := randomPost(t, author.ID)
+
+	revisions := []model.PostRevision{
+		{ID: 2, PostId: post.ID, Number: 2, UserId: author.ID, Title: "Caching", Body: "Use a cache.\nKeep it warm.\n"},
+		{ID: 1, PostId: post.ID, Number: 1, UserId: author.ID, Title: "Caching", Body: "Use a cache.\nKeep it cold.\n"},
+	}
+
+	testCases := []struct {
+		name          string
+		userId        uint
+		role          model.Role
+		path          string
+		params        []string
+		action        func(h *PostController) echo.HandlerFunc
+		buildStubs    func(posts *mock_repository.MockPostRepo, revs *mock_repository.MockPostRevisionRepo)
+		checkResponse func(recorder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name:   "List",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			path:   "/api/v1/posts/1/revisions",
+			action: func(h *PostController) echo.HandlerFunc { return h.GetRevisions },
+			buildStubs: func(posts *mock_repository.MockPostRepo, revs *mock_repository.MockPostRevisionRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				revs.EXPECT().GetRevisions(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(revisions, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+
+				var got []model.PostRevision
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Len(t, got, 2)
+				require.Equal(t, 2, got[0].Number)
+			},
+		},
+		{
+			name:   "ListOthers",
+			userId: author.ID + 1,
+			role:   model.RoleAuthor,
+			path:   "/api/v1/posts/1/revisions",
+			action: func(h *PostController) echo.HandlerFunc { return h.GetRevisions },
+			buildStubs: func(posts *mock_repository.MockPostRepo, revs *mock_repository.MockPostRevisionRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				revs.EXPECT().GetRevisions(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
+		{
+			name:   "ListAsEditor",
+			userId: author.ID + 1,
+			role:   model.RoleModerator,
+			path:   "/api/v1/posts/1/revisions",
+			action: func(h *PostController) echo.HandlerFunc { return h.GetRevisions },
+			buildStubs: func(posts *mock_repository.MockPostRepo, revs *mock_repository.MockPostRevisionRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				revs.EXPECT().GetRevisions(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(revisions, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "Get",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			path:   "/api/v1/posts/1/revisions/1",
+			params: []string{"number", "1"},
+			action: func(h *PostController) echo.HandlerFunc { return h.GetRevision },
+			buildStubs: func(posts *mock_repository.MockPostRepo, revs *mock_repository.MockPostRevisionRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				revs.EXPECT().GetRevision(gomock.Any(), gomock.Eq(post.ID), gomock.Eq(1)).Times(1).Return(&revisions[1], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+
+				var got model.PostRevision
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Equal(t, revisions[1].Body, got.Body)
+			},
+		},
+		{
+			name:   "Diff",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			path:   "/api/v1/posts/1/revisions/diff?from=1&to=2",
+			action: func(h *PostController) echo.HandlerFunc { return h.DiffRevisions },
+			buildStubs: func(posts *mock_repository.MockPostRepo, revs *mock_repository.MockPostRevisionRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				revs.EXPECT().GetRevision(gomock.Any(), gomock.Eq(post.ID), gomock.Eq(1)).Times(1).Return(&revisions[1], nil)
+				revs.EXPECT().GetRevision(gomock.Any(), gomock.Eq(post.ID), gomock.Eq(2)).Times(1).Return(&revisions[0], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+
+				var got model.RevisionDiff
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Equal(t, 1, got.From)
+				require.Equal(t, 2, got.To)
+				require.Equal(t, "--- revision 1\n+++ revision 2\n@@ -1,4 +1,4 @@\n Caching\n \n Use a cache.\n-Keep it cold.\n+Keep it warm.\n", got.Diff)
+			},
+		},
+		{
+			name:   "DiffUnknownRevision",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			path:   "/api/v1/posts/1/revisions/diff?from=1&to=9",
+			action: func(h *PostController) echo.HandlerFunc { return h.DiffRevisions },
+			buildStubs: func(posts *mock_repository.MockPostRepo, revs *mock_repository.MockPostRevisionRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				revs.EXPECT().GetRevision(gomock.Any(), gomock.Eq(post.ID), gomock.Eq(1)).Times(1).Return(&revisions[1], nil)
+				revs.EXPECT().GetRevision(gomock.Any(), gomock.Eq(post.ID), gomock.Eq(9)).Times(1).Return(nil, types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name:   "DiffMissingParameter",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			path:   "/api/v1/posts/1/revisions/diff?from=1",
+			action: func(h *PostController) echo.HandlerFunc { return h.DiffRevisions },
+			buildStubs: func(posts *mock_repository.MockPostRepo, revs *mock_repository.MockPostRevisionRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Restore",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			path:   "/api/v1/posts/1/revisions/1/restore",
+			params: []string{"number", "1"},
+			action: func(h *PostController) echo.HandlerFunc { return h.RestoreRevision },
+			buildStubs: func(posts *mock_repository.MockPostRepo, revs *mock_repository.MockPostRevisionRepo) {
+				existing := post
+				existing.Tags = []model.Tag{{ID: 1, Name: "Go", Slug: "go"}}
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&existing, nil)
+				revs.EXPECT().GetRevision(gomock.Any(), gomock.Eq(post.ID), gomock.Eq(1)).Times(1).Return(&revisions[1], nil)
+				posts.EXPECT().UpdatePost(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, updated *model.Post, revision model.PostRevision) (*model.Post, error) {
+						require.Equal(t, revisions[1].Body, updated.Body)
+						require.Nil(t, updated.Tags)
+						require.Equal(t, author.ID, revision.UserId)
+						require.Equal(t, 1, *revision.RestoredFrom)
+						return updated, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+
+				got := requireBodyPost(t, recorder.Body)
+				require.Equal(t, revisions[1].Body, got.Body)
+				require.Len(t, got.Tags, 1)
+			},
+		},
+		{
+			name:   "RestoreAsEditor",
+			userId: author.ID + 1,
+			role:   model.RoleModerator,
+			path:   "/api/v1/posts/1/revisions/1/restore",
+			params: []string{"number", "1"},
+			action: func(h *PostController) echo.HandlerFunc { return h.RestoreRevision },
+			buildStubs: func(posts *mock_repository.MockPostRepo, revs *mock_repository.MockPostRevisionRepo) {
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				posts.EXPECT().UpdatePost(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			revisionRepo := mock_repository.NewMockPostRevisionRepo(ctrl)
+
+			tc.buildStubs(postRepo, revisionRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Revision = revisionRepo
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, tc.path, nil), rec)
+			c.Set("userId", tc.userId)
+			c.Set("role", tc.role)
+			c.SetParamNames(append([]string{"id"}, tc.params[:len(tc.params)/2]...)...)
+			c.SetParamValues(append([]string{"1"}, tc.params[len(tc.params)/2:]...)...)
+
+			err = tc.action(NewUPostController(context.Background(), serviceManager))(c)
+
+			tc.checkResponse(rec, err)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/service"
+	"net/http"
+)
+
+// searchParams are the query parameters the search accepts
+var searchParams = []string{"q", "type", "limit", "page", "per_page"}
+
+type SearchController struct {
+	ctx      context.Context
+	services *service.Manager
+}
+
+func NewSearchController(ctx context.Context, services *service.Manager) *SearchController {
+	return &SearchController{
+		ctx:      ctx,
+		services: services,
+	}
+}
+
+// Search godoc
+//
+//	@Summary		Search
+//	@Security		ApiKeyAuth
+//	@Tags			Search
+//	@Description	full-text search over posts and comments, best match first
+//	@Description	title and snippet are HTML escaped with the matches wrapped in <mark>
+//	@ID				search
+//	@Produce		json
+//	@Param			q			query		string	true	"search text"
+//	@Param			type		query		string	false	"post or comment, both when empty"
+//	@Param			page		query		int		false	"page number"
+//	@Param			per_page	query		int		false	"page size"
+//	@Success		200			{object}	model.Page[model.SearchHit]
+//	@Router			/api/v1/search [get]
+func (h *SearchController) Search(c echo.Context) error {
+	if err := checkParams(c, searchParams); err != nil {
+		return err
+	}
+
+	page, err := bindPage(c)
+	if err != nil {
+		return err
+	}
+
+	query := model.SearchQuery{
+		Text: c.QueryParam("q"),
+		Kind: model.SearchKind(c.QueryParam("type")),
+		Page: page,
+	}
+	if query.Kind != "" && query.Kind != model.SearchPost && query.Kind != model.SearchComment {
+		return echo.NewHTTPError(http.StatusBadRequest, "type must be post or comment")
+	}
+
+	hits, err := h.services.SearchService.Search(query)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	setPageLinks(c, hits)
+	return c.JSON(http.StatusOK, hits)
+}
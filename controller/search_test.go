@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/slavik22/blogRestApi/lib/validator"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	mock_repository "github.com/slavik22/blogRestApi/repository/mock"
+	"github.com/slavik22/blogRestApi/service"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+	index := repository.NewSearchMemoryIndex()
+	store.Search = index
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+
+	searchController := NewSearchController(context.Background(), serviceManager)
+	e := echo.New()
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	require.NoError(t, index.IndexPost(ctx, &model.Post{ID: 1, UserId: 1, CreatedAt: created,
+		Title: "Generics in Go", Body: "Type parameters <finally> landed. Generics make containers reusable."}))
+	require.NoError(t, index.IndexPost(ctx, &model.Post{ID: 2, UserId: 2, CreatedAt: created.Add(time.Hour),
+		Title: "Error handling", Body: "Wrapping errors is not about generics at all."}))
+	require.NoError(t, index.IndexPost(ctx, &model.Post{ID: 3, UserId: 2, CreatedAt: created,
+		Title: "Gardening", Body: "Tomatoes need sun."}))
+	require.NoError(t, index.IndexComment(ctx, &model.Comment{ID: 1, PostId: 1, UserId: 2, CreatedAt: created.Add(2 * time.Hour),
+		Title: "Nice", Body: "I was waiting for generics for years, generics everywhere now."}))
+
+	search := func(query string) (*httptest.ResponseRecorder, model.Page[model.SearchHit], error) {
+		rec := httptest.NewRecorder()
+		err := searchController.Search(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/search?"+query, nil), rec))
+
+		var page model.Page[model.SearchHit]
+		if err == nil {
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		}
+		return rec, page, err
+	}
+
+	// Title matches rank first, the unrelated post isn't found
+	_, page, err := search("q=Generics")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), page.Total)
+	require.Len(t, page.Data, 3)
+	require.Equal(t, model.SearchPost, page.Data[0].Kind)
+	require.Equal(t, uint(1), page.Data[0].ID)
+	require.Equal(t, "<mark>Generics</mark> in Go", page.Data[0].Title)
+	require.Equal(t, "Type parameters &lt;finally&gt; landed. <mark>Generics</mark> make containers reusable.", page.Data[0].Snippet)
+	require.Greater(t, page.Data[0].Score, page.Data[1].Score)
+	for _, hit := range page.Data {
+		require.NotEqual(t, uint(3), hit.PostId)
+	}
+
+	// Only comments
+	_, page, err = search("q=generics&type=comment")
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	require.Equal(t, model.SearchComment, page.Data[0].Kind)
+	require.Equal(t, uint(1), page.Data[0].PostId)
+
+	// Paged by number
+	rec, page, err := search("q=generics&per_page=1&page=2")
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	require.Equal(t, 3, page.TotalPages)
+	require.Contains(t, rec.Header().Get("Link"), `<http://example.com/api/v1/search?page=3&per_page=1&q=generics>; rel="next"`)
+
+	// Past the last page, and too deep to page by number
+	_, page, err = search("q=generics&per_page=100&page=1000000")
+	require.NoError(t, err)
+	require.Empty(t, page.Data)
+	require.Equal(t, int64(3), page.Total)
+
+	hits, total, err := index.Search(ctx, model.SearchQuery{Text: "generics", Page: model.PageRequest{Page: math.MaxInt, Limit: 100}})
+	require.NoError(t, err)
+	require.Empty(t, hits)
+	require.Equal(t, int64(3), total)
+
+	_, _, err = search("q=generics&page=100000000000000000")
+	requireHTTPError(t, err, http.StatusBadRequest)
+
+	// Nothing matches
+	_, page, err = search("q=kubernetes")
+	require.NoError(t, err)
+	require.Empty(t, page.Data)
+	require.Zero(t, page.Total)
+
+	for _, query := range []string{"", "q=+", "q=go&type=user", "q=go&sort=title", "q=go&cursor=abc"} {
+		_, _, err = search(query)
+		requireHTTPError(t, err, http.StatusBadRequest)
+	}
+}
+
+func TestSearchIndexSync(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+	store.Search = repository.NewSearchMemoryIndex()
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+
+	postController := NewUPostController(context.Background(), serviceManager)
+	searchController := NewSearchController(context.Background(), serviceManager)
+	e := echo.New()
+	e.Validator = validator.NewValidator()
+
+	var stored model.Post
+	postRepo.EXPECT().CreatePost(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, post *model.Post) (uint, error) {
+			post.ID = 7
+			post.CreatedAt = time.Now()
+			stored = *post
+			return post.ID, nil
+		})
+	postRepo.EXPECT().GetPost(gomock.Any(), gomock.Eq(uint(7))).
+		AnyTimes().
+		DoAndReturn(func(context.Context, uint) (*model.Post, error) {
+			post := stored
+			return &post, nil
+		})
+	postRepo.EXPECT().SetPostStatus(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(2).
+		DoAndReturn(func(_ context.Context, post *model.Post, from model.PostStatus) error {
+			require.Equal(t, stored.Status, from)
+			stored.Status, stored.PublishedAt = post.Status, post.PublishedAt
+			return nil
+		})
+	postRepo.EXPECT().UpdatePost(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, post *model.Post, _ model.PostRevision) (*model.Post, error) {
+			stored = *post
+			return post, nil
+		})
+	postRepo.EXPECT().DeletePost(gomock.Any(), gomock.Eq(uint(7))).
+		Times(1).
+		Return(nil)
+
+	call := func(role model.Role, method string, body string, handler echo.HandlerFunc) {
+		req := httptest.NewRequest(method, "/api/v1/posts/7", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set("userId", uint(3))
+		c.Set("role", role)
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(7))
+		require.NoError(t, handler(c))
+	}
+	found := func(text string) bool {
+		rec := httptest.NewRecorder()
+		err := searchController.Search(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/search?q="+text, nil), rec))
+		require.NoError(t, err)
+
+		var page model.Page[model.SearchHit]
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		return len(page.Data) == 1 && page.Data[0].ID == 7
+	}
+
+	call(model.RoleAuthor, http.MethodPost, `{"title":"Hello","body":"first draft about caching"}`, postController.CreatePost)
+	require.False(t, found("caching"))
+
+	call(model.RoleAuthor, http.MethodPost, "", postController.SubmitPost)
+	require.False(t, found("caching"))
+
+	call(model.RoleModerator, http.MethodPost, "", postController.PublishPost)
+	require.True(t, found("caching"))
+
+	call(model.RoleAuthor, http.MethodPut, `{"title":"Hello","body":"second draft about sharding"}`, postController.UpdatePost)
+	require.False(t, found("caching"))
+	require.True(t, found("sharding"))
+
+	call(model.RoleAuthor, http.MethodDelete, "", postController.DeletePost)
+	require.False(t, found("sharding"))
+	require.False(t, found("hello"))
+}
@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/service"
+	"net/http"
+)
+
+type TaxonomyController struct {
+	ctx      context.Context
+	services *service.Manager
+}
+
+func NewTaxonomyController(ctx context.Context, services *service.Manager) *TaxonomyController {
+	return &TaxonomyController{
+		ctx:      ctx,
+		services: services,
+	}
+}
+
+type renameTagInput struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type mergeTagInput struct {
+	Into string `json:"into" validate:"required"`
+}
+
+type createCategoryInput struct {
+	Name     string `json:"name" validate:"required"`
+	ParentId *uint  `json:"parentId"`
+}
+
+// taxonomyError maps the errors of the taxonomy service to HTTP errors
+func taxonomyError(err error) error {
+	switch {
+	case errors.Cause(err) == types.ErrBadRequest:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Cause(err) == types.ErrNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, "not found")
+	case errors.Cause(err) == types.ErrConflict:
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+}
+
+// GetTags godoc
+//
+//	@Summary		Get Tags
+//	@Security		ApiKeyAuth
+//	@Tags			Tags
+//	@Description	get all tags with the number of posts using them, most used first
+//	@ID				get-tags
+//	@Produce		json
+//	@Success		200	{object}	[]model.TagCount
+//	@Router			/api/v1/tags [get]
+func (h *TaxonomyController) GetTags(c echo.Context) error {
+	tags, err := h.services.TaxonomyService.GetTags()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, tags)
+}
+
+// GetTagPosts godoc
+//
+//	@Summary		Get Tag Posts
+//	@Security		ApiKeyAuth
+//	@Tags			Tags
+//	@Description	get the posts with a tag, takes the same parameters as the post listing
+//	@ID				get-tag-posts
+//	@Produce		json
+//	@Param			slug	path		string	true	"tag slug"
+//	@Success		200		{object}	model.Page[model.Post]
+//	@Router			/api/v1/tags/{slug}/posts [get]
+func (h *TaxonomyController) GetTagPosts(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	tag, err := h.services.TaxonomyService.GetTag(c.Param("slug"))
+	if err != nil {
+		return taxonomyError(err)
+	}
+
+	query, err := bindPostQuery(c)
+	if err != nil {
+		return err
+	}
+	query.Tags = append(query.Tags, tag.Slug)
+
+	posts, err := h.services.PostService.GetPosts(query, actor)
+	if err != nil {
+		return taxonomyError(err)
+	}
+
+	setPageLinks(c, posts)
+	return c.JSON(http.StatusOK, posts)
+}
+
+// RenameTag godoc
+//
+//	@Summary		Rename Tag
+//	@Security		ApiKeyAuth
+//	@Tags			Tags
+//	@Description	rename a tag, its slug follows the name. Renaming onto an existing tag is a conflict, merge instead.
+//	@ID				rename-tag
+//	@Accept			json
+//	@Produce		json
+//	@Param			slug	path		string	true	"tag slug"
+//	@Success		200		{object}	model.Tag
+//	@Router			/api/v1/admin/tags/{slug} [put]
+func (h *TaxonomyController) RenameTag(c echo.Context) error {
+	var input renameTagInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	tag, err := h.services.TaxonomyService.RenameTag(c.Param("slug"), input.Name)
+	if err != nil {
+		return taxonomyError(err)
+	}
+
+	return c.JSON(http.StatusOK, tag)
+}
+
+// MergeTag godoc
+//
+//	@Summary		Merge Tag
+//	@Security		ApiKeyAuth
+//	@Tags			Tags
+//	@Description	move the posts of a tag to another tag and delete it
+//	@ID				merge-tag
+//	@Accept			json
+//	@Produce		json
+//	@Param			slug	path		string	true	"slug of the tag to merge away"
+//	@Success		200		{object}	model.Tag
+//	@Router			/api/v1/admin/tags/{slug}/merge [post]
+func (h *TaxonomyController) MergeTag(c echo.Context) error {
+	var input mergeTagInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	tag, err := h.services.TaxonomyService.MergeTags(c.Param("slug"), input.Into)
+	if err != nil {
+		return taxonomyError(err)
+	}
+
+	return c.JSON(http.StatusOK, tag)
+}
+
+// GetCategories godoc
+//
+//	@Summary		Get Categories
+//	@Security		ApiKeyAuth
+//	@Tags			Categories
+//	@Description	get the category tree
+//	@ID				get-categories
+//	@Produce		json
+//	@Success		200	{object}	[]model.Category
+//	@Router			/api/v1/categories [get]
+func (h *TaxonomyController) GetCategories(c echo.Context) error {
+	categories, err := h.services.TaxonomyService.GetCategories()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, categories)
+}
+
+// CreateCategory godoc
+//
+//	@Summary		Create Category
+//	@Security		ApiKeyAuth
+//	@Tags			Categories
+//	@Description	create a category, optionally below a parent category
+//	@ID				create-category
+//	@Accept			json
+//	@Produce		json
+//	@Success		201	{object}	model.Category
+//	@Router			/api/v1/admin/categories [post]
+func (h *TaxonomyController) CreateCategory(c echo.Context) error {
+	var input createCategoryInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	category, err := h.services.TaxonomyService.CreateCategory(model.Category{Name: input.Name, ParentId: input.ParentId})
+	if err != nil {
+		return taxonomyError(err)
+	}
+
+	return c.JSON(http.StatusCreated, category)
+}
+
+// DeleteCategory godoc
+//
+//	@Summary		Delete Category
+//	@Security		ApiKeyAuth
+//	@Tags			Categories
+//	@Description	delete a category without subcategories, its posts become uncategorised
+//	@ID				delete-category
+//	@Param			slug	path	string	true	"category slug"
+//	@Success		204
+//	@Router			/api/v1/admin/categories/{slug} [delete]
+func (h *TaxonomyController) DeleteCategory(c echo.Context) error {
+	if err := h.services.TaxonomyService.DeleteCategory(c.Param("slug")); err != nil {
+		return taxonomyError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
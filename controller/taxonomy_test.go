@@ -0,0 +1,448 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/lib/validator"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	mock_repository "github.com/slavik22/blogRestApi/repository/mock"
+	"github.com/slavik22/blogRestApi/service"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func categoryTree() []model.Category {
+	lang, web := uint(1), uint(3)
+	return []model.Category{
+		{ID: 1, Name: "Languages", Slug: "languages"},
+		{ID: 2, Name: "Go", Slug: "go", ParentId: &lang},
+		{ID: 3, Name: "Web", Slug: "web", ParentId: &lang},
+		{ID: 4, Name: "Frameworks", Slug: "frameworks", ParentId: &web},
+		{ID: 5, Name: "Life", Slug: "life"},
+	}
+}
+
+func TestPostTagsAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	post := randomPost(t, user.ID)
+	post.Tags = []model.Tag{{ID: 1, Name: "Go", Slug: "go"}}
+
+	testCases := []struct {
+		name          string
+		method        string
+		body          string
+		buildStubs    func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo)
+		checkResponse func(recorder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name:   "CreateWithTags",
+			method: http.MethodPost,
+			body:   `{"title":"t","body":"b","tags":["Go"," go ","Web Dev"],"categoryId":2}`,
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				tags.EXPECT().SaveTags(gomock.Any(), gomock.Eq([]model.Tag{{Name: "Go", Slug: "go"}, {Name: "Web Dev", Slug: "web-dev"}})).
+					Times(1).
+					Return([]model.Tag{{ID: 1, Name: "Go", Slug: "go"}, {ID: 2, Name: "web dev", Slug: "web-dev"}}, nil)
+				categories.EXPECT().GetCategories(gomock.Any()).
+					Times(1).
+					Return(categoryTree(), nil)
+				posts.EXPECT().CreatePost(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, created *model.Post) (uint, error) {
+						require.Len(t, created.Tags, 2)
+						require.Equal(t, uint(2), created.Tags[1].ID)
+						require.Equal(t, uint(2), *created.CategoryId)
+						return post.ID, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:   "TooManyTags",
+			method: http.MethodPost,
+			body:   `{"title":"t","body":"b","tags":["a","b","c","d","e","f","g","h","i","j","k"]}`,
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				tags.EXPECT().SaveTags(gomock.Any(), gomock.Any()).Times(0)
+				posts.EXPECT().CreatePost(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "InvalidTag",
+			method: http.MethodPost,
+			body:   `{"title":"t","body":"b","tags":["!!!"]}`,
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				tags.EXPECT().SaveTags(gomock.Any(), gomock.Any()).Times(0)
+				posts.EXPECT().CreatePost(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "UnknownCategory",
+			method: http.MethodPost,
+			body:   `{"title":"t","body":"b","categoryId":42}`,
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				tags.EXPECT().SaveTags(gomock.Any(), gomock.Any()).Times(1).Return([]model.Tag{}, nil)
+				categories.EXPECT().GetCategories(gomock.Any()).
+					Times(1).
+					Return(categoryTree(), nil)
+				posts.EXPECT().CreatePost(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "UpdateKeepsTags",
+			method: http.MethodPut,
+			body:   `{"title":"new","body":"b"}`,
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				existing := post
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&existing, nil)
+				tags.EXPECT().SaveTags(gomock.Any(), gomock.Any()).Times(0)
+				posts.EXPECT().UpdatePost(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, updated *model.Post, _ model.PostRevision) (*model.Post, error) {
+						require.Nil(t, updated.Tags)
+						return updated, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+
+				var updated model.Post
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &updated))
+				require.Equal(t, "new", updated.Title)
+				require.Equal(t, post.Tags, updated.Tags)
+			},
+		},
+		{
+			name:   "UpdateClearsTagsAndCategory",
+			method: http.MethodPut,
+			body:   `{"title":"new","body":"b","tags":[],"categoryId":0}`,
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				existing := post
+				category := uint(2)
+				existing.CategoryId = &category
+				posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&existing, nil)
+				tags.EXPECT().SaveTags(gomock.Any(), gomock.Len(0)).Times(1).Return([]model.Tag{}, nil)
+				posts.EXPECT().UpdatePost(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, updated *model.Post, _ model.PostRevision) (*model.Post, error) {
+						require.NotNil(t, updated.Tags)
+						require.Empty(t, updated.Tags)
+						require.Nil(t, updated.CategoryId)
+						return updated, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			tagRepo := mock_repository.NewMockTagRepo(ctrl)
+			categoryRepo := mock_repository.NewMockCategoryRepo(ctrl)
+
+			tc.buildStubs(postRepo, tagRepo, categoryRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Tag = tagRepo
+			store.Category = categoryRepo
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			e := echo.New()
+			e.Validator = validator.NewValidator()
+
+			req := httptest.NewRequest(tc.method, "/api/v1/posts", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.Set("userId", user.ID)
+			c.Set("role", model.RoleAuthor)
+
+			postController := NewUPostController(context.Background(), serviceManager)
+			if tc.method == http.MethodPost {
+				err = postController.CreatePost(c)
+			} else {
+				c.SetParamNames("id")
+				c.SetParamValues("1")
+				err = postController.UpdatePost(c)
+			}
+
+			tc.checkResponse(rec, err)
+		})
+	}
+}
+
+func TestTaxonomyFilterAPI(t *testing.T) {
+	testCases := []struct {
+		name          string
+		path          string
+		tag           string
+		buildStubs    func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo)
+		checkResponse func(recorder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name: "Tags",
+			path: "/api/v1/posts?tag=Go,web-dev,go",
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				query := model.PostQuery{ViewerId: 3, Tags: []string{"go", "web-dev"}}
+				posts.EXPECT().CountPosts(gomock.Any(), gomock.Eq(query)).Times(1).Return(int64(0), nil)
+				query.Page = model.PageRequest{Limit: 21}
+				posts.EXPECT().GetPosts(gomock.Any(), gomock.Eq(query)).Times(1).Return(nil, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "CategorySubtree",
+			path: "/api/v1/posts?category=languages",
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				categories.EXPECT().GetCategories(gomock.Any()).Times(1).Return(categoryTree(), nil)
+				posts.EXPECT().CountPosts(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, query model.PostQuery) (int64, error) {
+						require.ElementsMatch(t, []uint{1, 2, 3, 4}, query.CategoryIds)
+						return 0, nil
+					})
+				posts.EXPECT().GetPosts(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "UnknownCategory",
+			path: "/api/v1/posts?category=cooking",
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				categories.EXPECT().GetCategories(gomock.Any()).Times(1).Return(categoryTree(), nil)
+				posts.EXPECT().GetPosts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+
+				var page model.Page[model.Post]
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+				require.Empty(t, page.Data)
+				require.Zero(t, page.Total)
+			},
+		},
+		{
+			name: "TagPosts",
+			path: "/api/v1/tags/go/posts?sort=title",
+			tag:  "go",
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				tags.EXPECT().GetTag(gomock.Any(), gomock.Eq("go")).Times(1).Return(&model.Tag{ID: 1, Name: "Go", Slug: "go"}, nil)
+				posts.EXPECT().CountPosts(gomock.Any(), gomock.Any()).Times(1).Return(int64(0), nil)
+				posts.EXPECT().GetPosts(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, query model.PostQuery) ([]model.Post, error) {
+						require.Equal(t, []string{"go"}, query.Tags)
+						require.Equal(t, []model.SortField{{Field: "title"}}, query.Sort)
+						return nil, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "UnknownTagPosts",
+			path: "/api/v1/tags/cobol/posts",
+			tag:  "cobol",
+			buildStubs: func(posts *mock_repository.MockPostRepo, tags *mock_repository.MockTagRepo, categories *mock_repository.MockCategoryRepo) {
+				tags.EXPECT().GetTag(gomock.Any(), gomock.Eq("cobol")).Times(1).Return(nil, types.ErrNotFound)
+				posts.EXPECT().GetPosts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			tagRepo := mock_repository.NewMockTagRepo(ctrl)
+			categoryRepo := mock_repository.NewMockCategoryRepo(ctrl)
+
+			tc.buildStubs(postRepo, tagRepo, categoryRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Tag = tagRepo
+			store.Category = categoryRepo
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, tc.path, nil), rec)
+			c.Set("userId", uint(3))
+			c.Set("role", model.RoleReader)
+
+			if tc.tag != "" {
+				c.SetParamNames("slug")
+				c.SetParamValues(tc.tag)
+				err = NewTaxonomyController(context.Background(), serviceManager).GetTagPosts(c)
+			} else {
+				err = NewUPostController(context.Background(), serviceManager).GetAllPosts(c)
+			}
+
+			tc.checkResponse(rec, err)
+		})
+	}
+}
+
+func TestTaxonomyAdminAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+	tagRepo := mock_repository.NewMockTagRepo(ctrl)
+	categoryRepo := mock_repository.NewMockCategoryRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+	store.Tag = tagRepo
+	store.Category = categoryRepo
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+
+	taxonomyController := NewTaxonomyController(context.Background(), serviceManager)
+	e := echo.New()
+	e.Validator = validator.NewValidator()
+
+	call := func(handler echo.HandlerFunc, method, body string, slug string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if slug != "" {
+			c.SetParamNames("slug")
+			c.SetParamValues(slug)
+		}
+		return rec, handler(c)
+	}
+
+	golang := model.Tag{ID: 1, Name: "golang", Slug: "golang"}
+	goTag := model.Tag{ID: 2, Name: "Go", Slug: "go"}
+
+	// Usage counts
+	tagRepo.EXPECT().GetTags(gomock.Any()).
+		Times(1).
+		Return([]model.TagCount{{ID: 2, Name: "Go", Slug: "go", Posts: 12}, {ID: 1, Name: "golang", Slug: "golang", Posts: 1}}, nil)
+	rec, err := call(taxonomyController.GetTags, http.MethodGet, "", "")
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"id":2,"name":"Go","slug":"go","posts":12},{"id":1,"name":"golang","slug":"golang","posts":1}]`, rec.Body.String())
+
+	// Renaming onto an existing slug is a conflict
+	tagRepo.EXPECT().GetTag(gomock.Any(), gomock.Eq("golang")).Times(1).Return(&golang, nil)
+	tagRepo.EXPECT().GetTag(gomock.Any(), gomock.Eq("go")).Times(1).Return(&goTag, nil)
+	_, err = call(taxonomyController.RenameTag, http.MethodPut, `{"name":"Go"}`, "golang")
+	requireHTTPError(t, err, http.StatusConflict)
+
+	// A plain rename follows the name with the slug
+	renamed := golang
+	tagRepo.EXPECT().GetTag(gomock.Any(), gomock.Eq("golang")).Times(1).Return(&renamed, nil)
+	tagRepo.EXPECT().GetTag(gomock.Any(), gomock.Eq("go-lang")).Times(1).Return(nil, types.ErrNotFound)
+	tagRepo.EXPECT().UpdateTag(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, tag *model.Tag) error {
+			require.Equal(t, "go-lang", tag.Slug)
+			return nil
+		})
+	rec, err = call(taxonomyController.RenameTag, http.MethodPut, `{"name":"Go Lang"}`, "golang")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id":1,"name":"Go Lang","slug":"go-lang"}`, rec.Body.String())
+
+	// Merge moves the posts over
+	tagRepo.EXPECT().GetTag(gomock.Any(), gomock.Eq("golang")).Times(1).Return(&golang, nil)
+	tagRepo.EXPECT().GetTag(gomock.Any(), gomock.Eq("go")).Times(1).Return(&goTag, nil)
+	tagRepo.EXPECT().MergeTags(gomock.Any(), gomock.Eq(golang.ID), gomock.Eq(goTag.ID)).Times(1).Return(nil)
+	rec, err = call(taxonomyController.MergeTag, http.MethodPost, `{"into":"go"}`, "golang")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	tagRepo.EXPECT().GetTag(gomock.Any(), gomock.Eq("go")).Times(2).Return(&goTag, nil)
+	_, err = call(taxonomyController.MergeTag, http.MethodPost, `{"into":"go"}`, "go")
+	requireHTTPError(t, err, http.StatusBadRequest)
+
+	// Categories come back as a tree
+	categoryRepo.EXPECT().GetCategories(gomock.Any()).AnyTimes().Return(categoryTree(), nil)
+	rec, err = call(taxonomyController.GetCategories, http.MethodGet, "", "")
+	require.NoError(t, err)
+
+	var tree []model.Category
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tree))
+	require.Len(t, tree, 2)
+	require.Equal(t, "languages", tree[0].Slug)
+	require.Len(t, tree[0].Children, 2)
+	require.Equal(t, "frameworks", tree[0].Children[1].Children[0].Slug)
+
+	_, err = call(taxonomyController.CreateCategory, http.MethodPost, `{"name":"Web"}`, "")
+	requireHTTPError(t, err, http.StatusConflict)
+
+	_, err = call(taxonomyController.CreateCategory, http.MethodPost, `{"name":"Rust","parentId":42}`, "")
+	requireHTTPError(t, err, http.StatusBadRequest)
+
+	categoryRepo.EXPECT().CreateCategory(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, category *model.Category) error {
+			category.ID = 6
+			return nil
+		})
+	rec, err = call(taxonomyController.CreateCategory, http.MethodPost, `{"name":"Rust","parentId":1}`, "")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.JSONEq(t, `{"id":6,"name":"Rust","slug":"rust","parentId":1}`, rec.Body.String())
+
+	_, err = call(taxonomyController.DeleteCategory, http.MethodDelete, "", "web")
+	requireHTTPError(t, err, http.StatusConflict)
+
+	_, err = call(taxonomyController.DeleteCategory, http.MethodDelete, "", "cooking")
+	requireHTTPError(t, err, http.StatusNotFound)
+
+	categoryRepo.EXPECT().DeleteCategory(gomock.Any(), gomock.Eq(uint(4))).Times(1).Return(nil)
+	rec, err = call(taxonomyController.DeleteCategory, http.MethodDelete, "", "frameworks")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+}
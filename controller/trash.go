@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/service"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type TrashController struct {
+	ctx      context.Context
+	services *service.Manager
+}
+
+func NewTrashController(ctx context.Context, services *service.Manager) *TrashController {
+	return &TrashController{
+		ctx:      ctx,
+		services: services,
+	}
+}
+
+// trashError maps the errors of the trash service to HTTP errors
+func trashError(err error) error {
+	switch {
+	case errors.Cause(err) == types.ErrNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, "not in the trash")
+	case errors.Cause(err) == types.ErrForbidden:
+		return echo.NewHTTPError(http.StatusForbidden, err)
+	case errors.Cause(err) == types.ErrConflict:
+		return echo.NewHTTPError(http.StatusConflict, "what it belongs to is in the trash, restore that first")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+}
+
+// GetTrash godoc
+//
+//	@Summary		Get Trash
+//	@Security		ApiKeyAuth
+//	@Tags			Trash
+//	@Description	list the posts and comments the user deleted, last deleted first, with when they are removed for good
+//	@ID				get-trash
+//	@Produce		json
+//	@Success		200	{array}	model.TrashItem
+//	@Router			/api/v1/users/me/trash [get]
+func (h *TrashController) GetTrash(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	items, err := h.services.TrashService.GetTrash(userId)
+	if err != nil {
+		return trashError(err)
+	}
+
+	return c.JSON(http.StatusOK, items)
+}
+
+// RestorePost godoc
+//
+//	@Summary		Restore Post
+//	@Security		ApiKeyAuth
+//	@Tags			Trash
+//	@Description	take a post out of the trash with the comments deleted along with it
+//	@ID				restore-post
+//	@Produce		json
+//	@Param			id	path		int	true	"post id"
+//	@Success		200	{object}	model.Post
+//	@Router			/api/v1/posts/{id}/restore [post]
+func (h *TrashController) RestorePost(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	postId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "post id is incorrect"))
+	}
+
+	post, err := h.services.TrashService.RestorePost(uint(postId), actor)
+	if err != nil {
+		return trashError(err)
+	}
+
+	return c.JSON(http.StatusOK, post)
+}
+
+// RestoreComment godoc
+//
+//	@Summary		Restore Comment
+//	@Security		ApiKeyAuth
+//	@Tags			Trash
+//	@Description	take a comment out of the trash, its post has to be restored first
+//	@ID				restore-comment
+//	@Produce		json
+//	@Param			id	path		int	true	"comment id"
+//	@Success		200	{object}	model.Comment
+//	@Router			/api/v1/comments/{id}/restore [post]
+func (h *TrashController) RestoreComment(c echo.Context) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	commentId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "comment id is incorrect"))
+	}
+
+	comment, err := h.services.TrashService.RestoreComment(uint(commentId), actor)
+	if err != nil {
+		return trashError(err)
+	}
+
+	return c.JSON(http.StatusOK, comment)
+}
+
+// RestoreUser godoc
+//
+//	@Summary		Restore User
+//	@Security		ApiKeyAuth
+//	@Tags			Admin
+//	@Description	Takes a deleted account out of the trash with everything deleted along with it
+//	@ID				RestoreUser
+//	@Produce		json
+//	@Param			id	path	int	true	"user id"
+//	@Success		200
+//	@Router			/api/v1/admin/users/{id}/restore [post]
+func (h *TrashController) RestoreUser(c echo.Context) error {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "user id is incorrect"))
+	}
+
+	if err := h.services.TrashService.RestoreUser(uint(userId)); err != nil {
+		return trashError(err)
+	}
+
+	return c.JSON(http.StatusOK, "user restored")
+}
+
+// Purge godoc
+//
+//	@Summary		Purge Trash
+//	@Security		ApiKeyAuth
+//	@Tags			Admin
+//	@Description	Removes everything that went to the trash before a time for good, the whole trash by default
+//	@ID				Purge
+//	@Produce		json
+//	@Param			before	query		string	false	"RFC 3339 timestamp or date"
+//	@Success		200		{object}	model.PurgeResult
+//	@Router			/api/v1/admin/trash [delete]
+func (h *TrashController) Purge(c echo.Context) error {
+	if err := checkParams(c, []string{"before"}); err != nil {
+		return err
+	}
+
+	before, err := bindTime(c, "before")
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		now := time.Now()
+		before = &now
+	}
+
+	result, err := h.services.TrashService.Purge(*before)
+	if err != nil {
+		return trashError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
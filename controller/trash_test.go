@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	mock_repository "github.com/slavik22/blogRestApi/repository/mock"
+	"github.com/slavik22/blogRestApi/service"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTrashAPI(t *testing.T) {
+	author, _ := randomUser(t)
+	deletedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	post := randomPost(t, author.ID)
+	trashedPost := post
+	trashedPost.DeletedAt = gorm.DeletedAt{Time: deletedAt, Valid: true}
+
+	comment := model.Comment{ID: 4, PostId: post.ID, UserId: author.ID + 1, Title: "Nice", Body: "Nice post"}
+	trashedComment := comment
+	trashedComment.DeletedAt = gorm.DeletedAt{Time: deletedAt, Valid: true}
+
+	type stubs struct {
+		posts    *mock_repository.MockPostRepo
+		comments *mock_repository.MockCommentRepo
+		trash    *mock_repository.MockTrashRepo
+	}
+
+	testCases := []struct {
+		name          string
+		userId        uint
+		role          model.Role
+		path          string
+		id            string
+		action        func(h *TrashController) echo.HandlerFunc
+		buildStubs    func(s stubs)
+		checkResponse func(recorder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name:   "GetTrash",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			path:   "/api/v1/users/me/trash",
+			action: func(h *TrashController) echo.HandlerFunc { return h.GetTrash },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().GetTrash(gomock.Any(), gomock.Eq(author.ID)).
+					Times(1).
+					Return([]model.TrashItem{{Kind: model.TrashPost, ID: post.ID, PostId: post.ID, Title: post.Title, DeletedAt: deletedAt}}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+
+				var items []model.TrashItem
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &items))
+				require.Len(t, items, 1)
+				require.Equal(t, model.TrashPost, items[0].Kind)
+				require.True(t, deletedAt.Add(30*24*time.Hour).Equal(items[0].PurgeAt))
+			},
+		},
+		{
+			name:   "RestorePost",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			path:   "/api/v1/posts/1/restore",
+			id:     "1",
+			action: func(h *TrashController) echo.HandlerFunc { return h.RestorePost },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().GetTrashedPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&trashedPost, nil)
+				s.trash.EXPECT().RestorePost(gomock.Any(), gomock.Eq(&trashedPost)).Times(1).Return(nil)
+				s.posts.EXPECT().GetPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&post, nil)
+				s.comments.EXPECT().GetComments(gomock.Any(), gomock.Eq(model.CommentQuery{PostId: post.ID, Status: model.CommentApproved, AnyStatus: true, Page: model.PageRequest{Limit: 500}})).
+					Times(1).
+					Return([]model.Comment{comment}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, post.ID, requireBodyPost(t, recorder.Body).ID)
+			},
+		},
+		{
+			name:   "RestoreOthersPost",
+			userId: author.ID + 1,
+			role:   model.RoleModerator,
+			path:   "/api/v1/posts/1/restore",
+			id:     "1",
+			action: func(h *TrashController) echo.HandlerFunc { return h.RestorePost },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().GetTrashedPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(&trashedPost, nil)
+				s.trash.EXPECT().RestorePost(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusForbidden)
+			},
+		},
+		{
+			name:   "RestorePostNotInTrash",
+			userId: author.ID,
+			role:   model.RoleAuthor,
+			path:   "/api/v1/posts/1/restore",
+			id:     "1",
+			action: func(h *TrashController) echo.HandlerFunc { return h.RestorePost },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().GetTrashedPost(gomock.Any(), gomock.Eq(post.ID)).Times(1).Return(nil, types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name:   "RestoreComment",
+			userId: comment.UserId,
+			role:   model.RoleReader,
+			path:   "/api/v1/comments/4/restore",
+			id:     "4",
+			action: func(h *TrashController) echo.HandlerFunc { return h.RestoreComment },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().GetTrashedComment(gomock.Any(), gomock.Eq(comment.ID)).Times(1).Return(&trashedComment, nil)
+				s.trash.EXPECT().RestoreComment(gomock.Any(), gomock.Eq(&trashedComment)).Times(1).Return(nil)
+				s.comments.EXPECT().GetComment(gomock.Any(), gomock.Eq(comment.ID)).Times(1).Return(&comment, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "RestoreCommentOfTrashedPost",
+			userId: comment.UserId,
+			role:   model.RoleReader,
+			path:   "/api/v1/comments/4/restore",
+			id:     "4",
+			action: func(h *TrashController) echo.HandlerFunc { return h.RestoreComment },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().GetTrashedComment(gomock.Any(), gomock.Eq(comment.ID)).Times(1).Return(&trashedComment, nil)
+				s.trash.EXPECT().RestoreComment(gomock.Any(), gomock.Any()).Times(1).Return(types.ErrConflict)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusConflict)
+			},
+		},
+		{
+			name:   "RestoreUser",
+			userId: author.ID + 1,
+			role:   model.RoleAdmin,
+			path:   "/api/v1/admin/users/1/restore",
+			id:     "1",
+			action: func(h *TrashController) echo.HandlerFunc { return h.RestoreUser },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().RestoreUser(gomock.Any(), gomock.Eq(uint(1))).Times(1).Return(nil)
+				s.posts.EXPECT().GetPosts(gomock.Any(), gomock.Eq(model.PostQuery{AuthorId: 1, Page: model.PageRequest{Limit: 500}})).
+					Times(1).
+					Return([]model.Post{post}, nil)
+				s.comments.EXPECT().GetComments(gomock.Any(), gomock.Eq(model.CommentQuery{PostId: post.ID, Status: model.CommentApproved, AnyStatus: true, Page: model.PageRequest{Limit: 500}})).
+					Times(1).
+					Return([]model.Comment{comment}, nil)
+				s.comments.EXPECT().GetComments(gomock.Any(), gomock.Eq(model.CommentQuery{AuthorId: 1, Status: model.CommentApproved, AnyStatus: true, Page: model.PageRequest{Limit: 500}})).
+					Times(1).
+					Return(nil, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "RestoreUserNotInTrash",
+			userId: author.ID + 1,
+			role:   model.RoleAdmin,
+			path:   "/api/v1/admin/users/1/restore",
+			id:     "1",
+			action: func(h *TrashController) echo.HandlerFunc { return h.RestoreUser },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().RestoreUser(gomock.Any(), gomock.Eq(uint(1))).Times(1).Return(types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+		{
+			name:   "Purge",
+			userId: author.ID + 1,
+			role:   model.RoleAdmin,
+			path:   "/api/v1/admin/trash",
+			action: func(h *TrashController) echo.HandlerFunc { return h.Purge },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().Purge(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, before time.Time) (*model.PurgeResult, error) {
+						require.WithinDuration(t, time.Now(), before, time.Minute)
+						return &model.PurgeResult{Posts: 2, Comments: 5}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+
+				var result model.PurgeResult
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+				require.Equal(t, model.PurgeResult{Posts: 2, Comments: 5}, result)
+			},
+		},
+		{
+			name:   "PurgeBefore",
+			userId: author.ID + 1,
+			role:   model.RoleAdmin,
+			path:   "/api/v1/admin/trash?before=2024-01-01",
+			action: func(h *TrashController) echo.HandlerFunc { return h.Purge },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().Purge(gomock.Any(), gomock.Eq(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))).
+					Times(1).
+					Return(&model.PurgeResult{}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "PurgeInvalidBefore",
+			userId: author.ID + 1,
+			role:   model.RoleAdmin,
+			path:   "/api/v1/admin/trash?before=last-week",
+			action: func(h *TrashController) echo.HandlerFunc { return h.Purge },
+			buildStubs: func(s stubs) {
+				s.trash.EXPECT().Purge(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusBadRequest)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			s := stubs{
+				posts:    mock_repository.NewMockPostRepo(ctrl),
+				comments: mock_repository.NewMockCommentRepo(ctrl),
+				trash:    mock_repository.NewMockTrashRepo(ctrl),
+			}
+
+			tc.buildStubs(s)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, s.posts, s.comments)
+			require.NoError(t, err)
+			store.Trash = s.trash
+			store.Search = repository.NewSearchMemoryIndex()
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, tc.path, nil), rec)
+			c.Set("userId", tc.userId)
+			c.Set("role", tc.role)
+			if tc.id != "" {
+				c.SetParamNames("id")
+				c.SetParamValues(tc.id)
+			}
+
+			err = tc.action(NewTrashController(context.Background(), serviceManager))(c)
+
+			tc.checkResponse(rec, err)
+		})
+	}
+}
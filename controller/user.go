@@ -7,7 +7,10 @@ import (
 	"github.com/slavik22/blogRestApi/lib/types"
 	"github.com/slavik22/blogRestApi/model"
 	"github.com/slavik22/blogRestApi/service"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type UserController struct {
@@ -22,6 +25,12 @@ func NewUserController(ctx context.Context, services *service.Manager) *UserCont
 	}
 }
 
+type signUpInput struct {
+	Name     string `json:"name" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
 // SignUp godoc
 //
 //	@Summary		SignUp user
@@ -34,7 +43,7 @@ func NewUserController(ctx context.Context, services *service.Manager) *UserCont
 //	@Success		200	{object}	model.User
 //	@Router			/api/v1/auth/sign-up [post]
 func (u *UserController) SignUp(c echo.Context) error {
-	var input model.User
+	var input signUpInput
 
 	if err := c.Bind(&input); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "could not decode user data"))
@@ -45,12 +54,18 @@ func (u *UserController) SignUp(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
 	}
 
-	createdUser, err := u.services.UserService.CreateUser(input)
+	createdUser, err := u.services.UserService.CreateUser(model.User{
+		Name:     input.Name,
+		Email:    input.Email,
+		Password: input.Password,
+	})
 
 	if err != nil {
 		switch {
 		case errors.Cause(err) == types.ErrBadRequest:
 			return echo.NewHTTPError(http.StatusBadRequest, err)
+		case errors.Cause(err) == types.ErrConflict:
+			return echo.NewHTTPError(http.StatusConflict, "email is already taken")
 		default:
 			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not create user"))
 		}
@@ -64,14 +79,17 @@ type signInInput struct {
 	Password string `json:"password" binding:"required"`
 }
 type signInOutput struct {
-	Token string `json:"token"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
 }
 
 // SignIn godoc
 //
 //	@Summary		SignIn user
 //	@Tags			User
-//	@Description	Login new user and returns token
+//	@Description	Login new user and returns token. Users with two-factor authentication
+//	@Description	get an MFA token instead, to be exchanged at /api/v1/auth/mfa/verify.
 //	@ID				SignIn
 //	@Accept			json
 //	@Produce		json
@@ -84,10 +102,606 @@ func (u *UserController) SignIn(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err)
 	}
 
-	token, err := u.services.UserService.SignIn(input.Email, input.Password)
+	tokens, err := u.services.UserService.SignIn(input.Email, input.Password, clientIP(c))
+	if err != nil {
+		var throttled *service.ThrottleError
+		switch {
+		case errors.As(err, &throttled):
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			return echo.NewHTTPError(http.StatusTooManyRequests, "too many failed attempts, try again later")
+		case errors.Cause(err) == types.ErrUnauthorized:
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not sign in"))
+		}
+	}
+
+	return signInResponse(c, tokens)
+}
+
+type refreshInput struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+// Refresh godoc
+//
+//	@Summary		Refresh tokens
+//	@Tags			User
+//	@Description	Rotates the refresh token and returns a new token pair
+//	@ID				Refresh
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	signInOutput
+//	@Router			/api/v1/auth/refresh [post]
+func (u *UserController) Refresh(c echo.Context) error {
+	var input refreshInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	tokens, err := u.services.UserService.Refresh(input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrUnauthorized:
+			return echo.NewHTTPError(http.StatusUnauthorized, "refresh token is invalid")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not refresh token"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, newSignInOutput(tokens))
+}
+
+// Logout godoc
+//
+//	@Summary		Logout user
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Revokes the current session and all of its tokens
+//	@ID				Logout
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Router			/api/v1/auth/logout [post]
+func (u *UserController) Logout(c echo.Context) error {
+	sessionId, err := getSessionId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	if err := u.services.UserService.Logout(sessionId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not logout"))
+	}
+
+	return c.JSON(http.StatusOK, "logged out")
+}
+
+type setRoleInput struct {
+	Role model.Role `json:"role" validate:"required"`
+}
+
+// SetRole godoc
+//
+//	@Summary		Set user role
+//	@Security		ApiKeyAuth
+//	@Tags			Admin
+//	@Description	Changes the role of a user (reader, author, moderator or admin)
+//	@ID				SetRole
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Router			/api/v1/admin/users/:id/role [put]
+func (u *UserController) SetRole(c echo.Context) error {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "user id is incorrect"))
+	}
+
+	var input setRoleInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	err = u.services.UserService.SetRole(uint(userId), input.Role)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrBadRequest:
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown role")
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not set role"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, "role updated")
+}
+
+// GetLockouts godoc
+//
+//	@Summary		List lockouts
+//	@Security		ApiKeyAuth
+//	@Tags			Admin
+//	@Description	Lists the accounts and client IPs currently locked out after failed sign-ins
+//	@ID				GetLockouts
+//	@Produce		json
+//	@Success		200	{object}	[]model.LoginThrottle
+//	@Router			/api/v1/admin/lockouts [get]
+func (u *UserController) GetLockouts(c echo.Context) error {
+	lockouts, err := u.services.UserService.GetLockouts()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not get lockouts"))
+	}
+
+	return c.JSON(http.StatusOK, lockouts)
+}
+
+// ClearLockout godoc
+//
+//	@Summary		Clear lockout
+//	@Security		ApiKeyAuth
+//	@Tags			Admin
+//	@Description	Lifts a lockout and forgets the failed sign-ins behind it
+//	@ID				ClearLockout
+//	@Produce		json
+//	@Success		200
+//	@Router			/api/v1/admin/lockouts/:id [delete]
+func (u *UserController) ClearLockout(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "lockout id is incorrect"))
+	}
+
+	err = u.services.UserService.ClearLockout(uint(id))
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, "lockout not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not clear lockout"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, "lockout cleared")
+}
+
+type profileOutput struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Bio       string    `json:"bio"`
+	AvatarURL string    `json:"avatarUrl"`
+	PostCount int64     `json:"postCount"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// GetProfile godoc
+//
+//	@Summary		Get user profile
+//	@Tags			User
+//	@Description	Public profile of a user
+//	@ID				GetProfile
+//	@Produce		json
+//	@Success		200	{object}	profileOutput
+//	@Router			/api/v1/users/:id [get]
+func (u *UserController) GetProfile(c echo.Context) error {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, errors.Wrap(err, "user id is incorrect"))
+	}
+
+	profile, err := u.services.UserService.GetProfile(uint(userId))
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err)
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, profileOutput{
+		ID:        profile.ID,
+		Name:      profile.Name,
+		Bio:       profile.Bio,
+		AvatarURL: profile.AvatarURL,
+		PostCount: profile.PostCount,
+		CreatedAt: profile.CreatedAt,
+	})
+}
+
+// GetMe godoc
+//
+//	@Summary		Get current user
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Account of the authenticated user
+//	@ID				GetMe
+//	@Produce		json
+//	@Success		200	{object}	model.User
+//	@Router			/api/v1/users/me [get]
+func (u *UserController) GetMe(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	user, err := u.services.UserService.GetUser(userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+type updateMeInput struct {
+	Name      string `json:"name" validate:"required"`
+	Bio       string `json:"bio" validate:"max=1000"`
+	AvatarURL string `json:"avatarUrl" validate:"omitempty,url"`
+}
+
+// UpdateMe godoc
+//
+//	@Summary		Update current user
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Updates name, bio and avatar of the authenticated user
+//	@ID				UpdateMe
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	model.User
+//	@Router			/api/v1/users/me [put]
+func (u *UserController) UpdateMe(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	var input updateMeInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	user, err := u.services.UserService.UpdateProfile(userId, service.ProfileUpdate{
+		Name:      input.Name,
+		Bio:       input.Bio,
+		AvatarURL: input.AvatarURL,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not update user"))
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// DeleteMe godoc
+//
+//	@Summary		Delete current user
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Deletes the account of the authenticated user
+//	@Description	the account and everything it wrote go to the trash, an admin can restore them until TRASH_RETENTION has passed
+//	@ID				DeleteMe
+//	@Produce		json
+//	@Success		200
+//	@Router			/api/v1/users/me [delete]
+func (u *UserController) DeleteMe(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	if err := u.services.UserService.DeleteUser(userId); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not delete user"))
+	}
+
+	return c.JSON(http.StatusOK, "user deleted")
+}
+
+type changePasswordInput struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,min=6"`
+}
+
+// ChangePassword godoc
+//
+//	@Summary		Change password
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Changes the password and revokes all other sessions
+//	@ID				ChangePassword
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Router			/api/v1/users/me/password [put]
+func (u *UserController) ChangePassword(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	sessionId, _ := getSessionId(c)
+
+	var input changePasswordInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	err = u.services.UserService.ChangePassword(userId, input.CurrentPassword, input.NewPassword, sessionId)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, "current password is incorrect")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not change password"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, "password changed")
+}
+
+type changeEmailInput struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// RequestEmailChange godoc
+//
+//	@Summary		Change email
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Sends a confirmation link to the new address
+//	@ID				RequestEmailChange
+//	@Accept			json
+//	@Produce		json
+//	@Success		202
+//	@Router			/api/v1/users/me/email [post]
+func (u *UserController) RequestEmailChange(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	var input changeEmailInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	err = u.services.UserService.RequestEmailChange(userId, input.Email, input.Password)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrForbidden:
+			return echo.NewHTTPError(http.StatusForbidden, "password is incorrect")
+		case errors.Cause(err) == types.ErrConflict:
+			return echo.NewHTTPError(http.StatusConflict, "email is already taken")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not change email"))
+		}
+	}
+
+	return c.JSON(http.StatusAccepted, "confirmation sent")
+}
+
+// ConfirmEmailChange godoc
+//
+//	@Summary		Confirm email change
+//	@Tags			User
+//	@Description	Applies the email change the emailed token was issued for
+//	@ID				ConfirmEmailChange
+//	@Produce		json
+//	@Param			token	query	string	true	"confirmation token"
+//	@Success		200
+//	@Router			/api/v1/users/email/confirm [get]
+func (u *UserController) ConfirmEmailChange(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "token is empty")
+	}
+
+	err := u.services.UserService.ConfirmEmailChange(token)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrGone:
+			return echo.NewHTTPError(http.StatusGone, "link is invalid or has expired")
+		case errors.Cause(err) == types.ErrConflict:
+			return echo.NewHTTPError(http.StatusConflict, "email is already taken")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not change email"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, "email changed")
+}
+
+// VerifyEmail godoc
+//
+//	@Summary		Verify email
+//	@Tags			User
+//	@Description	Marks the email address the emailed verification link was issued for as verified
+//	@ID				VerifyEmail
+//	@Produce		json
+//	@Param			token	query	string	true	"verification token"
+//	@Success		200
+//	@Router			/api/v1/auth/verify [get]
+func (u *UserController) VerifyEmail(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "token is empty")
+	}
+
+	err := u.services.UserService.VerifyEmail(token)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrGone:
+			return echo.NewHTTPError(http.StatusGone, "link is invalid or has expired")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not verify email"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, "email verified")
+}
+
+// ResendVerification godoc
+//
+//	@Summary		Resend verification email
+//	@Security		ApiKeyAuth
+//	@Tags			User
+//	@Description	Mails a new verification link to the current user
+//	@ID				ResendVerification
+//	@Produce		json
+//	@Success		202
+//	@Router			/api/v1/auth/verify/resend [post]
+func (u *UserController) ResendVerification(c echo.Context) error {
+	userId, err := getUserId(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, errors.Wrap(err, "user is not authorized"))
+	}
+
+	err = u.services.UserService.ResendVerification(userId)
+	if err != nil {
+		switch {
+		case errors.Cause(err) == types.ErrConflict:
+			return echo.NewHTTPError(http.StatusConflict, "email is already verified")
+		case errors.Cause(err) == types.ErrTooManyRequests:
+			return echo.NewHTTPError(http.StatusTooManyRequests, "verification email was sent recently")
+		case errors.Cause(err) == types.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not send verification email"))
+		}
+	}
+
+	return c.JSON(http.StatusAccepted, "verification email sent")
+}
+
+type forgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ForgotPassword godoc
+//
+//	@Summary		Forgot password
+//	@Tags			User
+//	@Description	Mails a password reset link if an account with the email exists
+//	@ID				ForgotPassword
+//	@Accept			json
+//	@Produce		json
+//	@Success		202
+//	@Router			/api/v1/auth/password/forgot [post]
+func (u *UserController) ForgotPassword(c echo.Context) error {
+	var input forgotPasswordInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	if err := u.services.UserService.ForgotPassword(input.Email); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not send reset link"))
+	}
+
+	return c.JSON(http.StatusAccepted, "if the account exists, a reset link has been sent")
+}
+
+type resetPasswordInput struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+// ResetPassword godoc
+//
+//	@Summary		Reset password
+//	@Tags			User
+//	@Description	Sets a new password using the emailed reset token
+//	@ID				ResetPassword
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Router			/api/v1/auth/password/reset [post]
+func (u *UserController) ResetPassword(c echo.Context) error {
+	var input resetPasswordInput
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	err := u.services.UserService.ResetPassword(input.Token, input.Password)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not create user"))
+		switch {
+		case errors.Cause(err) == types.ErrGone:
+			return echo.NewHTTPError(http.StatusGone, "reset token is invalid or has expired")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "could not reset password"))
+		}
+	}
+
+	return c.JSON(http.StatusOK, "password changed")
+}
+
+// JWKS godoc
+//
+//	@Summary		JSON Web Key Set
+//	@Tags			User
+//	@Description	Public keys used to verify access tokens issued by this service
+//	@ID				JWKS
+//	@Produce		json
+//	@Success		200	{object}	util.JWKSet
+//	@Router			/.well-known/jwks.json [get]
+func (u *UserController) JWKS(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(http.StatusOK, u.services.UserService.JWKS())
+}
+
+// signInResponse answers a sign-in with the token pair, or with the MFA
+// challenge when the user still has to present the second factor
+func signInResponse(c echo.Context, tokens *service.AuthTokens) error {
+	if tokens.MFAToken != "" {
+		return c.JSON(http.StatusOK, mfaChallengeOutput{
+			MFARequired: true,
+			MFAToken:    tokens.MFAToken,
+			ExpiresAt:   tokens.ExpiresAt,
+		})
 	}
 
-	return c.JSON(http.StatusOK, signInOutput{Token: token})
+	return c.JSON(http.StatusOK, newSignInOutput(tokens))
+}
+
+func newSignInOutput(tokens *service.AuthTokens) signInOutput {
+	return signInOutput{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+	}
 }
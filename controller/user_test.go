@@ -2,8 +2,21 @@ package controller
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
 	"github.com/labstack/echo/v4"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/mail"
+	"github.com/slavik22/blogRestApi/lib/types"
 	util2 "github.com/slavik22/blogRestApi/lib/util"
 	"github.com/slavik22/blogRestApi/lib/validator"
 	"github.com/slavik22/blogRestApi/model"
@@ -16,9 +29,14 @@ import (
 	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateUserAPI(t *testing.T) {
@@ -28,7 +46,7 @@ func TestCreateUserAPI(t *testing.T) {
 		name          string
 		body          map[string]interface{}
 		buildStubs    func(store *mock_repository.MockUserRepo)
-		checkResponse func(recoder *httptest.ResponseRecorder)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
 	}{
 		{
 			name: "OK",
@@ -43,7 +61,8 @@ func TestCreateUserAPI(t *testing.T) {
 					Times(1).
 					Return(user.ID, nil)
 			},
-			checkResponse: func(recorder *httptest.ResponseRecorder) {
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
 				require.Equal(t, http.StatusCreated, recorder.Code)
 
 				str := recorder.Body.String()
@@ -56,6 +75,24 @@ func TestCreateUserAPI(t *testing.T) {
 				assert.Equal(t, uint(id), user.ID)
 			},
 		},
+		{
+			name: "EmailOfTrashedUser",
+			body: map[string]interface{}{
+				"name":     user.Name,
+				"password": password,
+				"email":    user.Email,
+			},
+			buildStubs: func(store *mock_repository.MockUserRepo) {
+				// The trashed user still holds the email in the unique index
+				store.EXPECT().
+					CreateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(uint(0), types.ErrConflict)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusConflict)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -92,27 +129,48 @@ func TestCreateUserAPI(t *testing.T) {
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
-			serviceManager, err := service.NewManager(context.Background(), store)
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
 			if err != nil {
 				t.Error(err)
 			}
 
 			userController := NewUserController(context.Background(), serviceManager)
-			_ = userController.SignUp(c)
+			err = userController.SignUp(c)
 
-			tc.checkResponse(rec)
+			tc.checkResponse(rec, err)
 		})
 	}
 }
 
 func TestLoginUserAPI(t *testing.T) {
 	user, password := randomUser(t)
+	ip := "192.0.2.1"
+	account := "account:" + strings.ToLower(user.Email)
+	client := "ip:" + ip
+
+	// Attempts are counted against the account and the client IP before the
+	// password is checked
+	countAttempt := func(login *mock_repository.MockLoginThrottleRepo, subject string, retryAfter time.Duration) {
+		login.EXPECT().CountAttempt(gomock.Any(), gomock.Eq(subject), gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(_ context.Context, _ string, policy model.ThrottlePolicy, _ time.Time) (time.Duration, error) {
+				require.Equal(t, 15*time.Minute, policy.Window)
+				if subject == account {
+					require.Equal(t, 5, policy.Limit)
+					require.Equal(t, time.Second, policy.Backoff)
+				} else {
+					require.Equal(t, 50, policy.Limit)
+					require.Zero(t, policy.Backoff)
+				}
+				return retryAfter, nil
+			})
+	}
 
 	testCases := []struct {
 		name          string
 		body          map[string]interface{}
-		buildStubs    func(store *mock_repository.MockUserRepo)
-		checkResponse func(recoder *httptest.ResponseRecorder)
+		buildStubs    func(store *mock_repository.MockUserRepo, sessions *mock_repository.MockSessionRepo, login *mock_repository.MockLoginThrottleRepo)
+		checkResponse func(recoder *httptest.ResponseRecorder, err error)
 	}{
 		{
 			name: "OK",
@@ -120,34 +178,119 @@ func TestLoginUserAPI(t *testing.T) {
 				"password": password,
 				"email":    user.Email,
 			},
-			buildStubs: func(store *mock_repository.MockUserRepo) {
+			buildStubs: func(store *mock_repository.MockUserRepo, sessions *mock_repository.MockSessionRepo, login *mock_repository.MockLoginThrottleRepo) {
+				countAttempt(login, account, 0)
+				countAttempt(login, client, 0)
 				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(&user, nil)
+				login.EXPECT().ResetThrottle(gomock.Any(), gomock.Eq(account)).
+					Times(1).
+					Return(nil)
+				login.EXPECT().ForgiveAttempt(gomock.Any(), gomock.Eq(client)).
+					Times(1).
+					Return(nil)
+				sessions.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+				sessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
 			},
-			checkResponse: func(recorder *httptest.ResponseRecorder) {
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
 				require.Equal(t, http.StatusOK, recorder.Code)
 
-				token := recorder.Body.String()
+				var output signInOutput
+				err = json.Unmarshal(recorder.Body.Bytes(), &output)
+				require.NoError(t, err)
 
-				assert.NotEmpty(t, token)
+				assert.NotEmpty(t, output.Token)
+				assert.NotEmpty(t, output.RefreshToken)
+			},
+		},
+		{
+			name: "WrongPassword",
+			body: map[string]interface{}{
+				"password": "wrong password",
+				"email":    user.Email,
+			},
+			buildStubs: func(store *mock_repository.MockUserRepo, sessions *mock_repository.MockSessionRepo, login *mock_repository.MockLoginThrottleRepo) {
+				countAttempt(login, account, 0)
+				countAttempt(login, client, 0)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&user, nil)
+				login.EXPECT().ResetThrottle(gomock.Any(), gomock.Any()).
+					Times(0)
+				login.EXPECT().ForgiveAttempt(gomock.Any(), gomock.Any()).
+					Times(0)
+				sessions.EXPECT().CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusUnauthorized)
+				require.Equal(t, "invalid credentials", err.(*echo.HTTPError).Message)
+			},
+		},
+		{
+			name: "UnknownEmail",
+			body: map[string]interface{}{
+				"password": password,
+				"email":    user.Email,
+			},
+			buildStubs: func(store *mock_repository.MockUserRepo, sessions *mock_repository.MockSessionRepo, login *mock_repository.MockLoginThrottleRepo) {
+				countAttempt(login, account, 0)
+				countAttempt(login, client, 0)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusUnauthorized)
+				require.Equal(t, "invalid credentials", err.(*echo.HTTPError).Message)
+			},
+		},
+		{
+			name: "LockedOut",
+			body: map[string]interface{}{
+				"password": password,
+				"email":    user.Email,
+			},
+			buildStubs: func(store *mock_repository.MockUserRepo, sessions *mock_repository.MockSessionRepo, login *mock_repository.MockLoginThrottleRepo) {
+				countAttempt(login, account, 10*time.Minute)
+				// The password is not even checked while locked out
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusTooManyRequests)
+				retryAfter, err := strconv.Atoi(recorder.Header().Get("Retry-After"))
+				require.NoError(t, err)
+				require.InDelta(t, 600, retryAfter, 5)
+			},
+		},
+		{
+			name: "IPLockedOut",
+			body: map[string]interface{}{
+				"password": password,
+				"email":    user.Email,
+			},
+			buildStubs: func(store *mock_repository.MockUserRepo, sessions *mock_repository.MockSessionRepo, login *mock_repository.MockLoginThrottleRepo) {
+				countAttempt(login, account, 0)
+				countAttempt(login, client, 2500*time.Millisecond)
+				// The refused attempt doesn't count against the account
+				login.EXPECT().ForgiveAttempt(gomock.Any(), gomock.Eq(account)).
+					Times(1).
+					Return(nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusTooManyRequests)
+				require.Equal(t, "3", recorder.Header().Get("Retry-After"))
 			},
 		},
-		//{
-		//	name: "InternalError",
-		//	body: map[string]interface{}{
-		//		"password": password,
-		//		"email":    user.Email,
-		//	},
-		//	buildStubs: func(store *mock_repository.MockUserRepo) {
-		//		store.EXPECT().GetUser(gomock.Any(), gomock.Any()).
-		//			Times(1).
-		//			Return(nil, sql.ErrNoRows)
-		//	},
-		//	checkResponse: func(recorder *httptest.ResponseRecorder) {
-		//		require.Equal(t, http.StatusInternalServerError, recorder.Code)
-		//	},
-		//},
 	}
 
 	for i := range testCases {
@@ -160,17 +303,23 @@ func TestLoginUserAPI(t *testing.T) {
 			userRepo := mock_repository.NewMockUserRepo(ctrl)
 			postRepo := mock_repository.NewMockPostRepo(ctrl)
 			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			sessionRepo := mock_repository.NewMockSessionRepo(ctrl)
+			loginRepo := mock_repository.NewMockLoginThrottleRepo(ctrl)
 
-			tc.buildStubs(userRepo)
+			tc.buildStubs(userRepo, sessionRepo, loginRepo)
 
 			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
 
 			if err != nil {
 				t.Error(err)
 			}
+			store.Session = sessionRepo
+			store.Login = loginRepo
 
 			e := echo.New()
 			e.Validator = validator.NewValidator()
+			e.IPExtractor, err = IPExtractor("")
+			require.NoError(t, err)
 
 			json, err := json.Marshal(tc.body)
 
@@ -180,12 +329,15 @@ func TestLoginUserAPI(t *testing.T) {
 
 			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(json)))
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.RemoteAddr = ip + ":1234"
+			// Clients can't pick the IP they are throttled as
+			req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.7")
+			req.Header.Set(echo.HeaderXRealIP, "198.51.100.8")
 
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
-			//c.Set("userId", uint(1))
 
-			serviceManager, err := service.NewManager(context.Background(), store)
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
 			if err != nil {
 				t.Error(err)
 			}
@@ -194,7 +346,438 @@ func TestLoginUserAPI(t *testing.T) {
 
 			err = userController.SignIn(c)
 
-			tc.checkResponse(rec)
+			tc.checkResponse(rec, err)
+		})
+	}
+}
+
+func TestThrottlePolicy(t *testing.T) {
+	now := time.Now()
+	lockedUntil := now.Add(10 * time.Minute)
+	unlockedAt := now.Add(-time.Minute)
+	policy := model.ThrottlePolicy{Limit: 5, Window: 15 * time.Minute, Backoff: time.Second}
+
+	testCases := []struct {
+		name       string
+		policy     model.ThrottlePolicy
+		throttle   model.LoginThrottle
+		retryAfter time.Duration
+		expired    bool
+	}{
+		{
+			name:     "New",
+			policy:   policy,
+			throttle: model.LoginThrottle{LastFailureAt: now},
+		},
+		{
+			name:       "BackingOff",
+			policy:     policy,
+			throttle:   model.LoginThrottle{Failures: 3, LastFailureAt: now.Add(-time.Second)},
+			retryAfter: 3 * time.Second,
+		},
+		{
+			name:     "BackedOff",
+			policy:   policy,
+			throttle: model.LoginThrottle{Failures: 3, LastFailureAt: now.Add(-4 * time.Second)},
+		},
+		{
+			name:       "BackoffCappedByWindow",
+			policy:     model.ThrottlePolicy{Limit: 50, Window: 15 * time.Minute, Backoff: time.Second},
+			throttle:   model.LoginThrottle{Failures: 40, LastFailureAt: now},
+			retryAfter: 15 * time.Minute,
+		},
+		{
+			name:     "NoBackoff",
+			policy:   model.ThrottlePolicy{Limit: 50, Window: 15 * time.Minute},
+			throttle: model.LoginThrottle{Failures: 40, LastFailureAt: now},
+		},
+		{
+			name:       "LockedOut",
+			policy:     policy,
+			throttle:   model.LoginThrottle{Failures: 5, LastFailureAt: now, LockedUntil: &lockedUntil},
+			retryAfter: 10 * time.Minute,
+		},
+		{
+			name:     "LockoutOver",
+			policy:   policy,
+			throttle: model.LoginThrottle{Failures: 5, LastFailureAt: now.Add(-16 * time.Minute), LockedUntil: &unlockedAt},
+			expired:  true,
+		},
+		{
+			name:     "FailuresForgotten",
+			policy:   policy,
+			throttle: model.LoginThrottle{Failures: 4, LastFailureAt: now.Add(-16 * time.Minute)},
+			expired:  true,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.retryAfter, tc.policy.RetryAfter(&tc.throttle, now))
+			require.Equal(t, tc.expired, tc.policy.Expired(&tc.throttle, now))
+		})
+	}
+}
+
+func TestIPExtractor(t *testing.T) {
+	testCases := []struct {
+		name           string
+		trustedProxies string
+		remoteAddr     string
+		forwardedFor   string
+		ip             string
+	}{
+		{
+			name:         "Direct",
+			remoteAddr:   "192.0.2.1:1234",
+			forwardedFor: "198.51.100.7",
+			ip:           "192.0.2.1",
+		},
+		{
+			name:         "DirectPrivateNet",
+			remoteAddr:   "10.0.0.5:1234",
+			forwardedFor: "198.51.100.7",
+			ip:           "10.0.0.5",
+		},
+		{
+			name:           "TrustedProxy",
+			trustedProxies: "10.0.0.0/8, 2001:db8::/32",
+			remoteAddr:     "10.0.0.5:1234",
+			forwardedFor:   "198.51.100.7",
+			ip:             "198.51.100.7",
+		},
+		{
+			name:           "SpoofedBehindProxy",
+			trustedProxies: "10.0.0.0/8",
+			remoteAddr:     "10.0.0.5:1234",
+			forwardedFor:   "203.0.113.9, 198.51.100.7",
+			ip:             "198.51.100.7",
+		},
+		{
+			name:           "UntrustedProxy",
+			trustedProxies: "10.0.0.0/8",
+			remoteAddr:     "192.168.1.5:1234",
+			forwardedFor:   "198.51.100.7",
+			ip:             "192.168.1.5",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			extractor, err := IPExtractor(tc.trustedProxies)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, tc.forwardedFor)
+			req.Header.Set(echo.HeaderXRealIP, "203.0.113.10")
+
+			require.Equal(t, tc.ip, extractor(req))
+		})
+	}
+
+	_, err := IPExtractor("10.0.0.0/33")
+	require.Error(t, err)
+}
+
+func TestRefreshTokenAPI(t *testing.T) {
+	refreshToken := util2.RandomString(43)
+	session := model.Session{
+		ID:        util2.RandomString(22),
+		UserId:    1000,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	usedAt := time.Now().Add(-time.Minute)
+	revokedAt := time.Now().Add(-time.Minute)
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(sessions *mock_repository.MockSessionRepo, users *mock_repository.MockUserRepo)
+		checkResponse func(recorder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(sessions *mock_repository.MockSessionRepo, users *mock_repository.MockUserRepo) {
+				token := model.RefreshToken{ID: 1, SessionId: session.ID, ExpiresAt: session.ExpiresAt}
+				sessions.EXPECT().GetRefreshToken(gomock.Any(), gomock.Eq(util2.HashToken(refreshToken))).
+					Times(1).
+					Return(&token, nil)
+				sessions.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(&session, nil)
+				sessions.EXPECT().UseRefreshToken(gomock.Any(), gomock.Eq(token.ID)).
+					Times(1).
+					Return(true, nil)
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(session.UserId)).
+					Times(1).
+					Return(&model.User{ID: session.UserId, Role: model.RoleAuthor}, nil)
+				sessions.EXPECT().UpdateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+				sessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+				sessions.EXPECT().RevokeSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var output signInOutput
+				err = json.Unmarshal(recorder.Body.Bytes(), &output)
+				require.NoError(t, err)
+
+				assert.NotEmpty(t, output.Token)
+				assert.NotEqual(t, refreshToken, output.RefreshToken)
+			},
+		},
+		{
+			name: "ReuseRevokesSession",
+			buildStubs: func(sessions *mock_repository.MockSessionRepo, users *mock_repository.MockUserRepo) {
+				token := model.RefreshToken{ID: 1, SessionId: session.ID, ExpiresAt: session.ExpiresAt, UsedAt: &usedAt}
+				sessions.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&token, nil)
+				sessions.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(&session, nil)
+				sessions.EXPECT().RevokeSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(nil)
+				sessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusUnauthorized)
+			},
+		},
+		{
+			name: "ConcurrentReuseRevokesSession",
+			buildStubs: func(sessions *mock_repository.MockSessionRepo, users *mock_repository.MockUserRepo) {
+				token := model.RefreshToken{ID: 1, SessionId: session.ID, ExpiresAt: session.ExpiresAt}
+				sessions.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&token, nil)
+				sessions.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(&session, nil)
+				sessions.EXPECT().UseRefreshToken(gomock.Any(), gomock.Eq(token.ID)).
+					Times(1).
+					Return(false, nil)
+				sessions.EXPECT().RevokeSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusUnauthorized)
+			},
+		},
+		{
+			name: "RevokedSession",
+			buildStubs: func(sessions *mock_repository.MockSessionRepo, users *mock_repository.MockUserRepo) {
+				revoked := session
+				revoked.RevokedAt = &revokedAt
+				token := model.RefreshToken{ID: 1, SessionId: session.ID, ExpiresAt: session.ExpiresAt}
+				sessions.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&token, nil)
+				sessions.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(&revoked, nil)
+				sessions.EXPECT().UseRefreshToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusUnauthorized)
+			},
+		},
+		{
+			name: "UnknownToken",
+			buildStubs: func(sessions *mock_repository.MockSessionRepo, users *mock_repository.MockUserRepo) {
+				sessions.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusUnauthorized)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			sessionRepo := mock_repository.NewMockSessionRepo(ctrl)
+
+			tc.buildStubs(sessionRepo, userRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Session = sessionRepo
+
+			e := echo.New()
+			e.Validator = validator.NewValidator()
+
+			body := fmt.Sprintf(`{"refreshToken": %q}`, refreshToken)
+			req := httptest.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			userController := NewUserController(context.Background(), serviceManager)
+			err = userController.Refresh(c)
+
+			tc.checkResponse(rec, err)
+		})
+	}
+}
+
+func TestUserIdentity(t *testing.T) {
+	session := model.Session{
+		ID:        util2.RandomString(22),
+		UserId:    1000,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	revokedAt := time.Now()
+
+	testCases := []struct {
+		name       string
+		header     func(t *testing.T, keys *util2.KeySet) string
+		buildStubs func(sessions *mock_repository.MockSessionRepo)
+		code       int
+	}{
+		{
+			name: "OK",
+			header: func(t *testing.T, keys *util2.KeySet) string {
+				token, err := keys.GenerateToken(session.UserId, string(model.RoleAuthor), session.ID)
+				require.NoError(t, err)
+				return "Bearer " + token
+			},
+			buildStubs: func(sessions *mock_repository.MockSessionRepo) {
+				sessions.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(&session, nil)
+			},
+			code: http.StatusOK,
+		},
+		{
+			name: "RevokedSession",
+			header: func(t *testing.T, keys *util2.KeySet) string {
+				token, err := keys.GenerateToken(session.UserId, string(model.RoleAuthor), session.ID)
+				require.NoError(t, err)
+				return "Bearer " + token
+			},
+			buildStubs: func(sessions *mock_repository.MockSessionRepo) {
+				revoked := session
+				revoked.RevokedAt = &revokedAt
+				sessions.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(&revoked, nil)
+			},
+			code: http.StatusUnauthorized,
+		},
+		{
+			name: "ExpiredSession",
+			header: func(t *testing.T, keys *util2.KeySet) string {
+				token, err := keys.GenerateToken(session.UserId, string(model.RoleAuthor), session.ID)
+				require.NoError(t, err)
+				return "Bearer " + token
+			},
+			buildStubs: func(sessions *mock_repository.MockSessionRepo) {
+				expired := session
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				sessions.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).
+					Times(1).
+					Return(&expired, nil)
+			},
+			code: http.StatusUnauthorized,
+		},
+		{
+			name: "MissingSession",
+			header: func(t *testing.T, keys *util2.KeySet) string {
+				token, err := keys.GenerateToken(session.UserId, string(model.RoleAuthor), session.ID)
+				require.NoError(t, err)
+				return "Bearer " + token
+			},
+			buildStubs: func(sessions *mock_repository.MockSessionRepo) {
+				sessions.EXPECT().GetSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+			},
+			code: http.StatusUnauthorized,
+		},
+		{
+			name: "InvalidToken",
+			header: func(t *testing.T, keys *util2.KeySet) string {
+				return "Bearer " + util2.RandomString(40)
+			},
+			buildStubs: func(sessions *mock_repository.MockSessionRepo) {
+				sessions.EXPECT().GetSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			code: http.StatusUnauthorized,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			sessionRepo := mock_repository.NewMockSessionRepo(ctrl)
+
+			tc.buildStubs(sessionRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Session = sessionRepo
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			e := echo.New()
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/posts", nil)
+			req.Header.Set(authorizationHeader, tc.header(t, serviceManager.Keys))
+
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			handler := UserIdentity(serviceManager)(func(c echo.Context) error {
+				userId, err := getUserId(c)
+				require.NoError(t, err)
+				require.Equal(t, session.UserId, userId)
+				return c.NoContent(http.StatusOK)
+			})
+			err = handler(c)
+
+			if tc.code == http.StatusOK {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, rec.Code)
+				return
+			}
+			requireHTTPError(t, err, tc.code)
 		})
 	}
 }
@@ -212,3 +795,843 @@ func randomUser(t *testing.T) (user model.User, password string) {
 	}
 	return
 }
+
+func requireHTTPError(t *testing.T, err error, code int) {
+	var he *echo.HTTPError
+	require.ErrorAs(t, err, &he)
+	require.Equal(t, code, he.Code)
+}
+
+func testConfig() *blogRestApi.Config {
+	cfg := blogRestApi.Default()
+	cfg.JWTSecret = util2.RandomString(32)
+	cfg.LinkSecret = util2.RandomString(32)
+	cfg.MediaDriver = "memory"
+	// The rate and bayes checks query the store, tests that need them turn
+	// them on
+	cfg.SpamChecks = "links,blocklist,honeypot"
+	return cfg
+}
+
+func TestRequirePermission(t *testing.T) {
+	testCases := []struct {
+		name string
+		role interface{}
+		perm model.Permission
+		code int
+	}{
+		{name: "ReaderComments", role: model.RoleReader, perm: model.PermCommentsWrite, code: http.StatusOK},
+		{name: "ReaderPosts", role: model.RoleReader, perm: model.PermPostsWrite, code: http.StatusForbidden},
+		{name: "ModeratorModerates", role: model.RoleModerator, perm: model.PermCommentsModerate, code: http.StatusOK},
+		{name: "ModeratorManagesUsers", role: model.RoleModerator, perm: model.PermUsersManage, code: http.StatusForbidden},
+		{name: "AdminManagesUsers", role: model.RoleAdmin, perm: model.PermUsersManage, code: http.StatusOK},
+		{name: "NoRole", role: nil, perm: model.PermPostsRead, code: http.StatusForbidden},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("role", tc.role)
+
+			handler := RequirePermission(tc.perm)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			err := handler(c)
+
+			if tc.code == http.StatusOK {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, rec.Code)
+				return
+			}
+			requireHTTPError(t, err, tc.code)
+		})
+	}
+}
+
+func TestSecretsRequired(t *testing.T) {
+	testCases := []struct {
+		name   string
+		update func(cfg *blogRestApi.Config)
+	}{
+		{
+			name:   "NoJWTSecret",
+			update: func(cfg *blogRestApi.Config) { cfg.JWTSecret = "" },
+		},
+		{
+			name:   "PublishedJWTSecret",
+			update: func(cfg *blogRestApi.Config) { cfg.JWTSecret = "qrkjk#4#%35FSFJlja#4353KSFjH" },
+		},
+		{
+			name:   "PublishedPreviousSecret",
+			update: func(cfg *blogRestApi.Config) { cfg.JWTPreviousSecrets = "qrkjk#4#%35FSFJlja#4353KSFjH" },
+		},
+		{
+			name:   "NoLinkSecret",
+			update: func(cfg *blogRestApi.Config) { cfg.LinkSecret = "" },
+		},
+		{
+			name:   "PublishedLinkSecret",
+			update: func(cfg *blogRestApi.Config) { cfg.LinkSecret = "dev-link-secret-change-me" },
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig()
+			tc.update(cfg)
+
+			_, err := service.NewManager(context.Background(), &repository.Store{}, cfg)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestMailConfig(t *testing.T) {
+	testCases := []struct {
+		name   string
+		update func(cfg *blogRestApi.Config)
+	}{
+		{
+			name:   "MemoryDriver",
+			update: func(cfg *blogRestApi.Config) { cfg.MailDriver = "memory" },
+		},
+		{
+			name:   "RelativeResetURL",
+			update: func(cfg *blogRestApi.Config) { cfg.PasswordResetURL = "/password/reset" },
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig()
+			tc.update(cfg)
+
+			_, err := service.NewManager(context.Background(), &repository.Store{}, cfg)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestJWKSAPI(t *testing.T) {
+	testCases := []struct {
+		name      string
+		algorithm string
+		kty       string
+		newKey    func(t *testing.T) crypto.Signer
+	}{
+		{
+			name:      "RS256",
+			algorithm: "RS256",
+			kty:       "RSA",
+			newKey: func(t *testing.T) crypto.Signer {
+				key, err := rsa.GenerateKey(rand.Reader, 2048)
+				require.NoError(t, err)
+				return key
+			},
+		},
+		{
+			name:      "ES256",
+			algorithm: "ES256",
+			kty:       "EC",
+			newKey: func(t *testing.T) crypto.Signer {
+				key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				require.NoError(t, err)
+				return key
+			},
+		},
+		{
+			name:      "EdDSA",
+			algorithm: "EdDSA",
+			kty:       "OKP",
+			newKey: func(t *testing.T) crypto.Signer {
+				_, key, err := ed25519.GenerateKey(rand.Reader)
+				require.NoError(t, err)
+				return key
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			oldKey := tc.newKey(t)
+			newKey := tc.newKey(t)
+
+			oldManager, err := service.NewManager(context.Background(), &repository.Store{}, keyConfig(t, dir, tc.algorithm, oldKey, nil))
+			require.NoError(t, err)
+			serviceManager, err := service.NewManager(context.Background(), &repository.Store{}, keyConfig(t, dir, tc.algorithm, newKey, oldKey))
+			require.NoError(t, err)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			userController := NewUserController(context.Background(), serviceManager)
+			err = userController.JWKS(c)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var set util2.JWKSet
+			err = json.Unmarshal(rec.Body.Bytes(), &set)
+			require.NoError(t, err)
+			require.Len(t, set.Keys, 2)
+
+			current, err := serviceManager.Keys.GenerateToken(1, string(model.RoleAuthor), "session")
+			require.NoError(t, err)
+			previous, err := oldManager.Keys.GenerateToken(1, string(model.RoleAuthor), "session")
+			require.NoError(t, err)
+
+			// The active key is published first and referenced by the kid header
+			header := strings.Split(current, ".")[0]
+			data, err := base64.RawURLEncoding.DecodeString(header)
+			require.NoError(t, err)
+			var jose map[string]string
+			require.NoError(t, json.Unmarshal(data, &jose))
+			require.Equal(t, tc.algorithm, jose["alg"])
+			require.Equal(t, set.Keys[0].Kid, jose["kid"])
+			require.Equal(t, tc.kty, set.Keys[0].Kty)
+
+			// Tokens signed with the rotated key are still accepted
+			claims, err := serviceManager.Keys.ParseToken(previous)
+			require.NoError(t, err)
+			require.Equal(t, uint(1), claims.UserId)
+
+			// but the old service does not know the new key
+			_, err = oldManager.Keys.ParseToken(current)
+			require.Error(t, err)
+		})
+	}
+}
+
+func keyConfig(t *testing.T, dir string, algorithm string, signing crypto.Signer, previous crypto.Signer) *blogRestApi.Config {
+	cfg := blogRestApi.Default()
+	cfg.JWTAlgorithm = algorithm
+	cfg.LinkSecret = util2.RandomString(32)
+	cfg.MediaDriver = "memory"
+
+	private, err := x509.MarshalPKCS8PrivateKey(signing)
+	require.NoError(t, err)
+	cfg.JWTPrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private}))
+
+	if previous != nil {
+		public, err := x509.MarshalPKIXPublicKey(previous.Public())
+		require.NoError(t, err)
+
+		path := filepath.Join(dir, "previous.pem")
+		err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), 0600)
+		require.NoError(t, err)
+		cfg.JWTVerificationKeyFiles = path
+	}
+
+	return cfg
+}
+
+func TestGetProfileAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	user.Bio = util2.RandomString(20)
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(users *mock_repository.MockUserRepo, posts *mock_repository.MockPostRepo)
+		checkResponse func(recorder *httptest.ResponseRecorder, err error)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(users *mock_repository.MockUserRepo, posts *mock_repository.MockPostRepo) {
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&user, nil)
+				posts.EXPECT().CountPosts(gomock.Any(), gomock.Eq(model.PostQuery{AuthorId: user.ID, Status: model.PostPublished})).
+					Times(1).
+					Return(int64(3), nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var profile map[string]interface{}
+				err = json.Unmarshal(recorder.Body.Bytes(), &profile)
+				require.NoError(t, err)
+
+				require.Equal(t, user.Name, profile["name"])
+				require.Equal(t, user.Bio, profile["bio"])
+				require.Equal(t, float64(3), profile["postCount"])
+				require.NotContains(t, profile, "password")
+				require.NotContains(t, profile, "email")
+				require.NotContains(t, recorder.Body.String(), user.Password)
+			},
+		},
+		{
+			name: "NotFound",
+			buildStubs: func(users *mock_repository.MockUserRepo, posts *mock_repository.MockPostRepo) {
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, err error) {
+				requireHTTPError(t, err, http.StatusNotFound)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+			tc.buildStubs(userRepo, postRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/users/%d", user.ID), nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(strconv.Itoa(int(user.ID)))
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			userController := NewUserController(context.Background(), serviceManager)
+			err = userController.GetProfile(c)
+
+			tc.checkResponse(rec, err)
+		})
+	}
+}
+
+func TestChangePasswordAPI(t *testing.T) {
+	user, password := randomUser(t)
+	sessionId := util2.RandomString(22)
+
+	testCases := []struct {
+		name       string
+		current    string
+		buildStubs func(users *mock_repository.MockUserRepo, sessions *mock_repository.MockSessionRepo)
+		code       int
+	}{
+		{
+			name:    "OK",
+			current: password,
+			buildStubs: func(users *mock_repository.MockUserRepo, sessions *mock_repository.MockSessionRepo) {
+				existing := user
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&existing, nil)
+				users.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, updated *model.User) (*model.User, error) {
+						require.NotEqual(t, user.Password, updated.Password)
+						return updated, nil
+					})
+				sessions.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Eq(user.ID), gomock.Eq(sessionId)).
+					Times(1).
+					Return(nil)
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "WrongCurrentPassword",
+			current: password + "x",
+			buildStubs: func(users *mock_repository.MockUserRepo, sessions *mock_repository.MockSessionRepo) {
+				existing := user
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&existing, nil)
+				users.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				sessions.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			code: http.StatusForbidden,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			sessionRepo := mock_repository.NewMockSessionRepo(ctrl)
+
+			tc.buildStubs(userRepo, sessionRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Session = sessionRepo
+
+			e := echo.New()
+			e.Validator = validator.NewValidator()
+
+			body := fmt.Sprintf(`{"currentPassword": %q, "newPassword": %q}`, tc.current, util2.RandomString(10))
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/users/me/password", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userId", user.ID)
+			c.Set("sessionId", sessionId)
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			userController := NewUserController(context.Background(), serviceManager)
+			err = userController.ChangePassword(c)
+
+			if tc.code == http.StatusOK {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, rec.Code)
+				return
+			}
+			requireHTTPError(t, err, tc.code)
+		})
+	}
+}
+
+func TestConfirmEmailChangeAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	token := util2.RandomString(43)
+	newEmail := util2.RandomEmail()
+	usedAt := time.Now()
+
+	testCases := []struct {
+		name       string
+		buildStubs func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockUserTokenRepo)
+		code       int
+	}{
+		{
+			name: "OK",
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockUserTokenRepo) {
+				userToken := model.UserToken{ID: 7, UserId: user.ID, Data: newEmail, ExpiresAt: time.Now().Add(time.Hour)}
+				tokens.EXPECT().GetUserToken(gomock.Any(), gomock.Eq(model.TokenEmailChange), gomock.Eq(util2.HashToken(token))).
+					Times(1).
+					Return(&userToken, nil)
+				tokens.EXPECT().UseUserToken(gomock.Any(), gomock.Eq(userToken.ID)).
+					Times(1).
+					Return(true, nil)
+				users.EXPECT().GetUser(gomock.Any(), gomock.Eq(newEmail)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+				existing := user
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&existing, nil)
+				users.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, updated *model.User) (*model.User, error) {
+						require.Equal(t, newEmail, updated.Email)
+						return updated, nil
+					})
+			},
+			code: http.StatusOK,
+		},
+		{
+			name: "AlreadyUsed",
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockUserTokenRepo) {
+				userToken := model.UserToken{ID: 7, UserId: user.ID, Data: newEmail, ExpiresAt: time.Now().Add(time.Hour), UsedAt: &usedAt}
+				tokens.EXPECT().GetUserToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&userToken, nil)
+				users.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			code: http.StatusGone,
+		},
+		{
+			name: "EmailTaken",
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockUserTokenRepo) {
+				userToken := model.UserToken{ID: 7, UserId: user.ID, Data: newEmail, ExpiresAt: time.Now().Add(time.Hour)}
+				tokens.EXPECT().GetUserToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&userToken, nil)
+				tokens.EXPECT().UseUserToken(gomock.Any(), gomock.Eq(userToken.ID)).
+					Times(1).
+					Return(true, nil)
+				users.EXPECT().GetUser(gomock.Any(), gomock.Eq(newEmail)).
+					Times(1).
+					Return(&model.User{ID: user.ID + 1, Email: newEmail}, nil)
+				users.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			code: http.StatusConflict,
+		},
+		{
+			name: "EmailOfTrashedUser",
+			buildStubs: func(users *mock_repository.MockUserRepo, tokens *mock_repository.MockUserTokenRepo) {
+				userToken := model.UserToken{ID: 7, UserId: user.ID, Data: newEmail, ExpiresAt: time.Now().Add(time.Hour)}
+				tokens.EXPECT().GetUserToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&userToken, nil)
+				tokens.EXPECT().UseUserToken(gomock.Any(), gomock.Eq(userToken.ID)).
+					Times(1).
+					Return(true, nil)
+				// GetUser doesn't see the trashed user, the unique index does
+				users.EXPECT().GetUser(gomock.Any(), gomock.Eq(newEmail)).
+					Times(1).
+					Return(nil, types.ErrNotFound)
+				existing := user
+				users.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&existing, nil)
+				users.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, types.ErrConflict)
+			},
+			code: http.StatusConflict,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+
+			userRepo := mock_repository.NewMockUserRepo(ctrl)
+			postRepo := mock_repository.NewMockPostRepo(ctrl)
+			commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+			tokenRepo := mock_repository.NewMockUserTokenRepo(ctrl)
+
+			tc.buildStubs(userRepo, tokenRepo)
+
+			store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+			require.NoError(t, err)
+			store.Token = tokenRepo
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users/email/confirm?token="+token, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+			require.NoError(t, err)
+
+			userController := NewUserController(context.Background(), serviceManager)
+			err = userController.ConfirmEmailChange(c)
+
+			if tc.code == http.StatusOK {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, rec.Code)
+				return
+			}
+			requireHTTPError(t, err, tc.code)
+		})
+	}
+}
+
+func TestPasswordResetAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	newPassword := util2.RandomString(10)
+
+	ctrl := gomock.NewController(t)
+
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+	sessionRepo := mock_repository.NewMockSessionRepo(ctrl)
+	tokenRepo := mock_repository.NewMockUserTokenRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+	store.Session = sessionRepo
+	store.Token = tokenRepo
+
+	cfg := testConfig()
+	cfg.PasswordResetURL = "https://blog.example/password/reset?lang=en"
+	mailer := mail.NewMemorySender()
+	serviceManager, err := service.NewManagerWithMailer(context.Background(), store, cfg, mailer)
+	require.NoError(t, err)
+
+	userController := NewUserController(context.Background(), serviceManager)
+
+	e := echo.New()
+	e.Validator = validator.NewValidator()
+
+	post := func(body string, handler echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, handler(e.NewContext(req, rec))
+	}
+
+	// Unknown addresses get the same answer but no mail
+	userRepo.EXPECT().GetUser(gomock.Any(), gomock.Eq("nobody@email.com")).
+		Times(1).
+		Return(nil, types.ErrNotFound)
+
+	rec, err := post(`{"email": "nobody@email.com"}`, userController.ForgotPassword)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Empty(t, mailer.Messages())
+
+	var stored model.UserToken
+	userRepo.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Email)).
+		Times(1).
+		Return(&user, nil)
+	tokenRepo.EXPECT().DeleteUserTokens(gomock.Any(), gomock.Eq(user.ID), gomock.Eq(model.TokenPasswordReset)).
+		Times(1).
+		Return(nil)
+	tokenRepo.EXPECT().CreateUserToken(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, token *model.UserToken) error {
+			stored = *token
+			stored.ID = 1
+			return nil
+		})
+
+	rec, err = post(fmt.Sprintf(`{"email": %q}`, user.Email), userController.ForgotPassword)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	messages := mailer.Messages()
+	require.Len(t, messages, 1)
+	require.Equal(t, user.Email, messages[0].To)
+
+	// The mail links to the frontend page with the plain token, the database
+	// only holds its hash
+	match := regexp.MustCompile(`https://blog\.example/password/reset\?lang=en&token=([A-Za-z0-9_-]+)`).FindStringSubmatch(messages[0].Body)
+	require.Len(t, match, 2)
+	token := match[1]
+	require.Equal(t, util2.HashToken(token), stored.TokenHash)
+	require.True(t, stored.ExpiresAt.After(time.Now()))
+
+	tokenRepo.EXPECT().GetUserToken(gomock.Any(), gomock.Eq(model.TokenPasswordReset), gomock.Eq(stored.TokenHash)).
+		Times(1).
+		Return(&stored, nil)
+	tokenRepo.EXPECT().UseUserToken(gomock.Any(), gomock.Eq(stored.ID)).
+		Times(1).
+		Return(true, nil)
+	existing := user
+	userRepo.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(&existing, nil)
+	userRepo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, updated *model.User) (*model.User, error) {
+			require.NoError(t, util2.CheckPassword(newPassword, updated.Password))
+			return updated, nil
+		})
+	sessionRepo.EXPECT().RevokeUserSessions(gomock.Any(), gomock.Eq(user.ID), gomock.Eq("")).
+		Times(1).
+		Return(nil)
+
+	rec, err = post(fmt.Sprintf(`{"token": %q, "password": %q}`, token, newPassword), userController.ResetPassword)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// The token is single-use
+	used := stored
+	usedAt := time.Now()
+	used.UsedAt = &usedAt
+	tokenRepo.EXPECT().GetUserToken(gomock.Any(), gomock.Eq(model.TokenPasswordReset), gomock.Eq(stored.TokenHash)).
+		Times(1).
+		Return(&used, nil)
+
+	_, err = post(fmt.Sprintf(`{"token": %q, "password": %q}`, token, newPassword), userController.ResetPassword)
+	requireHTTPError(t, err, http.StatusGone)
+}
+
+func TestEmailVerificationAPI(t *testing.T) {
+	user, password := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+
+	mailer := mail.NewMemorySender()
+	serviceManager, err := service.NewManagerWithMailer(context.Background(), store, testConfig(), mailer)
+	require.NoError(t, err)
+
+	userController := NewUserController(context.Background(), serviceManager)
+
+	e := echo.New()
+	e.Validator = validator.NewValidator()
+
+	// New users start unverified and get a link
+	var created model.User
+	userRepo.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, u *model.User) (uint, error) {
+			created = *u
+			created.ID = user.ID
+			return user.ID, nil
+		})
+
+	body := fmt.Sprintf(`{"name": %q, "email": %q, "password": %q}`, user.Name, user.Email, password)
+	req := httptest.NewRequest(http.MethodPost, "/auth/sign-up", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	require.NoError(t, userController.SignUp(e.NewContext(req, rec)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Nil(t, created.EmailVerifiedAt)
+	require.NotNil(t, created.VerificationSentAt)
+
+	messages := mailer.Messages()
+	require.Len(t, messages, 1)
+	require.Equal(t, user.Email, messages[0].To)
+
+	match := regexp.MustCompile(`token=([A-Za-z0-9_.%-]+)`).FindStringSubmatch(messages[0].Body)
+	require.Len(t, match, 2)
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+
+	verify := func(token string) error {
+		req := httptest.NewRequest(http.MethodGet, "/auth/verify?token="+url.QueryEscape(token), nil)
+		return userController.VerifyEmail(e.NewContext(req, httptest.NewRecorder()))
+	}
+
+	// Tampered and foreign links are rejected without touching the database
+	requireHTTPError(t, verify(token+"x"), http.StatusGone)
+	requireHTTPError(t, verify(util2.Sign([]byte("some-other-secret-value"), fmt.Sprintf("verify:%d:%s", user.ID, user.Email), time.Now().Add(time.Hour))), http.StatusGone)
+
+	// A link for an address the user no longer has is stale
+	moved := created
+	moved.Email = "moved@email.com"
+	userRepo.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(&moved, nil)
+	requireHTTPError(t, verify(token), http.StatusGone)
+
+	unverified := created
+	userRepo.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(&unverified, nil)
+	userRepo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, updated *model.User) (*model.User, error) {
+			require.NotNil(t, updated.EmailVerifiedAt)
+			return updated, nil
+		})
+	require.NoError(t, verify(token))
+
+	resend := func() error {
+		req := httptest.NewRequest(http.MethodPost, "/auth/verify/resend", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set("userId", user.ID)
+		return userController.ResendVerification(c)
+	}
+
+	// Resending is throttled
+	recent := created
+	userRepo.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(&recent, nil)
+	requireHTTPError(t, resend(), http.StatusTooManyRequests)
+
+	stale := created
+	sentAt := time.Now().Add(-time.Hour)
+	stale.VerificationSentAt = &sentAt
+	userRepo.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(&stale, nil)
+	userRepo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, updated *model.User) (*model.User, error) {
+			require.True(t, updated.VerificationSentAt.After(sentAt))
+			return updated, nil
+		})
+	require.NoError(t, resend())
+	require.Len(t, mailer.Messages(), 2)
+
+	verified := created
+	verifiedAt := time.Now()
+	verified.EmailVerifiedAt = &verifiedAt
+	userRepo.EXPECT().GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return(&verified, nil)
+	requireHTTPError(t, resend(), http.StatusConflict)
+}
+
+func TestLockoutsAPI(t *testing.T) {
+	lockedUntil := time.Now().Add(10 * time.Minute)
+	lockouts := []model.LoginThrottle{
+		{ID: 1, Subject: "account:someone@email.com", Failures: 5, LastFailureAt: time.Now(), LockedUntil: &lockedUntil},
+		{ID: 2, Subject: "ip:192.0.2.1", Failures: 50, LastFailureAt: time.Now(), LockedUntil: &lockedUntil},
+	}
+
+	ctrl := gomock.NewController(t)
+
+	userRepo := mock_repository.NewMockUserRepo(ctrl)
+	postRepo := mock_repository.NewMockPostRepo(ctrl)
+	commentRepo := mock_repository.NewMockCommentRepo(ctrl)
+	loginRepo := mock_repository.NewMockLoginThrottleRepo(ctrl)
+
+	store, err := repository.New(context.Background(), &gorm.DB{}, userRepo, postRepo, commentRepo)
+	require.NoError(t, err)
+	store.Login = loginRepo
+
+	serviceManager, err := service.NewManager(context.Background(), store, testConfig())
+	require.NoError(t, err)
+
+	userController := NewUserController(context.Background(), serviceManager)
+	e := echo.New()
+
+	loginRepo.EXPECT().GetLockouts(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(lockouts, nil)
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, userController.GetLockouts(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var output []model.LoginThrottle
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &output))
+	require.Len(t, output, 2)
+	require.Equal(t, lockouts[0].Subject, output[0].Subject)
+
+	clearLockout := func(id string) (*httptest.ResponseRecorder, error) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		return rec, userController.ClearLockout(c)
+	}
+
+	loginRepo.EXPECT().DeleteThrottle(gomock.Any(), gomock.Eq(uint(1))).
+		Times(1).
+		Return(nil)
+	rec, err = clearLockout("1")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	loginRepo.EXPECT().DeleteThrottle(gomock.Any(), gomock.Eq(uint(3))).
+		Times(1).
+		Return(types.ErrNotFound)
+	_, err = clearLockout("3")
+	requireHTTPError(t, err, http.StatusNotFound)
+
+	_, err = clearLockout("abc")
+	requireHTTPError(t, err, http.StatusBadRequest)
+}
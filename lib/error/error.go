@@ -41,6 +41,10 @@ func Error(err error, ctx echo.Context) {
 		errObj.Code = http.StatusGone
 	case types.ErrUnauthorized:
 		errObj.Code = http.StatusUnauthorized
+	case types.ErrTooManyRequests:
+		errObj.Code = http.StatusTooManyRequests
+	case types.ErrTooLarge:
+		errObj.Code = http.StatusRequestEntityTooLarge
 	}
 	he, ok := err.(*echo.HTTPError)
 	if ok {
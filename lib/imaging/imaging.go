@@ -0,0 +1,200 @@
+// Package imaging decodes uploaded images, strips their metadata and renders
+// the resized variants served in their place.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Format is an encoding variants are written in
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	WebP Format = "webp"
+)
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Extension returns the file extension of the format
+func (f Format) Extension() string {
+	if f == JPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// Variant is a rendition of an image that fits in a Size by Size square
+type Variant struct {
+	Name string
+	Size int
+}
+
+var variantName = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// ParseVariants parses a comma separated list of name:size pairs such as
+// "thumbnail:320,medium:800"
+func ParseVariants(list string) ([]Variant, error) {
+	var variants []Variant
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, size, ok := strings.Cut(item, ":")
+		if !ok || !variantName.MatchString(name) {
+			return nil, fmt.Errorf("invalid variant %q, want name:size", item)
+		}
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid size of variant %q", name)
+		}
+		for _, v := range variants {
+			if v.Name == name {
+				return nil, fmt.Errorf("duplicate variant %q", name)
+			}
+		}
+
+		variants = append(variants, Variant{Name: name, Size: n})
+	}
+	return variants, nil
+}
+
+// Supported reports whether images of the content type can be processed
+func Supported(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Dimensions returns the size the image is displayed at, without decoding
+// its pixels
+func Dimensions(data []byte) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if transposed(Orientation(data)) {
+		return cfg.Height, cfg.Width, nil
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// Decode decodes the image, the first frame of animations, and turns it
+// upright as its EXIF orientation says
+func Decode(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return orient(img, Orientation(data)), nil
+}
+
+// Fit scales the image down to fit in a size by size square, smaller images
+// are returned as they are
+func Fit(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	if w >= h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
+
+// Opaque reports whether every pixel of the image is opaque
+func Opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Encode writes the image in the format. JPEG has no alpha channel, images
+// are put on white first. WebP is written losslessly, quality only applies
+// to JPEG.
+func Encode(w io.Writer, img image.Image, format Format, quality int) error {
+	switch format {
+	case JPEG:
+		if !Opaque(img) {
+			img = flatten(img, color.White)
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case WebP:
+		return EncodeWebP(w, img)
+	}
+	return fmt.Errorf("unsupported image format %q", format)
+}
+
+// ErrFormat is returned for data in no format Strip knows
+var ErrFormat = errors.New("unknown image format")
+
+// Strip removes the EXIF, XMP, IPTC and text metadata of the image without
+// re-encoding it. JPEGs keep their orientation, the only EXIF tag that
+// changes how they are displayed.
+func Strip(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	case "image/gif":
+		return stripGIF(data)
+	}
+	return nil, ErrFormat
+}
+
+// flatten draws the image over the background colour
+func flatten(img image.Image, background color.Color) image.Image {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,379 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+)
+
+var errTruncated = errors.New("image data is truncated")
+
+// Orientation returns the EXIF orientation of a JPEG, 1 when it has none
+func Orientation(data []byte) int {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xff; {
+		marker := data[pos+1]
+		if marker == 0xda || marker == 0xd9 {
+			// Metadata precede the image data
+			break
+		}
+
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			break
+		}
+		if marker == 0xe1 && bytes.HasPrefix(data[pos+4:end], exifHeader) {
+			return exifOrientation(data[pos+4+len(exifHeader) : end])
+		}
+		pos = end
+	}
+	return 1
+}
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// exifOrientation reads the orientation tag from the first IFD of the TIFF
+// structure EXIF is stored in
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		// Orientation is a single SHORT
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// orientationExif is a minimal big-endian EXIF segment holding only the
+// orientation, the value is at orientationValue
+func orientationExif(orientation int) []byte {
+	segment := []byte{
+		0xff, 0xe1, 0x00, 0x22,
+		'E', 'x', 'i', 'f', 0x00, 0x00,
+		'M', 'M', 0x00, 0x2a, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x01,
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	binary.BigEndian.PutUint16(segment[orientationValue:], uint16(orientation))
+	return segment
+}
+
+const orientationValue = 28
+
+// transposed reports whether the orientation swaps width and height
+func transposed(orientation int) bool {
+	return orientation >= 5 && orientation <= 8
+}
+
+// orient turns the image the way the EXIF orientation says it is displayed
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if transposed(orientation) {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):])
+		}
+	}
+	return dst
+}
+
+// stripJPEG drops the APP1 (EXIF and XMP), APP13 (IPTC) and comment segments
+// and puts back an EXIF segment holding only the orientation
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, ErrFormat
+	}
+
+	orientation := Orientation(data)
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xff, 0xd8)
+	if orientation == 1 {
+		orientation = 0
+	}
+
+	for pos := 2; ; {
+		if pos+2 > len(data) || data[pos] != 0xff {
+			return nil, errTruncated
+		}
+		marker := data[pos+1]
+		if marker == 0xff {
+			// Fill byte
+			pos++
+			continue
+		}
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd9 {
+			// Markers without a length
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			if marker == 0xd9 {
+				return out, nil
+			}
+			continue
+		}
+
+		if pos+4 > len(data) {
+			return nil, errTruncated
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			return nil, errTruncated
+		}
+
+		// The orientation goes after JFIF, which has to come first
+		if orientation != 0 && marker != 0xe0 {
+			out = append(out, orientationExif(orientation)...)
+			orientation = 0
+		}
+
+		switch {
+		case marker == 0xda:
+			// The scans follow, nothing is stripped from them
+			return append(out, data[pos:]...), nil
+		case marker == 0xe1 || marker == 0xed || marker == 0xfe:
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+}
+
+// strippedPNGChunks hold EXIF, text and the modification time
+var strippedPNGChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrFormat
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	for pos := len(pngSignature); ; {
+		if pos+8 > len(data) {
+			return nil, errTruncated
+		}
+		// Length, type, data and CRC
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos {
+			return nil, errTruncated
+		}
+
+		kind := string(data[pos+4 : pos+8])
+		if !strippedPNGChunks[kind] {
+			out = append(out, data[pos:end]...)
+		}
+		if kind == "IEND" {
+			return out, nil
+		}
+		pos = end
+	}
+}
+
+// VP8X flags of the metadata chunks
+const (
+	webpExifFlag = 0x08
+	webpXMPFlag  = 0x04
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrFormat
+	}
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, errTruncated
+		}
+		// Chunks are padded to an even size
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size&1
+		if end > len(data) || end < pos {
+			if pos+8+size != len(data) {
+				return nil, errTruncated
+			}
+			// Writers may leave off the last padding byte
+			end = len(data)
+		}
+
+		switch kind := string(data[pos : pos+4]); kind {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= webpExifFlag | webpXMPFlag
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// gifApplications are the application extensions kept, they make
+// animations loop
+var gifApplications = map[string]bool{
+	"NETSCAPE2.0": true,
+	"ANIMEXTS1.0": true,
+}
+
+// stripGIF drops the comment extensions and the application extensions
+// other than looping, XMP is stored in one
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || string(data[:3]) != "GIF" {
+		return nil, ErrFormat
+	}
+
+	// Header, logical screen descriptor and global colour table
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+	if pos > len(data) {
+		return nil, errTruncated
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:pos]...)
+
+	for pos < len(data) {
+		start := pos
+		switch data[pos] {
+		case 0x3b:
+			// Trailer
+			return append(out, 0x3b), nil
+		case 0x21:
+			if pos+2 > len(data) {
+				return nil, errTruncated
+			}
+			label := data[pos+1]
+			end, err := gifSubBlocks(data, pos+2)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+
+			if label == 0xfe {
+				continue
+			}
+			if label == 0xff {
+				if start+14 > len(data) || data[start+2] != 11 || !gifApplications[string(data[start+3:start+14])] {
+					continue
+				}
+			}
+			out = append(out, data[start:end]...)
+		case 0x2c:
+			// Image descriptor, local colour table, LZW code size and data
+			pos += 10
+			if pos > len(data) {
+				return nil, errTruncated
+			}
+			if data[pos-1]&0x80 != 0 {
+				pos += 3 << (data[pos-1]&0x07 + 1)
+			}
+			end, err := gifSubBlocks(data, pos+1)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+			out = append(out, data[start:end]...)
+		default:
+			return nil, ErrFormat
+		}
+	}
+	return nil, errTruncated
+}
+
+// gifSubBlocks returns where the sub-blocks starting at pos end
+func gifSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, errTruncated
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
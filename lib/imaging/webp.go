@@ -0,0 +1,333 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// maxWebPSize is the largest width and height VP8L can store
+const maxWebPSize = 1 << 14
+
+// codeLengthOrder is the order code lengths of the code length code are
+// written in
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes the image as a lossless WebP. The encoder is simple: the
+// green channel is subtracted from red and blue, and every pixel is written
+// as literals under one prefix code per channel. There is no LZ77 or colour
+// cache, which suits the small variants it is used for.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxWebPSize || height > maxWebPSize {
+		return errors.New("image is too large for WebP")
+	}
+
+	src := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	// Subtract green and count the symbols of each channel
+	var histograms [4][256]int
+	opaque := true
+	for i := 0; i < len(src.Pix); i += 4 {
+		for c, symbol := range greenSubtracted(src.Pix[i:]) {
+			histograms[c][symbol]++
+		}
+		opaque = opaque && src.Pix[i+3] == 0xff
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3)
+
+	// The subtract green transform, then no more transforms
+	bw.write(1, 1)
+	bw.write(2, 2)
+	bw.write(0, 1)
+
+	// No colour cache and no meta prefix codes
+	bw.write(0, 1)
+	bw.write(0, 1)
+
+	// Green has the backward reference lengths after its literals, there are
+	// no backward references and so no distances
+	var codes [4]prefixCode
+	for c := range histograms {
+		size := 256
+		if c == 0 {
+			size += 24
+		}
+		counts := make([]int, size)
+		copy(counts, histograms[c][:])
+		codes[c] = writePrefixCode(bw, counts)
+	}
+	writePrefixCode(bw, make([]int, 40))
+
+	for i := 0; i < len(src.Pix); i += 4 {
+		for c, symbol := range greenSubtracted(src.Pix[i:]) {
+			codes[c].write(bw, int(symbol))
+		}
+	}
+
+	data := bw.bytes()
+	size := len(data)
+	if size%2 == 1 {
+		data = append(data, 0)
+	}
+
+	header := make([]byte, 20)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(size))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// greenSubtracted returns the green, red, blue and alpha symbols of the
+// NRGBA pixel, with green subtracted from red and blue
+func greenSubtracted(pix []uint8) [4]uint8 {
+	r, g, b, a := pix[0], pix[1], pix[2], pix[3]
+	return [4]uint8{g, r - g, b - g, a}
+}
+
+// bitWriter packs bits least significant first
+type bitWriter struct {
+	buf  []byte
+	bits uint64
+	n    uint
+}
+
+func (w *bitWriter) write(bits uint32, n uint) {
+	w.bits |= uint64(bits) << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.n -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.n > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.n = 0, 0
+	}
+	return w.buf
+}
+
+// prefixCode holds each symbol's code reversed, as it is written, and its
+// length. Codes of a single symbol take no bits.
+type prefixCode struct {
+	codes   []uint32
+	lengths []uint8
+}
+
+func (c prefixCode) write(w *bitWriter, symbol int) {
+	if n := c.lengths[symbol]; n > 0 {
+		w.write(c.codes[symbol], uint(n))
+	}
+}
+
+// writePrefixCode writes the code built for the symbol counts and returns it
+func writePrefixCode(w *bitWriter, counts []int) prefixCode {
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	// Up to two symbols below 256 fit a simple code
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		if len(used) == 0 {
+			used = []int{0}
+		}
+
+		w.write(1, 1)
+		w.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(used[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			w.write(uint32(used[1]), 8)
+		}
+
+		code := prefixCode{codes: make([]uint32, len(counts)), lengths: make([]uint8, len(counts))}
+		if len(used) == 2 {
+			code.codes[used[1]] = 1
+			code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+		}
+		return code
+	}
+
+	lengths := codeLengths(counts, 15)
+
+	// The lengths are written literally under a code of their own
+	lengthCounts := make([]int, 19)
+	for _, n := range lengths {
+		lengthCounts[n]++
+	}
+	lengthLengths := codeLengths(lengthCounts, 7)
+
+	last := 3
+	for i, symbol := range codeLengthOrder {
+		if lengthLengths[symbol] > 0 && i > last {
+			last = i
+		}
+	}
+
+	w.write(0, 1)
+	w.write(uint32(last+1-4), 4)
+	for _, symbol := range codeLengthOrder[:last+1] {
+		w.write(uint32(lengthLengths[symbol]), 3)
+	}
+	// All symbols' lengths follow
+	w.write(0, 1)
+
+	lengthCode := canonicalCode(lengthLengths)
+	for _, n := range lengths {
+		lengthCode.write(w, int(n))
+	}
+
+	return canonicalCode(lengths)
+}
+
+// codeLengths returns Huffman code lengths of at most limit bits for the
+// symbol counts. Counts are halved until the code fits, they end up equal.
+func codeLengths(counts []int, limit int) []uint8 {
+	adjusted := make([]int, len(counts))
+	for shift := 0; ; shift++ {
+		for symbol, count := range counts {
+			if count > 0 {
+				adjusted[symbol] = count>>shift | 1
+			}
+		}
+
+		lengths := huffmanLengths(adjusted)
+		fits := true
+		for _, n := range lengths {
+			if int(n) > limit {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			return lengths
+		}
+	}
+}
+
+// huffmanLengths returns the depth of each symbol in a Huffman tree built
+// for the counts. A lone symbol gets a length of 1, unused ones 0.
+func huffmanLengths(counts []int) []uint8 {
+	type node struct {
+		count       int
+		symbol      int
+		left, right int
+	}
+
+	var nodes []node
+	var queue []int
+	for symbol, count := range counts {
+		if count > 0 {
+			nodes = append(nodes, node{count: count, symbol: symbol, left: -1, right: -1})
+			queue = append(queue, len(nodes)-1)
+		}
+	}
+
+	lengths := make([]uint8, len(counts))
+	if len(queue) == 1 {
+		lengths[nodes[0].symbol] = 1
+		return lengths
+	}
+
+	for len(queue) > 1 {
+		sort.SliceStable(queue, func(i, j int) bool {
+			return nodes[queue[i]].count < nodes[queue[j]].count
+		})
+		nodes = append(nodes, node{
+			count:  nodes[queue[0]].count + nodes[queue[1]].count,
+			symbol: -1,
+			left:   queue[0],
+			right:  queue[1],
+		})
+		queue = append(queue[2:], len(nodes)-1)
+	}
+
+	var walk func(n int, depth uint8)
+	walk = func(n int, depth uint8) {
+		if nodes[n].symbol >= 0 {
+			lengths[nodes[n].symbol] = depth
+			return
+		}
+		walk(nodes[n].left, depth+1)
+		walk(nodes[n].right, depth+1)
+	}
+	if len(queue) == 1 {
+		walk(queue[0], 0)
+	}
+	return lengths
+}
+
+// canonicalCode assigns the canonical codes for the lengths
+func canonicalCode(lengths []uint8) prefixCode {
+	code := prefixCode{codes: make([]uint32, len(lengths)), lengths: append([]uint8(nil), lengths...)}
+
+	used := 0
+	var counts [16]uint32
+	for _, n := range lengths {
+		if n > 0 {
+			counts[n]++
+			used++
+		}
+	}
+	if used == 1 {
+		// The decoder reads no bits for a single symbol
+		for i := range code.lengths {
+			code.lengths[i] = 0
+		}
+		return code
+	}
+
+	var next [16]uint32
+	for n, c := uint32(0), 1; c < 16; c++ {
+		n = (n + counts[c-1]) << 1
+		next[c] = n
+	}
+
+	for symbol, n := range lengths {
+		if n == 0 {
+			continue
+		}
+		c := next[n]
+		next[n]++
+
+		// Codes are read most significant bit first
+		var reversed uint32
+		for i := uint8(0); i < n; i++ {
+			reversed = reversed<<1 | c>>i&1
+		}
+		code.codes[symbol] = reversed
+	}
+	return code
+}
@@ -0,0 +1,148 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+)
+
+// randomImage fills a width by height image with random colours, opaque or
+// with random alpha
+func randomImage(rnd *rand.Rand, width, height int, alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rnd.Read(img.Pix)
+	if !alpha {
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 0xff
+		}
+	}
+	return img
+}
+
+// skewedImage repeats grey levels by the Fibonacci numbers, so an optimal
+// prefix code would be deeper than the 15 bits VP8L allows
+func skewedImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 70))
+	pos, a, b := 0, 1, 1
+	for level := 1; level <= 20; level++ {
+		for i := 0; i < a; i++ {
+			img.Pix[pos], img.Pix[pos+1], img.Pix[pos+2] = uint8(level), uint8(level), uint8(level)
+			img.Pix[pos+3] = 0xff
+			pos += 4
+		}
+		a, b = b, a+b
+	}
+	return img
+}
+
+// requireLossless encodes the image, decodes it again and compares the pixels
+func requireLossless(t *testing.T, img image.Image) {
+	var buf bytes.Buffer
+	require.NoError(t, EncodeWebP(&buf, img))
+
+	decoded, err := webp.Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, img.Bounds().Size(), decoded.Bounds().Size())
+
+	want := image.NewNRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(want, want.Bounds(), img, img.Bounds().Min, draw.Src)
+	got := image.NewNRGBA(want.Bounds())
+	draw.Draw(got, got.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	require.True(t, bytes.Equal(want.Pix, got.Pix), "decoded pixels differ")
+}
+
+func TestEncodeWebP(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	uniform := image.NewNRGBA(image.Rect(0, 0, 7, 5))
+	draw.Draw(uniform, uniform.Bounds(), image.NewUniform(color.NRGBA{0x12, 0x34, 0x56, 0x78}), image.Point{}, draw.Src)
+
+	offset := randomImage(rnd, 40, 30, true).SubImage(image.Rect(5, 7, 33, 29))
+
+	testCases := []struct {
+		name string
+		img  image.Image
+	}{
+		{name: "OnePixel", img: randomImage(rnd, 1, 1, false)},
+		{name: "Uniform", img: uniform},
+		{name: "Opaque", img: randomImage(rnd, 97, 61, false)},
+		{name: "Alpha", img: randomImage(rnd, 61, 97, true)},
+		{name: "Transparent", img: image.NewNRGBA(image.Rect(0, 0, 9, 9))},
+		{name: "Skewed", img: skewedImage()},
+		{name: "Offset", img: offset},
+		{name: "Gray", img: image.NewGray(image.Rect(0, 0, 3, 4))},
+		{name: "Widest", img: randomImage(rnd, maxWebPSize, 1, true)},
+		{name: "Tallest", img: randomImage(rnd, 1, maxWebPSize, true)},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			requireLossless(t, tc.img)
+		})
+	}
+}
+
+func TestEncodeWebPVariants(t *testing.T) {
+	variants, err := ParseVariants("thumbnail:320,medium:800,large:1600")
+	require.NoError(t, err)
+
+	rnd := rand.New(rand.NewSource(2))
+	for _, alpha := range []bool{false, true} {
+		src := randomImage(rnd, 1700, 1100, alpha)
+
+		for _, v := range variants {
+			t.Run(fmt.Sprintf("%s/alpha=%t", v.Name, alpha), func(t *testing.T) {
+				img := Fit(src, v.Size)
+				require.Equal(t, v.Size, img.Bounds().Dx())
+				requireLossless(t, img)
+			})
+		}
+	}
+}
+
+func TestEncodeWebPTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	require.Error(t, EncodeWebP(&buf, image.NewNRGBA(image.Rect(0, 0, maxWebPSize+1, 1))))
+	require.Error(t, EncodeWebP(&buf, image.NewNRGBA(image.Rect(0, 0, 0, 0))))
+	require.Zero(t, buf.Len())
+}
+
+func TestCodeLengths(t *testing.T) {
+	// Fibonacci counts make the Huffman tree as deep as there are symbols
+	counts := make([]int, 30)
+	a, b := 1, 1
+	for symbol := range counts {
+		counts[symbol] = a
+		a, b = b, a+b
+	}
+
+	deepest := func(lengths []uint8) int {
+		n := 0
+		for _, length := range lengths {
+			if int(length) > n {
+				n = int(length)
+			}
+		}
+		return n
+	}
+	require.Greater(t, deepest(huffmanLengths(counts)), 15)
+
+	lengths := codeLengths(counts, 15)
+	require.LessOrEqual(t, deepest(lengths), 15)
+
+	// The lengths still make a complete prefix code
+	var kraft float64
+	for _, length := range lengths {
+		require.NotZero(t, length)
+		kraft += 1 / float64(uint(1)<<length)
+	}
+	require.Equal(t, 1.0, kraft)
+}
@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// SMTPSender delivers messages through an SMTP server. STARTTLS is used when
+// the server offers it.
+type SMTPSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPSender creates a sender for the server at host:port. Authentication
+// is skipped when no username is given.
+func NewSMTPSender(host string, port int, username, password, from string) *SMTPSender {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPSender{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		auth: auth,
+		from: from,
+	}
+}
+
+// Send delivers the message
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	// Guard against header injection through the recipient
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return errors.New("invalid recipient")
+	}
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, encode(s.from, msg))
+}
@@ -0,0 +1,101 @@
+package markdown
+
+import (
+	"bytes"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+	"regexp"
+)
+
+// Policy is how much of Markdown and HTML a body may use
+type Policy int
+
+const (
+	// Post allows raw HTML and images, whatever survives sanitizing
+	Post Policy = iota
+	// Comment strips raw HTML and images
+	Comment
+)
+
+// highlighted marks up fenced code blocks with chroma's CSS classes, clients
+// style them with any chroma stylesheet
+var highlighted = highlighting.NewHighlighting(
+	highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+)
+
+// gfm is GitHub's flavor with table alignment written as an attribute the
+// sanitizers keep
+var gfm = []goldmark.Extender{
+	extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+	extension.Strikethrough,
+	extension.Linkify,
+	extension.TaskList,
+}
+
+var (
+	postMarkdown = goldmark.New(
+		goldmark.WithExtensions(append(gfm, highlighted)...),
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)
+	// Without html.WithUnsafe raw HTML is left out of comments
+	commentMarkdown = goldmark.New(
+		goldmark.WithExtensions(append(gfm, highlighted)...),
+	)
+)
+
+var (
+	postSanitizer    = allowRendered(bluemonday.UGCPolicy())
+	commentSanitizer = allowRendered(commentPolicy())
+)
+
+// chromaClass matches the classes chroma puts on code
+var chromaClass = regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)
+
+// allowRendered lets through what the renderer itself writes, highlighted
+// code, task list checkboxes and table alignment
+func allowRendered(p *bluemonday.Policy) *bluemonday.Policy {
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("class").Matching(chromaClass).OnElements("pre", "code", "span")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// commentPolicy is UGCPolicy without images, media and the attributes that
+// only raw HTML could set
+func commentPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowStandardURLs()
+	p.AllowAttrs("href").OnElements("a")
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	p.AllowElements("p", "br", "hr", "blockquote", "pre", "code", "span",
+		"strong", "em", "del", "h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowLists()
+	p.AllowTables()
+
+	return p
+}
+
+// Render turns Markdown (CommonMark with GitHub tables, task lists,
+// strikethrough and autolinks) into HTML that is safe to embed under the
+// policy
+func Render(source string, policy Policy) (string, error) {
+	md, sanitizer := postMarkdown, postSanitizer
+	if policy == Comment {
+		md, sanitizer = commentMarkdown, commentSanitizer
+	}
+
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+
+	return sanitizer.Sanitize(buf.String()), nil
+}
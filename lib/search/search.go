@@ -0,0 +1,143 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SnippetLength is the length of snippets in runes
+const SnippetLength = 160
+
+type token struct {
+	start, end int
+	term       string
+}
+
+// tokenize splits text into lower cased words of letters and digits
+func tokenize(text string) []token {
+	var tokens []token
+
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			tokens = append(tokens, token{start: start, end: i, term: strings.ToLower(text[start:i])})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{start: start, end: len(text), term: strings.ToLower(text[start:])})
+	}
+
+	return tokens
+}
+
+// Terms returns the words of text in the form they are indexed, in order
+func Terms(text string) []string {
+	tokens := tokenize(text)
+
+	terms := make([]string, len(tokens))
+	for i, t := range tokens {
+		terms[i] = t.term
+	}
+
+	return terms
+}
+
+// Highlight escapes text for HTML and wraps the words matching terms in <mark>
+func Highlight(text string, terms []string) string {
+	return highlight(text, tokenize(text), termSet(terms))
+}
+
+// Snippet cuts about SnippetLength runes around the first match out of text
+// and highlights it
+func Snippet(text string, terms []string) string {
+	tokens := tokenize(text)
+	set := termSet(terms)
+
+	first := 0
+	for i, t := range tokens {
+		if set[t.term] {
+			first = i
+			break
+		}
+	}
+
+	// Keep a few words of context before the first match
+	start := 0
+	if len(tokens) > 0 {
+		start = tokens[first].start
+		for i := first - 1; i >= 0; i-- {
+			if utf8.RuneCountInString(text[tokens[i].start:tokens[first].start]) > SnippetLength/4 {
+				break
+			}
+			start = tokens[i].start
+		}
+		if first == 0 || start == tokens[0].start {
+			start = 0
+		}
+	}
+
+	end := len(text)
+	if utf8.RuneCountInString(text[start:]) > SnippetLength {
+		end = start
+		for _, t := range tokens {
+			if t.start < start {
+				continue
+			}
+			if utf8.RuneCountInString(text[start:t.end]) > SnippetLength {
+				break
+			}
+			end = t.end
+		}
+	}
+
+	var window []token
+	for _, t := range tokens {
+		if t.start >= start && t.end <= end {
+			window = append(window, token{start: t.start - start, end: t.end - start, term: t.term})
+		}
+	}
+
+	snippet := highlight(text[start:end], window, set)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+
+	return snippet
+}
+
+func highlight(text string, tokens []token, terms map[string]bool) string {
+	var b strings.Builder
+
+	last := 0
+	for _, t := range tokens {
+		if !terms[t.term] {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[last:t.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[t.start:t.end]))
+		b.WriteString("</mark>")
+		last = t.end
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+
+	return b.String()
+}
+
+func termSet(terms []string) map[string]bool {
+	set := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		set[strings.ToLower(term)] = true
+	}
+	return set
+}
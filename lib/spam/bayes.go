@@ -0,0 +1,78 @@
+package spam
+
+import (
+	"math"
+	"sort"
+)
+
+// interesting is how many tokens, the ones furthest from neutral, are
+// combined into the score of a text
+const interesting = 15
+
+// TokenCount is how many spam and ham texts a token was trained with
+type TokenCount struct {
+	Spam int64
+	Ham  int64
+}
+
+// Score returns the probability the tokens are spam, between 0 and 1, given
+// the trained counts of the tokens and of the spam and ham texts. Token
+// probabilities are smoothed towards 0.5 as Gary Robinson suggests, so rare
+// tokens weigh little, and combined with Fisher's method.
+func Score(tokens []string, counts map[string]TokenCount, spamDocs, hamDocs int64) float64 {
+	if spamDocs <= 0 || hamDocs <= 0 {
+		return 0.5
+	}
+
+	const strength, neutral = 1.0, 0.5
+	var probs []float64
+	for _, token := range tokens {
+		count, ok := counts[token]
+		if !ok {
+			continue
+		}
+		spamFreq := math.Min(float64(count.Spam)/float64(spamDocs), 1)
+		hamFreq := math.Min(float64(count.Ham)/float64(hamDocs), 1)
+		if spamFreq+hamFreq == 0 {
+			continue
+		}
+
+		n := float64(count.Spam + count.Ham)
+		p := spamFreq / (spamFreq + hamFreq)
+		p = (strength*neutral + n*p) / (strength + n)
+		probs = append(probs, math.Max(0.01, math.Min(0.99, p)))
+	}
+	if len(probs) == 0 {
+		return 0.5
+	}
+
+	sort.Slice(probs, func(i, j int) bool {
+		return math.Abs(probs[i]-neutral) > math.Abs(probs[j]-neutral)
+	})
+	if len(probs) > interesting {
+		probs = probs[:interesting]
+	}
+
+	var logSpam, logHam float64
+	for _, p := range probs {
+		logSpam += math.Log(1 - p)
+		logHam += math.Log(p)
+	}
+	n := len(probs)
+	spamness := 1 - chiSquare(-2*logSpam, 2*n)
+	hamness := 1 - chiSquare(-2*logHam, 2*n)
+	return (1 + spamness - hamness) / 2
+}
+
+// chiSquare returns the probability a chi-square distributed value with df
+// degrees of freedom, which must be even, is at least chi
+func chiSquare(chi float64, df int) float64 {
+	m := chi / 2
+	term := math.Exp(-m)
+	sum := term
+	for i := 1; i < df/2; i++ {
+		term *= m / float64(i)
+		sum += term
+	}
+	return math.Min(sum, 1)
+}
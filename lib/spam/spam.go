@@ -0,0 +1,131 @@
+// Package spam holds the text heuristics comments are checked with: links,
+// blocklists and the tokens of the naive Bayes classifier.
+package spam
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxTokens is how many distinct tokens of a text are classified
+const MaxTokens = 200
+
+// MaxTokenLength is the longest token in bytes, longer ones are dropped
+const MaxTokenLength = 64
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>()\[\]"']+`)
+
+// CountLinks counts the URLs in the text, bare, in Markdown links or in
+// HTML attributes
+func CountLinks(text string) int {
+	return len(linkPattern.FindAllStringIndex(text, -1))
+}
+
+// Blocklist matches texts against blocked words and regular expressions
+type Blocklist struct {
+	entries  []string
+	patterns []*regexp.Regexp
+}
+
+// ParseBlocklist parses a comma separated list. Words match whole words in
+// any case, entries between slashes such as /casino\s+bonus/ are regular
+// expressions, they can't hold commas.
+func ParseBlocklist(list string) (*Blocklist, error) {
+	b := &Blocklist{}
+	for _, entry := range strings.Split(list, ",") {
+		if err := b.Add(entry); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// ReadBlocklist adds the entries of a file, one per line, to the blocklist.
+// Empty lines and lines starting with # are skipped.
+func (b *Blocklist) ReadBlocklist(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); !strings.HasPrefix(line, "#") {
+			if err := b.Add(line); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// Add adds a word or a regular expression between slashes
+func (b *Blocklist) Add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return nil
+	}
+
+	expr := `(?i)(?:^|[^\pL\pN])` + regexp.QuoteMeta(entry) + `(?:[^\pL\pN]|$)`
+	if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		expr = "(?i)" + entry[1:len(entry)-1]
+	}
+
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid blocklist entry %q: %w", entry, err)
+	}
+
+	b.entries = append(b.entries, entry)
+	b.patterns = append(b.patterns, pattern)
+	return nil
+}
+
+// Len returns the number of entries
+func (b *Blocklist) Len() int {
+	return len(b.patterns)
+}
+
+// Match returns the first entry found in the text, "" if there is none
+func (b *Blocklist) Match(text string) string {
+	for i, pattern := range b.patterns {
+		if pattern.MatchString(text) {
+			return b.entries[i]
+		}
+	}
+	return ""
+}
+
+// Tokenize returns the distinct lower case words of the text, and the hosts
+// it links to prefixed with host:, at most MaxTokens of them
+func Tokenize(text string) []string {
+	seen := map[string]bool{}
+	var tokens []string
+	add := func(token string) {
+		if len(tokens) < MaxTokens && len(token) <= MaxTokenLength && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	for _, link := range linkPattern.FindAllString(text, -1) {
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		if u, err := url.Parse(link); err == nil && u.Hostname() != "" {
+			add("host:" + strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."))
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '$' && r != '\''
+	})
+	for _, word := range words {
+		word = strings.Trim(word, "'")
+		if n := utf8.RuneCountInString(word); n >= 3 && n <= 32 {
+			add(word)
+		}
+	}
+	return tokens
+}
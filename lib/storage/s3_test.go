@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an S3 bucket in memory that checks requests are signed
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+var sigV4 = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=key-id/\d{8}/eu-test-1/s3/aws4_request, ` +
+	`SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=[0-9a-f]{64}$`)
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !sigV4.MatchString(r.Header.Get("Authorization")) || r.Header.Get("X-Amz-Date") == "" {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/blog-media/") {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		require.NoError(s.t, err)
+		s.objects[r.URL.Path] = data
+	case http.MethodGet:
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	bucket := &fakeS3{t: t, objects: map[string][]byte{}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	cfg := S3Config{
+		Endpoint:  server.URL,
+		Region:    "eu-test-1",
+		Bucket:    "blog-media",
+		AccessKey: "key-id",
+		SecretKey: "secret",
+		PathStyle: true,
+	}
+	store, err := NewS3Store(cfg, nil)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	blob := []byte("not really a cat picture")
+	const key = "0123456789abcdef0123456789abcdef.png"
+
+	require.NoError(t, store.Put(ctx, key, bytes.NewReader(blob), int64(len(blob)), "image/png"))
+	require.Equal(t, blob, bucket.objects["/blog-media/"+key])
+
+	r, err := store.Get(ctx, key)
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, blob, data)
+
+	require.NoError(t, store.Delete(ctx, key))
+	require.Empty(t, bucket.objects)
+
+	// A blob missing from the bucket is not found, deleting it again is fine
+	_, err = store.Get(ctx, key)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, store.Delete(ctx, key))
+
+	// Keys can't escape the bucket
+	require.Error(t, store.Put(ctx, "../other/"+key, bytes.NewReader(blob), int64(len(blob)), "image/png"))
+
+	// Requests signed with other credentials are refused
+	cfg.AccessKey = "other-key"
+	store, err = NewS3Store(cfg, nil)
+	require.NoError(t, err)
+	_, err = store.Get(ctx, key)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrNotFound)
+}
@@ -19,6 +19,8 @@ var (
 	ErrNotAllowed          = errors.New("operation not allowed")
 	ErrBusy                = errors.New("resource is busy")
 	ErrUnauthorized        = errors.New("unauthorized")
+	ErrTooManyRequests     = errors.New("too many requests")
+	ErrTooLarge            = errors.New("entity too large")
 )
 
 // HTTPError is our custom HTTP error to get a proper string output.
@@ -1,50 +1,234 @@
 package util
 
 import (
+	"crypto"
 	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt"
 	"time"
 )
 
-type tokenClaims struct {
+// TokenClaims are the claims carried by access and MFA challenge tokens
+type TokenClaims struct {
 	jwt.StandardClaims
-	UserId uint `json:"user_id"`
+	UserId    uint   `json:"user_id"`
+	Role      string `json:"role"`
+	SessionId string `json:"sid"`
+	// Type is empty for access tokens
+	Type string `json:"typ,omitempty"`
 }
 
 const (
-	salt       = "hjqrhjqw124617ajfhajs"
-	signingKey = "qrkjk#4#%35FSFJlja#4353KSFjH"
-	tokenTTL   = 12 * time.Hour
+	// AccessTokenTTL is the lifetime of access tokens
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is the lifetime of refresh tokens
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// MFATokenTTL is the time a user has to present the second factor after the password
+	MFATokenTTL = 5 * time.Minute
+
+	// TokenTypeMFA marks the challenge token handed out between password and second factor
+	TokenTypeMFA = "mfa"
 )
 
-func GenerateToken(id uint) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(tokenTTL).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
-		id,
-	})
+// Key is a JWT signing or verification key identified by its kid
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Sign is the secret or private key, it is nil for verification-only keys
+	Sign interface{}
+	// Verify is the secret or public key
+	Verify interface{}
+}
+
+// KeySet signs tokens with the active key and verifies them with any of the
+// configured keys, which allows keys to be rotated without logging users out
+type KeySet struct {
+	issuer string
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewKeySet creates a key set signing with active and additionally accepting verification keys
+func NewKeySet(issuer string, active *Key, verification ...*Key) (*KeySet, error) {
+	if active == nil || active.Sign == nil {
+		return nil, errors.New("no signing key provided")
+	}
+
+	ks := &KeySet{
+		issuer: issuer,
+		active: active,
+		keys:   map[string]*Key{active.ID: active},
+	}
+	for _, key := range verification {
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	return ks, nil
+}
+
+// NewHMACKey creates an HS256 key from a shared secret
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("HMAC secret must be at least 16 bytes long")
+	}
+	if id == "" {
+		id = "hs-" + HashToken(string(secret))[:16]
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, Sign: secret, Verify: secret}, nil
+}
 
-	return token.SignedString([]byte(signingKey))
+// NewPrivateKey creates a signing key from an RSA, ECDSA P-256 or Ed25519 private key
+func NewPrivateKey(id string, algorithm string, private crypto.Signer) (*Key, error) {
+	key, err := NewPublicKey(id, private.Public())
+	if err != nil {
+		return nil, err
+	}
+	if algorithm != "" && algorithm != key.Method.Alg() {
+		return nil, fmt.Errorf("signing key does not match algorithm %s", algorithm)
+	}
+	key.Sign = private
+	return key, nil
 }
 
-func ParseToken(accessToken string) (uint, error) {
-	token, err := jwt.ParseWithClaims(accessToken, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
+// NewPublicKey creates a verification-only key. The kid defaults to the RFC 7638 thumbprint.
+func NewPublicKey(id string, public crypto.PublicKey) (*Key, error) {
+	method, err := signingMethodFor(public)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		id, err = Thumbprint(public)
+		if err != nil {
+			return nil, err
 		}
+	}
+	return &Key{ID: id, Method: method, Verify: public}, nil
+}
 
-		return []byte(signingKey), nil
+// GenerateToken issues an access token for the user bound to the given session
+func (ks *KeySet) GenerateToken(id uint, role string, sessionId string) (string, error) {
+	return ks.sign(&TokenClaims{
+		StandardClaims: ks.standardClaims(AccessTokenTTL),
+		UserId:         id,
+		Role:           role,
+		SessionId:      sessionId,
 	})
+}
+
+// GenerateMFAToken creates the challenge token that is exchanged for an access
+// token once the second factor has been verified
+func (ks *KeySet) GenerateMFAToken(id uint) (string, error) {
+	return ks.sign(&TokenClaims{
+		StandardClaims: ks.standardClaims(MFATokenTTL),
+		UserId:         id,
+		Type:           TokenTypeMFA,
+	})
+}
+
+// ParseToken validates the access token and returns its claims
+func (ks *KeySet) ParseToken(accessToken string) (*TokenClaims, error) {
+	claims, err := ks.parse(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != "" {
+		return nil, errors.New("token is not an access token")
+	}
+
+	if claims.SessionId == "" {
+		return nil, errors.New("token is not bound to a session")
+	}
+
+	return claims, nil
+}
+
+// ParseMFAToken validates the MFA challenge token and returns its claims
+func (ks *KeySet) ParseMFAToken(mfaToken string) (*TokenClaims, error) {
+	claims, err := ks.parse(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != TokenTypeMFA {
+		return nil, errors.New("token is not an MFA token")
+	}
+
+	return claims, nil
+}
+
+func (ks *KeySet) standardClaims(ttl time.Duration) jwt.StandardClaims {
+	return jwt.StandardClaims{
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+		IssuedAt:  time.Now().Unix(),
+		Issuer:    ks.issuer,
+	}
+}
+
+func (ks *KeySet) sign(claims *TokenClaims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+
+	return token.SignedString(ks.active.Sign)
+}
+
+func (ks *KeySet) parse(tokenString string) (*TokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, ks.keyFunc)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	claims, ok := token.Claims.(*tokenClaims)
+	claims, ok := token.Claims.(*TokenClaims)
 	if !ok {
-		return 0, errors.New("token claims are not of type *tokenClaims")
+		return nil, errors.New("token claims are not of type *TokenClaims")
 	}
 
-	return claims.UserId, nil
+	if ks.issuer != "" && !claims.VerifyIssuer(ks.issuer, true) {
+		return nil, errors.New("token issuer is invalid")
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public verification keys. Shared secrets are never published.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.ordered() {
+		jwk, err := NewJWK(key)
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, *jwk)
+	}
+	return set
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := ks.active
+	if kid, ok := token.Header["kid"].(string); ok {
+		key, ok = ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("invalid signing method")
+	}
+
+	return key.Verify, nil
+}
+
+// ordered returns the active key first followed by the remaining keys
+func (ks *KeySet) ordered() []*Key {
+	keys := []*Key{ks.active}
+	for id, key := range ks.keys {
+		if id != ks.active.ID {
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("signed value has expired")
+)
+
+// Sign returns a tamper-proof, URL-safe encoding of the value that stops being
+// valid after expires
+func Sign(secret []byte, value string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value + "|" + strconv.FormatInt(expires.Unix(), 10)))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature(secret, payload))
+}
+
+// Verify checks a value produced by Sign and returns the original value
+func Verify(secret []byte, signed string) (string, error) {
+	payload, sig, ok := strings.Cut(signed, ".")
+	if !ok {
+		return "", ErrInvalidSignature
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signature(secret, payload)) {
+		return "", ErrInvalidSignature
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	i := strings.LastIndex(string(data), "|")
+	if i < 0 {
+		return "", ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(string(data[i+1:]), 10, 64)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return "", ErrExpired
+	}
+
+	return string(data[:i]), nil
+}
+
+func signature(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -1,14 +1,105 @@
 package model
 
-import "time"
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// MaxCommentDepth is the deepest replies can nest, Path has room for no more
+const MaxCommentDepth = 16
+
+// CommentTombstone is shown in place of deleted comments that have replies
+const CommentTombstone = "[deleted]"
+
+// CommentStatus is where a comment is in moderation
+type CommentStatus string
+
+const (
+	// CommentPending comments wait in the moderation queue
+	CommentPending  CommentStatus = "pending"
+	CommentApproved CommentStatus = "approved"
+	CommentRejected CommentStatus = "rejected"
+	CommentSpam     CommentStatus = "spam"
+)
+
+// Valid reports whether the status is known
+func (s CommentStatus) Valid() bool {
+	switch s {
+	case CommentPending, CommentApproved, CommentRejected, CommentSpam:
+		return true
+	}
+	return false
+}
+
+// CommentMode is how new comments on a post are moderated
+type CommentMode string
+
+const (
+	// CommentsOpen approves comments as they are written
+	CommentsOpen CommentMode = "open"
+	// CommentsPremoderated queues every comment for a moderator
+	CommentsPremoderated CommentMode = "premoderated"
+	// CommentsClosed takes no new comments
+	CommentsClosed CommentMode = "closed"
+	// CommentsFirstPremoderated queues the comments of users who have none
+	// approved yet
+	CommentsFirstPremoderated CommentMode = "first_premoderated"
+)
+
+// Valid reports whether the mode is known
+func (m CommentMode) Valid() bool {
+	switch m {
+	case CommentsOpen, CommentsPremoderated, CommentsClosed, CommentsFirstPremoderated:
+		return true
+	}
+	return false
+}
 
 type Comment struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	CreatedAt time.Time `json:"-"`
+	ID        uint      `json:"id" gorm:"primaryKey;index:idx_comments_created,priority:2"`
+	CreatedAt time.Time `json:"-" gorm:"index:idx_comments_created,priority:1"`
 	Title     string    `json:"title"`
 	Body      string    `json:"body"`
-	UserId    uint      `json:"-"`
-	User      User      `gorm:"foreignKey:UserId" json:"-"`
-	PostId    uint      `json:"postId"`
-	Post      Post      `gorm:"foreignKey:PostId" json:"-"`
+	UserId    uint      `json:"-" gorm:"not null"`
+	User      User      `gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE" json:"-"`
+	PostId    uint      `json:"postId" gorm:"not null;index:idx_comments_thread,priority:1"`
+	Post      Post      `gorm:"foreignKey:PostId;constraint:OnDelete:CASCADE" json:"-"`
+	// BodyHTML is the Markdown body rendered by the service, images and raw
+	// HTML are stripped
+	BodyHTML string `json:"bodyHtml"`
+	// DeletedAt is set while the comment is in the trash
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	// ParentId is the comment replied to, nil for top-level comments. It has
+	// no foreign key, replies outlive the comments they answer.
+	ParentId *uint `json:"parentId" gorm:"index"`
+	// Path and Depth are set by the repository. Path lists the zero padded
+	// ids from the top-level comment down to this one, sorting by it walks a
+	// thread depth first.
+	Path  string `json:"path" gorm:"size:191;index:idx_comments_thread,priority:2"`
+	Depth int    `json:"depth"`
+	// Status is set by the service and moderators, never bound from input.
+	// Comments written before moderation existed default to approved.
+	Status CommentStatus `json:"status" gorm:"size:16;not null;default:approved;index"`
+	// ModeratedAt and ModeratedBy record the last moderator decision
+	ModeratedAt *time.Time `json:"moderatedAt"`
+	ModeratedBy *uint      `json:"-"`
+	// IP is the client address the comment was written from, for the spam
+	// checks' rate limits. It is the connection's address or the one trusted
+	// proxies forwarded, never a header clients set.
+	IP string `json:"-" gorm:"size:45;index"`
+	// Honeypot is the hidden form field only bots fill in, it is checked for
+	// spam and never stored
+	Honeypot string `json:"-" gorm:"-"`
+}
+
+// CommentNode is a comment in a thread, with its replies when the thread is
+// a tree
+type CommentNode struct {
+	Comment
+	// Deleted comments are tombstones kept in place of comments in the trash,
+	// purged or not approved, their replies stay where they were
+	Deleted bool `json:"deleted"`
+	// ReplyCount counts the comments below this one, not only direct replies
+	ReplyCount int            `json:"replyCount"`
+	Replies    []*CommentNode `json:"replies,omitempty"`
 }
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// ExternalIdentity links a user to an account at an external identity provider
+type ExternalIdentity struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserId    uint   `gorm:"index"`
+	User      User   `gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE"`
+	Issuer    string `gorm:"size:255;uniqueIndex:idx_external_identity"`
+	Subject   string `gorm:"size:255;uniqueIndex:idx_external_identity"`
+	Email     string
+	CreatedAt time.Time
+}
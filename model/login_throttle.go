@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// LoginThrottle counts failed sign-in attempts for an account or a client IP.
+// Attempts are counted while they are checked and uncounted if they succeed.
+type LoginThrottle struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Subject       string     `json:"subject" gorm:"size:320;uniqueIndex"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil" gorm:"index"`
+}
+
+// ThrottlePolicy is how the failed attempts of a subject are limited
+type ThrottlePolicy struct {
+	// Limit failures lock the subject for Window, 0 never locks it. Failures
+	// older than Window are forgotten.
+	Limit  int
+	Window time.Duration
+	// Backoff is the delay after the first failure, it doubles with every
+	// further one and never exceeds Window. 0 lets attempts through until
+	// the limit is reached.
+	Backoff time.Duration
+}
+
+// Expired reports whether the throttle's failures no longer count, its
+// lockout is over or its last failure older than the window
+func (p ThrottlePolicy) Expired(t *LoginThrottle, now time.Time) bool {
+	if t.LockedUntil != nil {
+		return !now.Before(*t.LockedUntil)
+	}
+	return now.Sub(t.LastFailureAt) > p.Window
+}
+
+// RetryAfter returns how long the subject has to wait before its next
+// attempt, 0 if it may try now
+func (p ThrottlePolicy) RetryAfter(t *LoginThrottle, now time.Time) time.Duration {
+	if t.LockedUntil != nil {
+		if now.Before(*t.LockedUntil) {
+			return t.LockedUntil.Sub(now)
+		}
+		return 0
+	}
+
+	if next := t.LastFailureAt.Add(p.backoff(t.Failures)); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// backoff is the delay enforced after the given number of failures
+func (p ThrottlePolicy) backoff(failures int) time.Duration {
+	if failures <= 0 || p.Backoff <= 0 {
+		return 0
+	}
+
+	delay := p.Backoff
+	for i := 1; i < failures && delay < p.Window; i++ {
+		delay *= 2
+	}
+	if delay > p.Window {
+		delay = p.Window
+	}
+	return delay
+}
@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// MediaStatus is where uploaded media are in image processing
+type MediaStatus string
+
+const (
+	// MediaPending images wait for their variants
+	MediaPending MediaStatus = "pending"
+	// MediaReady media have their variants, if they are images
+	MediaReady MediaStatus = "ready"
+	// MediaFailed images could not be decoded, they are served as uploaded
+	MediaFailed MediaStatus = "failed"
+)
+
+// Media is an uploaded file, its bytes are in the blob store under Key. It
+// belongs to the posts whose bodies embed it and is deleted once none does.
+type Media struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+	// UserId is the uploader, media outlive them until no post embeds them
+	UserId uint `json:"userId" gorm:"index"`
+	// Key names the blob and is the last segment of the media's URL
+	Key         string `json:"key" gorm:"size:64;uniqueIndex"`
+	Filename    string `json:"filename" gorm:"size:255"`
+	ContentType string `json:"contentType" gorm:"size:127"`
+	Size        int64  `json:"size"`
+	// URL is where the media is served, posts embed it
+	URL   string `json:"url" gorm:"-"`
+	Posts []Post `gorm:"many2many:post_media;constraint:OnDelete:CASCADE" json:"-"`
+	// Width and Height are the upright size of images in pixels
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Status is set by the service. Media uploaded before images were
+	// processed default to pending and get their variants.
+	Status MediaStatus `json:"status" gorm:"size:16;not null;default:pending;index"`
+	// BlurHash and Color stand in for images while they load
+	BlurHash string         `json:"blurHash" gorm:"size:64"`
+	Color    string         `json:"color" gorm:"size:7"`
+	Variants []MediaVariant `json:"variants" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// MediaVariant is a smaller rendition of an uploaded image, stored in the
+// blob store under Key
+type MediaVariant struct {
+	ID      uint `json:"-" gorm:"primaryKey"`
+	MediaId uint `json:"-" gorm:"index"`
+	// Name is the variant's name in MEDIA_VARIANTS
+	Name        string `json:"name" gorm:"size:32"`
+	Key         string `json:"key" gorm:"size:80;uniqueIndex"`
+	ContentType string `json:"contentType" gorm:"size:127"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	URL         string `json:"url" gorm:"-"`
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a cursor can't be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a keyset position in a listing ordered by created_at, id
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// String encodes the cursor as an opaque token
+func (c Cursor) String() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + "," + strconv.FormatUint(uint64(c.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a cursor produced by Cursor.String
+func ParseCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{CreatedAt: time.Unix(0, nanos).UTC(), ID: uint(n)}, nil
+}
+
+// MaxPage is the highest page number, deeper listings are walked by cursor.
+// It keeps offsets far from overflowing whatever the page size.
+const MaxPage = 1000000
+
+// PageRequest selects a slice of a listing, newest first. A positive Page
+// switches to offset pagination, otherwise rows are read after the cursor.
+type PageRequest struct {
+	Limit  int
+	Page   int
+	Cursor *Cursor
+}
+
+// Offset reports whether the request uses page numbers instead of a cursor
+func (p PageRequest) Offset() bool {
+	return p.Page > 0
+}
+
+// Skip returns how many rows come before the requested page
+func (p PageRequest) Skip() int {
+	if p.Page <= 1 || p.Limit <= 0 {
+		return 0
+	}
+	return (p.Page - 1) * p.Limit
+}
+
+// Page is one page of a listing
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	PerPage    int    `json:"per_page"`
+	TotalPages int    `json:"total_pages,omitempty"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// PersonalAccessToken is a named, scoped API token for scripts and CI. Only the
+// hash of the token is stored, Prefix keeps enough of it to be recognized.
+type PersonalAccessToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserId     uint       `json:"-" gorm:"index"`
+	User       User       `json:"-" gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE"`
+	Name       string     `json:"name" gorm:"size:100"`
+	Prefix     string     `json:"prefix" gorm:"size:32"`
+	TokenHash  string     `json:"-" gorm:"size:64;uniqueIndex"`
+	Scopes     string     `json:"-" gorm:"size:255"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// ScopeList returns the permissions the token is limited to
+func (t *PersonalAccessToken) ScopeList() []Permission {
+	fields := strings.Fields(t.Scopes)
+	scopes := make([]Permission, len(fields))
+	for i, field := range fields {
+		scopes[i] = Permission(field)
+	}
+	return scopes
+}
@@ -1,12 +1,81 @@
 package model
 
-import "time"
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// PostStatus is where a post is in the editorial workflow
+type PostStatus string
+
+const (
+	PostDraft     PostStatus = "draft"
+	PostInReview  PostStatus = "in_review"
+	PostScheduled PostStatus = "scheduled"
+	PostPublished PostStatus = "published"
+	PostArchived  PostStatus = "archived"
+)
+
+// postTransitions lists the statuses each status may move to
+var postTransitions = map[PostStatus][]PostStatus{
+	PostDraft:     {PostInReview},
+	PostInReview:  {PostDraft, PostScheduled, PostPublished},
+	PostScheduled: {PostDraft, PostPublished},
+	PostPublished: {PostArchived},
+	PostArchived:  {},
+}
+
+// Valid reports whether the status is known
+func (s PostStatus) Valid() bool {
+	_, ok := postTransitions[s]
+	return ok
+}
+
+// CanTransition reports whether a post may move from s to the status
+func (s PostStatus) CanTransition(to PostStatus) bool {
+	for _, next := range postTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
 
 type Post struct {
-	ID        uint `json:"id" gorm:"primaryKey"`
-	CreatedAt time.Time
-	Title     string `json:"title"`
-	Body      string `json:"body"`
-	UserId    uint   `json:"userId"`
-	User      User   `gorm:"foreignKey:UserId" json:"-"`
+	ID        uint      `json:"id" gorm:"primaryKey;index:idx_posts_created,priority:2"`
+	CreatedAt time.Time `gorm:"index:idx_posts_created,priority:1"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	UserId    uint      `json:"userId"`
+	User      User      `gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE" json:"-"`
+	// BodyHTML is the Markdown body rendered and sanitized by the service
+	BodyHTML string `json:"bodyHtml"`
+	// Slug is generated from the title by the repository, never bound from
+	// input. PostSlug keeps it unique among current and old slugs.
+	Slug string `json:"slug" gorm:"size:191;index"`
+	// DeletedAt is set while the post is in the trash, its comments go with it
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	// Status is set by the service and its transitions, never bound from
+	// input. Posts written before the workflow existed default to published.
+	Status PostStatus `json:"status" gorm:"size:16;not null;default:published;index:idx_posts_status"`
+	// PublishedAt is when the post went or will go live
+	PublishedAt *time.Time `json:"publishedAt" gorm:"index:idx_posts_status"`
+	// CategoryId is kept on update when omitted, 0 removes the category
+	CategoryId *uint     `json:"categoryId"`
+	Category   *Category `gorm:"foreignKey:CategoryId;constraint:OnDelete:SET NULL" json:"-"`
+	// Tags are kept on update when omitted and replaced otherwise
+	Tags []Tag `gorm:"many2many:post_tags;constraint:OnDelete:CASCADE" json:"tags"`
+	// CommentMode overrides COMMENT_MODE for the post when set. It is only
+	// changed through its own endpoint after the post is created.
+	CommentMode CommentMode `json:"commentMode" gorm:"size:32"`
+}
+
+// PostSlug reserves a slug for a post, its current one or one it had before a
+// title change. Old slugs keep leading to the post and are never reused.
+type PostSlug struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	Slug      string    `json:"slug" gorm:"size:191;uniqueIndex"`
+	PostId    uint      `json:"postId" gorm:"index"`
+	Post      Post      `gorm:"foreignKey:PostId;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
 }
@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// SortField is one column of a listing's ORDER BY
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Keyset reports whether a listing sorted this way can be walked with a
+// Cursor. Cursors only hold created_at and id.
+func Keyset(sort []SortField) bool {
+	return len(sort) == 0 || (len(sort) == 1 && sort[0].Field == "created_at")
+}
+
+// PostQuery filters, sorts and pages the post listing. Zero values don't filter.
+type PostQuery struct {
+	AuthorId uint
+	// Status narrows the listing to one status, within what the viewer may see
+	Status PostStatus
+	// ViewerId sees their own posts in every status, everyone else only
+	// published ones. AnyStatus lifts that for editors.
+	ViewerId  uint
+	AnyStatus bool
+	// Tags are slugs, posts must have all of them
+	Tags []string
+	// Category is a slug, the service resolves it and its descendants to CategoryIds
+	Category    string
+	CategoryIds []uint
+	// CreatedAfter is inclusive, CreatedBefore is exclusive
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Sort defaults to newest first
+	Sort []SortField
+	Page PageRequest
+}
+
+// CommentQuery filters, sorts and pages the comment listing. Zero values don't filter.
+type CommentQuery struct {
+	AuthorId uint
+	PostId   uint
+	// Status narrows the listing to one status, within what the viewer may see
+	Status CommentStatus
+	// ViewerId sees their own comments in every status, everyone else only
+	// approved ones. AnyStatus lifts that for moderators.
+	ViewerId  uint
+	AnyStatus bool
+	// IP narrows the listing to comments written from the client address
+	IP string
+	// CreatedAfter is inclusive, CreatedBefore is exclusive
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Sort defaults to newest first
+	Sort []SortField
+	Page PageRequest
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// RecoveryCode is a one-time code that replaces the TOTP code when the
+// authenticator is lost. Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserId    uint   `gorm:"index"`
+	User      User   `gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE"`
+	CodeHash  string `gorm:"size:64;uniqueIndex"`
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// PostRevision is a snapshot of a post's content, one is taken on every write
+type PostRevision struct {
+	ID     uint `json:"id" gorm:"primaryKey"`
+	PostId uint `json:"postId" gorm:"uniqueIndex:idx_post_revisions_number,priority:1"`
+	Post   Post `gorm:"foreignKey:PostId;constraint:OnDelete:CASCADE" json:"-"`
+	// Number counts a post's revisions up from 1
+	Number int `json:"number" gorm:"uniqueIndex:idx_post_revisions_number,priority:2"`
+	// UserId made the edit, it isn't necessarily the post's author
+	UserId uint   `json:"userId"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	// RestoredFrom is the number of the revision this one brought back
+	RestoredFrom *int      `json:"restoredFrom,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// RevisionDiff is a unified diff between two revisions of a post
+type RevisionDiff struct {
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"`
+}
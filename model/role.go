@@ -0,0 +1,69 @@
+package model
+
+// Role is the role of a user
+type Role string
+
+const (
+	RoleReader    Role = "reader"
+	RoleAuthor    Role = "author"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission is an action guarded by a role
+type Permission string
+
+const (
+	PermPostsRead        Permission = "posts:read"
+	PermPostsWrite       Permission = "posts:write"
+	PermPostsManage      Permission = "posts:manage"
+	PermPostsPublish     Permission = "posts:publish"
+	PermCommentsRead     Permission = "comments:read"
+	PermCommentsWrite    Permission = "comments:write"
+	PermCommentsModerate Permission = "comments:moderate"
+	PermUsersManage      Permission = "users:manage"
+	PermTaxonomyManage   Permission = "taxonomy:manage"
+	PermTrashPurge       Permission = "trash:purge"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleReader: {
+		PermPostsRead, PermCommentsRead, PermCommentsWrite,
+	},
+	RoleAuthor: {
+		PermPostsRead, PermPostsWrite, PermCommentsRead, PermCommentsWrite,
+	},
+	RoleModerator: {
+		PermPostsRead, PermPostsWrite, PermPostsPublish, PermCommentsRead, PermCommentsWrite, PermCommentsModerate,
+	},
+	RoleAdmin: {
+		PermPostsRead, PermPostsWrite, PermPostsManage, PermPostsPublish, PermCommentsRead, PermCommentsWrite,
+		PermCommentsModerate, PermUsersManage, PermTaxonomyManage, PermTrashPurge,
+	},
+}
+
+// Valid reports whether the permission is known
+func (p Permission) Valid() bool {
+	for _, perm := range rolePermissions[RoleAdmin] {
+		if perm == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether the role is known
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants the permission
+func (r Role) Can(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
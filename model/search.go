@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// SearchKind tells posts and comments apart in search results
+type SearchKind string
+
+const (
+	SearchPost    SearchKind = "post"
+	SearchComment SearchKind = "comment"
+)
+
+// SearchQuery is a full-text search over posts and comments
+type SearchQuery struct {
+	Text string
+	// Kind limits the search to posts or comments, empty searches both
+	Kind SearchKind
+	Page PageRequest
+}
+
+// SearchHit is a post or comment matching a search. Title and Snippet are
+// HTML escaped with the matched words wrapped in <mark>.
+type SearchHit struct {
+	Kind      SearchKind `json:"kind"`
+	ID        uint       `json:"id"`
+	PostId    uint       `json:"postId"`
+	Title     string     `json:"title"`
+	Snippet   string     `json:"snippet"`
+	Score     float64    `json:"score"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
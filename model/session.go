@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// Session is a login session. Every refresh token issued for the same sign-in
+// belongs to one session, so revoking the session kills the whole token family.
+type Session struct {
+	ID        string     `json:"id" gorm:"primaryKey;size:64"`
+	UserId    uint       `json:"-"`
+	User      User       `gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// RefreshToken is a single-use refresh token. Only the hash of the token is stored.
+type RefreshToken struct {
+	ID        uint    `gorm:"primaryKey"`
+	SessionId string  `gorm:"size:64;index"`
+	Session   Session `gorm:"foreignKey:SessionId;constraint:OnDelete:CASCADE"`
+	TokenHash string  `gorm:"size:64;uniqueIndex"`
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// SpamToken counts the spam and ham comments moderators decided on that
+// hold the token, the naive Bayes classifier is trained with them
+type SpamToken struct {
+	Token string `gorm:"primaryKey;size:64"`
+	Spam  int64  `gorm:"not null;default:0"`
+	Ham   int64  `gorm:"not null;default:0"`
+}
+
+// SpamTraining records which class a comment was trained as and with which
+// tokens, so a moderator changing their mind untrains it. It has no foreign
+// key, the counts outlive the comments they were trained with.
+type SpamTraining struct {
+	CommentId uint `gorm:"primaryKey;autoIncrement:false"`
+	Spam      bool `gorm:"index"`
+	// Tokens are separated by newlines
+	Tokens    string `gorm:"type:text"`
+	CreatedAt time.Time
+}
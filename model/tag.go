@@ -0,0 +1,46 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Tag labels posts, a post has many tags and a tag many posts
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"size:64"`
+	Slug      string    `json:"slug" gorm:"size:64;uniqueIndex"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// UnmarshalJSON also accepts a bare tag name, so posts can be tagged with ["go", "web"]
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = Tag{Name: name}
+		return nil
+	}
+
+	type tag Tag
+	return json.Unmarshal(data, (*tag)(t))
+}
+
+// TagCount is a tag with the number of posts using it
+type TagCount struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Posts int64  `json:"posts"`
+}
+
+// Category files posts in a tree, a post has at most one category
+type Category struct {
+	ID       uint      `json:"id" gorm:"primaryKey"`
+	Name     string    `json:"name" gorm:"size:64"`
+	Slug     string    `json:"slug" gorm:"size:64;uniqueIndex"`
+	ParentId *uint     `json:"parentId"`
+	Parent   *Category `gorm:"foreignKey:ParentId;constraint:OnDelete:RESTRICT" json:"-"`
+	// Children is filled when categories are returned as a tree
+	Children  []Category `json:"children,omitempty" gorm:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// TrashKind is what a TrashItem holds
+type TrashKind string
+
+const (
+	TrashPost    TrashKind = "post"
+	TrashComment TrashKind = "comment"
+)
+
+// TrashItem is a deleted post or comment its author can still restore
+type TrashItem struct {
+	Kind TrashKind `json:"kind"`
+	ID   uint      `json:"id"`
+	// PostId is the post itself or the post commented on
+	PostId    uint      `json:"postId"`
+	Title     string    `json:"title"`
+	DeletedAt time.Time `json:"deletedAt"`
+	// PurgeAt is when the item is removed for good
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+// PurgeResult counts what a purge removed for good. Rows deleted with a
+// purged user or post aren't counted.
+type PurgeResult struct {
+	Users    int64 `json:"users"`
+	Posts    int64 `json:"posts"`
+	Comments int64 `json:"comments"`
+}
@@ -1,11 +1,27 @@
 package model
 
-import "time"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 type User struct {
 	ID        uint   `json:"id" gorm:"primaryKey"`
 	Name      string `json:"name"`
 	Email     string `json:"email" gorm:"unique"`
-	Password  string `json:"password"`
+	Password  string `json:"-"`
+	Role      Role   `json:"role" gorm:"size:16;default:author"`
+	Bio       string `json:"bio"`
+	AvatarURL string `json:"avatarUrl"`
 	CreatedAt time.Time
+	// DeletedAt is set while the account is in the trash
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	EmailVerifiedAt    *time.Time `json:"emailVerifiedAt"`
+	VerificationSentAt *time.Time `json:"-"`
+
+	// TOTPSecret is set on enrollment and only used once TOTPEnabled is confirmed
+	TOTPSecret   string `json:"-" gorm:"size:64"`
+	TOTPEnabled  bool   `json:"totpEnabled"`
+	TOTPLastStep int64  `json:"-"`
 }
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// TokenPurpose tells what a user token may be used for
+type TokenPurpose string
+
+const (
+	TokenEmailChange   TokenPurpose = "email_change"
+	TokenPasswordReset TokenPurpose = "password_reset"
+)
+
+// UserToken is a single-use, expiring token mailed to a user. Only the hash of
+// the token is stored.
+type UserToken struct {
+	ID        uint         `gorm:"primaryKey"`
+	UserId    uint         `gorm:"index"`
+	User      User         `gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE"`
+	Purpose   TokenPurpose `gorm:"size:32"`
+	TokenHash string       `gorm:"size:64;uniqueIndex"`
+	// Data carries purpose specific payload, e.g. the new address of an email change
+	Data      string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
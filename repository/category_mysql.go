@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+)
+
+// CategoryMysqlRepo ...
+type CategoryMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewCategoryMysqlRepo ...
+func NewCategoryMysqlRepo(db *gorm.DB) *CategoryMysqlRepo {
+	return &CategoryMysqlRepo{db: db}
+}
+
+func (repo *CategoryMysqlRepo) GetCategories(ctx context.Context) ([]model.Category, error) {
+	var categories []model.Category
+	err := repo.db.Order("name").Find(&categories).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching categories %v", err)
+	}
+
+	return categories, nil
+}
+
+func (repo *CategoryMysqlRepo) CreateCategory(ctx context.Context, category *model.Category) error {
+	if category == nil {
+		return errors.New("No category provided")
+	}
+	return repo.db.Create(category).Error
+}
+
+func (repo *CategoryMysqlRepo) DeleteCategory(ctx context.Context, categoryId uint) error {
+	result := repo.db.Delete(&model.Category{}, categoryId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return types.ErrNotFound
+	}
+	return nil
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/slavik22/blogRestApi/lib/types"
 	"github.com/slavik22/blogRestApi/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
 )
 
 // CommentMysqlRepo ...
@@ -18,9 +23,31 @@ func NewCommentMysqlRepo(db *gorm.DB) *CommentMysqlRepo {
 	return &CommentMysqlRepo{db: db}
 }
 
-func (repo *CommentMysqlRepo) GetComments(context.Context) ([]model.Comment, error) {
+// filterComments applies the query's filters, not its sort or page
+func (repo *CommentMysqlRepo) filterComments(query model.CommentQuery) *gorm.DB {
+	db := repo.db.Model(&model.Comment{})
+	if query.AuthorId != 0 {
+		db = db.Where("user_id = ?", query.AuthorId)
+	}
+	if query.PostId != 0 {
+		db = db.Where("post_id = ?", query.PostId)
+	}
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if !query.AnyStatus {
+		db = db.Where("(status = ? OR user_id = ?)", model.CommentApproved, query.ViewerId)
+	}
+	if query.IP != "" {
+		db = db.Where("ip = ?", query.IP)
+	}
+
+	return createdBetween(db, query.CreatedAfter, query.CreatedBefore)
+}
+
+func (repo *CommentMysqlRepo) GetComments(ctx context.Context, query model.CommentQuery) ([]model.Comment, error) {
 	var Comments []model.Comment
-	err := repo.db.Find(&Comments).Error
+	err := paginate(repo.filterComments(query), query.Sort, query.Page).Find(&Comments).Error
 	if err != nil {
 		return nil, fmt.Errorf("error while fetching Comments %v", err)
 	}
@@ -28,29 +55,114 @@ func (repo *CommentMysqlRepo) GetComments(context.Context) ([]model.Comment, err
 	return Comments, nil
 }
 
+func (repo *CommentMysqlRepo) CountComments(ctx context.Context, query model.CommentQuery) (int64, error) {
+	var count int64
+	err := repo.filterComments(query).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("error while counting Comments %v", err)
+	}
+
+	return count, nil
+}
+
 func (repo *CommentMysqlRepo) GetComment(ctx context.Context, commentId uint) (*model.Comment, error) {
 	var comment model.Comment
 	err := repo.db.First(&comment, "id = ?", commentId).Error
 	if err != nil {
-		return nil, fmt.Errorf("no Comment found %v", err)
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching Comment %v", err)
 	}
 
 	return &comment, nil
 }
 
+// CreateComment creates the comment below its parent, the parent may be in
+// the trash. The post and the author must exist, types.ErrNotFound is
+// returned otherwise.
 func (repo *CommentMysqlRepo) CreateComment(ctx context.Context, comment *model.Comment) (uint, error) {
 	if comment == nil {
 		return 0, errors.New("No Comment provided")
 	}
-	err := repo.db.Create(comment).Error
+
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		var parent model.Comment
+		if comment.ParentId != nil {
+			err := tx.Unscoped().Select("path", "depth").First(&parent, "id = ?", *comment.ParentId).Error
+			if err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return types.ErrNotFound
+				}
+				return err
+			}
+			comment.Depth = parent.Depth + 1
+		} else {
+			comment.Depth = 0
+		}
+
+		comment.Path = ""
+		if err := tx.Create(comment).Error; err != nil {
+			if foreignKeyViolated(err) {
+				return types.ErrNotFound
+			}
+			return err
+		}
+
+		comment.Path = commentPath(parent.Path, comment.ID)
+		return tx.Model(comment).Update("path", comment.Path).Error
+	})
 	if err != nil {
 		return 0, err
 	}
 	return comment.ID, nil
 }
 
+// GetThread returns the comments matching the query ordered by path, each
+// reply after the comment it answers. The query's sort and page are ignored.
+func (repo *CommentMysqlRepo) GetThread(ctx context.Context, query model.CommentQuery) ([]model.Comment, error) {
+	var comments []model.Comment
+	err := repo.filterComments(query).Order("path").Find(&comments).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching thread %v", err)
+	}
+
+	return comments, nil
+}
+
+// ModerateComments sets the status of the live comments among the ids and
+// returns them as they are now. Missing ids are skipped.
+func (repo *CommentMysqlRepo) ModerateComments(ctx context.Context, ids []uint, status model.CommentStatus, moderatorId uint) ([]model.Comment, error) {
+	var comments []model.Comment
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Order("id").Find(&comments).Error
+		if err != nil || len(comments) == 0 {
+			return err
+		}
+
+		now := time.Now()
+		found := make([]uint, len(comments))
+		for i := range comments {
+			found[i] = comments[i].ID
+			comments[i].Status = status
+			comments[i].ModeratedAt = &now
+			comments[i].ModeratedBy = &moderatorId
+		}
+
+		return tx.Model(&model.Comment{}).Where("id IN ?", found).
+			Updates(map[string]interface{}{"status": status, "moderated_at": now, "moderated_by": moderatorId}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error while moderating comments %v", err)
+	}
+
+	return comments, nil
+}
+
 func (repo *CommentMysqlRepo) UpdateComment(ctx context.Context, comment *model.Comment) (*model.Comment, error) {
-	err := repo.db.Model(&comment).Updates(model.Comment{Title: comment.Title, Body: comment.Body}).Error
+	err := repo.db.Model(comment).
+		Select("title", "body", "body_html", "status", "moderated_at", "moderated_by").
+		Updates(comment).Error
 
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -62,8 +174,9 @@ func (repo *CommentMysqlRepo) UpdateComment(ctx context.Context, comment *model.
 	return comment, nil
 }
 
-func (repo *CommentMysqlRepo) DeleteComment(ctx context.Context, userId uint, commentId uint) error {
-	err := repo.db.Where("id = ? AND user_id = ?", commentId, userId).Delete(model.Comment{}).Error
+// DeleteComment moves the comment to the trash
+func (repo *CommentMysqlRepo) DeleteComment(ctx context.Context, commentId uint) error {
+	err := repo.db.Where("id = ?", commentId).Delete(model.Comment{}).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return fmt.Errorf("no Comment found %v", err)
@@ -72,3 +185,71 @@ func (repo *CommentMysqlRepo) DeleteComment(ctx context.Context, userId uint, co
 	}
 	return nil
 }
+
+// commentPath appends the id to the parent's path
+func commentPath(parent string, id uint) string {
+	segment := fmt.Sprintf("%010d", id)
+	if parent == "" {
+		return segment
+	}
+	return parent + "/" + segment
+}
+
+// migrateCommentPaths makes comments written before threads top-level ones
+func migrateCommentPaths(db *gorm.DB) error {
+	return db.Unscoped().Model(&model.Comment{}).
+		Where("path = ''").
+		Update("path", gorm.Expr("LPAD(id, 10, '0')")).Error
+}
+
+// migrateCommentOrphans deals with the comments whose post or author is gone
+// before the foreign keys on them are added, it does nothing once they are.
+// The comments are deleted, each logged, only when deleteOrphans is set.
+func migrateCommentOrphans(db *gorm.DB, deleteOrphans bool) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&model.Comment{}) ||
+		migrator.HasConstraint(&model.Comment{}, "Post") && migrator.HasConstraint(&model.Comment{}, "User") {
+		return nil
+	}
+
+	var orphans []model.Comment
+	err := db.Unscoped().Select("id", "post_id", "user_id").
+		Where("post_id IS NULL OR post_id NOT IN (?)", db.Unscoped().Model(&model.Post{}).Select("id")).
+		Or("user_id IS NULL OR user_id NOT IN (?)", db.Unscoped().Model(&model.User{}).Select("id")).
+		Order("id").Find(&orphans).Error
+	if err != nil {
+		return fmt.Errorf("error while finding orphan comments %v", err)
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+	if !deleteOrphans {
+		return fmt.Errorf("%d comments belong to missing posts or users, set DELETE_ORPHAN_COMMENTS to delete them", len(orphans))
+	}
+
+	ids := make([]uint, len(orphans))
+	for i, orphan := range orphans {
+		log.Printf("deleting comment %d of missing post %d or user %d", orphan.ID, orphan.PostId, orphan.UserId)
+		ids[i] = orphan.ID
+	}
+	if err := db.Unscoped().Where("id IN ?", ids).Delete(&model.Comment{}).Error; err != nil {
+		return fmt.Errorf("error while deleting orphan comments %v", err)
+	}
+
+	log.Printf("deleted %d orphan comments", len(orphans))
+	return nil
+}
+
+// foreignKeyViolated reports whether the error is MySQL refusing a row that
+// references a missing one
+func foreignKeyViolated(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1452
+}
+
+// duplicateEntry reports whether the error is MySQL refusing a row that
+// repeats a unique key
+func duplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+)
+
+// ExternalIdentityMysqlRepo ...
+type ExternalIdentityMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewExternalIdentityMysqlRepo ...
+func NewExternalIdentityMysqlRepo(db *gorm.DB) *ExternalIdentityMysqlRepo {
+	return &ExternalIdentityMysqlRepo{db: db}
+}
+
+// GetExternalIdentity retrieves the identity the provider knows by the subject
+func (repo *ExternalIdentityMysqlRepo) GetExternalIdentity(ctx context.Context, issuer, subject string) (*model.ExternalIdentity, error) {
+	var identity model.ExternalIdentity
+	err := repo.db.First(&identity, "issuer = ? AND subject = ?", issuer, subject).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching external identity %v", err)
+	}
+
+	return &identity, nil
+}
+
+// CreateExternalIdentity links a new external identity to a user
+func (repo *ExternalIdentityMysqlRepo) CreateExternalIdentity(ctx context.Context, identity *model.ExternalIdentity) error {
+	if identity == nil {
+		return errors.New("No external identity provided")
+	}
+	return repo.db.Create(identity).Error
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// LoginThrottleMysqlRepo ...
+type LoginThrottleMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewLoginThrottleMysqlRepo ...
+func NewLoginThrottleMysqlRepo(db *gorm.DB) *LoginThrottleMysqlRepo {
+	return &LoginThrottleMysqlRepo{db: db}
+}
+
+// CountAttempt counts an attempt against the subject unless the policy makes
+// it wait, and returns how long it has to wait. The subject's row is locked
+// while its failures are checked and counted, so concurrent attempts can't
+// all get through.
+func (repo *LoginThrottleMysqlRepo) CountAttempt(ctx context.Context, subject string, policy model.ThrottlePolicy, now time.Time) (time.Duration, error) {
+	var retryAfter time.Duration
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		// The row has to exist to be locked
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.LoginThrottle{Subject: subject, LastFailureAt: now}).Error
+		if err != nil {
+			return err
+		}
+
+		var throttle model.LoginThrottle
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&throttle, "subject = ?", subject).Error
+		if err != nil {
+			return err
+		}
+
+		// An expired lockout or failures older than the window start over
+		failures := gorm.Expr("failures + 1")
+		if policy.Expired(&throttle, now) {
+			throttle.Failures = 0
+			failures = gorm.Expr("1")
+		} else if retryAfter = policy.RetryAfter(&throttle, now); retryAfter > 0 {
+			return nil
+		}
+
+		var lockedUntil *time.Time
+		if policy.Limit > 0 && throttle.Failures+1 >= policy.Limit {
+			until := now.Add(policy.Window)
+			lockedUntil = &until
+		}
+
+		res := tx.Model(&model.LoginThrottle{}).Where("id = ?", throttle.ID).Updates(map[string]interface{}{
+			"failures":        failures,
+			"last_failure_at": now,
+			"locked_until":    lockedUntil,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return fmt.Errorf("login throttle %q was not updated", subject)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error while counting sign-in attempt %v", err)
+	}
+
+	return retryAfter, nil
+}
+
+// ForgiveAttempt uncounts an attempt that turned out to succeed, lifting the
+// lockout it may have caused
+func (repo *LoginThrottleMysqlRepo) ForgiveAttempt(ctx context.Context, subject string) error {
+	return repo.db.Model(&model.LoginThrottle{}).
+		Where("subject = ? AND failures > 0", subject).
+		Updates(map[string]interface{}{"failures": gorm.Expr("failures - 1"), "locked_until": nil}).Error
+}
+
+// ResetThrottle forgets the failed attempts of the subject
+func (repo *LoginThrottleMysqlRepo) ResetThrottle(ctx context.Context, subject string) error {
+	return repo.db.Where("subject = ?", subject).Delete(&model.LoginThrottle{}).Error
+}
+
+// GetLockouts retrieves the subjects that are locked out at the given time
+func (repo *LoginThrottleMysqlRepo) GetLockouts(ctx context.Context, now time.Time) ([]model.LoginThrottle, error) {
+	var throttles []model.LoginThrottle
+	err := repo.db.Where("locked_until > ?", now).Order("locked_until desc").Find(&throttles).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching lockouts %v", err)
+	}
+
+	return throttles, nil
+}
+
+// DeleteThrottle removes a throttle by its id
+func (repo *LoginThrottleMysqlRepo) DeleteThrottle(ctx context.Context, id uint) error {
+	result := repo.db.Delete(&model.LoginThrottle{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return types.ErrNotFound
+	}
+	return nil
+}
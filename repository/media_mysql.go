@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// MediaMysqlRepo ...
+type MediaMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewMediaMysqlRepo ...
+func NewMediaMysqlRepo(db *gorm.DB) *MediaMysqlRepo {
+	return &MediaMysqlRepo{db: db}
+}
+
+// CreateMedia stores the media unless the uploader's media and their variants
+// would take more than quota bytes with them, types.ErrTooLarge is returned
+// then. The uploader's row is locked while counting, so parallel uploads are
+// counted one after the other.
+func (repo *MediaMysqlRepo) CreateMedia(ctx context.Context, media *model.Media, quota int64) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		var uploader model.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&uploader, "id = ?", media.UserId).Error
+		if err != nil {
+			return fmt.Errorf("error while locking uploader %v", err)
+		}
+
+		used, err := usedSpace(tx, media.UserId)
+		if err != nil {
+			return err
+		}
+		if used+media.Size > quota {
+			return types.ErrTooLarge
+		}
+
+		return tx.Create(media).Error
+	})
+}
+
+func (repo *MediaMysqlRepo) GetMedia(ctx context.Context, key string) (*model.Media, error) {
+	var media model.Media
+	err := repo.db.Preload("Variants").First(&media, "`key` = ?", key).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching media %v", err)
+	}
+
+	return &media, nil
+}
+
+func (repo *MediaMysqlRepo) GetMediaById(ctx context.Context, id uint) (*model.Media, error) {
+	var media model.Media
+	err := repo.db.Preload("Variants").First(&media, "id = ?", id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching media %v", err)
+	}
+
+	return &media, nil
+}
+
+// GetUserMedia returns the user's uploads, newest first
+func (repo *MediaMysqlRepo) GetUserMedia(ctx context.Context, userId uint) ([]model.Media, error) {
+	var media []model.Media
+	err := repo.db.Preload("Variants").Where("user_id = ?", userId).Order("id DESC").Find(&media).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching media %v", err)
+	}
+
+	return media, nil
+}
+
+// GetMediaVariant returns the variant stored under the key
+func (repo *MediaMysqlRepo) GetMediaVariant(ctx context.Context, key string) (*model.MediaVariant, error) {
+	var variant model.MediaVariant
+	err := repo.db.First(&variant, "`key` = ?", key).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching media variant %v", err)
+	}
+
+	return &variant, nil
+}
+
+// GetPendingMedia returns up to limit media waiting for image processing,
+// oldest first
+func (repo *MediaMysqlRepo) GetPendingMedia(ctx context.Context, limit int) ([]model.Media, error) {
+	var media []model.Media
+	err := repo.db.Where("status = ?", model.MediaPending).Order("id").Limit(limit).Find(&media).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching pending media %v", err)
+	}
+
+	return media, nil
+}
+
+// FinishMedia saves the outcome of processing pending media: the status,
+// dimensions, placeholders and variants. types.ErrNotFound is returned when
+// the media were deleted or finished meanwhile.
+func (repo *MediaMysqlRepo) FinishMedia(ctx context.Context, media *model.Media) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Media{}).
+			Where("id = ? AND status = ?", media.ID, model.MediaPending).
+			Updates(map[string]interface{}{
+				"status":    media.Status,
+				"width":     media.Width,
+				"height":    media.Height,
+				"blur_hash": media.BlurHash,
+				"color":     media.Color,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("error while updating media %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return types.ErrNotFound
+		}
+
+		if len(media.Variants) == 0 {
+			return nil
+		}
+		for i := range media.Variants {
+			media.Variants[i].MediaId = media.ID
+		}
+		if err := tx.Create(&media.Variants).Error; err != nil {
+			return fmt.Errorf("error while creating media variants %v", err)
+		}
+		return nil
+	})
+}
+
+// UsedSpace returns the bytes the user's uploads and their variants take
+func (repo *MediaMysqlRepo) UsedSpace(ctx context.Context, userId uint) (int64, error) {
+	return usedSpace(repo.db, userId)
+}
+
+func usedSpace(db *gorm.DB, userId uint) (int64, error) {
+	var used int64
+	err := db.Raw("SELECT (SELECT COALESCE(SUM(size), 0) FROM media WHERE user_id = ?) + "+
+		"(SELECT COALESCE(SUM(media_variants.size), 0) FROM media_variants "+
+		"JOIN media ON media.id = media_variants.media_id WHERE media.user_id = ?)",
+		userId, userId).Scan(&used).Error
+	if err != nil {
+		return 0, fmt.Errorf("error while summing media %v", err)
+	}
+
+	return used, nil
+}
+
+// LinkPostMedia replaces the media the post embeds with the ones under the
+// keys, or whose variants are under them. Unknown keys are ignored.
+func (repo *MediaMysqlRepo) LinkPostMedia(ctx context.Context, postId uint, keys []string) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM post_media WHERE post_id = ?", postId).Error; err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+
+		return tx.Exec("INSERT INTO post_media (media_id, post_id) SELECT id, ? FROM media "+
+			"WHERE `key` IN ? OR id IN (SELECT media_id FROM media_variants WHERE `key` IN ?)",
+			postId, keys, keys).Error
+	})
+}
+
+// CountMediaPosts returns how many posts, trashed ones included, embed the media
+func (repo *MediaMysqlRepo) CountMediaPosts(ctx context.Context, mediaId uint) (int64, error) {
+	var count int64
+	err := repo.db.Table("post_media").Where("media_id = ?", mediaId).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("error while counting media posts %v", err)
+	}
+
+	return count, nil
+}
+
+// GetOrphanedMedia returns up to limit media uploaded before the time that no
+// post embeds
+func (repo *MediaMysqlRepo) GetOrphanedMedia(ctx context.Context, before time.Time, limit int) ([]model.Media, error) {
+	var media []model.Media
+	err := repo.db.Preload("Variants").Where("created_at < ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM post_media WHERE post_media.media_id = media.id)").
+		Order("id").Limit(limit).Find(&media).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching orphaned media %v", err)
+	}
+
+	return media, nil
+}
+
+// DeleteMedia deletes the media record unless a post embeds it meanwhile, in
+// which case types.ErrConflict is returned. The blob is left to the caller.
+func (repo *MediaMysqlRepo) DeleteMedia(ctx context.Context, id uint) error {
+	result := repo.db.
+		Where("id = ? AND NOT EXISTS (SELECT 1 FROM post_media WHERE post_media.media_id = ?)", id, id).
+		Delete(&model.Media{})
+	if result.Error != nil {
+		return fmt.Errorf("error while deleting media %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return types.ErrConflict
+	}
+
+	return nil
+}
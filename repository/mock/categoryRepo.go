@@ -0,0 +1,79 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: CategoryRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockCategoryRepo is a mock of CategoryRepo interface.
+type MockCategoryRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockCategoryRepoMockRecorder
+}
+
+// MockCategoryRepoMockRecorder is the mock recorder for MockCategoryRepo.
+type MockCategoryRepoMockRecorder struct {
+	mock *MockCategoryRepo
+}
+
+// NewMockCategoryRepo creates a new mock instance.
+func NewMockCategoryRepo(ctrl *gomock.Controller) *MockCategoryRepo {
+	mock := &MockCategoryRepo{ctrl: ctrl}
+	mock.recorder = &MockCategoryRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCategoryRepo) EXPECT() *MockCategoryRepoMockRecorder {
+	return m.recorder
+}
+
+// CreateCategory mocks base method.
+func (m *MockCategoryRepo) CreateCategory(arg0 context.Context, arg1 *model.Category) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCategory", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateCategory indicates an expected call of CreateCategory.
+func (mr *MockCategoryRepoMockRecorder) CreateCategory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCategory", reflect.TypeOf((*MockCategoryRepo)(nil).CreateCategory), arg0, arg1)
+}
+
+// DeleteCategory mocks base method.
+func (m *MockCategoryRepo) DeleteCategory(arg0 context.Context, arg1 uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCategory", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCategory indicates an expected call of DeleteCategory.
+func (mr *MockCategoryRepoMockRecorder) DeleteCategory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCategory", reflect.TypeOf((*MockCategoryRepo)(nil).DeleteCategory), arg0, arg1)
+}
+
+// GetCategories mocks base method.
+func (m *MockCategoryRepo) GetCategories(arg0 context.Context) ([]model.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCategories", arg0)
+	ret0, _ := ret[0].([]model.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCategories indicates an expected call of GetCategories.
+func (mr *MockCategoryRepoMockRecorder) GetCategories(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategories", reflect.TypeOf((*MockCategoryRepo)(nil).GetCategories), arg0)
+}
@@ -35,6 +35,21 @@ func (m *MockCommentRepo) EXPECT() *MockCommentRepoMockRecorder {
 	return m.recorder
 }
 
+// CountComments mocks base method.
+func (m *MockCommentRepo) CountComments(arg0 context.Context, arg1 model.CommentQuery) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountComments", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountComments indicates an expected call of CountComments.
+func (mr *MockCommentRepoMockRecorder) CountComments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountComments", reflect.TypeOf((*MockCommentRepo)(nil).CountComments), arg0, arg1)
+}
+
 // CreateComment mocks base method.
 func (m *MockCommentRepo) CreateComment(arg0 context.Context, arg1 *model.Comment) (uint, error) {
 	m.ctrl.T.Helper()
@@ -51,17 +66,17 @@ func (mr *MockCommentRepoMockRecorder) CreateComment(arg0, arg1 interface{}) *go
 }
 
 // DeleteComment mocks base method.
-func (m *MockCommentRepo) DeleteComment(arg0 context.Context, arg1, arg2 uint) error {
+func (m *MockCommentRepo) DeleteComment(arg0 context.Context, arg1 uint) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteComment", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "DeleteComment", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteComment indicates an expected call of DeleteComment.
-func (mr *MockCommentRepoMockRecorder) DeleteComment(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockCommentRepoMockRecorder) DeleteComment(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockCommentRepo)(nil).DeleteComment), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockCommentRepo)(nil).DeleteComment), arg0, arg1)
 }
 
 // GetComment mocks base method.
@@ -80,18 +95,48 @@ func (mr *MockCommentRepoMockRecorder) GetComment(arg0, arg1 interface{}) *gomoc
 }
 
 // GetComments mocks base method.
-func (m *MockCommentRepo) GetComments(arg0 context.Context) ([]model.Comment, error) {
+func (m *MockCommentRepo) GetComments(arg0 context.Context, arg1 model.CommentQuery) ([]model.Comment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetComments", arg0)
+	ret := m.ctrl.Call(m, "GetComments", arg0, arg1)
 	ret0, _ := ret[0].([]model.Comment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetComments indicates an expected call of GetComments.
-func (mr *MockCommentRepoMockRecorder) GetComments(arg0 interface{}) *gomock.Call {
+func (mr *MockCommentRepoMockRecorder) GetComments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetComments", reflect.TypeOf((*MockCommentRepo)(nil).GetComments), arg0, arg1)
+}
+
+// GetThread mocks base method.
+func (m *MockCommentRepo) GetThread(arg0 context.Context, arg1 model.CommentQuery) ([]model.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetThread", arg0, arg1)
+	ret0, _ := ret[0].([]model.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetThread indicates an expected call of GetThread.
+func (mr *MockCommentRepoMockRecorder) GetThread(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetThread", reflect.TypeOf((*MockCommentRepo)(nil).GetThread), arg0, arg1)
+}
+
+// ModerateComments mocks base method.
+func (m *MockCommentRepo) ModerateComments(arg0 context.Context, arg1 []uint, arg2 model.CommentStatus, arg3 uint) ([]model.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ModerateComments", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]model.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ModerateComments indicates an expected call of ModerateComments.
+func (mr *MockCommentRepoMockRecorder) ModerateComments(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetComments", reflect.TypeOf((*MockCommentRepo)(nil).GetComments), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ModerateComments", reflect.TypeOf((*MockCommentRepo)(nil).ModerateComments), arg0, arg1, arg2, arg3)
 }
 
 // UpdateComment mocks base method.
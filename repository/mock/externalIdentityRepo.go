@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: ExternalIdentityRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockExternalIdentityRepo is a mock of ExternalIdentityRepo interface.
+type MockExternalIdentityRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockExternalIdentityRepoMockRecorder
+}
+
+// MockExternalIdentityRepoMockRecorder is the mock recorder for MockExternalIdentityRepo.
+type MockExternalIdentityRepoMockRecorder struct {
+	mock *MockExternalIdentityRepo
+}
+
+// NewMockExternalIdentityRepo creates a new mock instance.
+func NewMockExternalIdentityRepo(ctrl *gomock.Controller) *MockExternalIdentityRepo {
+	mock := &MockExternalIdentityRepo{ctrl: ctrl}
+	mock.recorder = &MockExternalIdentityRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockExternalIdentityRepo) EXPECT() *MockExternalIdentityRepoMockRecorder {
+	return m.recorder
+}
+
+// CreateExternalIdentity mocks base method.
+func (m *MockExternalIdentityRepo) CreateExternalIdentity(arg0 context.Context, arg1 *model.ExternalIdentity) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateExternalIdentity", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateExternalIdentity indicates an expected call of CreateExternalIdentity.
+func (mr *MockExternalIdentityRepoMockRecorder) CreateExternalIdentity(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateExternalIdentity", reflect.TypeOf((*MockExternalIdentityRepo)(nil).CreateExternalIdentity), arg0, arg1)
+}
+
+// GetExternalIdentity mocks base method.
+func (m *MockExternalIdentityRepo) GetExternalIdentity(arg0 context.Context, arg1, arg2 string) (*model.ExternalIdentity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExternalIdentity", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*model.ExternalIdentity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExternalIdentity indicates an expected call of GetExternalIdentity.
+func (mr *MockExternalIdentityRepoMockRecorder) GetExternalIdentity(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExternalIdentity", reflect.TypeOf((*MockExternalIdentityRepo)(nil).GetExternalIdentity), arg0, arg1, arg2)
+}
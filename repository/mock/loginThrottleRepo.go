@@ -0,0 +1,109 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: LoginThrottleRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockLoginThrottleRepo is a mock of LoginThrottleRepo interface.
+type MockLoginThrottleRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginThrottleRepoMockRecorder
+}
+
+// MockLoginThrottleRepoMockRecorder is the mock recorder for MockLoginThrottleRepo.
+type MockLoginThrottleRepoMockRecorder struct {
+	mock *MockLoginThrottleRepo
+}
+
+// NewMockLoginThrottleRepo creates a new mock instance.
+func NewMockLoginThrottleRepo(ctrl *gomock.Controller) *MockLoginThrottleRepo {
+	mock := &MockLoginThrottleRepo{ctrl: ctrl}
+	mock.recorder = &MockLoginThrottleRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginThrottleRepo) EXPECT() *MockLoginThrottleRepoMockRecorder {
+	return m.recorder
+}
+
+// CountAttempt mocks base method.
+func (m *MockLoginThrottleRepo) CountAttempt(arg0 context.Context, arg1 string, arg2 model.ThrottlePolicy, arg3 time.Time) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountAttempt", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountAttempt indicates an expected call of CountAttempt.
+func (mr *MockLoginThrottleRepoMockRecorder) CountAttempt(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountAttempt", reflect.TypeOf((*MockLoginThrottleRepo)(nil).CountAttempt), arg0, arg1, arg2, arg3)
+}
+
+// DeleteThrottle mocks base method.
+func (m *MockLoginThrottleRepo) DeleteThrottle(arg0 context.Context, arg1 uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteThrottle", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteThrottle indicates an expected call of DeleteThrottle.
+func (mr *MockLoginThrottleRepoMockRecorder) DeleteThrottle(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteThrottle", reflect.TypeOf((*MockLoginThrottleRepo)(nil).DeleteThrottle), arg0, arg1)
+}
+
+// ForgiveAttempt mocks base method.
+func (m *MockLoginThrottleRepo) ForgiveAttempt(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForgiveAttempt", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForgiveAttempt indicates an expected call of ForgiveAttempt.
+func (mr *MockLoginThrottleRepoMockRecorder) ForgiveAttempt(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForgiveAttempt", reflect.TypeOf((*MockLoginThrottleRepo)(nil).ForgiveAttempt), arg0, arg1)
+}
+
+// GetLockouts mocks base method.
+func (m *MockLoginThrottleRepo) GetLockouts(arg0 context.Context, arg1 time.Time) ([]model.LoginThrottle, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLockouts", arg0, arg1)
+	ret0, _ := ret[0].([]model.LoginThrottle)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLockouts indicates an expected call of GetLockouts.
+func (mr *MockLoginThrottleRepoMockRecorder) GetLockouts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLockouts", reflect.TypeOf((*MockLoginThrottleRepo)(nil).GetLockouts), arg0, arg1)
+}
+
+// ResetThrottle mocks base method.
+func (m *MockLoginThrottleRepo) ResetThrottle(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetThrottle", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetThrottle indicates an expected call of ResetThrottle.
+func (mr *MockLoginThrottleRepoMockRecorder) ResetThrottle(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetThrottle", reflect.TypeOf((*MockLoginThrottleRepo)(nil).ResetThrottle), arg0, arg1)
+}
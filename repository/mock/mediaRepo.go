@@ -0,0 +1,213 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: MediaRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockMediaRepo is a mock of MediaRepo interface.
+type MockMediaRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockMediaRepoMockRecorder
+}
+
+// MockMediaRepoMockRecorder is the mock recorder for MockMediaRepo.
+type MockMediaRepoMockRecorder struct {
+	mock *MockMediaRepo
+}
+
+// NewMockMediaRepo creates a new mock instance.
+func NewMockMediaRepo(ctrl *gomock.Controller) *MockMediaRepo {
+	mock := &MockMediaRepo{ctrl: ctrl}
+	mock.recorder = &MockMediaRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMediaRepo) EXPECT() *MockMediaRepoMockRecorder {
+	return m.recorder
+}
+
+// CountMediaPosts mocks base method.
+func (m *MockMediaRepo) CountMediaPosts(arg0 context.Context, arg1 uint) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountMediaPosts", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountMediaPosts indicates an expected call of CountMediaPosts.
+func (mr *MockMediaRepoMockRecorder) CountMediaPosts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountMediaPosts", reflect.TypeOf((*MockMediaRepo)(nil).CountMediaPosts), arg0, arg1)
+}
+
+// CreateMedia mocks base method.
+func (m *MockMediaRepo) CreateMedia(arg0 context.Context, arg1 *model.Media, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMedia", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateMedia indicates an expected call of CreateMedia.
+func (mr *MockMediaRepoMockRecorder) CreateMedia(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMedia", reflect.TypeOf((*MockMediaRepo)(nil).CreateMedia), arg0, arg1, arg2)
+}
+
+// DeleteMedia mocks base method.
+func (m *MockMediaRepo) DeleteMedia(arg0 context.Context, arg1 uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMedia", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMedia indicates an expected call of DeleteMedia.
+func (mr *MockMediaRepoMockRecorder) DeleteMedia(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMedia", reflect.TypeOf((*MockMediaRepo)(nil).DeleteMedia), arg0, arg1)
+}
+
+// FinishMedia mocks base method.
+func (m *MockMediaRepo) FinishMedia(arg0 context.Context, arg1 *model.Media) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishMedia", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FinishMedia indicates an expected call of FinishMedia.
+func (mr *MockMediaRepoMockRecorder) FinishMedia(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishMedia", reflect.TypeOf((*MockMediaRepo)(nil).FinishMedia), arg0, arg1)
+}
+
+// GetMedia mocks base method.
+func (m *MockMediaRepo) GetMedia(arg0 context.Context, arg1 string) (*model.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMedia", arg0, arg1)
+	ret0, _ := ret[0].(*model.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMedia indicates an expected call of GetMedia.
+func (mr *MockMediaRepoMockRecorder) GetMedia(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMedia", reflect.TypeOf((*MockMediaRepo)(nil).GetMedia), arg0, arg1)
+}
+
+// GetMediaById mocks base method.
+func (m *MockMediaRepo) GetMediaById(arg0 context.Context, arg1 uint) (*model.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMediaById", arg0, arg1)
+	ret0, _ := ret[0].(*model.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMediaById indicates an expected call of GetMediaById.
+func (mr *MockMediaRepoMockRecorder) GetMediaById(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMediaById", reflect.TypeOf((*MockMediaRepo)(nil).GetMediaById), arg0, arg1)
+}
+
+// GetMediaVariant mocks base method.
+func (m *MockMediaRepo) GetMediaVariant(arg0 context.Context, arg1 string) (*model.MediaVariant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMediaVariant", arg0, arg1)
+	ret0, _ := ret[0].(*model.MediaVariant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMediaVariant indicates an expected call of GetMediaVariant.
+func (mr *MockMediaRepoMockRecorder) GetMediaVariant(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMediaVariant", reflect.TypeOf((*MockMediaRepo)(nil).GetMediaVariant), arg0, arg1)
+}
+
+// GetOrphanedMedia mocks base method.
+func (m *MockMediaRepo) GetOrphanedMedia(arg0 context.Context, arg1 time.Time, arg2 int) ([]model.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrphanedMedia", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrphanedMedia indicates an expected call of GetOrphanedMedia.
+func (mr *MockMediaRepoMockRecorder) GetOrphanedMedia(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrphanedMedia", reflect.TypeOf((*MockMediaRepo)(nil).GetOrphanedMedia), arg0, arg1, arg2)
+}
+
+// GetPendingMedia mocks base method.
+func (m *MockMediaRepo) GetPendingMedia(arg0 context.Context, arg1 int) ([]model.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPendingMedia", arg0, arg1)
+	ret0, _ := ret[0].([]model.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPendingMedia indicates an expected call of GetPendingMedia.
+func (mr *MockMediaRepoMockRecorder) GetPendingMedia(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingMedia", reflect.TypeOf((*MockMediaRepo)(nil).GetPendingMedia), arg0, arg1)
+}
+
+// GetUserMedia mocks base method.
+func (m *MockMediaRepo) GetUserMedia(arg0 context.Context, arg1 uint) ([]model.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserMedia", arg0, arg1)
+	ret0, _ := ret[0].([]model.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserMedia indicates an expected call of GetUserMedia.
+func (mr *MockMediaRepoMockRecorder) GetUserMedia(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserMedia", reflect.TypeOf((*MockMediaRepo)(nil).GetUserMedia), arg0, arg1)
+}
+
+// LinkPostMedia mocks base method.
+func (m *MockMediaRepo) LinkPostMedia(arg0 context.Context, arg1 uint, arg2 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkPostMedia", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkPostMedia indicates an expected call of LinkPostMedia.
+func (mr *MockMediaRepoMockRecorder) LinkPostMedia(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkPostMedia", reflect.TypeOf((*MockMediaRepo)(nil).LinkPostMedia), arg0, arg1, arg2)
+}
+
+// UsedSpace mocks base method.
+func (m *MockMediaRepo) UsedSpace(arg0 context.Context, arg1 uint) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UsedSpace", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UsedSpace indicates an expected call of UsedSpace.
+func (mr *MockMediaRepoMockRecorder) UsedSpace(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UsedSpace", reflect.TypeOf((*MockMediaRepo)(nil).UsedSpace), arg0, arg1)
+}
@@ -0,0 +1,109 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: PersonalAccessTokenRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockPersonalAccessTokenRepo is a mock of PersonalAccessTokenRepo interface.
+type MockPersonalAccessTokenRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockPersonalAccessTokenRepoMockRecorder
+}
+
+// MockPersonalAccessTokenRepoMockRecorder is the mock recorder for MockPersonalAccessTokenRepo.
+type MockPersonalAccessTokenRepoMockRecorder struct {
+	mock *MockPersonalAccessTokenRepo
+}
+
+// NewMockPersonalAccessTokenRepo creates a new mock instance.
+func NewMockPersonalAccessTokenRepo(ctrl *gomock.Controller) *MockPersonalAccessTokenRepo {
+	mock := &MockPersonalAccessTokenRepo{ctrl: ctrl}
+	mock.recorder = &MockPersonalAccessTokenRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPersonalAccessTokenRepo) EXPECT() *MockPersonalAccessTokenRepoMockRecorder {
+	return m.recorder
+}
+
+// CreatePersonalToken mocks base method.
+func (m *MockPersonalAccessTokenRepo) CreatePersonalToken(arg0 context.Context, arg1 *model.PersonalAccessToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePersonalToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePersonalToken indicates an expected call of CreatePersonalToken.
+func (mr *MockPersonalAccessTokenRepoMockRecorder) CreatePersonalToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePersonalToken", reflect.TypeOf((*MockPersonalAccessTokenRepo)(nil).CreatePersonalToken), arg0, arg1)
+}
+
+// DeletePersonalToken mocks base method.
+func (m *MockPersonalAccessTokenRepo) DeletePersonalToken(arg0 context.Context, arg1, arg2 uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePersonalToken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePersonalToken indicates an expected call of DeletePersonalToken.
+func (mr *MockPersonalAccessTokenRepoMockRecorder) DeletePersonalToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePersonalToken", reflect.TypeOf((*MockPersonalAccessTokenRepo)(nil).DeletePersonalToken), arg0, arg1, arg2)
+}
+
+// GetPersonalToken mocks base method.
+func (m *MockPersonalAccessTokenRepo) GetPersonalToken(arg0 context.Context, arg1 string) (*model.PersonalAccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPersonalToken", arg0, arg1)
+	ret0, _ := ret[0].(*model.PersonalAccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPersonalToken indicates an expected call of GetPersonalToken.
+func (mr *MockPersonalAccessTokenRepoMockRecorder) GetPersonalToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPersonalToken", reflect.TypeOf((*MockPersonalAccessTokenRepo)(nil).GetPersonalToken), arg0, arg1)
+}
+
+// GetPersonalTokens mocks base method.
+func (m *MockPersonalAccessTokenRepo) GetPersonalTokens(arg0 context.Context, arg1 uint) ([]model.PersonalAccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPersonalTokens", arg0, arg1)
+	ret0, _ := ret[0].([]model.PersonalAccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPersonalTokens indicates an expected call of GetPersonalTokens.
+func (mr *MockPersonalAccessTokenRepoMockRecorder) GetPersonalTokens(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPersonalTokens", reflect.TypeOf((*MockPersonalAccessTokenRepo)(nil).GetPersonalTokens), arg0, arg1)
+}
+
+// TouchPersonalToken mocks base method.
+func (m *MockPersonalAccessTokenRepo) TouchPersonalToken(arg0 context.Context, arg1 uint, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchPersonalToken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchPersonalToken indicates an expected call of TouchPersonalToken.
+func (mr *MockPersonalAccessTokenRepoMockRecorder) TouchPersonalToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchPersonalToken", reflect.TypeOf((*MockPersonalAccessTokenRepo)(nil).TouchPersonalToken), arg0, arg1, arg2)
+}
@@ -7,6 +7,7 @@ package mock_repository
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	model "github.com/slavik22/blogRestApi/model"
 	gomock "go.uber.org/mock/gomock"
@@ -35,6 +36,21 @@ func (m *MockPostRepo) EXPECT() *MockPostRepoMockRecorder {
 	return m.recorder
 }
 
+// CountPosts mocks base method.
+func (m *MockPostRepo) CountPosts(arg0 context.Context, arg1 model.PostQuery) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountPosts", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountPosts indicates an expected call of CountPosts.
+func (mr *MockPostRepoMockRecorder) CountPosts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountPosts", reflect.TypeOf((*MockPostRepo)(nil).CountPosts), arg0, arg1)
+}
+
 // CreatePost mocks base method.
 func (m *MockPostRepo) CreatePost(arg0 context.Context, arg1 *model.Post) (uint, error) {
 	m.ctrl.T.Helper()
@@ -51,60 +67,118 @@ func (mr *MockPostRepoMockRecorder) CreatePost(arg0, arg1 interface{}) *gomock.C
 }
 
 // DeletePost mocks base method.
-func (m *MockPostRepo) DeletePost(arg0 context.Context, arg1, arg2 uint) error {
+func (m *MockPostRepo) DeletePost(arg0 context.Context, arg1 uint) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeletePost", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "DeletePost", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeletePost indicates an expected call of DeletePost.
-func (mr *MockPostRepoMockRecorder) DeletePost(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockPostRepoMockRecorder) DeletePost(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePost", reflect.TypeOf((*MockPostRepo)(nil).DeletePost), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePost", reflect.TypeOf((*MockPostRepo)(nil).DeletePost), arg0, arg1)
+}
+
+// GetDuePosts mocks base method.
+func (m *MockPostRepo) GetDuePosts(arg0 context.Context, arg1 time.Time, arg2 int) ([]model.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDuePosts", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDuePosts indicates an expected call of GetDuePosts.
+func (mr *MockPostRepoMockRecorder) GetDuePosts(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDuePosts", reflect.TypeOf((*MockPostRepo)(nil).GetDuePosts), arg0, arg1, arg2)
 }
 
 // GetPost mocks base method.
-func (m *MockPostRepo) GetPost(arg0 context.Context, arg1, arg2 uint) (*model.Post, error) {
+func (m *MockPostRepo) GetPost(arg0 context.Context, arg1 uint) (*model.Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPost", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "GetPost", arg0, arg1)
 	ret0, _ := ret[0].(*model.Post)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPost indicates an expected call of GetPost.
-func (mr *MockPostRepoMockRecorder) GetPost(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockPostRepoMockRecorder) GetPost(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPost", reflect.TypeOf((*MockPostRepo)(nil).GetPost), arg0, arg1)
+}
+
+// GetPostBySlug mocks base method.
+func (m *MockPostRepo) GetPostBySlug(arg0 context.Context, arg1 string) (*model.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostBySlug", arg0, arg1)
+	ret0, _ := ret[0].(*model.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostBySlug indicates an expected call of GetPostBySlug.
+func (mr *MockPostRepoMockRecorder) GetPostBySlug(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPost", reflect.TypeOf((*MockPostRepo)(nil).GetPost), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostBySlug", reflect.TypeOf((*MockPostRepo)(nil).GetPostBySlug), arg0, arg1)
 }
 
 // GetPosts mocks base method.
-func (m *MockPostRepo) GetPosts(arg0 context.Context) ([]model.Post, error) {
+func (m *MockPostRepo) GetPosts(arg0 context.Context, arg1 model.PostQuery) ([]model.Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPosts", arg0)
+	ret := m.ctrl.Call(m, "GetPosts", arg0, arg1)
 	ret0, _ := ret[0].([]model.Post)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPosts indicates an expected call of GetPosts.
-func (mr *MockPostRepoMockRecorder) GetPosts(arg0 interface{}) *gomock.Call {
+func (mr *MockPostRepoMockRecorder) GetPosts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPosts", reflect.TypeOf((*MockPostRepo)(nil).GetPosts), arg0, arg1)
+}
+
+// SetCommentMode mocks base method.
+func (m *MockPostRepo) SetCommentMode(arg0 context.Context, arg1 *model.Post) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetCommentMode", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetCommentMode indicates an expected call of SetCommentMode.
+func (mr *MockPostRepoMockRecorder) SetCommentMode(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCommentMode", reflect.TypeOf((*MockPostRepo)(nil).SetCommentMode), arg0, arg1)
+}
+
+// SetPostStatus mocks base method.
+func (m *MockPostRepo) SetPostStatus(arg0 context.Context, arg1 *model.Post, arg2 model.PostStatus) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPostStatus", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPostStatus indicates an expected call of SetPostStatus.
+func (mr *MockPostRepoMockRecorder) SetPostStatus(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPosts", reflect.TypeOf((*MockPostRepo)(nil).GetPosts), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPostStatus", reflect.TypeOf((*MockPostRepo)(nil).SetPostStatus), arg0, arg1, arg2)
 }
 
 // UpdatePost mocks base method.
-func (m *MockPostRepo) UpdatePost(arg0 context.Context, arg1 *model.Post) (*model.Post, error) {
+func (m *MockPostRepo) UpdatePost(arg0 context.Context, arg1 *model.Post, arg2 model.PostRevision) (*model.Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdatePost", arg0, arg1)
+	ret := m.ctrl.Call(m, "UpdatePost", arg0, arg1, arg2)
 	ret0, _ := ret[0].(*model.Post)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UpdatePost indicates an expected call of UpdatePost.
-func (mr *MockPostRepoMockRecorder) UpdatePost(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockPostRepoMockRecorder) UpdatePost(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePost", reflect.TypeOf((*MockPostRepo)(nil).UpdatePost), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePost", reflect.TypeOf((*MockPostRepo)(nil).UpdatePost), arg0, arg1, arg2)
 }
@@ -0,0 +1,66 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: PostRevisionRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockPostRevisionRepo is a mock of PostRevisionRepo interface.
+type MockPostRevisionRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockPostRevisionRepoMockRecorder
+}
+
+// MockPostRevisionRepoMockRecorder is the mock recorder for MockPostRevisionRepo.
+type MockPostRevisionRepoMockRecorder struct {
+	mock *MockPostRevisionRepo
+}
+
+// NewMockPostRevisionRepo creates a new mock instance.
+func NewMockPostRevisionRepo(ctrl *gomock.Controller) *MockPostRevisionRepo {
+	mock := &MockPostRevisionRepo{ctrl: ctrl}
+	mock.recorder = &MockPostRevisionRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPostRevisionRepo) EXPECT() *MockPostRevisionRepoMockRecorder {
+	return m.recorder
+}
+
+// GetRevision mocks base method.
+func (m *MockPostRevisionRepo) GetRevision(arg0 context.Context, arg1 uint, arg2 int) (*model.PostRevision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevision", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*model.PostRevision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevision indicates an expected call of GetRevision.
+func (mr *MockPostRevisionRepoMockRecorder) GetRevision(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevision", reflect.TypeOf((*MockPostRevisionRepo)(nil).GetRevision), arg0, arg1, arg2)
+}
+
+// GetRevisions mocks base method.
+func (m *MockPostRevisionRepo) GetRevisions(arg0 context.Context, arg1 uint) ([]model.PostRevision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevisions", arg0, arg1)
+	ret0, _ := ret[0].([]model.PostRevision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevisions indicates an expected call of GetRevisions.
+func (mr *MockPostRevisionRepoMockRecorder) GetRevisions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevisions", reflect.TypeOf((*MockPostRevisionRepo)(nil).GetRevisions), arg0, arg1)
+}
@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: RecoveryCodeRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockRecoveryCodeRepo is a mock of RecoveryCodeRepo interface.
+type MockRecoveryCodeRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockRecoveryCodeRepoMockRecorder
+}
+
+// MockRecoveryCodeRepoMockRecorder is the mock recorder for MockRecoveryCodeRepo.
+type MockRecoveryCodeRepoMockRecorder struct {
+	mock *MockRecoveryCodeRepo
+}
+
+// NewMockRecoveryCodeRepo creates a new mock instance.
+func NewMockRecoveryCodeRepo(ctrl *gomock.Controller) *MockRecoveryCodeRepo {
+	mock := &MockRecoveryCodeRepo{ctrl: ctrl}
+	mock.recorder = &MockRecoveryCodeRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRecoveryCodeRepo) EXPECT() *MockRecoveryCodeRepoMockRecorder {
+	return m.recorder
+}
+
+// ReplaceRecoveryCodes mocks base method.
+func (m *MockRecoveryCodeRepo) ReplaceRecoveryCodes(arg0 context.Context, arg1 uint, arg2 []model.RecoveryCode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceRecoveryCodes", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceRecoveryCodes indicates an expected call of ReplaceRecoveryCodes.
+func (mr *MockRecoveryCodeRepoMockRecorder) ReplaceRecoveryCodes(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceRecoveryCodes", reflect.TypeOf((*MockRecoveryCodeRepo)(nil).ReplaceRecoveryCodes), arg0, arg1, arg2)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockRecoveryCodeRepo) UseRecoveryCode(arg0 context.Context, arg1 uint, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockRecoveryCodeRepoMockRecorder) UseRecoveryCode(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockRecoveryCodeRepo)(nil).UseRecoveryCode), arg0, arg1, arg2)
+}
@@ -0,0 +1,81 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: SpamRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockSpamRepo is a mock of SpamRepo interface.
+type MockSpamRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockSpamRepoMockRecorder
+}
+
+// MockSpamRepoMockRecorder is the mock recorder for MockSpamRepo.
+type MockSpamRepoMockRecorder struct {
+	mock *MockSpamRepo
+}
+
+// NewMockSpamRepo creates a new mock instance.
+func NewMockSpamRepo(ctrl *gomock.Controller) *MockSpamRepo {
+	mock := &MockSpamRepo{ctrl: ctrl}
+	mock.recorder = &MockSpamRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSpamRepo) EXPECT() *MockSpamRepoMockRecorder {
+	return m.recorder
+}
+
+// GetSpamTokens mocks base method.
+func (m *MockSpamRepo) GetSpamTokens(arg0 context.Context, arg1 []string) (map[string]model.SpamToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSpamTokens", arg0, arg1)
+	ret0, _ := ret[0].(map[string]model.SpamToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSpamTokens indicates an expected call of GetSpamTokens.
+func (mr *MockSpamRepoMockRecorder) GetSpamTokens(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSpamTokens", reflect.TypeOf((*MockSpamRepo)(nil).GetSpamTokens), arg0, arg1)
+}
+
+// GetSpamTotals mocks base method.
+func (m *MockSpamRepo) GetSpamTotals(arg0 context.Context) (int64, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSpamTotals", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetSpamTotals indicates an expected call of GetSpamTotals.
+func (mr *MockSpamRepoMockRecorder) GetSpamTotals(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSpamTotals", reflect.TypeOf((*MockSpamRepo)(nil).GetSpamTotals), arg0)
+}
+
+// TrainSpam mocks base method.
+func (m *MockSpamRepo) TrainSpam(arg0 context.Context, arg1 uint, arg2 []string, arg3 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrainSpam", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TrainSpam indicates an expected call of TrainSpam.
+func (mr *MockSpamRepoMockRecorder) TrainSpam(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrainSpam", reflect.TypeOf((*MockSpamRepo)(nil).TrainSpam), arg0, arg1, arg2, arg3)
+}
@@ -0,0 +1,109 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: TagRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockTagRepo is a mock of TagRepo interface.
+type MockTagRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockTagRepoMockRecorder
+}
+
+// MockTagRepoMockRecorder is the mock recorder for MockTagRepo.
+type MockTagRepoMockRecorder struct {
+	mock *MockTagRepo
+}
+
+// NewMockTagRepo creates a new mock instance.
+func NewMockTagRepo(ctrl *gomock.Controller) *MockTagRepo {
+	mock := &MockTagRepo{ctrl: ctrl}
+	mock.recorder = &MockTagRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTagRepo) EXPECT() *MockTagRepoMockRecorder {
+	return m.recorder
+}
+
+// GetTag mocks base method.
+func (m *MockTagRepo) GetTag(arg0 context.Context, arg1 string) (*model.Tag, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTag", arg0, arg1)
+	ret0, _ := ret[0].(*model.Tag)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTag indicates an expected call of GetTag.
+func (mr *MockTagRepoMockRecorder) GetTag(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTag", reflect.TypeOf((*MockTagRepo)(nil).GetTag), arg0, arg1)
+}
+
+// GetTags mocks base method.
+func (m *MockTagRepo) GetTags(arg0 context.Context) ([]model.TagCount, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTags", arg0)
+	ret0, _ := ret[0].([]model.TagCount)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTags indicates an expected call of GetTags.
+func (mr *MockTagRepoMockRecorder) GetTags(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTags", reflect.TypeOf((*MockTagRepo)(nil).GetTags), arg0)
+}
+
+// MergeTags mocks base method.
+func (m *MockTagRepo) MergeTags(arg0 context.Context, arg1, arg2 uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeTags", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MergeTags indicates an expected call of MergeTags.
+func (mr *MockTagRepoMockRecorder) MergeTags(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeTags", reflect.TypeOf((*MockTagRepo)(nil).MergeTags), arg0, arg1, arg2)
+}
+
+// SaveTags mocks base method.
+func (m *MockTagRepo) SaveTags(arg0 context.Context, arg1 []model.Tag) ([]model.Tag, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTags", arg0, arg1)
+	ret0, _ := ret[0].([]model.Tag)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveTags indicates an expected call of SaveTags.
+func (mr *MockTagRepoMockRecorder) SaveTags(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTags", reflect.TypeOf((*MockTagRepo)(nil).SaveTags), arg0, arg1)
+}
+
+// UpdateTag mocks base method.
+func (m *MockTagRepo) UpdateTag(arg0 context.Context, arg1 *model.Tag) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTag", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateTag indicates an expected call of UpdateTag.
+func (mr *MockTagRepoMockRecorder) UpdateTag(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTag", reflect.TypeOf((*MockTagRepo)(nil).UpdateTag), arg0, arg1)
+}
@@ -0,0 +1,139 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: TrashRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockTrashRepo is a mock of TrashRepo interface.
+type MockTrashRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockTrashRepoMockRecorder
+}
+
+// MockTrashRepoMockRecorder is the mock recorder for MockTrashRepo.
+type MockTrashRepoMockRecorder struct {
+	mock *MockTrashRepo
+}
+
+// NewMockTrashRepo creates a new mock instance.
+func NewMockTrashRepo(ctrl *gomock.Controller) *MockTrashRepo {
+	mock := &MockTrashRepo{ctrl: ctrl}
+	mock.recorder = &MockTrashRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTrashRepo) EXPECT() *MockTrashRepoMockRecorder {
+	return m.recorder
+}
+
+// GetTrash mocks base method.
+func (m *MockTrashRepo) GetTrash(arg0 context.Context, arg1 uint) ([]model.TrashItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrash", arg0, arg1)
+	ret0, _ := ret[0].([]model.TrashItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrash indicates an expected call of GetTrash.
+func (mr *MockTrashRepoMockRecorder) GetTrash(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrash", reflect.TypeOf((*MockTrashRepo)(nil).GetTrash), arg0, arg1)
+}
+
+// GetTrashedComment mocks base method.
+func (m *MockTrashRepo) GetTrashedComment(arg0 context.Context, arg1 uint) (*model.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrashedComment", arg0, arg1)
+	ret0, _ := ret[0].(*model.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrashedComment indicates an expected call of GetTrashedComment.
+func (mr *MockTrashRepoMockRecorder) GetTrashedComment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrashedComment", reflect.TypeOf((*MockTrashRepo)(nil).GetTrashedComment), arg0, arg1)
+}
+
+// GetTrashedPost mocks base method.
+func (m *MockTrashRepo) GetTrashedPost(arg0 context.Context, arg1 uint) (*model.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrashedPost", arg0, arg1)
+	ret0, _ := ret[0].(*model.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrashedPost indicates an expected call of GetTrashedPost.
+func (mr *MockTrashRepoMockRecorder) GetTrashedPost(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrashedPost", reflect.TypeOf((*MockTrashRepo)(nil).GetTrashedPost), arg0, arg1)
+}
+
+// Purge mocks base method.
+func (m *MockTrashRepo) Purge(arg0 context.Context, arg1 time.Time) (*model.PurgeResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", arg0, arg1)
+	ret0, _ := ret[0].(*model.PurgeResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockTrashRepoMockRecorder) Purge(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockTrashRepo)(nil).Purge), arg0, arg1)
+}
+
+// RestoreComment mocks base method.
+func (m *MockTrashRepo) RestoreComment(arg0 context.Context, arg1 *model.Comment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreComment", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreComment indicates an expected call of RestoreComment.
+func (mr *MockTrashRepoMockRecorder) RestoreComment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreComment", reflect.TypeOf((*MockTrashRepo)(nil).RestoreComment), arg0, arg1)
+}
+
+// RestorePost mocks base method.
+func (m *MockTrashRepo) RestorePost(arg0 context.Context, arg1 *model.Post) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestorePost", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestorePost indicates an expected call of RestorePost.
+func (mr *MockTrashRepoMockRecorder) RestorePost(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestorePost", reflect.TypeOf((*MockTrashRepo)(nil).RestorePost), arg0, arg1)
+}
+
+// RestoreUser mocks base method.
+func (m *MockTrashRepo) RestoreUser(arg0 context.Context, arg1 uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUser", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreUser indicates an expected call of RestoreUser.
+func (mr *MockTrashRepoMockRecorder) RestoreUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUser", reflect.TypeOf((*MockTrashRepo)(nil).RestoreUser), arg0, arg1)
+}
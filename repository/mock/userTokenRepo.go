@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/slavik22/blogRestApi/repository (interfaces: UserTokenRepo)
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/slavik22/blogRestApi/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockUserTokenRepo is a mock of UserTokenRepo interface.
+type MockUserTokenRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserTokenRepoMockRecorder
+}
+
+// MockUserTokenRepoMockRecorder is the mock recorder for MockUserTokenRepo.
+type MockUserTokenRepoMockRecorder struct {
+	mock *MockUserTokenRepo
+}
+
+// NewMockUserTokenRepo creates a new mock instance.
+func NewMockUserTokenRepo(ctrl *gomock.Controller) *MockUserTokenRepo {
+	mock := &MockUserTokenRepo{ctrl: ctrl}
+	mock.recorder = &MockUserTokenRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserTokenRepo) EXPECT() *MockUserTokenRepoMockRecorder {
+	return m.recorder
+}
+
+// CreateUserToken mocks base method.
+func (m *MockUserTokenRepo) CreateUserToken(arg0 context.Context, arg1 *model.UserToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUserToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUserToken indicates an expected call of CreateUserToken.
+func (mr *MockUserTokenRepoMockRecorder) CreateUserToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserToken", reflect.TypeOf((*MockUserTokenRepo)(nil).CreateUserToken), arg0, arg1)
+}
+
+// DeleteUserTokens mocks base method.
+func (m *MockUserTokenRepo) DeleteUserTokens(arg0 context.Context, arg1 uint, arg2 model.TokenPurpose) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserTokens", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUserTokens indicates an expected call of DeleteUserTokens.
+func (mr *MockUserTokenRepoMockRecorder) DeleteUserTokens(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserTokens", reflect.TypeOf((*MockUserTokenRepo)(nil).DeleteUserTokens), arg0, arg1, arg2)
+}
+
+// GetUserToken mocks base method.
+func (m *MockUserTokenRepo) GetUserToken(arg0 context.Context, arg1 model.TokenPurpose, arg2 string) (*model.UserToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserToken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*model.UserToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserToken indicates an expected call of GetUserToken.
+func (mr *MockUserTokenRepoMockRecorder) GetUserToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserToken", reflect.TypeOf((*MockUserTokenRepo)(nil).GetUserToken), arg0, arg1, arg2)
+}
+
+// UseUserToken mocks base method.
+func (m *MockUserTokenRepo) UseUserToken(arg0 context.Context, arg1 uint) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseUserToken", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseUserToken indicates an expected call of UseUserToken.
+func (mr *MockUserTokenRepoMockRecorder) UseUserToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseUserToken", reflect.TypeOf((*MockUserTokenRepo)(nil).UseUserToken), arg0, arg1)
+}
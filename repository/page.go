@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// paginate orders the query, newest first unless sorted otherwise, and
+// applies the page request. Sort fields are whitelisted by the caller.
+func paginate(db *gorm.DB, sort []model.SortField, page model.PageRequest) *gorm.DB {
+	if len(sort) == 0 {
+		sort = []model.SortField{{Field: "created_at", Desc: true}}
+	}
+
+	for _, field := range sort {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: field.Field}, Desc: field.Desc})
+	}
+	if last := sort[len(sort)-1]; last.Field != "id" {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: last.Desc})
+	}
+
+	db = db.Limit(page.Limit)
+
+	if page.Offset() {
+		return db.Offset(page.Skip())
+	}
+
+	if page.Cursor != nil {
+		if sort[0].Desc {
+			db = db.Where("created_at < ? OR (created_at = ? AND id < ?)",
+				page.Cursor.CreatedAt, page.Cursor.CreatedAt, page.Cursor.ID)
+		} else {
+			db = db.Where("created_at > ? OR (created_at = ? AND id > ?)",
+				page.Cursor.CreatedAt, page.Cursor.CreatedAt, page.Cursor.ID)
+		}
+	}
+
+	return db
+}
+
+// createdBetween limits the query to rows created in [after, before)
+func createdBetween(db *gorm.DB, after, before *time.Time) *gorm.DB {
+	if after != nil {
+		db = db.Where("created_at >= ?", *after)
+	}
+	if before != nil {
+		db = db.Where("created_at < ?", *before)
+	}
+
+	return db
+}
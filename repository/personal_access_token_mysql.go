@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PersonalAccessTokenMysqlRepo ...
+type PersonalAccessTokenMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewPersonalAccessTokenMysqlRepo ...
+func NewPersonalAccessTokenMysqlRepo(db *gorm.DB) *PersonalAccessTokenMysqlRepo {
+	return &PersonalAccessTokenMysqlRepo{db: db}
+}
+
+// CreatePersonalToken stores a new personal access token
+func (repo *PersonalAccessTokenMysqlRepo) CreatePersonalToken(ctx context.Context, token *model.PersonalAccessToken) error {
+	if token == nil {
+		return errors.New("No personal access token provided")
+	}
+	return repo.db.Create(token).Error
+}
+
+// GetPersonalToken retrieves a personal access token by the hash of the token
+func (repo *PersonalAccessTokenMysqlRepo) GetPersonalToken(ctx context.Context, tokenHash string) (*model.PersonalAccessToken, error) {
+	var token model.PersonalAccessToken
+	err := repo.db.First(&token, "token_hash = ?", tokenHash).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching personal access token %v", err)
+	}
+
+	return &token, nil
+}
+
+// GetPersonalTokens retrieves all personal access tokens of the user
+func (repo *PersonalAccessTokenMysqlRepo) GetPersonalTokens(ctx context.Context, userId uint) ([]model.PersonalAccessToken, error) {
+	var tokens []model.PersonalAccessToken
+	err := repo.db.Where("user_id = ?", userId).Order("created_at desc").Find(&tokens).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching personal access tokens %v", err)
+	}
+
+	return tokens, nil
+}
+
+// TouchPersonalToken records when the token was last used
+func (repo *PersonalAccessTokenMysqlRepo) TouchPersonalToken(ctx context.Context, id uint, usedAt time.Time) error {
+	return repo.db.Model(&model.PersonalAccessToken{}).
+		Where("id = ?", id).
+		Update("last_used_at", usedAt).Error
+}
+
+// DeletePersonalToken deletes the user's token
+func (repo *PersonalAccessTokenMysqlRepo) DeletePersonalToken(ctx context.Context, userId uint, id uint) error {
+	result := repo.db.Where("id = ? AND user_id = ?", id, userId).Delete(&model.PersonalAccessToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return types.ErrNotFound
+	}
+	return nil
+}
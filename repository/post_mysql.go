@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
 	"github.com/slavik22/blogRestApi/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 )
 
 // PostMysqlRepo ...
@@ -18,9 +21,37 @@ func NewPostMysqlRepo(db *gorm.DB) *PostMysqlRepo {
 	return &PostMysqlRepo{db: db}
 }
 
-func (repo *PostMysqlRepo) GetPosts(context.Context) ([]model.Post, error) {
+// filterPosts applies the query's filters, not its sort or page
+func (repo *PostMysqlRepo) filterPosts(query model.PostQuery) *gorm.DB {
+	db := repo.db.Model(&model.Post{})
+	if query.AuthorId != 0 {
+		db = db.Where("user_id = ?", query.AuthorId)
+	}
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if !query.AnyStatus {
+		db = db.Where("(status = ? OR user_id = ?)", model.PostPublished, query.ViewerId)
+	}
+	if len(query.Tags) > 0 {
+		tagged := repo.db.Table("post_tags").
+			Select("post_tags.post_id").
+			Joins("JOIN tags ON tags.id = post_tags.tag_id").
+			Where("tags.slug IN ?", query.Tags).
+			Group("post_tags.post_id").
+			Having("COUNT(*) = ?", len(query.Tags))
+		db = db.Where("id IN (?)", tagged)
+	}
+	if len(query.CategoryIds) > 0 {
+		db = db.Where("category_id IN ?", query.CategoryIds)
+	}
+
+	return createdBetween(db, query.CreatedAfter, query.CreatedBefore)
+}
+
+func (repo *PostMysqlRepo) GetPosts(ctx context.Context, query model.PostQuery) ([]model.Post, error) {
 	var posts []model.Post
-	err := repo.db.Find(&posts).Error
+	err := paginate(repo.filterPosts(query), query.Sort, query.Page).Preload("Tags").Find(&posts).Error
 	if err != nil {
 		return nil, fmt.Errorf("error while fetching posts %v", err)
 	}
@@ -28,30 +59,85 @@ func (repo *PostMysqlRepo) GetPosts(context.Context) ([]model.Post, error) {
 	return posts, nil
 }
 
-func (repo *PostMysqlRepo) GetPost(ctx context.Context, userId uint, postId uint) (*model.Post, error) {
+func (repo *PostMysqlRepo) GetPost(ctx context.Context, postId uint) (*model.Post, error) {
+	var post model.Post
+	err := repo.db.Preload("Tags").First(&post, "id = ?", postId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching post %v", err)
+	}
+
+	return &post, nil
+}
+
+// GetPostBySlug returns the post that has or had the slug
+func (repo *PostMysqlRepo) GetPostBySlug(ctx context.Context, slug string) (*model.Post, error) {
+	owner := repo.db.Model(&model.PostSlug{}).Select("post_id").Where("slug = ?", slug)
+
 	var post model.Post
-	err := repo.db.First(&post, "userId = ? AND postId = ?", userId, postId).Error
+	err := repo.db.Preload("Tags").First(&post, "id = (?)", owner).Error
 	if err != nil {
-		return nil, fmt.Errorf("no post found %v", err)
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching post %v", err)
 	}
 
 	return &post, nil
 }
 
+// CreatePost saves the post with a slug generated from its title
 func (repo *PostMysqlRepo) CreatePost(ctx context.Context, post *model.Post) (uint, error) {
 	if post == nil {
 		return 0, errors.New("No post provided")
 	}
-	err := repo.db.Create(post).Error
+	post.Slug = ""
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(post).Error; err != nil {
+			return err
+		}
+		if err := reserveSlug(tx, post); err != nil {
+			return err
+		}
+		return addRevision(tx, post, model.PostRevision{UserId: post.UserId, CreatedAt: post.CreatedAt})
+	})
 	if err != nil {
 		return 0, err
 	}
 	return post.ID, nil
 }
 
-func (repo *PostMysqlRepo) UpdatePost(ctx context.Context, post *model.Post) (*model.Post, error) {
-	err := repo.db.Where("id = ? AND user_id = ?", post.ID, post.UserId).
-		Updates(model.Post{Title: post.Title, Body: post.Body}).Error
+// UpdatePost saves the title, body and category and replaces the tags unless
+// they are nil. A new title gets a new slug, the old one keeps leading to the
+// post. The new content is kept as the next revision, made by the revision's
+// user.
+func (repo *PostMysqlRepo) UpdatePost(ctx context.Context, post *model.Post, revision model.PostRevision) (*model.Post, error) {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(post).Omit(clause.Associations).
+			Updates(model.Post{Title: post.Title, Body: post.Body, BodyHTML: post.BodyHTML}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(post).Omit(clause.Associations).Update("category_id", post.CategoryId).Error
+		if err != nil {
+			return err
+		}
+
+		if post.Tags != nil {
+			if err := tx.Model(post).Association("Tags").Replace(post.Tags); err != nil {
+				return err
+			}
+		}
+
+		if err := reserveSlug(tx, post); err != nil {
+			return err
+		}
+
+		return addRevision(tx, post, revision)
+	})
 
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -63,13 +149,67 @@ func (repo *PostMysqlRepo) UpdatePost(ctx context.Context, post *model.Post) (*m
 	return post, nil
 }
 
-func (repo *PostMysqlRepo) DeletePost(ctx context.Context, userId uint, postId uint) error {
-	err := repo.db.Where("id = ? AND user_id = ?", postId, userId).Delete(model.Post{}).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return fmt.Errorf("no post found %v", err)
+// DeletePost moves the post to the trash, its comments go with it
+func (repo *PostMysqlRepo) DeletePost(ctx context.Context, postId uint) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&model.Post{}).Where("id = ?", postId).Update("deleted_at", now)
+		if result.Error != nil {
+			return result.Error
 		}
-		return err
+		if result.RowsAffected == 0 {
+			return types.ErrNotFound
+		}
+
+		return tx.Model(&model.Comment{}).Where("post_id = ?", postId).Update("deleted_at", now).Error
+	})
+}
+
+// SetPostStatus saves the post's status and publish time if it is still in
+// the status from, and returns types.ErrConflict if it moved meanwhile
+func (repo *PostMysqlRepo) SetPostStatus(ctx context.Context, post *model.Post, from model.PostStatus) error {
+	result := repo.db.Model(&model.Post{}).
+		Where("id = ? AND status = ?", post.ID, from).
+		Updates(map[string]interface{}{"status": post.Status, "published_at": post.PublishedAt})
+	if result.Error != nil {
+		return fmt.Errorf("error while updating post status %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return types.ErrConflict
+	}
+
+	return nil
+}
+
+// SetCommentMode sets how new comments on the post are moderated, an empty
+// mode follows COMMENT_MODE
+func (repo *PostMysqlRepo) SetCommentMode(ctx context.Context, post *model.Post) error {
+	err := repo.db.Model(post).Omit(clause.Associations).Update("comment_mode", post.CommentMode).Error
+	if err != nil {
+		return fmt.Errorf("error while updating comment mode %v", err)
 	}
+
 	return nil
 }
+
+// GetDuePosts returns up to limit scheduled posts whose publish time has come
+func (repo *PostMysqlRepo) GetDuePosts(ctx context.Context, now time.Time, limit int) ([]model.Post, error) {
+	var posts []model.Post
+	err := repo.db.Where("status = ? AND published_at <= ?", model.PostScheduled, now).
+		Order("published_at").Limit(limit).Find(&posts).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching due posts %v", err)
+	}
+
+	return posts, nil
+}
+
+func (repo *PostMysqlRepo) CountPosts(ctx context.Context, query model.PostQuery) (int64, error) {
+	var count int64
+	err := repo.filterPosts(query).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("error while counting posts %v", err)
+	}
+
+	return count, nil
+}
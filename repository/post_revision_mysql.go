@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+)
+
+// PostRevisionMysqlRepo ...
+type PostRevisionMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewPostRevisionMysqlRepo ...
+func NewPostRevisionMysqlRepo(db *gorm.DB) *PostRevisionMysqlRepo {
+	return &PostRevisionMysqlRepo{db: db}
+}
+
+// GetRevisions returns the post's revisions, newest first
+func (repo *PostRevisionMysqlRepo) GetRevisions(ctx context.Context, postId uint) ([]model.PostRevision, error) {
+	var revisions []model.PostRevision
+	err := repo.db.Where("post_id = ?", postId).Order("number DESC").Find(&revisions).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching revisions %v", err)
+	}
+
+	return revisions, nil
+}
+
+func (repo *PostRevisionMysqlRepo) GetRevision(ctx context.Context, postId uint, number int) (*model.PostRevision, error) {
+	var revision model.PostRevision
+	err := repo.db.First(&revision, "post_id = ? AND number = ?", postId, number).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching revision %v", err)
+	}
+
+	return &revision, nil
+}
+
+// addRevision snapshots the post's title and body as its next revision.
+// Concurrent edits numbering the same revision fail on the unique index.
+func addRevision(tx *gorm.DB, post *model.Post, revision model.PostRevision) error {
+	var last int
+	err := tx.Model(&model.PostRevision{}).
+		Where("post_id = ?", post.ID).
+		Select("COALESCE(MAX(number), 0)").
+		Scan(&last).Error
+	if err != nil {
+		return err
+	}
+
+	revision.PostId = post.ID
+	revision.Number = last + 1
+	revision.Title = post.Title
+	revision.Body = post.Body
+	return tx.Create(&revision).Error
+}
+
+// migrateRevisions gives posts written before revisions existed their first one
+func migrateRevisions(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO post_revisions (post_id, number, user_id, title, body, created_at)
+		SELECT id, 1, user_id, title, body, created_at FROM posts
+		WHERE NOT EXISTS (SELECT 1 FROM post_revisions WHERE post_revisions.post_id = posts.id)`).Error
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"strings"
+)
+
+// maxSlugBase is how long a slug gets before its collision suffix
+const maxSlugBase = 80
+
+// slugBase is the slug a title asks for, cut at a word boundary
+func slugBase(title string) string {
+	slug := util.Slugify(util.Transliterate(title))
+	for i := range slug {
+		if i > maxSlugBase {
+			slug = slug[:i]
+			if cut := strings.LastIndexByte(slug, '-'); cut > 0 {
+				slug = slug[:cut]
+			}
+			break
+		}
+	}
+
+	if slug == "" {
+		return "post"
+	}
+	return slug
+}
+
+// hasSlugBase reports whether slug is base or base with a collision suffix
+func hasSlugBase(slug, base string) bool {
+	if slug == base {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(slug, base+"-")
+	if !ok {
+		return false
+	}
+	_, err := strconv.Atoi(suffix)
+	return err == nil
+}
+
+// reserveSlug sets the post's slug from its title. The current slug is kept
+// while the title still asks for it, otherwise the first of base, base-2,
+// base-3... that is free or was the post's before is reserved for it. Slugs
+// reserved concurrently are skipped thanks to the unique index.
+func reserveSlug(tx *gorm.DB, post *model.Post) error {
+	base := slugBase(post.Title)
+	if post.Slug != "" && hasSlugBase(post.Slug, base) {
+		return nil
+	}
+
+	var reserved []model.PostSlug
+	err := tx.Where("slug = ? OR slug LIKE ?", base, base+"-%").Find(&reserved).Error
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[string]uint, len(reserved))
+	for _, s := range reserved {
+		owners[s.Slug] = s.PostId
+	}
+
+	for n := 1; ; n++ {
+		slug := base
+		if n > 1 {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+
+		owner, ok := owners[slug]
+		if ok && owner != post.ID {
+			continue
+		}
+		if !ok {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&model.PostSlug{Slug: slug, PostId: post.ID})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				owners[slug] = 0
+				continue
+			}
+		}
+
+		post.Slug = slug
+		return tx.Unscoped().Model(&model.Post{}).Where("id = ?", post.ID).Update("slug", slug).Error
+	}
+}
+
+// migrateSlugs gives posts written before slugs existed their first one
+func migrateSlugs(db *gorm.DB) error {
+	for {
+		var posts []model.Post
+		err := db.Unscoped().Select("id", "title").Where("slug = ?", "").
+			Order("id").Limit(100).Find(&posts).Error
+		if err != nil {
+			return err
+		}
+		if len(posts) == 0 {
+			return nil
+		}
+
+		for i := range posts {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return reserveSlug(tx, &posts[i])
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
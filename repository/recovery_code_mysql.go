@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+// RecoveryCodeMysqlRepo ...
+type RecoveryCodeMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewRecoveryCodeMysqlRepo ...
+func NewRecoveryCodeMysqlRepo(db *gorm.DB) *RecoveryCodeMysqlRepo {
+	return &RecoveryCodeMysqlRepo{db: db}
+}
+
+// ReplaceRecoveryCodes replaces all recovery codes of the user with the given ones
+func (repo *RecoveryCodeMysqlRepo) ReplaceRecoveryCodes(ctx context.Context, userId uint, codes []model.RecoveryCode) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode marks the user's code as used. It reports false when there
+// is no such unused code.
+func (repo *RecoveryCodeMysqlRepo) UseRecoveryCode(ctx context.Context, userId uint, codeHash string) (bool, error) {
+	res := repo.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
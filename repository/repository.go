@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"github.com/slavik22/blogRestApi/model"
+	"time"
 )
 
 // UserRepo is a repository for users
@@ -10,26 +11,158 @@ import (
 //go:generate mockery --dir . --name UserRepo --output ./mocks
 type UserRepo interface {
 	GetUser(context.Context, string) (*model.User, error)
+	GetUserById(context.Context, uint) (*model.User, error)
 	CreateUser(context.Context, *model.User) (uint, error)
 	UpdateUser(context.Context, *model.User) (*model.User, error)
 	DeleteUser(context.Context, uint) error
+	UseTOTPStep(ctx context.Context, userId uint, step int64) (bool, error)
 }
 
 // PostRepo is a store for posts
 //
 //go:generate mockery --dir . --name PostRepo --output ./mocks
 type PostRepo interface {
-	GetPosts(context.Context) ([]model.Post, error)
-	GetPost(context.Context, uint, uint) (*model.Post, error)
+	GetPosts(context.Context, model.PostQuery) ([]model.Post, error)
+	CountPosts(context.Context, model.PostQuery) (int64, error)
+	GetPost(context.Context, uint) (*model.Post, error)
+	GetPostBySlug(context.Context, string) (*model.Post, error)
 	CreatePost(context.Context, *model.Post) (uint, error)
-	UpdatePost(context.Context, *model.Post) (*model.Post, error)
-	DeletePost(context.Context, uint, uint) error
+	UpdatePost(context.Context, *model.Post, model.PostRevision) (*model.Post, error)
+	DeletePost(context.Context, uint) error
+	SetPostStatus(context.Context, *model.Post, model.PostStatus) error
+	SetCommentMode(context.Context, *model.Post) error
+	GetDuePosts(context.Context, time.Time, int) ([]model.Post, error)
 }
 
 type CommentRepo interface {
-	GetComments(context.Context) ([]model.Comment, error)
+	GetComments(context.Context, model.CommentQuery) ([]model.Comment, error)
+	CountComments(context.Context, model.CommentQuery) (int64, error)
 	GetComment(context.Context, uint) (*model.Comment, error)
 	CreateComment(context.Context, *model.Comment) (uint, error)
+	GetThread(context.Context, model.CommentQuery) ([]model.Comment, error)
+	ModerateComments(context.Context, []uint, model.CommentStatus, uint) ([]model.Comment, error)
 	UpdateComment(context.Context, *model.Comment) (*model.Comment, error)
-	DeleteComment(context.Context, uint, uint) error
+	DeleteComment(context.Context, uint) error
+}
+
+// SessionRepo is a store for login sessions and their refresh tokens
+type SessionRepo interface {
+	CreateSession(context.Context, *model.Session) error
+	GetSession(context.Context, string) (*model.Session, error)
+	UpdateSession(context.Context, *model.Session) error
+	RevokeSession(context.Context, string) error
+	RevokeUserSessions(context.Context, uint, string) error
+	CreateRefreshToken(context.Context, *model.RefreshToken) error
+	GetRefreshToken(context.Context, string) (*model.RefreshToken, error)
+	UseRefreshToken(context.Context, uint) (bool, error)
+}
+
+// UserTokenRepo is a store for single-use tokens mailed to users
+type UserTokenRepo interface {
+	CreateUserToken(context.Context, *model.UserToken) error
+	GetUserToken(context.Context, model.TokenPurpose, string) (*model.UserToken, error)
+	UseUserToken(context.Context, uint) (bool, error)
+	DeleteUserTokens(context.Context, uint, model.TokenPurpose) error
+}
+
+// LoginThrottleRepo is a store for failed sign-in attempts
+type LoginThrottleRepo interface {
+	CountAttempt(ctx context.Context, subject string, policy model.ThrottlePolicy, now time.Time) (time.Duration, error)
+	ForgiveAttempt(ctx context.Context, subject string) error
+	ResetThrottle(context.Context, string) error
+	GetLockouts(context.Context, time.Time) ([]model.LoginThrottle, error)
+	DeleteThrottle(context.Context, uint) error
+}
+
+// RecoveryCodeRepo is a store for hashed MFA recovery codes
+type RecoveryCodeRepo interface {
+	ReplaceRecoveryCodes(context.Context, uint, []model.RecoveryCode) error
+	UseRecoveryCode(context.Context, uint, string) (bool, error)
+}
+
+// PersonalAccessTokenRepo is a store for hashed personal access tokens
+type PersonalAccessTokenRepo interface {
+	CreatePersonalToken(context.Context, *model.PersonalAccessToken) error
+	GetPersonalToken(context.Context, string) (*model.PersonalAccessToken, error)
+	GetPersonalTokens(context.Context, uint) ([]model.PersonalAccessToken, error)
+	TouchPersonalToken(context.Context, uint, time.Time) error
+	DeletePersonalToken(context.Context, uint, uint) error
+}
+
+// ExternalIdentityRepo is a store for identities at external providers
+type ExternalIdentityRepo interface {
+	GetExternalIdentity(context.Context, string, string) (*model.ExternalIdentity, error)
+	CreateExternalIdentity(context.Context, *model.ExternalIdentity) error
+}
+
+// SearchIndex ranks posts and comments by relevance to a text query. Services
+// keep it in sync on every write, indexes the database maintains by itself
+// may ignore those calls.
+type SearchIndex interface {
+	IndexPost(context.Context, *model.Post) error
+	IndexComment(context.Context, *model.Comment) error
+	// RemovePost also removes the post's comments, they are deleted with it
+	RemovePost(context.Context, uint) error
+	RemoveComment(context.Context, uint) error
+	// RemoveAuthor removes everything the user wrote and the comments on their posts, they are deleted with the user
+	RemoveAuthor(context.Context, uint) error
+	Search(context.Context, model.SearchQuery) ([]model.SearchHit, int64, error)
+}
+
+// TagRepo is a store for tags, posts are tagged through PostRepo
+type TagRepo interface {
+	GetTags(context.Context) ([]model.TagCount, error)
+	GetTag(context.Context, string) (*model.Tag, error)
+	SaveTags(context.Context, []model.Tag) ([]model.Tag, error)
+	UpdateTag(context.Context, *model.Tag) error
+	MergeTags(ctx context.Context, fromId, intoId uint) error
+}
+
+// CategoryRepo is a store for the category tree
+type CategoryRepo interface {
+	GetCategories(context.Context) ([]model.Category, error)
+	CreateCategory(context.Context, *model.Category) error
+	DeleteCategory(context.Context, uint) error
+}
+
+// TrashRepo is a store for the posts, comments and users in the trash. The
+// other repositories move them there and no longer see them.
+type TrashRepo interface {
+	GetTrash(context.Context, uint) ([]model.TrashItem, error)
+	GetTrashedPost(context.Context, uint) (*model.Post, error)
+	GetTrashedComment(context.Context, uint) (*model.Comment, error)
+	RestorePost(context.Context, *model.Post) error
+	RestoreComment(context.Context, *model.Comment) error
+	RestoreUser(context.Context, uint) error
+	Purge(context.Context, time.Time) (*model.PurgeResult, error)
+}
+
+// PostRevisionRepo is a store for the revisions PostRepo snapshots
+type PostRevisionRepo interface {
+	GetRevisions(context.Context, uint) ([]model.PostRevision, error)
+	GetRevision(context.Context, uint, int) (*model.PostRevision, error)
+}
+
+// MediaRepo is a store for uploaded media and the posts embedding them, the
+// bytes are kept in a storage.BlobStore
+type MediaRepo interface {
+	CreateMedia(ctx context.Context, media *model.Media, quota int64) error
+	GetMedia(context.Context, string) (*model.Media, error)
+	GetMediaById(context.Context, uint) (*model.Media, error)
+	GetUserMedia(context.Context, uint) ([]model.Media, error)
+	GetMediaVariant(context.Context, string) (*model.MediaVariant, error)
+	GetPendingMedia(context.Context, int) ([]model.Media, error)
+	FinishMedia(context.Context, *model.Media) error
+	UsedSpace(context.Context, uint) (int64, error)
+	LinkPostMedia(ctx context.Context, postId uint, keys []string) error
+	CountMediaPosts(context.Context, uint) (int64, error)
+	GetOrphanedMedia(context.Context, time.Time, int) ([]model.Media, error)
+	DeleteMedia(context.Context, uint) error
+}
+
+// SpamRepo is a store for the naive Bayes spam classifier's training
+type SpamRepo interface {
+	GetSpamTokens(context.Context, []string) (map[string]model.SpamToken, error)
+	GetSpamTotals(ctx context.Context) (spam, ham int64, err error)
+	TrainSpam(ctx context.Context, commentId uint, tokens []string, spam bool) error
 }
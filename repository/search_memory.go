@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"github.com/slavik22/blogRestApi/lib/search"
+	"github.com/slavik22/blogRestApi/model"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BM25 parameters, titles count twice as much as bodies
+const (
+	bm25K1      = 1.2
+	bm25B       = 0.75
+	titleWeight = 2
+)
+
+type memoryKey struct {
+	kind model.SearchKind
+	id   uint
+}
+
+type memoryDocument struct {
+	postId    uint
+	userId    uint
+	title     string
+	body      string
+	createdAt time.Time
+	// terms counts the weighted occurrences of each term
+	terms  map[string]float64
+	length float64
+}
+
+// SearchMemoryIndex is an in-process inverted index ranking with BM25. It is
+// meant for databases without full-text search and for tests, and has to be
+// filled on start up.
+type SearchMemoryIndex struct {
+	mu        sync.RWMutex
+	documents map[memoryKey]*memoryDocument
+	postings  map[string]map[memoryKey]struct{}
+	length    float64
+}
+
+// NewSearchMemoryIndex ...
+func NewSearchMemoryIndex() *SearchMemoryIndex {
+	return &SearchMemoryIndex{
+		documents: map[memoryKey]*memoryDocument{},
+		postings:  map[string]map[memoryKey]struct{}{},
+	}
+}
+
+func (idx *SearchMemoryIndex) IndexPost(ctx context.Context, post *model.Post) error {
+	idx.put(memoryKey{model.SearchPost, post.ID}, post.ID, post.UserId, post.Title, post.Body, post.CreatedAt)
+	return nil
+}
+
+func (idx *SearchMemoryIndex) IndexComment(ctx context.Context, comment *model.Comment) error {
+	idx.put(memoryKey{model.SearchComment, comment.ID}, comment.PostId, comment.UserId, comment.Title, comment.Body, comment.CreatedAt)
+	return nil
+}
+
+func (idx *SearchMemoryIndex) RemovePost(ctx context.Context, postId uint) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for key, doc := range idx.documents {
+		if doc.postId == postId {
+			idx.remove(key)
+		}
+	}
+	return nil
+}
+
+func (idx *SearchMemoryIndex) RemoveComment(ctx context.Context, commentId uint) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(memoryKey{model.SearchComment, commentId})
+	return nil
+}
+
+func (idx *SearchMemoryIndex) RemoveAuthor(ctx context.Context, userId uint) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	removed := map[uint]bool{}
+	for key, doc := range idx.documents {
+		if doc.userId == userId && key.kind == model.SearchPost {
+			removed[key.id] = true
+		}
+	}
+	for key, doc := range idx.documents {
+		if doc.userId == userId || removed[doc.postId] {
+			idx.remove(key)
+		}
+	}
+	return nil
+}
+
+func (idx *SearchMemoryIndex) Search(ctx context.Context, query model.SearchQuery) ([]model.SearchHit, int64, error) {
+	terms := search.Terms(query.Text)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := float64(len(idx.documents))
+	average := idx.length / math.Max(n, 1)
+
+	scores := map[memoryKey]float64{}
+	seen := map[string]bool{}
+	for _, term := range terms {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.postings[term]
+		idf := math.Log(1 + (n-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+		for key := range postings {
+			if query.Kind != "" && key.kind != query.Kind {
+				continue
+			}
+			doc := idx.documents[key]
+			// Only published posts are indexed, their comments go with them
+			if _, ok := idx.documents[memoryKey{model.SearchPost, doc.postId}]; !ok {
+				continue
+			}
+			tf := doc.terms[term]
+			scores[key] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*doc.length/average))
+		}
+	}
+
+	keys := make([]memoryKey, 0, len(scores))
+	for key := range scores {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		if created := idx.documents[a].createdAt; !created.Equal(idx.documents[b].createdAt) {
+			return created.After(idx.documents[b].createdAt)
+		}
+		if a.id != b.id {
+			return a.id > b.id
+		}
+		return a.kind < b.kind
+	})
+
+	total := int64(len(keys))
+	offset := query.Page.Skip()
+	if offset < 0 || offset > len(keys) {
+		offset = len(keys)
+	}
+	keys = keys[offset:]
+	if len(keys) > query.Page.Limit {
+		keys = keys[:query.Page.Limit]
+	}
+
+	hits := make([]model.SearchHit, len(keys))
+	for i, key := range keys {
+		doc := idx.documents[key]
+		hits[i] = model.SearchHit{
+			Kind:      key.kind,
+			ID:        key.id,
+			PostId:    doc.postId,
+			Title:     search.Highlight(doc.title, terms),
+			Snippet:   search.Snippet(doc.body, terms),
+			Score:     scores[key],
+			CreatedAt: doc.createdAt,
+		}
+	}
+
+	return hits, total, nil
+}
+
+func (idx *SearchMemoryIndex) put(key memoryKey, postId, userId uint, title, body string, createdAt time.Time) {
+	doc := &memoryDocument{
+		postId:    postId,
+		userId:    userId,
+		title:     title,
+		body:      body,
+		createdAt: createdAt,
+		terms:     map[string]float64{},
+	}
+	for _, term := range search.Terms(title) {
+		doc.terms[term] += titleWeight
+		doc.length += titleWeight
+	}
+	for _, term := range search.Terms(body) {
+		doc.terms[term]++
+		doc.length++
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(key)
+
+	idx.documents[key] = doc
+	idx.length += doc.length
+	for term := range doc.terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = map[memoryKey]struct{}{}
+		}
+		idx.postings[term][key] = struct{}{}
+	}
+}
+
+// remove drops a document, the caller holds the lock
+func (idx *SearchMemoryIndex) remove(key memoryKey) {
+	doc, ok := idx.documents[key]
+	if !ok {
+		return
+	}
+
+	for term := range doc.terms {
+		delete(idx.postings[term], key)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.length -= doc.length
+	delete(idx.documents, key)
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/search"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// postgresDocument is how Postgres indexes posts and comments
+const postgresDocument = "to_tsvector('simple', coalesce(title, '') || ' ' || coalesce(body, ''))"
+
+// SearchSQLIndex searches with the database's own full-text index, MySQL
+// FULLTEXT or Postgres tsvector. The database keeps it in sync.
+type SearchSQLIndex struct {
+	db *gorm.DB
+}
+
+// NewSearchSQLIndex ...
+func NewSearchSQLIndex(db *gorm.DB) *SearchSQLIndex {
+	return &SearchSQLIndex{db: db}
+}
+
+func (idx *SearchSQLIndex) IndexPost(context.Context, *model.Post) error {
+	return nil
+}
+
+func (idx *SearchSQLIndex) IndexComment(context.Context, *model.Comment) error {
+	return nil
+}
+
+func (idx *SearchSQLIndex) RemovePost(context.Context, uint) error {
+	return nil
+}
+
+func (idx *SearchSQLIndex) RemoveComment(context.Context, uint) error {
+	return nil
+}
+
+func (idx *SearchSQLIndex) RemoveAuthor(context.Context, uint) error {
+	return nil
+}
+
+type searchRow struct {
+	Kind      model.SearchKind
+	ID        uint
+	PostId    uint
+	Title     string
+	Body      string
+	CreatedAt time.Time
+	Score     float64
+}
+
+func (idx *SearchSQLIndex) Search(ctx context.Context, query model.SearchQuery) ([]model.SearchHit, int64, error) {
+	var score, match string
+	switch idx.db.Dialector.Name() {
+	case "mysql":
+		score = "MATCH(title, body) AGAINST (? IN NATURAL LANGUAGE MODE)"
+		match = score
+	case "postgres":
+		score = "ts_rank(" + postgresDocument + ", websearch_to_tsquery('simple', ?))"
+		match = postgresDocument + " @@ websearch_to_tsquery('simple', ?)"
+	default:
+		return nil, 0, fmt.Errorf("no full-text search for %s, use the memory search index", idx.db.Dialector.Name())
+	}
+
+	var selects []string
+	var args []interface{}
+	if query.Kind == "" || query.Kind == model.SearchPost {
+		selects = append(selects, fmt.Sprintf(
+			"SELECT 'post' AS kind, id, id AS post_id, title, body, created_at, %s AS score FROM posts WHERE %s AND status = ? AND deleted_at IS NULL", score, match))
+		args = append(args, query.Text, query.Text, model.PostPublished)
+	}
+	if query.Kind == "" || query.Kind == model.SearchComment {
+		selects = append(selects, fmt.Sprintf(
+			"SELECT 'comment' AS kind, id, post_id, title, body, created_at, %s AS score FROM comments WHERE %s"+
+				" AND status = ? AND deleted_at IS NULL AND post_id IN (SELECT id FROM posts WHERE status = ?)", score, match))
+		args = append(args, query.Text, query.Text, model.CommentApproved, model.PostPublished)
+	}
+	hits := "(" + strings.Join(selects, " UNION ALL ") + ") AS hits"
+
+	var total int64
+	err := idx.db.Raw("SELECT COUNT(*) FROM "+hits, args...).Scan(&total).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while counting search hits %v", err)
+	}
+
+	var rows []searchRow
+	err = idx.db.Raw("SELECT * FROM "+hits+" ORDER BY score DESC, created_at DESC, id DESC LIMIT ? OFFSET ?",
+		append(args, query.Page.Limit, query.Page.Skip())...).Scan(&rows).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while searching %v", err)
+	}
+
+	terms := search.Terms(query.Text)
+	result := make([]model.SearchHit, len(rows))
+	for i, row := range rows {
+		result[i] = model.SearchHit{
+			Kind:      row.Kind,
+			ID:        row.ID,
+			PostId:    row.PostId,
+			Title:     search.Highlight(row.Title, terms),
+			Snippet:   search.Snippet(row.Body, terms),
+			Score:     row.Score,
+			CreatedAt: row.CreatedAt,
+		}
+	}
+
+	return result, total, nil
+}
+
+// migrateSearch creates the full-text indexes SearchSQLIndex relies on
+func migrateSearch(db *gorm.DB) error {
+	for _, table := range []interface{}{&model.Post{}, &model.Comment{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(table); err != nil {
+			return err
+		}
+
+		name := "idx_" + stmt.Table + "_search"
+		if db.Migrator().HasIndex(table, name) {
+			continue
+		}
+
+		var err error
+		switch db.Dialector.Name() {
+		case "mysql":
+			err = db.Exec(fmt.Sprintf("CREATE FULLTEXT INDEX %s ON %s (title, body)", name, stmt.Table)).Error
+		case "postgres":
+			err = db.Exec(fmt.Sprintf("CREATE INDEX %s ON %s USING GIN (%s)", name, stmt.Table, postgresDocument)).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
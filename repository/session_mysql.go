@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+// SessionMysqlRepo ...
+type SessionMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewSessionMysqlRepo ...
+func NewSessionMysqlRepo(db *gorm.DB) *SessionMysqlRepo {
+	return &SessionMysqlRepo{db: db}
+}
+
+// CreateSession stores a new login session
+func (repo *SessionMysqlRepo) CreateSession(ctx context.Context, session *model.Session) error {
+	if session == nil {
+		return errors.New("No session provided")
+	}
+	return repo.db.Create(session).Error
+}
+
+// GetSession retrieves a session by its id
+func (repo *SessionMysqlRepo) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	var session model.Session
+	err := repo.db.First(&session, "id = ?", id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching session %v", err)
+	}
+
+	return &session, nil
+}
+
+// UpdateSession saves the session expiry
+func (repo *SessionMysqlRepo) UpdateSession(ctx context.Context, session *model.Session) error {
+	return repo.db.Model(session).Update("expires_at", session.ExpiresAt).Error
+}
+
+// RevokeSession revokes the session and thereby every token of its family
+func (repo *SessionMysqlRepo) RevokeSession(ctx context.Context, id string) error {
+	return repo.db.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions revokes all sessions of the user except the given one
+func (repo *SessionMysqlRepo) RevokeUserSessions(ctx context.Context, userId uint, except string) error {
+	return repo.db.Model(&model.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userId, except).
+		Update("revoked_at", time.Now()).Error
+}
+
+// CreateRefreshToken stores a new refresh token
+func (repo *SessionMysqlRepo) CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error {
+	if token == nil {
+		return errors.New("No refresh token provided")
+	}
+	return repo.db.Create(token).Error
+}
+
+// GetRefreshToken retrieves a refresh token by its hash
+func (repo *SessionMysqlRepo) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	err := repo.db.First(&token, "token_hash = ?", tokenHash).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching refresh token %v", err)
+	}
+
+	return &token, nil
+}
+
+// UseRefreshToken marks the refresh token as used. It reports false when the
+// token had already been used, which means it is being replayed.
+func (repo *SessionMysqlRepo) UseRefreshToken(ctx context.Context, id uint) (bool, error) {
+	res := repo.db.Model(&model.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
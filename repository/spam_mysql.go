@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// SpamMysqlRepo ...
+type SpamMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewSpamMysqlRepo ...
+func NewSpamMysqlRepo(db *gorm.DB) *SpamMysqlRepo {
+	return &SpamMysqlRepo{db: db}
+}
+
+// GetSpamTokens retrieves the counts of the trained tokens among the given
+// ones, keyed by token
+func (repo *SpamMysqlRepo) GetSpamTokens(ctx context.Context, tokens []string) (map[string]model.SpamToken, error) {
+	counts := make(map[string]model.SpamToken, len(tokens))
+	if len(tokens) == 0 {
+		return counts, nil
+	}
+
+	var rows []model.SpamToken
+	if err := repo.db.Where("token IN ?", tokens).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("error while fetching spam tokens %v", err)
+	}
+	for _, row := range rows {
+		counts[row.Token] = row
+	}
+
+	return counts, nil
+}
+
+// GetSpamTotals counts the comments trained as spam and as ham
+func (repo *SpamMysqlRepo) GetSpamTotals(ctx context.Context) (spam, ham int64, err error) {
+	var rows []struct {
+		Spam  bool
+		Count int64
+	}
+	err = repo.db.Model(&model.SpamTraining{}).Select("spam, COUNT(*) AS count").Group("spam").Find(&rows).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("error while counting spam training %v", err)
+	}
+
+	for _, row := range rows {
+		if row.Spam {
+			spam = row.Count
+		} else {
+			ham = row.Count
+		}
+	}
+	return spam, ham, nil
+}
+
+// TrainSpam counts the comment's tokens as spam or ham. A comment is trained
+// once, training it as the other class moves the tokens it was trained with.
+func (repo *SpamMysqlRepo) TrainSpam(ctx context.Context, commentId uint, tokens []string, spam bool) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		var trained []model.SpamTraining
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("comment_id = ?", commentId).Find(&trained).Error
+		if err != nil {
+			return err
+		}
+
+		if len(trained) == 1 {
+			if trained[0].Spam == spam {
+				return nil
+			}
+
+			if old := strings.Fields(trained[0].Tokens); len(old) > 0 {
+				column := spamColumn(trained[0].Spam)
+				err = tx.Model(&model.SpamToken{}).Where("token IN ?", old).
+					Update(column, gorm.Expr("GREATEST("+column+" - 1, 0)")).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(tokens) > 0 {
+			column := spamColumn(spam)
+			rows := make([]model.SpamToken, len(tokens))
+			for i, token := range tokens {
+				rows[i].Token = token
+				if spam {
+					rows[i].Spam = 1
+				} else {
+					rows[i].Ham = 1
+				}
+			}
+
+			err = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "token"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{column: gorm.Expr(column + " + 1")}),
+			}).Create(&rows).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "comment_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"spam", "tokens"}),
+		}).Create(&model.SpamTraining{CommentId: commentId, Spam: spam, Tokens: strings.Join(tokens, "\n")}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error while training spam filter %v", err)
+	}
+
+	return nil
+}
+
+// spamColumn is the spam_tokens column counting the class
+func spamColumn(spam bool) string {
+	if spam {
+		return "spam"
+	}
+	return "ham"
+}
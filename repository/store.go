@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"github.com/slavik22/blogRestApi/lib/markdown"
+	"github.com/slavik22/blogRestApi/model"
 	"gorm.io/gorm"
 )
 
@@ -9,17 +11,26 @@ import (
 type Store struct {
 	Db *gorm.DB
 
-	User    UserRepo
-	Post    PostRepo
-	Comment CommentRepo
+	User     UserRepo
+	Post     PostRepo
+	Comment  CommentRepo
+	Session  SessionRepo
+	Token    UserTokenRepo
+	Login    LoginThrottleRepo
+	Recovery RecoveryCodeRepo
+	Personal PersonalAccessTokenRepo
+	External ExternalIdentityRepo
+	Search   SearchIndex
+	Tag      TagRepo
+	Category CategoryRepo
+	Revision PostRevisionRepo
+	Trash    TrashRepo
+	Media    MediaRepo
+	Spam     SpamRepo
 }
 
 // New creates new repository
 func New(ctx context.Context, db *gorm.DB, userRepo UserRepo, postRepo PostRepo, commentRepo CommentRepo) (*Store, error) {
-	//if err := db.AutoMigrate(&model.User{}, &model.Post{}, &model.Comment{}); err != nil {
-	//	log.Println(err)
-	//}
-
 	var store Store
 
 	// Init MySQL repositories
@@ -28,7 +39,132 @@ func New(ctx context.Context, db *gorm.DB, userRepo UserRepo, postRepo PostRepo,
 		store.User = userRepo
 		store.Post = postRepo
 		store.Comment = commentRepo
+		store.Session = NewSessionMysqlRepo(db)
+		store.Token = NewUserTokenMysqlRepo(db)
+		store.Login = NewLoginThrottleMysqlRepo(db)
+		store.Recovery = NewRecoveryCodeMysqlRepo(db)
+		store.Personal = NewPersonalAccessTokenMysqlRepo(db)
+		store.External = NewExternalIdentityMysqlRepo(db)
+		store.Search = NewSearchSQLIndex(db)
+		store.Tag = NewTagMysqlRepo(db)
+		store.Category = NewCategoryMysqlRepo(db)
+		store.Revision = NewPostRevisionMysqlRepo(db)
+		store.Trash = NewTrashMysqlRepo(db)
+		store.Media = NewMediaMysqlRepo(db)
+		store.Spam = NewSpamMysqlRepo(db)
 	}
 
 	return &store, nil
 }
+
+// MigrateOptions allows the migrations that delete data
+type MigrateOptions struct {
+	// DeleteOrphanComments deletes the comments whose post or author is gone
+	// when the foreign keys on comments are added, Migrate fails on them
+	// otherwise
+	DeleteOrphanComments bool
+}
+
+// Migrate creates or updates the database schema
+func Migrate(db *gorm.DB, opts MigrateOptions) error {
+	if err := migrateCommentOrphans(db, opts.DeleteOrphanComments); err != nil {
+		return err
+	}
+
+	// Accounts created before email verification existed count as verified,
+	// once, when the column is added
+	verifyExisting := db.Migrator().HasTable(&model.User{}) &&
+		!db.Migrator().HasColumn(&model.User{}, "EmailVerifiedAt")
+
+	err := db.AutoMigrate(
+		&model.User{},
+		&model.Category{},
+		&model.Tag{},
+		&model.Post{},
+		&model.PostSlug{},
+		&model.PostRevision{},
+		&model.Comment{},
+		&model.Session{},
+		&model.RefreshToken{},
+		&model.UserToken{},
+		&model.LoginThrottle{},
+		&model.RecoveryCode{},
+		&model.PersonalAccessToken{},
+		&model.ExternalIdentity{},
+		&model.Media{},
+		&model.MediaVariant{},
+		&model.SpamToken{},
+		&model.SpamTraining{},
+	)
+	if err != nil {
+		return err
+	}
+
+	if verifyExisting {
+		if err := migrateVerifiedEmails(db); err != nil {
+			return err
+		}
+	}
+
+	// Posts written before the workflow existed were live, the status column
+	// defaults to published for them but they still need a publish time
+	err = db.Model(&model.Post{}).
+		Where("status = ? AND published_at IS NULL", model.PostPublished).
+		Update("published_at", gorm.Expr("created_at")).Error
+	if err != nil {
+		return err
+	}
+
+	if err := migrateRevisions(db); err != nil {
+		return err
+	}
+
+	if err := migrateSlugs(db); err != nil {
+		return err
+	}
+
+	if err := migrateBodyHTML(db, &model.Post{}, markdown.Post); err != nil {
+		return err
+	}
+
+	if err := migrateBodyHTML(db, &model.Comment{}, markdown.Comment); err != nil {
+		return err
+	}
+
+	if err := migrateCommentPaths(db); err != nil {
+		return err
+	}
+
+	return migrateSearch(db)
+}
+
+// migrateBodyHTML renders the bodies written before they were rendered, in
+// the table of the post or comment model
+func migrateBodyHTML(db *gorm.DB, table interface{}, policy markdown.Policy) error {
+	for {
+		var rows []struct {
+			ID   uint
+			Body string
+		}
+		err := db.Unscoped().Model(table).Select("id", "body").Where("body_html IS NULL").
+			Order("id").Limit(100).Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		for _, row := range rows {
+			html, err := markdown.Render(row.Body, policy)
+			if err != nil {
+				return err
+			}
+
+			err = db.Unscoped().Model(table).Where("id = ?", row.ID).Update("body_html", html).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TagMysqlRepo ...
+type TagMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewTagMysqlRepo ...
+func NewTagMysqlRepo(db *gorm.DB) *TagMysqlRepo {
+	return &TagMysqlRepo{db: db}
+}
+
+// GetTags returns all tags with the number of posts using them, most used first
+func (repo *TagMysqlRepo) GetTags(ctx context.Context) ([]model.TagCount, error) {
+	var tags []model.TagCount
+	err := repo.db.Model(&model.Tag{}).
+		Select("tags.id, tags.name, tags.slug, COUNT(posts.id) AS posts").
+		Joins("LEFT JOIN post_tags ON post_tags.tag_id = tags.id").
+		Joins("LEFT JOIN posts ON posts.id = post_tags.post_id AND posts.status = ? AND posts.deleted_at IS NULL", model.PostPublished).
+		Group("tags.id").
+		Order("posts DESC, tags.name").
+		Scan(&tags).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching tags %v", err)
+	}
+
+	return tags, nil
+}
+
+func (repo *TagMysqlRepo) GetTag(ctx context.Context, slug string) (*model.Tag, error) {
+	var tag model.Tag
+	err := repo.db.First(&tag, "slug = ?", slug).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching tag %v", err)
+	}
+
+	return &tag, nil
+}
+
+// SaveTags creates the tags whose slugs don't exist yet and returns all of them with ids
+func (repo *TagMysqlRepo) SaveTags(ctx context.Context, tags []model.Tag) ([]model.Tag, error) {
+	if len(tags) == 0 {
+		return []model.Tag{}, nil
+	}
+
+	err := repo.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "slug"}}, DoNothing: true}).
+		Create(&tags).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while saving tags %v", err)
+	}
+
+	slugs := make([]string, len(tags))
+	for i, tag := range tags {
+		slugs[i] = tag.Slug
+	}
+
+	var saved []model.Tag
+	err = repo.db.Where("slug IN ?", slugs).Find(&saved).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching tags %v", err)
+	}
+
+	return saved, nil
+}
+
+func (repo *TagMysqlRepo) UpdateTag(ctx context.Context, tag *model.Tag) error {
+	return repo.db.Model(tag).Updates(model.Tag{Name: tag.Name, Slug: tag.Slug}).Error
+}
+
+// MergeTags moves every post from one tag to another and deletes the first
+func (repo *TagMysqlRepo) MergeTags(ctx context.Context, fromId, intoId uint) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO post_tags (post_id, tag_id)
+			SELECT post_id, ? FROM post_tags WHERE tag_id = ?
+			AND post_id NOT IN (SELECT post_id FROM post_tags WHERE tag_id = ?)`, intoId, fromId, intoId).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&model.Tag{}, fromId).Error
+	})
+}
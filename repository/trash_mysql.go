@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+// TrashMysqlRepo ...
+type TrashMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewTrashMysqlRepo ...
+func NewTrashMysqlRepo(db *gorm.DB) *TrashMysqlRepo {
+	return &TrashMysqlRepo{db: db}
+}
+
+// GetTrash returns the user's deleted posts and comments, last deleted first.
+// Comments that went with their post come back with it and aren't listed.
+func (repo *TrashMysqlRepo) GetTrash(ctx context.Context, userId uint) ([]model.TrashItem, error) {
+	var posts []model.Post
+	err := repo.db.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userId).
+		Find(&posts).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching trashed posts %v", err)
+	}
+
+	var comments []model.Comment
+	err = repo.db.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userId).
+		Where("post_id IN (SELECT id FROM posts WHERE deleted_at IS NULL)").
+		Find(&comments).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching trashed comments %v", err)
+	}
+
+	items := make([]model.TrashItem, 0, len(posts)+len(comments))
+	for _, post := range posts {
+		items = append(items, model.TrashItem{
+			Kind:      model.TrashPost,
+			ID:        post.ID,
+			PostId:    post.ID,
+			Title:     post.Title,
+			DeletedAt: post.DeletedAt.Time,
+		})
+	}
+	for _, comment := range comments {
+		items = append(items, model.TrashItem{
+			Kind:      model.TrashComment,
+			ID:        comment.ID,
+			PostId:    comment.PostId,
+			Title:     comment.Title,
+			DeletedAt: comment.DeletedAt.Time,
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+
+	return items, nil
+}
+
+func (repo *TrashMysqlRepo) GetTrashedPost(ctx context.Context, postId uint) (*model.Post, error) {
+	var post model.Post
+	err := repo.db.Unscoped().First(&post, "id = ? AND deleted_at IS NOT NULL", postId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching trashed post %v", err)
+	}
+
+	return &post, nil
+}
+
+func (repo *TrashMysqlRepo) GetTrashedComment(ctx context.Context, commentId uint) (*model.Comment, error) {
+	var comment model.Comment
+	err := repo.db.Unscoped().First(&comment, "id = ? AND deleted_at IS NOT NULL", commentId).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching trashed comment %v", err)
+	}
+
+	return &comment, nil
+}
+
+// RestorePost takes the post and the comments deleted with it out of the
+// trash. It fails with types.ErrConflict while the author is in the trash.
+func (repo *TrashMysqlRepo) RestorePost(ctx context.Context, post *model.Post) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := requireLive(tx, &model.User{}, post.UserId); err != nil {
+			return err
+		}
+
+		err := tx.Unscoped().Model(&model.Comment{}).
+			Where("post_id = ? AND deleted_at = ?", post.ID, post.DeletedAt.Time).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+
+		return restore(tx, &model.Post{}, post.ID)
+	})
+}
+
+// RestoreComment takes the comment out of the trash. It fails with
+// types.ErrConflict while its post or author is in the trash.
+func (repo *TrashMysqlRepo) RestoreComment(ctx context.Context, comment *model.Comment) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := requireLive(tx, &model.Post{}, comment.PostId); err != nil {
+			return err
+		}
+		if err := requireLive(tx, &model.User{}, comment.UserId); err != nil {
+			return err
+		}
+
+		return restore(tx, &model.Comment{}, comment.ID)
+	})
+}
+
+// RestoreUser takes the user out of the trash with everything deleted along with them
+func (repo *TrashMysqlRepo) RestoreUser(ctx context.Context, userId uint) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		err := tx.Unscoped().First(&user, "id = ? AND deleted_at IS NOT NULL", userId).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return types.ErrNotFound
+			}
+			return err
+		}
+		deletedAt := user.DeletedAt.Time
+
+		err = tx.Unscoped().Model(&model.Comment{}).
+			Where("deleted_at = ?", deletedAt).
+			Where("user_id = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)", userId, userId).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().Model(&model.Post{}).
+			Where("user_id = ? AND deleted_at = ?", userId, deletedAt).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+
+		return restore(tx, &model.User{}, userId)
+	})
+}
+
+// Purge removes everything that went to the trash before the time for good.
+// The database deletes what belongs to purged users and posts with them.
+func (repo *TrashMysqlRepo) Purge(ctx context.Context, before time.Time) (*model.PurgeResult, error) {
+	var result model.PurgeResult
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		for _, purge := range []struct {
+			table interface{}
+			count *int64
+		}{
+			{&model.Comment{}, &result.Comments},
+			{&model.Post{}, &result.Posts},
+			{&model.User{}, &result.Users},
+		} {
+			deleted := tx.Unscoped().Where("deleted_at < ?", before).Delete(purge.table)
+			if deleted.Error != nil {
+				return deleted.Error
+			}
+			*purge.count = deleted.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error while purging the trash %v", err)
+	}
+
+	return &result, nil
+}
+
+// requireLive fails with types.ErrConflict unless the row exists outside the trash
+func requireLive(tx *gorm.DB, table interface{}, id uint) error {
+	var count int64
+	if err := tx.Model(table).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return types.ErrConflict
+	}
+	return nil
+}
+
+// restore takes the row out of the trash, types.ErrNotFound if it isn't in there
+func restore(tx *gorm.DB, table interface{}, id uint) error {
+	result := tx.Unscoped().Model(table).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return types.ErrNotFound
+	}
+	return nil
+}
@@ -3,8 +3,10 @@ package repository
 import (
 	"context"
 	"errors"
+	"github.com/slavik22/blogRestApi/lib/types"
 	"github.com/slavik22/blogRestApi/model"
 	"gorm.io/gorm"
+	"time"
 )
 
 // UserMysqlRepo ...
@@ -22,6 +24,23 @@ func (repo *UserMysqlRepo) GetUser(ctx context.Context, email string) (*model.Us
 	var user model.User
 	err := repo.db.First(&user, "email = ?", email).Error
 	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetUserById retrieves user by id from Postgres
+func (repo *UserMysqlRepo) GetUserById(ctx context.Context, id uint) (*model.User, error) {
+	var user model.User
+	err := repo.db.First(&user, "id = ?", id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
 		return nil, err
 	}
 
@@ -34,6 +53,10 @@ func (repo *UserMysqlRepo) CreateUser(ctx context.Context, user *model.User) (ui
 		return 0, errors.New("No user provided")
 	}
 	err := repo.db.Create(user).Error
+	if duplicateEntry(err) {
+		// The email may belong to a user in the trash, GetUser doesn't see those
+		return 0, types.ErrConflict
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -43,6 +66,9 @@ func (repo *UserMysqlRepo) CreateUser(ctx context.Context, user *model.User) (ui
 // UpdateUser updates user in Postgres
 func (repo *UserMysqlRepo) UpdateUser(ctx context.Context, user *model.User) (*model.User, error) {
 	err := repo.db.Save(user).Error
+	if duplicateEntry(err) {
+		return nil, types.ErrConflict
+	}
 	if err != nil {
 		if err == gorm.ErrRecordNotFound { //not found
 			return nil, nil
@@ -53,17 +79,49 @@ func (repo *UserMysqlRepo) UpdateUser(ctx context.Context, user *model.User) (*m
 	return user, nil
 }
 
+// UseTOTPStep records the time step of an accepted TOTP code, unless the
+// user's last accepted code was of the step or a later one. It reports
+// whether the step was recorded, concurrent sign-ins with one code can't all
+// be.
+func (repo *UserMysqlRepo) UseTOTPStep(ctx context.Context, userId uint, step int64) (bool, error) {
+	res := repo.db.Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", userId, step).
+		Update("totp_last_step", step)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
 // DeleteUser deletes user in Postgres
 func (repo *UserMysqlRepo) DeleteUser(ctx context.Context, id uint) error {
 	if id < 0 {
 		return errors.New("No user ID provided")
 	}
-	err := repo.db.Where("id = ?", id).Delete(model.User{}).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil
+	// Everything the user wrote and every comment on their posts goes to the
+	// trash at the same time, so restoring the user can tell it apart
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&model.Comment{}).
+			Where("user_id = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)", id, id).
+			Update("deleted_at", now).Error
+		if err != nil {
+			return err
 		}
-		return err
-	}
-	return nil
+
+		err = tx.Model(&model.Post{}).Where("user_id = ?", id).Update("deleted_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&model.User{}).Where("id = ?", id).Update("deleted_at", now).Error
+	})
+}
+
+// migrateVerifiedEmails marks the accounts created before email verification
+// existed verified, REQUIRE_VERIFIED_EMAIL would lock them out otherwise
+func migrateVerifiedEmails(db *gorm.DB) error {
+	return db.Unscoped().Model(&model.User{}).
+		Where("email_verified_at IS NULL").
+		Update("email_verified_at", gorm.Expr("created_at")).Error
 }
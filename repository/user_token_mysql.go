@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+// UserTokenMysqlRepo ...
+type UserTokenMysqlRepo struct {
+	db *gorm.DB
+}
+
+// NewUserTokenMysqlRepo ...
+func NewUserTokenMysqlRepo(db *gorm.DB) *UserTokenMysqlRepo {
+	return &UserTokenMysqlRepo{db: db}
+}
+
+// CreateUserToken stores a new user token
+func (repo *UserTokenMysqlRepo) CreateUserToken(ctx context.Context, token *model.UserToken) error {
+	if token == nil {
+		return errors.New("No token provided")
+	}
+	return repo.db.Create(token).Error
+}
+
+// GetUserToken retrieves a token by purpose and hash
+func (repo *UserTokenMysqlRepo) GetUserToken(ctx context.Context, purpose model.TokenPurpose, tokenHash string) (*model.UserToken, error) {
+	var token model.UserToken
+	err := repo.db.First(&token, "purpose = ? AND token_hash = ?", purpose, tokenHash).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, types.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while fetching token %v", err)
+	}
+
+	return &token, nil
+}
+
+// UseUserToken marks the token as used. It reports false when the token had already been used.
+func (repo *UserTokenMysqlRepo) UseUserToken(ctx context.Context, id uint) (bool, error) {
+	res := repo.db.Model(&model.UserToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// DeleteUserTokens deletes all tokens of the user issued for the purpose
+func (repo *UserTokenMysqlRepo) DeleteUserTokens(ctx context.Context, userId uint, purpose model.TokenPurpose) error {
+	return repo.db.Where("user_id = ? AND purpose = ?", userId, purpose).Delete(&model.UserToken{}).Error
+}
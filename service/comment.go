@@ -2,39 +2,442 @@ package service
 
 import (
 	"context"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/markdown"
+	"github.com/slavik22/blogRestApi/lib/types"
 	"github.com/slavik22/blogRestApi/model"
 	"github.com/slavik22/blogRestApi/repository"
+	"strconv"
+	"strings"
 )
 
 type CommentService struct {
 	ctx   context.Context
 	store *repository.Store
+	cfg   *blogRestApi.Config
+	spam  SpamChecker
 }
 
-func NewCommentService(ctx context.Context, store *repository.Store) *CommentService {
+func NewCommentService(ctx context.Context, store *repository.Store, cfg *blogRestApi.Config, spam SpamChecker) *CommentService {
 	return &CommentService{
 		ctx:   ctx,
 		store: store,
+		cfg:   cfg,
+		spam:  spam,
 	}
 }
 
-func (s *CommentService) GetComments() ([]model.Comment, error) {
-	return s.store.Comment.GetComments(s.ctx)
+// GetComments returns a page of the comments matching the query. Only
+// moderators see the comments of others that aren't approved.
+func (s *CommentService) GetComments(query model.CommentQuery, actor Actor) (*model.Page[model.Comment], error) {
+	page, err := pageRequest(s.cfg, query.Sort, query.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	query.ViewerId = actor.UserId
+	query.AnyStatus = actor.Role.Can(model.PermCommentsModerate)
+
+	total, err := s.store.Comment.CountComments(s.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query.Page = lookahead(page)
+	comments, err := s.store.Comment.GetComments(s.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(page, comments, total, func(comment model.Comment) model.Cursor {
+		return model.Cursor{CreatedAt: comment.CreatedAt, ID: comment.ID}
+	}), nil
 }
 
-func (s *CommentService) GetComment(commentId uint) (*model.Comment, error) {
-	return s.store.Comment.GetComment(s.ctx, commentId)
+// GetPostComments returns a page of the comments on the post matching the
+// query, the post has to be visible to the actor
+func (s *CommentService) GetPostComments(postId uint, query model.CommentQuery, actor Actor) (*model.Page[model.Comment], error) {
+	if _, err := s.visiblePost(postId, actor); err != nil {
+		return nil, err
+	}
+
+	query.PostId = postId
+	return s.GetComments(query, actor)
 }
 
-func (s *CommentService) CreateComment(comment model.Comment, userId uint) (uint, error) {
-	comment.UserId = userId
-	return s.store.Comment.CreateComment(s.ctx, &comment)
+// GetQueue returns a page of the comments waiting for a moderator, oldest
+// first unless sorted otherwise
+func (s *CommentService) GetQueue(query model.CommentQuery, actor Actor) (*model.Page[model.Comment], error) {
+	if !actor.Role.Can(model.PermCommentsModerate) {
+		return nil, types.ErrForbidden
+	}
+
+	if query.Status == "" {
+		query.Status = model.CommentPending
+	}
+	if len(query.Sort) == 0 {
+		query.Sort = []model.SortField{{Field: "created_at"}}
+	}
+	return s.GetComments(query, actor)
 }
 
-func (s *CommentService) DeleteComment(commentId uint, userId uint) error {
-	return s.store.Comment.DeleteComment(s.ctx, userId, commentId)
+// GetComment returns the comment if the actor can see its post and it is
+// approved, the actor wrote it or moderates comments
+func (s *CommentService) GetComment(commentId uint, actor Actor) (*model.Comment, error) {
+	comment, err := s.store.Comment.GetComment(s.ctx, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.visiblePost(comment.PostId, actor); err != nil {
+		return nil, err
+	}
+	if !canViewComment(actor, comment) {
+		return nil, types.ErrNotFound
+	}
+	return comment, nil
+}
+
+// GetThread returns the post's comments depth first, each with its depth,
+// path and reply count. Deleted comments with replies are tombstones.
+func (s *CommentService) GetThread(postId uint, actor Actor) ([]*model.CommentNode, error) {
+	if _, err := s.visiblePost(postId, actor); err != nil {
+		return nil, err
+	}
+
+	query := model.CommentQuery{
+		PostId:    postId,
+		ViewerId:  actor.UserId,
+		AnyStatus: actor.Role.Can(model.PermCommentsModerate),
+	}
+	comments, err := s.store.Comment.GetThread(s.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return threadNodes(comments), nil
+}
+
+// GetTree returns the post's top-level comments with their replies nested,
+// as GetThread lists them
+func (s *CommentService) GetTree(postId uint, actor Actor) ([]*model.CommentNode, error) {
+	nodes, err := s.GetThread(postId, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []*model.CommentNode
+	byId := map[uint]*model.CommentNode{}
+	for _, node := range nodes {
+		byId[node.ID] = node
+		if parent, ok := byId[parentOf(node)]; ok && node.Depth > 0 {
+			parent.Replies = append(parent.Replies, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots, nil
 }
 
-func (s *CommentService) UpdateComment(comment model.Comment) (*model.Comment, error) {
-	return s.store.Comment.UpdateComment(s.ctx, &comment)
+// CreateComment adds the actor's comment to a post open for comments. A post
+// the actor can't see is types.ErrNotFound, one that isn't published or has
+// comments closed types.ErrNotAllowed. The comment is approved or pending as
+// the post's moderation mode says, unless the spam checks make it pending or
+// spam. Moderators' comments aren't checked.
+func (s *CommentService) CreateComment(comment model.Comment, actor Actor) (*model.Comment, error) {
+	if err := checkVerified(s.ctx, s.store, s.cfg, actor.UserId); err != nil {
+		return nil, err
+	}
+
+	comment.UserId = actor.UserId
+	comment.ModeratedAt = nil
+	comment.ModeratedBy = nil
+
+	if comment.ParentId != nil {
+		parent, err := s.GetComment(*comment.ParentId, actor)
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil, errors.Wrap(types.ErrNotFound, "parent comment not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if comment.PostId == 0 {
+			comment.PostId = parent.PostId
+		}
+		if comment.PostId != parent.PostId {
+			return nil, errors.Wrap(types.ErrBadRequest, "parent comment is on another post")
+		}
+		if parent.Depth >= s.cfg.CommentMaxDepth {
+			return nil, errors.Wrapf(types.ErrBadRequest, "replies may not nest deeper than %d", s.cfg.CommentMaxDepth)
+		}
+	}
+
+	post, err := s.visiblePost(comment.PostId, actor)
+	if err != nil {
+		return nil, err
+	}
+	if post.Status != model.PostPublished {
+		return nil, errors.Wrapf(types.ErrNotAllowed, "a %s post is not open for comments", post.Status)
+	}
+	if comment.Status, err = s.commentStatus(post, &comment, actor); err != nil {
+		return nil, err
+	}
+
+	if comment.BodyHTML, err = markdown.Render(comment.Body, markdown.Comment); err != nil {
+		return nil, err
+	}
+
+	comment.ID, err = s.store.Comment.CreateComment(s.ctx, &comment)
+	if errors.Cause(err) == types.ErrNotFound {
+		// The post was purged meanwhile
+		return nil, errors.Wrap(types.ErrNotFound, "post not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logIndexError(indexComment(s.ctx, s.store, &comment), "creating comment", comment.ID)
+	return &comment, nil
+}
+
+// commentStatus returns the status the actor's new or edited comment on the
+// post is stored in, as initialStatus says unless the spam checks make it
+// pending or spam. Moderators' comments aren't checked.
+func (s *CommentService) commentStatus(post *model.Post, comment *model.Comment, actor Actor) (model.CommentStatus, error) {
+	status, err := s.initialStatus(post, comment, actor)
+	if err != nil || actor.Role.Can(model.PermCommentsModerate) {
+		return status, err
+	}
+
+	result, err := s.spam.Check(s.ctx, comment)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case result.Verdict == SpamSpam:
+		return model.CommentSpam, nil
+	case result.Verdict == SpamSuspicious && status == model.CommentApproved:
+		return model.CommentPending, nil
+	}
+	return status, nil
+}
+
+// initialStatus returns the status the actor's comment on the post starts in.
+// Moderators' comments are approved unless comments are closed. An edited
+// comment doesn't count towards its author's approved comments, or editing
+// their first one would skip first_premoderated.
+func (s *CommentService) initialStatus(post *model.Post, comment *model.Comment, actor Actor) (model.CommentStatus, error) {
+	mode := post.CommentMode
+	if mode == "" {
+		mode = model.CommentMode(s.cfg.CommentMode)
+	}
+
+	switch {
+	case mode == model.CommentsClosed:
+		return "", errors.Wrap(types.ErrNotAllowed, "comments on the post are closed")
+	case mode == model.CommentsOpen || actor.Role.Can(model.PermCommentsModerate):
+		return model.CommentApproved, nil
+	case mode == model.CommentsFirstPremoderated:
+		approved, err := s.store.Comment.CountComments(s.ctx, model.CommentQuery{
+			AuthorId:  actor.UserId,
+			Status:    model.CommentApproved,
+			AnyStatus: true,
+		})
+		if err != nil {
+			return "", err
+		}
+		if comment.ID != 0 && comment.Status == model.CommentApproved {
+			approved--
+		}
+		if approved > 0 {
+			return model.CommentApproved, nil
+		}
+	}
+	return model.CommentPending, nil
+}
+
+// ModerateComments approves, rejects or marks as spam the comments with the
+// ids, those not found are skipped. It returns the comments moderated.
+// Approved and spam comments train the spam classifier.
+func (s *CommentService) ModerateComments(ids []uint, status model.CommentStatus, actor Actor) ([]model.Comment, error) {
+	if !actor.Role.Can(model.PermCommentsModerate) {
+		return nil, types.ErrForbidden
+	}
+
+	if !status.Valid() || status == model.CommentPending {
+		return nil, errors.Wrapf(types.ErrBadRequest, "comments can't be moderated to %q", status)
+	}
+	if len(ids) == 0 || len(ids) > s.cfg.MaxPageSize {
+		return nil, errors.Wrapf(types.ErrBadRequest, "between 1 and %d comment ids are moderated at once", s.cfg.MaxPageSize)
+	}
+
+	comments, err := s.store.Comment.ModerateComments(s.ctx, ids, status, actor.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range comments {
+		trainSpam(s.ctx, s.store, &comments[i])
+		if status == model.CommentApproved {
+			logIndexError(indexComment(s.ctx, s.store, &comments[i]), "approving comment", comments[i].ID)
+		} else {
+			logIndexError(s.store.Search.RemoveComment(s.ctx, comments[i].ID), "rejecting comment", comments[i].ID)
+		}
+	}
+	return comments, nil
+}
+
+// DeleteComment moves the comment to the trash if the actor wrote it or is a moderator
+func (s *CommentService) DeleteComment(commentId uint, actor Actor) error {
+	comment, err := s.store.Comment.GetComment(s.ctx, commentId)
+	if err != nil {
+		return err
+	}
+
+	if !canManageComment(actor, comment) {
+		return types.ErrForbidden
+	}
+
+	if err := s.store.Comment.DeleteComment(s.ctx, commentId); err != nil {
+		return err
+	}
+
+	logIndexError(s.store.Search.RemoveComment(s.ctx, commentId), "deleting comment", commentId)
+	return nil
+}
+
+// UpdateComment updates the comment if the actor wrote it or is a moderator.
+// Comments on a post with comments closed are types.ErrNotAllowed. Edits by
+// others than moderators are moderated and checked for spam as new comments
+// are, moderators' edits keep the status.
+func (s *CommentService) UpdateComment(comment model.Comment, actor Actor) (*model.Comment, error) {
+	existing, err := s.store.Comment.GetComment(s.ctx, comment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canManageComment(actor, existing) {
+		return nil, types.ErrForbidden
+	}
+
+	post, err := s.store.Post.GetPost(s.ctx, existing.PostId)
+	if errors.Cause(err) == types.ErrNotFound {
+		return nil, errors.Wrap(types.ErrNotFound, "post not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	existing.Title = comment.Title
+	existing.Body = comment.Body
+	status, err := s.commentStatus(post, existing, actor)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.Role.Can(model.PermCommentsModerate) && status != existing.Status {
+		existing.Status = status
+		existing.ModeratedAt = nil
+		existing.ModeratedBy = nil
+	}
+
+	if existing.BodyHTML, err = markdown.Render(comment.Body, markdown.Comment); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.store.Comment.UpdateComment(s.ctx, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated.Status == model.CommentApproved {
+		logIndexError(indexComment(s.ctx, s.store, updated), "updating comment", updated.ID)
+	} else {
+		logIndexError(s.store.Search.RemoveComment(s.ctx, updated.ID), "updating comment", updated.ID)
+	}
+	return updated, nil
+}
+
+// visiblePost returns the post if the actor may see it, types.ErrNotFound
+// otherwise
+func (s *CommentService) visiblePost(postId uint, actor Actor) (*model.Post, error) {
+	post, err := s.store.Post.GetPost(s.ctx, postId)
+	if errors.Cause(err) == types.ErrNotFound {
+		return nil, errors.Wrap(types.ErrNotFound, "post not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewPost(actor, post) {
+		return nil, errors.Wrap(types.ErrNotFound, "post not found")
+	}
+	return post, nil
+}
+
+// threadNodes turns comments ordered by path into the nodes of their thread.
+// Ancestors missing from the comments are in the trash or purged, tombstones
+// take their place before their first reply.
+func threadNodes(comments []model.Comment) []*model.CommentNode {
+	nodes := make([]*model.CommentNode, 0, len(comments))
+	byPath := map[string]*model.CommentNode{}
+
+	for _, comment := range comments {
+		segments := strings.Split(comment.Path, "/")
+
+		var ancestors []*model.CommentNode
+		for depth := range segments[:len(segments)-1] {
+			path := strings.Join(segments[:depth+1], "/")
+			ancestor, ok := byPath[path]
+			if !ok {
+				ancestor = tombstone(comment.PostId, segments[:depth+1])
+				byPath[path] = ancestor
+				nodes = append(nodes, ancestor)
+			}
+			ancestors = append(ancestors, ancestor)
+		}
+
+		node := &model.CommentNode{Comment: comment}
+		byPath[comment.Path] = node
+		nodes = append(nodes, node)
+
+		for _, ancestor := range ancestors {
+			ancestor.ReplyCount++
+		}
+	}
+	return nodes
+}
+
+// tombstone stands in for the comment at the end of the path
+func tombstone(postId uint, segments []string) *model.CommentNode {
+	node := &model.CommentNode{
+		Comment: model.Comment{
+			ID:       pathId(segments[len(segments)-1]),
+			PostId:   postId,
+			Body:     model.CommentTombstone,
+			BodyHTML: "<p>" + model.CommentTombstone + "</p>\n",
+			Path:     strings.Join(segments, "/"),
+			Depth:    len(segments) - 1,
+		},
+		Deleted: true,
+	}
+	if len(segments) > 1 {
+		parentId := pathId(segments[len(segments)-2])
+		node.ParentId = &parentId
+	}
+	return node
+}
+
+func pathId(segment string) uint {
+	id, _ := strconv.ParseUint(segment, 10, 64)
+	return uint(id)
+}
+
+func parentOf(node *model.CommentNode) uint {
+	if node.ParentId == nil {
+		return 0
+	}
+	return *node.ParentId
 }
@@ -3,24 +3,304 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/imaging"
+	"github.com/slavik22/blogRestApi/lib/mail"
+	"github.com/slavik22/blogRestApi/lib/oidc"
+	"github.com/slavik22/blogRestApi/lib/storage"
+	"github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/model"
 	"github.com/slavik22/blogRestApi/repository"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"strings"
 )
 
 // Manager is just a collection of all services we have in the project
 type Manager struct {
-	UserService    UserServ
-	PostService    PostServ
-	CommentService CommentServ
+	Keys   *util.KeySet
+	Mailer mail.Sender
+	Blobs  storage.BlobStore
+
+	UserService     UserServ
+	PostService     PostServ
+	CommentService  CommentServ
+	SearchService   SearchServ
+	TaxonomyService TaxonomyServ
+	TrashService    TrashServ
+	MediaService    MediaServ
+}
+
+// NewManager creates new service manager, mail is sent with the MAIL_DRIVER sender
+func NewManager(ctx context.Context, store *repository.Store, cfg *blogRestApi.Config) (*Manager, error) {
+	if cfg == nil {
+		return nil, errors.New("No config provided")
+	}
+
+	mailer, err := newMailer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create mailer: %w", err)
+	}
+
+	return NewManagerWithMailer(ctx, store, cfg, mailer)
 }
 
-// NewManager creates new service manager
-func NewManager(ctx context.Context, store *repository.Store) (*Manager, error) {
+// NewManagerWithMailer creates new service manager sending mail with mailer
+func NewManagerWithMailer(ctx context.Context, store *repository.Store, cfg *blogRestApi.Config, mailer mail.Sender) (*Manager, error) {
 	if store == nil {
 		return nil, errors.New("No repository provided")
 	}
+	if cfg == nil {
+		return nil, errors.New("No config provided")
+	}
+
+	if err := checkSecret("LINK_SECRET", cfg.LinkSecret); err != nil {
+		return nil, err
+	}
+
+	if resetURL, err := url.Parse(cfg.PasswordResetURL); err != nil || !resetURL.IsAbs() {
+		return nil, errors.New("PASSWORD_RESET_URL must be an absolute URL")
+	}
+
+	if cfg.MaxPageSize <= 0 || cfg.DefaultPageSize <= 0 || cfg.DefaultPageSize > cfg.MaxPageSize {
+		return nil, errors.New("DEFAULT_PAGE_SIZE must be positive and not above MAX_PAGE_SIZE")
+	}
+
+	if cfg.MaxPageSize > math.MaxInt32/model.MaxPage {
+		return nil, fmt.Errorf("MAX_PAGE_SIZE must not exceed %d", math.MaxInt32/model.MaxPage)
+	}
+
+	if cfg.PublishInterval <= 0 {
+		return nil, errors.New("PUBLISH_INTERVAL must be positive")
+	}
+
+	if cfg.CommentMaxDepth < 0 || cfg.CommentMaxDepth > model.MaxCommentDepth {
+		return nil, fmt.Errorf("COMMENT_MAX_DEPTH must be between 0 and %d", model.MaxCommentDepth)
+	}
+
+	if !model.CommentMode(cfg.CommentMode).Valid() {
+		return nil, fmt.Errorf("unknown COMMENT_MODE %q", cfg.CommentMode)
+	}
+
+	if cfg.SpamLinkLimit < 0 || cfg.SpamLinkSpamLimit < cfg.SpamLinkLimit {
+		return nil, errors.New("SPAM_LINK_LIMIT must not be negative nor above SPAM_LINK_SPAM_LIMIT")
+	}
+
+	if cfg.SpamRateWindow <= 0 || cfg.SpamRateLimit <= 0 {
+		return nil, errors.New("SPAM_RATE_WINDOW and SPAM_RATE_LIMIT must be positive")
+	}
+
+	if cfg.SpamBayesThreshold <= 0.5 || cfg.SpamBayesThreshold > 1 {
+		return nil, errors.New("SPAM_BAYES_THRESHOLD must be above 0.5 and at most 1")
+	}
+
+	if cfg.SpamBayesMinTraining <= 0 {
+		return nil, errors.New("SPAM_BAYES_MIN_TRAINING must be positive")
+	}
+
+	if cfg.TrashRetention <= 0 || cfg.TrashPurgeInterval <= 0 {
+		return nil, errors.New("TRASH_RETENTION and TRASH_PURGE_INTERVAL must be positive")
+	}
+
+	if cfg.MediaMaxSize <= 0 || cfg.MediaUserQuota <= 0 {
+		return nil, errors.New("MEDIA_MAX_SIZE and MEDIA_USER_QUOTA must be positive")
+	}
+
+	if cfg.MediaOrphanTTL <= 0 || cfg.MediaCleanupInterval <= 0 {
+		return nil, errors.New("MEDIA_ORPHAN_TTL and MEDIA_CLEANUP_INTERVAL must be positive")
+	}
+
+	variants, err := imaging.ParseVariants(cfg.MediaVariants)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MEDIA_VARIANTS: %w", err)
+	}
+
+	switch cfg.MediaVariantFormat {
+	case "auto", string(imaging.JPEG), string(imaging.WebP):
+	default:
+		return nil, fmt.Errorf("unsupported MEDIA_VARIANT_FORMAT %q", cfg.MediaVariantFormat)
+	}
+
+	if cfg.MediaJPEGQuality < 1 || cfg.MediaJPEGQuality > 100 {
+		return nil, errors.New("MEDIA_JPEG_QUALITY must be between 1 and 100")
+	}
+
+	if cfg.MediaMaxPixels <= 0 || cfg.MediaWorkers <= 0 || cfg.MediaQueueSize <= 0 || cfg.MediaRequeueInterval <= 0 {
+		return nil, errors.New("MEDIA_MAX_PIXELS, MEDIA_WORKERS, MEDIA_QUEUE_SIZE and MEDIA_REQUEUE_INTERVAL must be positive")
+	}
+
+	keys, err := loadKeySet(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not load JWT keys: %w", err)
+	}
+
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create blob store: %w", err)
+	}
+
+	spamChecker, err := NewSpamChecker(cfg, store)
+	if err != nil {
+		return nil, fmt.Errorf("could not create spam checker: %w", err)
+	}
+
+	var oidcClient *oidc.Client
+	if cfg.OIDCIssuer != "" {
+		oidcClient, err = oidc.NewClient(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       strings.Fields(cfg.OIDCScopes),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not create OIDC client: %w", err)
+		}
+	}
+
 	return &Manager{
-		UserService:    NewUserService(ctx, store),
-		PostService:    NewPostService(ctx, store),
-		CommentService: NewCommentService(ctx, store),
+		Keys:            keys,
+		Mailer:          mailer,
+		Blobs:           blobs,
+		UserService:     NewUserService(ctx, store, cfg, keys, mailer, oidcClient),
+		PostService:     NewPostService(ctx, store, cfg),
+		CommentService:  NewCommentService(ctx, store, cfg, spamChecker),
+		SearchService:   NewSearchService(ctx, store, cfg),
+		TaxonomyService: NewTaxonomyService(ctx, store, cfg),
+		TrashService:    NewTrashService(ctx, store, cfg),
+		MediaService:    NewMediaService(ctx, store, cfg, blobs, variants),
 	}, nil
 }
+
+// publishedSecrets were committed to the repository as development values,
+// anyone can sign with them
+var publishedSecrets = map[string]bool{
+	"qrkjk#4#%35FSFJlja#4353KSFjH": true,
+	"dev-link-secret-change-me":    true,
+}
+
+// checkSecret refuses secrets that are missing, short or published
+func checkSecret(name, secret string) error {
+	switch {
+	case secret == "":
+		return fmt.Errorf("%s is required", name)
+	case len(secret) < 16:
+		return fmt.Errorf("%s must be at least 16 bytes", name)
+	case publishedSecrets[secret]:
+		return fmt.Errorf("%s is a published development value, generate a new one", name)
+	}
+	return nil
+}
+
+// loadKeySet builds the JWT key set from the signing key and the keys kept for rotation
+func loadKeySet(cfg *blogRestApi.Config) (*util.KeySet, error) {
+	var active *util.Key
+	var verification []*util.Key
+
+	switch cfg.JWTAlgorithm {
+	case "", "HS256":
+		if err := checkSecret("JWT_SECRET", cfg.JWTSecret); err != nil {
+			return nil, err
+		}
+		key, err := util.NewHMACKey(cfg.JWTKeyId, []byte(cfg.JWTSecret))
+		if err != nil {
+			return nil, err
+		}
+		active = key
+
+		for _, secret := range splitList(cfg.JWTPreviousSecrets) {
+			if err := checkSecret("JWT_PREVIOUS_SECRETS", secret); err != nil {
+				return nil, err
+			}
+			key, err := util.NewHMACKey("", []byte(secret))
+			if err != nil {
+				return nil, err
+			}
+			verification = append(verification, key)
+		}
+	case "RS256", "ES256", "EdDSA":
+		data := []byte(strings.ReplaceAll(cfg.JWTPrivateKey, `\n`, "\n"))
+		if cfg.JWTPrivateKeyFile != "" {
+			var err error
+			data, err = os.ReadFile(cfg.JWTPrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		private, err := util.ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		active, err = util.NewPrivateKey(cfg.JWTKeyId, cfg.JWTAlgorithm, private)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.JWTAlgorithm)
+	}
+
+	for _, path := range splitList(cfg.JWTVerificationKeyFiles) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		public, err := util.ParsePublicKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		key, err := util.NewPublicKey("", public)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		verification = append(verification, key)
+	}
+
+	return util.NewKeySet(cfg.JWTIssuer, active, verification...)
+}
+
+// newMailer creates the mail sender selected by MAIL_DRIVER
+func newMailer(cfg *blogRestApi.Config) (mail.Sender, error) {
+	switch cfg.MailDriver {
+	case "", "log":
+		return mail.NewLogSender(log.Default()), nil
+	case "smtp":
+		return mail.NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "file":
+		return mail.NewFileSender(cfg.MailDir, cfg.MailFrom)
+	}
+	return nil, fmt.Errorf("unsupported mail driver %q", cfg.MailDriver)
+}
+
+// newBlobStore creates the store for media selected by MEDIA_DRIVER
+func newBlobStore(cfg *blogRestApi.Config) (storage.BlobStore, error) {
+	switch cfg.MediaDriver {
+	case "", "local":
+		return storage.NewLocalStore(cfg.MediaDir)
+	case "s3":
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		}, nil)
+	case "memory":
+		return storage.NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unsupported media driver %q", cfg.MediaDriver)
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,523 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/imaging"
+	"github.com/slavik22/blogRestApi/lib/storage"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	"image"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mediaBatch is how many orphaned media DeleteOrphans reads at once
+const mediaBatch = 100
+
+// mediaPath is where media are served, embedding it in a post body links the
+// media to the post
+const mediaPath = "/api/v1/media/"
+
+// mediaReference finds the keys of media and their variants embedded in a body
+var mediaReference = regexp.MustCompile(regexp.QuoteMeta(mediaPath) + `([0-9a-f]{32}(?:-[a-z0-9]+)?(?:\.[a-z0-9]+)?)`)
+
+// mediaExtensions are preferred over the system's list, which may be ambiguous
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type MediaService struct {
+	ctx      context.Context
+	store    *repository.Store
+	cfg      *blogRestApi.Config
+	blobs    storage.BlobStore
+	variants []imaging.Variant
+
+	// queue holds the ids of images waiting for a worker, queued keeps them
+	// from being queued twice
+	queue  chan uint
+	mu     sync.Mutex
+	queued map[uint]bool
+}
+
+func NewMediaService(ctx context.Context, store *repository.Store, cfg *blogRestApi.Config, blobs storage.BlobStore, variants []imaging.Variant) *MediaService {
+	return &MediaService{
+		ctx:      ctx,
+		store:    store,
+		cfg:      cfg,
+		blobs:    blobs,
+		variants: variants,
+		queue:    make(chan uint, cfg.MediaQueueSize),
+		queued:   map[uint]bool{},
+	}
+}
+
+// Upload stores size bytes of the file for the user. The content type is
+// sniffed from the bytes, the client's claim is ignored.
+func (s *MediaService) Upload(file io.Reader, size int64, filename string, userId uint) (*model.Media, error) {
+	if err := checkVerified(s.ctx, s.store, s.cfg, userId); err != nil {
+		return nil, err
+	}
+
+	if size > s.cfg.MediaMaxSize {
+		return nil, errors.Wrapf(types.ErrTooLarge, "media may not be larger than %d bytes", s.cfg.MediaMaxSize)
+	}
+	if size <= 0 {
+		return nil, errors.Wrap(types.ErrBadRequest, "media file is empty")
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	if !contains(splitList(s.cfg.MediaTypes), contentType) {
+		return nil, errors.Wrapf(types.ErrUnprocessableEntity, "media of type %s are not allowed", contentType)
+	}
+
+	media := model.Media{
+		UserId:      userId,
+		Filename:    mediaFilename(filename),
+		ContentType: contentType,
+		Size:        size,
+		Status:      model.MediaReady,
+	}
+
+	data := io.MultiReader(bytes.NewReader(head), file)
+	if imaging.Supported(contentType) {
+		stripped, err := s.readImage(data, &media)
+		if err != nil {
+			return nil, err
+		}
+		data = bytes.NewReader(stripped)
+	}
+
+	// Checked before the blob is stored, and again as the media are
+	// created for parallel uploads
+	if err := s.checkQuota(userId, media.Size); err != nil {
+		return nil, err
+	}
+
+	media.Key, err = mediaKey(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.blobs.Put(s.ctx, media.Key, data, media.Size, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Media.CreateMedia(s.ctx, &media, s.cfg.MediaUserQuota); err != nil {
+		logBlobError(s.blobs.Delete(s.ctx, media.Key), media.Key)
+		if err == types.ErrTooLarge {
+			return nil, s.checkQuota(userId, media.Size)
+		}
+		return nil, err
+	}
+
+	if media.Status == model.MediaPending {
+		s.enqueue(media.ID)
+	}
+
+	s.setURL(&media)
+	return &media, nil
+}
+
+// checkQuota returns types.ErrTooLarge if the user's media and their variants
+// leave less than size bytes of MEDIA_USER_QUOTA
+func (s *MediaService) checkQuota(userId uint, size int64) error {
+	used, err := s.store.Media.UsedSpace(s.ctx, userId)
+	if err != nil {
+		return err
+	}
+	if used+size > s.cfg.MediaUserQuota {
+		return errors.Wrapf(types.ErrTooLarge, "media quota of %d bytes is used up, %d bytes left",
+			s.cfg.MediaUserQuota, max64(s.cfg.MediaUserQuota-used, 0))
+	}
+	return nil
+}
+
+// readImage reads the uploaded image whole, checks its size and strips its
+// metadata, GPS positions among them, before it is ever served. The variants
+// are left to the workers.
+func (s *MediaService) readImage(r io.Reader, media *model.Media) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, media.Size))
+	if err != nil {
+		return nil, err
+	}
+
+	media.Width, media.Height, err = imaging.Dimensions(data)
+	if err != nil {
+		return nil, errors.Wrap(types.ErrUnprocessableEntity, "image could not be decoded")
+	}
+	if media.Width*media.Height > s.cfg.MediaMaxPixels {
+		return nil, errors.Wrapf(types.ErrTooLarge, "images may not have more than %d pixels", s.cfg.MediaMaxPixels)
+	}
+
+	data, err = imaging.Strip(data, media.ContentType)
+	if err != nil {
+		return nil, errors.Wrap(types.ErrUnprocessableEntity, "image could not be decoded")
+	}
+
+	media.Size = int64(len(data))
+	media.Status = model.MediaPending
+	return data, nil
+}
+
+// OpenMedia returns the media or variant under the key and its bytes,
+// callers close them. Variants come as media of their own.
+func (s *MediaService) OpenMedia(key string) (*model.Media, io.ReadCloser, error) {
+	media, err := s.store.Media.GetMedia(s.ctx, key)
+	if errors.Cause(err) == types.ErrNotFound {
+		variant, verr := s.store.Media.GetMediaVariant(s.ctx, key)
+		if verr == nil {
+			media = &model.Media{Key: variant.Key, ContentType: variant.ContentType, Size: variant.Size}
+		}
+		err = verr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blob, err := s.blobs.Get(s.ctx, key)
+	if err == storage.ErrNotFound {
+		return nil, nil, types.ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return media, blob, nil
+}
+
+// GetUserMedia returns the user's uploads, newest first
+func (s *MediaService) GetUserMedia(userId uint) ([]model.Media, error) {
+	media, err := s.store.Media.GetUserMedia(s.ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range media {
+		s.setURL(&media[i])
+	}
+	return media, nil
+}
+
+// DeleteMedia deletes the media if the actor uploaded it or may manage any
+// post, and no post embeds it
+func (s *MediaService) DeleteMedia(mediaId uint, actor Actor) error {
+	media, err := s.store.Media.GetMediaById(s.ctx, mediaId)
+	if err != nil {
+		return err
+	}
+
+	if media.UserId != actor.UserId && !actor.Role.Can(model.PermPostsManage) {
+		return types.ErrForbidden
+	}
+
+	if err := s.store.Media.DeleteMedia(s.ctx, media.ID); err != nil {
+		if errors.Cause(err) == types.ErrConflict {
+			return errors.Wrap(err, "media is embedded in a post")
+		}
+		return err
+	}
+
+	s.deleteBlobs(media)
+	return nil
+}
+
+// DeleteOrphans deletes the media no post has embedded since MediaOrphanTTL
+func (s *MediaService) DeleteOrphans() error {
+	before := time.Now().Add(-s.cfg.MediaOrphanTTL)
+
+	deleted := 0
+	for {
+		orphans, err := s.store.Media.GetOrphanedMedia(s.ctx, before, mediaBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, media := range orphans {
+			err := s.store.Media.DeleteMedia(s.ctx, media.ID)
+			if errors.Cause(err) == types.ErrConflict {
+				// Embedded meanwhile
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			s.deleteBlobs(&media)
+			deleted++
+		}
+
+		if len(orphans) < mediaBatch {
+			break
+		}
+	}
+
+	if deleted > 0 {
+		log.Printf("deleted %d media no post embeds", deleted)
+	}
+	return nil
+}
+
+// StartWorkers starts MEDIA_WORKERS workers processing queued images until
+// ctx is done
+func (s *MediaService) StartWorkers(ctx context.Context) {
+	for i := 0; i < s.cfg.MediaWorkers; i++ {
+		go s.work(ctx)
+	}
+}
+
+func (s *MediaService) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case mediaId := <-s.queue:
+			if err := s.ProcessMedia(mediaId); err != nil {
+				log.Printf("processing media %d failed: %v", mediaId, err)
+			}
+
+			s.mu.Lock()
+			delete(s.queued, mediaId)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// enqueue hands the image to the workers. A full queue is not an error, the
+// image stays pending until QueuePending finds it.
+func (s *MediaService) enqueue(mediaId uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.queued[mediaId] {
+		return
+	}
+	select {
+	case s.queue <- mediaId:
+		s.queued[mediaId] = true
+	default:
+	}
+}
+
+// QueuePending queues the images left pending by a full queue, a failed
+// attempt or a restart
+func (s *MediaService) QueuePending() error {
+	pending, err := s.store.Media.GetPendingMedia(s.ctx, s.cfg.MediaQueueSize)
+	if err != nil {
+		return err
+	}
+
+	for _, media := range pending {
+		s.enqueue(media.ID)
+	}
+	return nil
+}
+
+// ProcessMedia renders the variants of a pending image and computes its
+// placeholders. Images that cannot be decoded are marked failed and served
+// as uploaded, other errors leave them pending for another attempt.
+func (s *MediaService) ProcessMedia(mediaId uint) error {
+	media, err := s.store.Media.GetMediaById(s.ctx, mediaId)
+	if errors.Cause(err) == types.ErrNotFound {
+		// Deleted meanwhile
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if media.Status != model.MediaPending {
+		return nil
+	}
+
+	if !imaging.Supported(media.ContentType) {
+		media.Status = model.MediaReady
+		return s.finishMedia(media)
+	}
+
+	blob, err := s.blobs.Get(s.ctx, media.Key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		return err
+	}
+
+	img, err := imaging.Decode(data)
+	if err != nil {
+		log.Printf("could not decode media %d: %v", media.ID, err)
+		media.Status = model.MediaFailed
+		return s.finishMedia(media)
+	}
+
+	b := img.Bounds()
+	media.Width, media.Height = b.Dx(), b.Dy()
+	media.BlurHash = imaging.BlurHash(img)
+	media.Color = imaging.DominantColor(img)
+
+	format := imaging.Format(s.cfg.MediaVariantFormat)
+	if format == "auto" {
+		format = imaging.JPEG
+		if !imaging.Opaque(img) {
+			format = imaging.WebP
+		}
+	}
+
+	for _, v := range s.variants {
+		// Variants are never larger than the image
+		if media.Width <= v.Size && media.Height <= v.Size {
+			continue
+		}
+
+		variant, err := s.putVariant(media, img, v, format)
+		if err != nil {
+			s.deleteVariantBlobs(media.Variants)
+			return err
+		}
+		media.Variants = append(media.Variants, *variant)
+	}
+
+	media.Status = model.MediaReady
+	return s.finishMedia(media)
+}
+
+// putVariant renders the variant of the image and stores it
+func (s *MediaService) putVariant(media *model.Media, img image.Image, v imaging.Variant, format imaging.Format) (*model.MediaVariant, error) {
+	resized := imaging.Fit(img, v.Size)
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, resized, format, s.cfg.MediaJPEGQuality); err != nil {
+		return nil, err
+	}
+
+	variant := model.MediaVariant{
+		Name:        v.Name,
+		Key:         strings.TrimSuffix(media.Key, filepath.Ext(media.Key)) + "-" + v.Name + format.Extension(),
+		ContentType: format.ContentType(),
+		Size:        int64(buf.Len()),
+		Width:       resized.Bounds().Dx(),
+		Height:      resized.Bounds().Dy(),
+	}
+	if err := s.blobs.Put(s.ctx, variant.Key, &buf, variant.Size, variant.ContentType); err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// finishMedia saves the processed media, the variants' blobs are deleted if
+// the media were deleted meanwhile
+func (s *MediaService) finishMedia(media *model.Media) error {
+	err := s.store.Media.FinishMedia(s.ctx, media)
+	if err != nil {
+		s.deleteVariantBlobs(media.Variants)
+	}
+	if errors.Cause(err) == types.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// deleteBlobs deletes the blobs of the media and its variants
+func (s *MediaService) deleteBlobs(media *model.Media) {
+	logBlobError(s.blobs.Delete(s.ctx, media.Key), media.Key)
+	s.deleteVariantBlobs(media.Variants)
+}
+
+func (s *MediaService) deleteVariantBlobs(variants []model.MediaVariant) {
+	for _, variant := range variants {
+		logBlobError(s.blobs.Delete(s.ctx, variant.Key), variant.Key)
+	}
+}
+
+func (s *MediaService) setURL(media *model.Media) {
+	base := strings.TrimSuffix(s.cfg.AppBaseURL, "/") + mediaPath
+	media.URL = base + media.Key
+	for i := range media.Variants {
+		media.Variants[i].URL = base + media.Variants[i].Key
+	}
+}
+
+// linkMedia links the post to the media its body embeds, previous is the
+// body it had before
+func linkMedia(ctx context.Context, store *repository.Store, post *model.Post, previous string) error {
+	if !mediaReference.MatchString(post.Body) && !mediaReference.MatchString(previous) {
+		// Nothing was linked and nothing is to be
+		return nil
+	}
+
+	var keys []string
+	for _, match := range mediaReference.FindAllStringSubmatch(post.Body, -1) {
+		if !contains(keys, match[1]) {
+			keys = append(keys, match[1])
+		}
+	}
+
+	return store.Media.LinkPostMedia(ctx, post.ID, keys)
+}
+
+// mediaKey names a new blob randomly, with an extension for the content type
+func mediaKey(contentType string) (string, error) {
+	b, err := util.RandomBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	ext, ok := mediaExtensions[contentType]
+	if !ok {
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return hex.EncodeToString(b) + ext, nil
+}
+
+// mediaFilename keeps the base name of an uploaded file for display only
+func mediaFilename(filename string) string {
+	name := filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	if r := []rune(name); len(r) > 255 {
+		name = string(r[:255])
+	}
+	return name
+}
+
+// logBlobError reports blobs left behind, they don't fail the request
+func logBlobError(err error, key string) {
+	if err != nil {
+		log.Printf("could not delete blob %s: %v", key, err)
+	}
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
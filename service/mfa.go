@@ -0,0 +1,200 @@
+package service
+
+import (
+	"encoding/base32"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TOTPEnrollment is what an authenticator app needs to enroll the account
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+const recoveryCodeCount = 10
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollTOTP generates a new TOTP secret for the user. It is not used for
+// sign-in until ConfirmTOTP has been called with a code generated from it.
+func (s *UserService) EnrollTOTP(userId uint) (*TOTPEnrollment, error) {
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, errors.Wrap(types.ErrConflict, "two-factor authentication is already enabled")
+	}
+
+	secret, err := util.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPSecret = secret
+	if _, err := s.store.User.UpdateUser(s.ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    util.TOTPURI(s.cfg.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their
+// authenticator works and returns fresh recovery codes. The codes are only
+// shown this once.
+func (s *UserService) ConfirmTOTP(userId uint, code string) ([]string, error) {
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, errors.Wrap(types.ErrConflict, "two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return nil, errors.Wrap(types.ErrBadRequest, "two-factor enrollment has not been started")
+	}
+
+	step, ok := util.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, errors.Wrap(types.ErrUnprocessableEntity, "code is invalid")
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	if _, err := s.store.User.UpdateUser(s.ctx, user); err != nil {
+		return nil, err
+	}
+
+	return s.resetRecoveryCodes(user.ID)
+}
+
+// DisableTOTP turns two-factor authentication off and drops the recovery codes
+func (s *UserService) DisableTOTP(userId uint, password string) error {
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := util.CheckPassword(password, user.Password); err != nil {
+		return errors.Wrap(types.ErrForbidden, "password is incorrect")
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	if _, err := s.store.User.UpdateUser(s.ctx, user); err != nil {
+		return err
+	}
+
+	return s.store.Recovery.ReplaceRecoveryCodes(s.ctx, user.ID, nil)
+}
+
+// VerifyMFA exchanges the challenge token handed out by SignIn and a TOTP or
+// recovery code for a new session. Wrong codes are throttled like passwords.
+func (s *UserService) VerifyMFA(mfaToken, code string) (*AuthTokens, error) {
+	claims, err := s.keys.ParseMFAToken(mfaToken)
+	if err != nil {
+		return nil, errors.Wrap(types.ErrUnauthorized, err.Error())
+	}
+
+	now := time.Now()
+	subject := mfaSubject(claims.UserId)
+	if err := s.countAttempt(subject, s.accountPolicy(), now); err != nil {
+		return nil, err
+	}
+
+	user, err := s.store.User.GetUserById(s.ctx, claims.UserId)
+	if err != nil {
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil, types.ErrUnauthorized
+		}
+		return nil, err
+	}
+
+	if !user.TOTPEnabled {
+		return nil, types.ErrUnauthorized
+	}
+
+	ok, err := s.checkSecondFactor(user, code, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrap(types.ErrUnauthorized, "invalid code")
+	}
+
+	if err := s.store.Login.ResetThrottle(s.ctx, subject); err != nil {
+		return nil, err
+	}
+
+	return s.openSession(user)
+}
+
+// checkSecondFactor accepts a TOTP code that has not been used before or an
+// unused recovery code
+func (s *UserService) checkSecondFactor(user *model.User, code string, now time.Time) (bool, error) {
+	if step, ok := util.ValidateTOTP(user.TOTPSecret, code, now); ok {
+		// A code that has been seen already may have been observed by someone
+		// else, the store refuses steps not after the last accepted one
+		return s.store.User.UseTOTPStep(s.ctx, user.ID, step)
+	}
+
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return false, nil
+	}
+	return s.store.Recovery.UseRecoveryCode(s.ctx, user.ID, util.HashToken(code))
+}
+
+// resetRecoveryCodes replaces the user's recovery codes and returns the new ones
+func (s *UserService) resetRecoveryCodes(userId uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]model.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = model.RecoveryCode{
+			UserId:   userId,
+			CodeHash: util.HashToken(normalizeRecoveryCode(code)),
+		}
+	}
+
+	if err := s.store.Recovery.ReplaceRecoveryCodes(s.ctx, userId, records); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns a random code formatted as xxxxx-xxxxx
+func newRecoveryCode() (string, error) {
+	raw, err := util.RandomBytes(6)
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryEncoding.EncodeToString(raw))
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func mfaSubject(userId uint) string {
+	return "mfa:" + strconv.FormatUint(uint64(userId), 10)
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/oidc"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/model"
+	"strings"
+	"time"
+)
+
+// oidcStateTTL is the time the user has to sign in at the provider
+const oidcStateTTL = 10 * time.Minute
+
+// ErrOIDCNotConfigured is returned by the OIDC flow when no provider is set up
+var ErrOIDCNotConfigured = errors.New("OIDC sign-in is not configured")
+
+// OIDCLogin is where to send the browser, and the signed state to keep in a
+// cookie until the provider redirects back
+type OIDCLogin struct {
+	URL   string
+	State string
+}
+
+// StartOIDC begins an authorization code flow with PKCE
+func (s *UserService) StartOIDC() (*OIDCLogin, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCNotConfigured
+	}
+
+	state, err := util.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := util.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.oidc.AuthCodeURL(s.ctx, state, nonce, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCLogin{
+		URL: url,
+		State: util.Sign([]byte(s.cfg.LinkSecret), fmt.Sprintf("oidc:%s:%s:%s", state, nonce, verifier),
+			time.Now().Add(oidcStateTTL)),
+	}, nil
+}
+
+// FinishOIDC redeems the code the provider redirected back with, links the
+// external identity to a user, provisioning one on first login, and signs the
+// user in the same way SignIn does
+func (s *UserService) FinishOIDC(code, state, savedState string) (*AuthTokens, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCNotConfigured
+	}
+
+	value, err := util.Verify([]byte(s.cfg.LinkSecret), savedState)
+	if err != nil {
+		return nil, errors.Wrap(types.ErrBadRequest, "sign-in state is invalid or has expired")
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 || parts[0] != "oidc" || subtle.ConstantTimeCompare([]byte(parts[1]), []byte(state)) != 1 {
+		return nil, errors.Wrap(types.ErrBadRequest, "sign-in state does not match")
+	}
+
+	identity, err := s.oidc.Exchange(s.ctx, code, parts[3], parts[2])
+	if err != nil {
+		if errors.Is(err, oidc.ErrExchange) || errors.Is(err, oidc.ErrInvalidToken) {
+			return nil, errors.Wrap(types.ErrUnauthorized, err.Error())
+		}
+		return nil, err
+	}
+
+	user, err := s.linkExternalIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeSignIn(user)
+}
+
+// linkExternalIdentity finds the user behind the external identity. Unknown
+// identities are linked to the account with the same, provider-verified email
+// or get a new account.
+func (s *UserService) linkExternalIdentity(identity *oidc.Identity) (*model.User, error) {
+	external, err := s.store.External.GetExternalIdentity(s.ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		user, err := s.store.User.GetUserById(s.ctx, external.UserId)
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil, errors.Wrap(types.ErrForbidden, "the account linked to this identity has been deleted")
+		}
+		return user, err
+	}
+	if errors.Cause(err) != types.ErrNotFound {
+		return nil, err
+	}
+
+	if identity.Email == "" {
+		return nil, errors.Wrap(types.ErrForbidden, "identity provider did not share an email address")
+	}
+
+	now := time.Now()
+	user, err := s.store.User.GetUser(s.ctx, identity.Email)
+	switch {
+	case err == nil:
+		// Only trust the provider with an existing account when it vouches for the address
+		if !identity.EmailVerified {
+			return nil, errors.Wrap(types.ErrConflict, "an account with this email already exists")
+		}
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &now
+			if _, err := s.store.User.UpdateUser(s.ctx, user); err != nil {
+				return nil, err
+			}
+		}
+	case errors.Cause(err) == types.ErrNotFound:
+		user, err = s.provisionUser(identity, now)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = s.store.External.CreateExternalIdentity(s.ctx, &model.ExternalIdentity{
+		UserId:  user.ID,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// provisionUser creates the account for a first login through the provider.
+// It gets a random password, which can be replaced through the reset flow.
+func (s *UserService) provisionUser(identity *oidc.Identity, now time.Time) (*model.User, error) {
+	password, err := util.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := util.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	name := identity.Name
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	user := model.User{
+		Name:     name,
+		Email:    identity.Email,
+		Password: hashedPassword,
+		Role:     model.RoleAuthor,
+	}
+	if identity.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+
+	id, err := s.store.User.CreateUser(s.ctx, &user)
+	if err != nil {
+		return nil, err
+	}
+	user.ID = id
+
+	return &user, nil
+}
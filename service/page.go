@@ -0,0 +1,71 @@
+package service
+
+import (
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+)
+
+// pageRequest checks the requested page and clamps its size to the
+// configured limits, a size of 0 takes the default. Listings that can't be
+// walked by cursor fall back to page numbers.
+func pageRequest(cfg *blogRestApi.Config, sort []model.SortField, page model.PageRequest) (model.PageRequest, error) {
+	if page.Limit < 0 {
+		return page, errors.Wrap(types.ErrBadRequest, "page size must not be negative")
+	}
+	if page.Page < 0 {
+		return page, errors.Wrap(types.ErrBadRequest, "page must not be negative")
+	}
+	if page.Page > model.MaxPage {
+		return page, errors.Wrapf(types.ErrBadRequest, "page must not exceed %d, walk deeper by cursor", model.MaxPage)
+	}
+
+	if page.Limit == 0 {
+		page.Limit = cfg.DefaultPageSize
+	}
+	if page.Limit > cfg.MaxPageSize {
+		page.Limit = cfg.MaxPageSize
+	}
+
+	if !model.Keyset(sort) && !page.Offset() {
+		if page.Cursor != nil {
+			return page, errors.Wrap(types.ErrBadRequest, "cursor requires sorting by created_at")
+		}
+		page.Page = 1
+	}
+
+	return page, nil
+}
+
+// lookahead asks for one row past the page so we know if there is a next one
+func lookahead(page model.PageRequest) model.PageRequest {
+	page.Limit++
+	return page
+}
+
+// newPage builds the page envelope from rows fetched with lookahead
+func newPage[T any](page model.PageRequest, rows []T, total int64, cursor func(T) model.Cursor) *model.Page[T] {
+	result := &model.Page[T]{
+		Data:    rows,
+		Total:   total,
+		PerPage: page.Limit,
+	}
+
+	more := len(rows) > page.Limit
+	if more {
+		result.Data = rows[:page.Limit]
+	}
+	if result.Data == nil {
+		result.Data = []T{}
+	}
+
+	if page.Offset() {
+		result.Page = page.Page
+		result.TotalPages = int((total + int64(page.Limit) - 1) / int64(page.Limit))
+	} else if more {
+		result.NextCursor = cursor(result.Data[len(result.Data)-1]).String()
+	}
+
+	return result
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/model"
+	"strings"
+	"time"
+)
+
+// PersonalTokenPrefix marks personal access tokens so they can be told apart from JWTs
+const PersonalTokenPrefix = "blog_pat_"
+
+// personalTokenTouchInterval limits how often last_used_at is written
+const personalTokenTouchInterval = time.Minute
+
+// PersonalTokenInput describes a personal access token to create
+type PersonalTokenInput struct {
+	Name      string
+	Scopes    []model.Permission
+	ExpiresAt *time.Time
+}
+
+// CreatePersonalToken creates a token limited to the given scopes, each of
+// which the user's role must grant. The plain token is only returned here.
+func (s *UserService) CreatePersonalToken(userId uint, input PersonalTokenInput) (*model.PersonalAccessToken, string, error) {
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(input.Scopes) == 0 {
+		return nil, "", errors.Wrap(types.ErrBadRequest, "at least one scope is required")
+	}
+
+	var scopes []string
+	for _, scope := range input.Scopes {
+		if !scope.Valid() {
+			return nil, "", errors.Wrap(types.ErrBadRequest, fmt.Sprintf("unknown scope %q", scope))
+		}
+		if !user.Role.Can(scope) {
+			return nil, "", errors.Wrap(types.ErrForbidden, fmt.Sprintf("role does not grant scope %q", scope))
+		}
+		if !contains(scopes, string(scope)) {
+			scopes = append(scopes, string(scope))
+		}
+	}
+
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, "", errors.Wrap(types.ErrBadRequest, "expiry must be in the future")
+	}
+
+	secret, err := util.RandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := PersonalTokenPrefix + secret
+
+	record := model.PersonalAccessToken{
+		UserId:    userId,
+		Name:      input.Name,
+		Prefix:    token[:len(PersonalTokenPrefix)+4],
+		TokenHash: util.HashToken(token),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: input.ExpiresAt,
+	}
+	if err := s.store.Personal.CreatePersonalToken(s.ctx, &record); err != nil {
+		return nil, "", err
+	}
+
+	return &record, token, nil
+}
+
+// GetPersonalTokens lists the user's personal access tokens
+func (s *UserService) GetPersonalTokens(userId uint) ([]model.PersonalAccessToken, error) {
+	return s.store.Personal.GetPersonalTokens(s.ctx, userId)
+}
+
+// RevokePersonalToken deletes one of the user's personal access tokens
+func (s *UserService) RevokePersonalToken(userId uint, tokenId uint) error {
+	return s.store.Personal.DeletePersonalToken(s.ctx, userId, tokenId)
+}
+
+// authenticatePersonalToken resolves a personal access token to the identity of
+// its owner, limited to the token's scopes
+func (s *UserService) authenticatePersonalToken(token string) (*Identity, error) {
+	record, err := s.store.Personal.GetPersonalToken(s.ctx, util.HashToken(token))
+	if err != nil {
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil, errors.Wrap(types.ErrUnauthorized, "personal access token not found")
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if record.ExpiresAt != nil && now.After(*record.ExpiresAt) {
+		return nil, errors.Wrap(types.ErrUnauthorized, "personal access token has expired")
+	}
+
+	// The role is looked up on every request so demotions take effect at once
+	user, err := s.store.User.GetUserById(s.ctx, record.UserId)
+	if err != nil {
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil, errors.Wrap(types.ErrUnauthorized, "user not found")
+		}
+		return nil, err
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > personalTokenTouchInterval {
+		if err := s.store.Personal.TouchPersonalToken(s.ctx, record.ID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Identity{UserId: user.ID, Role: user.Role, Scopes: record.ScopeList()}, nil
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
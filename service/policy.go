@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+)
+
+// Actor is the user on whose behalf a service call is made
+type Actor struct {
+	UserId uint
+	Role   model.Role
+}
+
+// canManagePost reports whether the actor may edit or delete the post
+func canManagePost(actor Actor, post *model.Post) bool {
+	return post.UserId == actor.UserId || actor.Role.Can(model.PermPostsManage)
+}
+
+// canViewPost reports whether the actor may see the post in its current status
+func canViewPost(actor Actor, post *model.Post) bool {
+	return post.Status == model.PostPublished || post.UserId == actor.UserId || actor.Role.Can(model.PermPostsPublish)
+}
+
+// canViewComment reports whether the actor may read the comment, comments
+// that aren't approved are seen by their author and moderators
+func canViewComment(actor Actor, comment *model.Comment) bool {
+	return comment.Status == model.CommentApproved || comment.UserId == actor.UserId ||
+		actor.Role.Can(model.PermCommentsModerate)
+}
+
+// canReviewPost reports whether the actor may read the post's revisions, they
+// can hold text that was taken out of the published post
+func canReviewPost(actor Actor, post *model.Post) bool {
+	return canManagePost(actor, post) || actor.Role.Can(model.PermPostsPublish)
+}
+
+// canTransitionPost reports whether the actor may move the post to the status.
+// Authors submit and archive their posts, editors schedule and publish them
+// or send them back to draft.
+func canTransitionPost(actor Actor, post *model.Post, to model.PostStatus) bool {
+	switch to {
+	case model.PostScheduled, model.PostPublished:
+		return actor.Role.Can(model.PermPostsPublish)
+	case model.PostDraft:
+		return canManagePost(actor, post) || actor.Role.Can(model.PermPostsPublish)
+	}
+	return canManagePost(actor, post)
+}
+
+// canManageComment reports whether the actor may edit or delete the comment
+func canManageComment(actor Actor, comment *model.Comment) bool {
+	return comment.UserId == actor.UserId || actor.Role.Can(model.PermCommentsModerate)
+}
+
+// checkVerified enforces REQUIRE_VERIFIED_EMAIL for users creating content
+func checkVerified(ctx context.Context, store *repository.Store, cfg *blogRestApi.Config, userId uint) error {
+	if !cfg.RequireVerifiedEmail {
+		return nil
+	}
+
+	user, err := store.User.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		return errors.Wrap(types.ErrForbidden, "email address is not verified")
+	}
+	return nil
+}
@@ -2,39 +2,306 @@ package service
 
 import (
 	"context"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/markdown"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/lib/util"
 	"github.com/slavik22/blogRestApi/model"
 	"github.com/slavik22/blogRestApi/repository"
+	"time"
 )
 
+// publishBatch is how many due posts PublishScheduled reads at once
+const publishBatch = 100
+
 type PostService struct {
 	ctx   context.Context
 	store *repository.Store
+	cfg   *blogRestApi.Config
 }
 
-func NewPostService(ctx context.Context, store *repository.Store) *PostService {
+func NewPostService(ctx context.Context, store *repository.Store, cfg *blogRestApi.Config) *PostService {
 	return &PostService{
 		ctx:   ctx,
 		store: store,
+		cfg:   cfg,
 	}
 }
 
-func (s *PostService) GetPosts() ([]model.Post, error) {
-	return s.store.Post.GetPosts(s.ctx)
+// GetPosts returns a page of the posts matching the query that the actor may see
+func (s *PostService) GetPosts(query model.PostQuery, actor Actor) (*model.Page[model.Post], error) {
+	page, err := pageRequest(s.cfg, query.Sort, query.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	query.ViewerId = actor.UserId
+	query.AnyStatus = actor.Role.Can(model.PermPostsPublish)
+
+	var tags []string
+	for _, tag := range query.Tags {
+		if slug := util.Slugify(tag); slug != "" && !contains(tags, slug) {
+			tags = append(tags, slug)
+		}
+	}
+	query.Tags = tags
+
+	if query.Category != "" {
+		query.CategoryIds, err = categorySubtree(s.ctx, s.store, query.Category)
+		if err != nil {
+			return nil, err
+		}
+		if query.CategoryIds == nil {
+			return newPage(page, []model.Post{}, 0, nil), nil
+		}
+	}
+
+	total, err := s.store.Post.CountPosts(s.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query.Page = lookahead(page)
+	posts, err := s.store.Post.GetPosts(s.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(page, posts, total, func(post model.Post) model.Cursor {
+		return model.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}
+	}), nil
+}
+
+// GetPost returns the post, unpublished posts only to their author and editors
+func (s *PostService) GetPost(postId uint, actor Actor) (*model.Post, error) {
+	post, err := s.store.Post.GetPost(s.ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewPost(actor, post) {
+		return nil, types.ErrNotFound
+	}
+	return post, nil
 }
 
-func (s *PostService) GetPost(postId uint, userId uint) (*model.Post, error) {
-	return s.store.Post.GetPost(s.ctx, userId, postId)
+// GetPostBySlug returns the post that has or had the slug, like GetPost.
+// Callers compare the slug with the post's to redirect old ones.
+func (s *PostService) GetPostBySlug(slug string, actor Actor) (*model.Post, error) {
+	post, err := s.store.Post.GetPostBySlug(s.ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewPost(actor, post) {
+		return nil, types.ErrNotFound
+	}
+	return post, nil
 }
 
 func (s *PostService) CreatePost(post model.Post, userId uint) (uint, error) {
+	if err := checkVerified(s.ctx, s.store, s.cfg, userId); err != nil {
+		return 0, err
+	}
+
 	post.UserId = userId
-	return s.store.Post.CreatePost(s.ctx, &post)
+	post.Status = model.PostDraft
+	post.PublishedAt = nil
+	if post.CommentMode != "" && !post.CommentMode.Valid() {
+		return 0, errors.Wrapf(types.ErrBadRequest, "unknown comment mode %q", post.CommentMode)
+	}
+
+	var err error
+	if post.BodyHTML, err = markdown.Render(post.Body, markdown.Post); err != nil {
+		return 0, err
+	}
+	if post.Tags, err = resolveTags(s.ctx, s.store, post.Tags); err != nil {
+		return 0, err
+	}
+	if post.CategoryId, err = checkCategory(s.ctx, s.store, post.CategoryId); err != nil {
+		return 0, err
+	}
+
+	// Drafts aren't searchable, the post is indexed once it is published
+	id, err := s.store.Post.CreatePost(s.ctx, &post)
+	if err != nil {
+		return 0, err
+	}
+
+	post.ID = id
+	if err := linkMedia(s.ctx, s.store, &post, ""); err != nil {
+		return 0, err
+	}
+	return id, nil
 }
 
-func (s *PostService) DeletePost(postId uint, userId uint) error {
-	return s.store.Post.DeletePost(s.ctx, userId, postId)
+// DeletePost moves the post to the trash if the actor owns it or may manage any post
+func (s *PostService) DeletePost(postId uint, actor Actor) error {
+	post, err := s.store.Post.GetPost(s.ctx, postId)
+	if err != nil {
+		return err
+	}
+
+	if !canManagePost(actor, post) {
+		return types.ErrForbidden
+	}
+
+	if err := s.store.Post.DeletePost(s.ctx, postId); err != nil {
+		return err
+	}
+
+	logIndexError(s.store.Search.RemovePost(s.ctx, postId), "deleting post", postId)
+	return nil
 }
 
-func (s *PostService) UpdatePost(post model.Post) (*model.Post, error) {
-	return s.store.Post.UpdatePost(s.ctx, &post)
+// UpdatePost updates the post if the actor owns it or may manage any post
+func (s *PostService) UpdatePost(post model.Post, actor Actor) (*model.Post, error) {
+	existing, err := s.store.Post.GetPost(s.ctx, post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canManagePost(actor, existing) {
+		return nil, types.ErrForbidden
+	}
+
+	previous := existing.Body
+	existing.Title = post.Title
+	existing.Body = post.Body
+	if existing.BodyHTML, err = markdown.Render(post.Body, markdown.Post); err != nil {
+		return nil, err
+	}
+
+	// Omitted tags and category stay as they are
+	tags := existing.Tags
+	existing.Tags = nil
+	if post.Tags != nil {
+		if existing.Tags, err = resolveTags(s.ctx, s.store, post.Tags); err != nil {
+			return nil, err
+		}
+	}
+	if post.CategoryId != nil {
+		if existing.CategoryId, err = checkCategory(s.ctx, s.store, post.CategoryId); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := s.store.Post.UpdatePost(s.ctx, existing, model.PostRevision{UserId: actor.UserId})
+	if err != nil {
+		return nil, err
+	}
+	if updated.Tags == nil {
+		updated.Tags = tags
+	}
+
+	if err := linkMedia(s.ctx, s.store, updated, previous); err != nil {
+		return nil, err
+	}
+
+	if updated.Status == model.PostPublished {
+		logIndexError(s.store.Search.IndexPost(s.ctx, updated), "updating post", updated.ID)
+	}
+	return updated, nil
+}
+
+// SetCommentMode sets how new comments on the post are moderated, the empty
+// mode follows COMMENT_MODE. The post's author and moderators may set it.
+func (s *PostService) SetCommentMode(postId uint, mode model.CommentMode, actor Actor) (*model.Post, error) {
+	if mode != "" && !mode.Valid() {
+		return nil, errors.Wrapf(types.ErrBadRequest, "unknown comment mode %q", mode)
+	}
+
+	post, err := s.store.Post.GetPost(s.ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canManagePost(actor, post) && !actor.Role.Can(model.PermCommentsModerate) {
+		return nil, types.ErrForbidden
+	}
+
+	post.CommentMode = mode
+	if err := s.store.Post.SetCommentMode(s.ctx, post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// TransitionPost moves the post to the status. Transitions the workflow
+// doesn't allow fail with types.ErrNotAllowed, scheduling needs publishAt in
+// the future.
+func (s *PostService) TransitionPost(postId uint, to model.PostStatus, publishAt *time.Time, actor Actor) (*model.Post, error) {
+	post, err := s.store.Post.GetPost(s.ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewPost(actor, post) {
+		return nil, types.ErrNotFound
+	}
+	if !post.Status.CanTransition(to) {
+		return nil, errors.Wrapf(types.ErrNotAllowed, "a %s post can't become %s", post.Status, to)
+	}
+	if !canTransitionPost(actor, post, to) {
+		return nil, types.ErrForbidden
+	}
+
+	from := post.Status
+	post.Status = to
+	switch to {
+	case model.PostScheduled:
+		if publishAt == nil || !publishAt.After(time.Now()) {
+			return nil, errors.Wrap(types.ErrBadRequest, "publishAt must be in the future")
+		}
+		at := publishAt.UTC()
+		post.PublishedAt = &at
+	case model.PostPublished:
+		now := time.Now().UTC()
+		post.PublishedAt = &now
+	case model.PostDraft, model.PostInReview:
+		post.PublishedAt = nil
+	}
+
+	if err := s.store.Post.SetPostStatus(s.ctx, post, from); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case to == model.PostPublished:
+		logIndexError(s.store.Search.IndexPost(s.ctx, post), "publishing post", post.ID)
+	case from == model.PostPublished:
+		logIndexError(s.store.Search.RemovePost(s.ctx, post.ID), "unpublishing post", post.ID)
+	}
+	return post, nil
+}
+
+// PublishScheduled publishes the scheduled posts whose time has come. The
+// scheduler runs it, posts another instance got to first are skipped.
+func (s *PostService) PublishScheduled() error {
+	for {
+		posts, err := s.store.Post.GetDuePosts(s.ctx, time.Now(), publishBatch)
+		if err != nil {
+			return err
+		}
+
+		for i := range posts {
+			post := &posts[i]
+			post.Status = model.PostPublished
+
+			err := s.store.Post.SetPostStatus(s.ctx, post, model.PostScheduled)
+			if errors.Cause(err) == types.ErrConflict {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			logIndexError(s.store.Search.IndexPost(s.ctx, post), "publishing post", post.ID)
+		}
+
+		if len(posts) < publishBatch {
+			return nil
+		}
+	}
 }
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"fmt"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/slavik22/blogRestApi/lib/markdown"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"strings"
+)
+
+// diffContext is how many unchanged lines surround each change in a diff
+const diffContext = 3
+
+// GetRevisions returns the post's revisions, newest first
+func (s *PostService) GetRevisions(postId uint, actor Actor) ([]model.PostRevision, error) {
+	if _, err := s.reviewPost(postId, actor); err != nil {
+		return nil, err
+	}
+
+	return s.store.Revision.GetRevisions(s.ctx, postId)
+}
+
+func (s *PostService) GetRevision(postId uint, number int, actor Actor) (*model.PostRevision, error) {
+	if _, err := s.reviewPost(postId, actor); err != nil {
+		return nil, err
+	}
+
+	return s.store.Revision.GetRevision(s.ctx, postId, number)
+}
+
+// DiffRevisions returns a unified diff that turns revision from into revision to
+func (s *PostService) DiffRevisions(postId uint, from, to int, actor Actor) (*model.RevisionDiff, error) {
+	if _, err := s.reviewPost(postId, actor); err != nil {
+		return nil, err
+	}
+
+	a, err := s.store.Revision.GetRevision(s.ctx, postId, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.store.Revision.GetRevision(s.ctx, postId, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(revisionText(a)),
+		B:        difflib.SplitLines(revisionText(b)),
+		FromFile: fmt.Sprintf("revision %d", from),
+		ToFile:   fmt.Sprintf("revision %d", to),
+		Context:  diffContext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.RevisionDiff{From: from, To: to, Diff: diff}, nil
+}
+
+// RestoreRevision brings back the title and body of an earlier revision. The
+// post's history is kept, the restored content becomes the newest revision.
+func (s *PostService) RestoreRevision(postId uint, number int, actor Actor) (*model.Post, error) {
+	post, err := s.reviewPost(postId, actor)
+	if err != nil {
+		return nil, err
+	}
+	if !canManagePost(actor, post) {
+		return nil, types.ErrForbidden
+	}
+
+	revision, err := s.store.Revision.GetRevision(s.ctx, postId, number)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := post.Body
+	post.Title = revision.Title
+	post.Body = revision.Body
+	if post.BodyHTML, err = markdown.Render(revision.Body, markdown.Post); err != nil {
+		return nil, err
+	}
+
+	// The tags are left alone
+	tags := post.Tags
+	post.Tags = nil
+
+	restored, err := s.store.Post.UpdatePost(s.ctx, post, model.PostRevision{UserId: actor.UserId, RestoredFrom: &number})
+	if err != nil {
+		return nil, err
+	}
+	restored.Tags = tags
+
+	if err := linkMedia(s.ctx, s.store, restored, previous); err != nil {
+		return nil, err
+	}
+
+	if restored.Status == model.PostPublished {
+		logIndexError(s.store.Search.IndexPost(s.ctx, restored), "restoring post", restored.ID)
+	}
+	return restored, nil
+}
+
+// reviewPost returns the post if the actor may read its revisions
+func (s *PostService) reviewPost(postId uint, actor Actor) (*model.Post, error) {
+	post, err := s.store.Post.GetPost(s.ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewPost(actor, post) {
+		return nil, types.ErrNotFound
+	}
+	if !canReviewPost(actor, post) {
+		return nil, types.ErrForbidden
+	}
+	return post, nil
+}
+
+// revisionText is what a diff compares, the title on the first line. A
+// trailing newline would show up as an extra blank line.
+func revisionText(revision *model.PostRevision) string {
+	return strings.TrimSuffix(revision.Title+"\n\n"+revision.Body, "\n")
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	"log"
+	"strings"
+)
+
+// reindexBatch is how many rows Reindex reads at once
+const reindexBatch = 500
+
+type SearchService struct {
+	ctx   context.Context
+	store *repository.Store
+	cfg   *blogRestApi.Config
+}
+
+func NewSearchService(ctx context.Context, store *repository.Store, cfg *blogRestApi.Config) *SearchService {
+	return &SearchService{
+		ctx:   ctx,
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Search returns a page of the posts and comments matching the query, best
+// match first. Hits are ranked, so they are paged by number only.
+func (s *SearchService) Search(query model.SearchQuery) (*model.Page[model.SearchHit], error) {
+	query.Text = strings.TrimSpace(query.Text)
+	if query.Text == "" {
+		return nil, errors.Wrap(types.ErrBadRequest, "search text is required")
+	}
+	if query.Page.Cursor != nil {
+		return nil, errors.Wrap(types.ErrBadRequest, "search results are paged by number")
+	}
+
+	page, err := pageRequest(s.cfg, nil, query.Page)
+	if err != nil {
+		return nil, err
+	}
+	if !page.Offset() {
+		page.Page = 1
+	}
+	query.Page = page
+
+	hits, total, err := s.store.Search.Search(s.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(page, hits, total, nil), nil
+}
+
+// Reindex feeds every published post and every comment to the search index.
+// Only indexes that live outside the database need it, on start up.
+func (s *SearchService) Reindex() error {
+	if err := indexPosts(s.ctx, s.store, model.PostQuery{}, false); err != nil {
+		return err
+	}
+	return indexComments(s.ctx, s.store, model.CommentQuery{})
+}
+
+// indexPosts feeds the published posts matching the query to the search
+// index, with all of their comments if withComments is set
+func indexPosts(ctx context.Context, store *repository.Store, query model.PostQuery, withComments bool) error {
+	query.Page = model.PageRequest{Limit: reindexBatch}
+	for {
+		posts, err := store.Post.GetPosts(ctx, query)
+		if err != nil {
+			return err
+		}
+		for i := range posts {
+			if err := store.Search.IndexPost(ctx, &posts[i]); err != nil {
+				return err
+			}
+			if withComments {
+				if err := indexComments(ctx, store, model.CommentQuery{PostId: posts[i].ID}); err != nil {
+					return err
+				}
+			}
+		}
+		if len(posts) < reindexBatch {
+			return nil
+		}
+		last := posts[len(posts)-1]
+		query.Page.Cursor = &model.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// indexComments feeds the approved comments matching the query to the search
+// index
+func indexComments(ctx context.Context, store *repository.Store, query model.CommentQuery) error {
+	query.Status = model.CommentApproved
+	query.AnyStatus = true
+	query.Page = model.PageRequest{Limit: reindexBatch}
+	for {
+		comments, err := store.Comment.GetComments(ctx, query)
+		if err != nil {
+			return err
+		}
+		for i := range comments {
+			if err := store.Search.IndexComment(ctx, &comments[i]); err != nil {
+				return err
+			}
+		}
+		if len(comments) < reindexBatch {
+			return nil
+		}
+		last := comments[len(comments)-1]
+		query.Page.Cursor = &model.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// logIndexError reports a search index that fell out of sync. The write it
+// follows has already succeeded, so it isn't failed.
+func logIndexError(err error, action string, id uint) {
+	if err != nil {
+		log.Printf("could not update search index after %s %d: %v", action, id, err)
+	}
+}
+
+// indexComment feeds the comment to the search index if it is approved,
+// others aren't public
+func indexComment(ctx context.Context, store *repository.Store, comment *model.Comment) error {
+	if comment.Status != model.CommentApproved {
+		return nil
+	}
+	return store.Search.IndexComment(ctx, comment)
+}
@@ -1,29 +1,106 @@
 package service
 
 import (
+	"context"
+	"github.com/slavik22/blogRestApi/lib/util"
 	"github.com/slavik22/blogRestApi/model"
+	"io"
+	"time"
 )
 
 //go:generate mockery --dir . --name UserService --output ./mocks
 type UserServ interface {
 	CreateUser(user model.User) (uint, error)
-	SignIn(email, password string) (string, error)
-	//UpdateUser(context.Context, *model.User) (*model.User, error)
-	//DeleteUser(context.Context, uint) error
+	VerifyEmail(token string) error
+	ResendVerification(userId uint) error
+	SignIn(email, password, ip string) (*AuthTokens, error)
+	VerifyMFA(mfaToken, code string) (*AuthTokens, error)
+	StartOIDC() (*OIDCLogin, error)
+	FinishOIDC(code, state, savedState string) (*AuthTokens, error)
+	EnrollTOTP(userId uint) (*TOTPEnrollment, error)
+	ConfirmTOTP(userId uint, code string) ([]string, error)
+	DisableTOTP(userId uint, password string) error
+	Refresh(refreshToken string) (*AuthTokens, error)
+	Logout(sessionId string) error
+	Authenticate(accessToken string) (*Identity, error)
+	CreatePersonalToken(userId uint, input PersonalTokenInput) (*model.PersonalAccessToken, string, error)
+	GetPersonalTokens(userId uint) ([]model.PersonalAccessToken, error)
+	RevokePersonalToken(userId uint, tokenId uint) error
+	JWKS() util.JWKSet
+	SetRole(userId uint, role model.Role) error
+	GetLockouts() ([]model.LoginThrottle, error)
+	ClearLockout(id uint) error
+	GetUser(userId uint) (*model.User, error)
+	GetProfile(userId uint) (*Profile, error)
+	UpdateProfile(userId uint, update ProfileUpdate) (*model.User, error)
+	DeleteUser(userId uint) error
+	ChangePassword(userId uint, currentPassword, newPassword, sessionId string) error
+	RequestEmailChange(userId uint, newEmail, password string) error
+	ConfirmEmailChange(token string) error
+	ForgotPassword(email string) error
+	ResetPassword(token, newPassword string) error
 }
 
 type PostServ interface {
-	GetPosts() ([]model.Post, error)
-	GetPost(postId uint, userId uint) (*model.Post, error)
+	GetPosts(query model.PostQuery, actor Actor) (*model.Page[model.Post], error)
+	GetPost(postId uint, actor Actor) (*model.Post, error)
+	GetPostBySlug(slug string, actor Actor) (*model.Post, error)
 	CreatePost(post model.Post, userId uint) (uint, error)
-	UpdatePost(post model.Post) (*model.Post, error)
-	DeletePost(postId uint, userId uint) error
+	UpdatePost(post model.Post, actor Actor) (*model.Post, error)
+	DeletePost(postId uint, actor Actor) error
+	TransitionPost(postId uint, to model.PostStatus, publishAt *time.Time, actor Actor) (*model.Post, error)
+	SetCommentMode(postId uint, mode model.CommentMode, actor Actor) (*model.Post, error)
+	PublishScheduled() error
+	GetRevisions(postId uint, actor Actor) ([]model.PostRevision, error)
+	GetRevision(postId uint, number int, actor Actor) (*model.PostRevision, error)
+	DiffRevisions(postId uint, from, to int, actor Actor) (*model.RevisionDiff, error)
+	RestoreRevision(postId uint, number int, actor Actor) (*model.Post, error)
 }
 
 type CommentServ interface {
-	GetComments() ([]model.Comment, error)
-	GetComment(commentId uint) (*model.Comment, error)
-	CreateComment(comment model.Comment, userId uint) (uint, error)
-	UpdateComment(comment model.Comment) (*model.Comment, error)
-	DeleteComment(commentId uint, userId uint) error
+	GetComments(query model.CommentQuery, actor Actor) (*model.Page[model.Comment], error)
+	GetPostComments(postId uint, query model.CommentQuery, actor Actor) (*model.Page[model.Comment], error)
+	GetQueue(query model.CommentQuery, actor Actor) (*model.Page[model.Comment], error)
+	GetComment(commentId uint, actor Actor) (*model.Comment, error)
+	GetThread(postId uint, actor Actor) ([]*model.CommentNode, error)
+	GetTree(postId uint, actor Actor) ([]*model.CommentNode, error)
+	CreateComment(comment model.Comment, actor Actor) (*model.Comment, error)
+	ModerateComments(ids []uint, status model.CommentStatus, actor Actor) ([]model.Comment, error)
+	UpdateComment(comment model.Comment, actor Actor) (*model.Comment, error)
+	DeleteComment(commentId uint, actor Actor) error
+}
+
+type SearchServ interface {
+	Search(query model.SearchQuery) (*model.Page[model.SearchHit], error)
+	Reindex() error
+}
+
+type TrashServ interface {
+	GetTrash(userId uint) ([]model.TrashItem, error)
+	RestorePost(postId uint, actor Actor) (*model.Post, error)
+	RestoreComment(commentId uint, actor Actor) (*model.Comment, error)
+	RestoreUser(userId uint) error
+	Purge(before time.Time) (*model.PurgeResult, error)
+	PurgeExpired() error
+}
+
+type MediaServ interface {
+	Upload(file io.Reader, size int64, filename string, userId uint) (*model.Media, error)
+	OpenMedia(key string) (*model.Media, io.ReadCloser, error)
+	GetUserMedia(userId uint) ([]model.Media, error)
+	DeleteMedia(mediaId uint, actor Actor) error
+	DeleteOrphans() error
+	StartWorkers(ctx context.Context)
+	QueuePending() error
+	ProcessMedia(mediaId uint) error
+}
+
+type TaxonomyServ interface {
+	GetTags() ([]model.TagCount, error)
+	GetTag(slug string) (*model.Tag, error)
+	RenameTag(slug, name string) (*model.Tag, error)
+	MergeTags(slug, into string) (*model.Tag, error)
+	GetCategories() ([]model.Category, error)
+	CreateCategory(category model.Category) (*model.Category, error)
+	DeleteCategory(slug string) error
 }
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/spam"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	"log"
+	"os"
+	"time"
+)
+
+// SpamVerdict is what a spam check makes of a comment, stronger verdicts
+// are greater
+type SpamVerdict int
+
+const (
+	// SpamHam comments are moderated as the post says
+	SpamHam SpamVerdict = iota
+	// SpamSuspicious comments wait for a moderator even on open posts
+	SpamSuspicious
+	// SpamSpam comments are stored as spam, only moderators see them
+	SpamSpam
+)
+
+func (v SpamVerdict) String() string {
+	switch v {
+	case SpamSuspicious:
+		return "suspicious"
+	case SpamSpam:
+		return "spam"
+	}
+	return "ham"
+}
+
+// SpamResult is a verdict and the reason for it
+type SpamResult struct {
+	Verdict SpamVerdict
+	Reason  string
+}
+
+// SpamChecker checks new comments for spam. The comment has its author, IP
+// and honeypot set but is not stored yet.
+type SpamChecker interface {
+	Check(ctx context.Context, comment *model.Comment) (SpamResult, error)
+}
+
+// SpamCheckers runs the checks in order and returns the strongest verdict,
+// it stops at the first spam one. A failing check is logged and skipped, so
+// comments aren't refused because a check is down.
+type SpamCheckers []SpamChecker
+
+func (checkers SpamCheckers) Check(ctx context.Context, comment *model.Comment) (SpamResult, error) {
+	var result SpamResult
+	for _, checker := range checkers {
+		res, err := checker.Check(ctx, comment)
+		if err != nil {
+			log.Printf("spam check %T failed: %v", checker, err)
+			continue
+		}
+		if res.Verdict > result.Verdict {
+			result = res
+		}
+		if result.Verdict == SpamSpam {
+			break
+		}
+	}
+	return result, nil
+}
+
+// LinkChecker finds comments with many links suspicious, and with a lot of
+// them spam
+type LinkChecker struct {
+	Limit     int
+	SpamLimit int
+}
+
+func (c LinkChecker) Check(ctx context.Context, comment *model.Comment) (SpamResult, error) {
+	links := spam.CountLinks(commentText(comment))
+	switch {
+	case links > c.SpamLimit:
+		return SpamResult{SpamSpam, fmt.Sprintf("%d links", links)}, nil
+	case links > c.Limit:
+		return SpamResult{SpamSuspicious, fmt.Sprintf("%d links", links)}, nil
+	}
+	return SpamResult{}, nil
+}
+
+// BlocklistChecker finds comments holding a blocked word or expression spam
+type BlocklistChecker struct {
+	Blocklist *spam.Blocklist
+}
+
+func (c BlocklistChecker) Check(ctx context.Context, comment *model.Comment) (SpamResult, error) {
+	if entry := c.Blocklist.Match(commentText(comment)); entry != "" {
+		return SpamResult{SpamSpam, fmt.Sprintf("blocklisted %q", entry)}, nil
+	}
+	return SpamResult{}, nil
+}
+
+// HoneypotChecker finds comments that filled in the hidden form field spam,
+// people don't see it
+type HoneypotChecker struct{}
+
+func (HoneypotChecker) Check(ctx context.Context, comment *model.Comment) (SpamResult, error) {
+	if comment.Honeypot != "" {
+		return SpamResult{SpamSpam, "honeypot filled in"}, nil
+	}
+	return SpamResult{}, nil
+}
+
+// RateChecker finds comments suspicious once their author or client IP wrote
+// Limit comments within Window, whatever their status
+type RateChecker struct {
+	Store  *repository.Store
+	Window time.Duration
+	Limit  int
+}
+
+func (c RateChecker) Check(ctx context.Context, comment *model.Comment) (SpamResult, error) {
+	since := time.Now().Add(-c.Window)
+
+	queries := []model.CommentQuery{{AuthorId: comment.UserId, AnyStatus: true, CreatedAfter: &since}}
+	if comment.IP != "" {
+		queries = append(queries, model.CommentQuery{IP: comment.IP, AnyStatus: true, CreatedAfter: &since})
+	}
+
+	for _, query := range queries {
+		count, err := c.Store.Comment.CountComments(ctx, query)
+		if err != nil {
+			return SpamResult{}, err
+		}
+		if count >= int64(c.Limit) {
+			return SpamResult{SpamSuspicious, fmt.Sprintf("%d comments within %s", count, c.Window)}, nil
+		}
+	}
+	return SpamResult{}, nil
+}
+
+// BayesChecker finds comments the naive Bayes classifier scores Threshold or
+// more spam. Moderators train it, it doesn't classify before they decided
+// on MinTraining spam and as many ham comments.
+type BayesChecker struct {
+	Store       *repository.Store
+	Threshold   float64
+	MinTraining int64
+}
+
+func (c BayesChecker) Check(ctx context.Context, comment *model.Comment) (SpamResult, error) {
+	spamDocs, hamDocs, err := c.Store.Spam.GetSpamTotals(ctx)
+	if err != nil {
+		return SpamResult{}, err
+	}
+	if spamDocs < c.MinTraining || hamDocs < c.MinTraining {
+		return SpamResult{}, nil
+	}
+
+	tokens := spam.Tokenize(commentText(comment))
+	rows, err := c.Store.Spam.GetSpamTokens(ctx, tokens)
+	if err != nil {
+		return SpamResult{}, err
+	}
+
+	counts := make(map[string]spam.TokenCount, len(rows))
+	for token, row := range rows {
+		counts[token] = spam.TokenCount{Spam: row.Spam, Ham: row.Ham}
+	}
+
+	if score := spam.Score(tokens, counts, spamDocs, hamDocs); score >= c.Threshold {
+		return SpamResult{SpamSpam, fmt.Sprintf("scored %.2f", score)}, nil
+	}
+	return SpamResult{}, nil
+}
+
+// NewSpamChecker chains the checks listed in SPAM_CHECKS
+func NewSpamChecker(cfg *blogRestApi.Config, store *repository.Store) (SpamChecker, error) {
+	var checkers SpamCheckers
+	for _, name := range splitList(cfg.SpamChecks) {
+		switch name {
+		case "links":
+			checkers = append(checkers, LinkChecker{Limit: cfg.SpamLinkLimit, SpamLimit: cfg.SpamLinkSpamLimit})
+		case "blocklist":
+			blocklist, err := loadBlocklist(cfg)
+			if err != nil {
+				return nil, err
+			}
+			if blocklist.Len() > 0 {
+				checkers = append(checkers, BlocklistChecker{Blocklist: blocklist})
+			}
+		case "honeypot":
+			checkers = append(checkers, HoneypotChecker{})
+		case "rate":
+			checkers = append(checkers, RateChecker{Store: store, Window: cfg.SpamRateWindow, Limit: cfg.SpamRateLimit})
+		case "bayes":
+			checkers = append(checkers, BayesChecker{Store: store, Threshold: cfg.SpamBayesThreshold, MinTraining: cfg.SpamBayesMinTraining})
+		default:
+			return nil, fmt.Errorf("unknown spam check %q", name)
+		}
+	}
+	return checkers, nil
+}
+
+// loadBlocklist reads SPAM_BLOCKLIST and SPAM_BLOCKLIST_FILE
+func loadBlocklist(cfg *blogRestApi.Config) (*spam.Blocklist, error) {
+	blocklist, err := spam.ParseBlocklist(cfg.SpamBlocklist)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SpamBlocklistFile == "" {
+		return blocklist, nil
+	}
+
+	file, err := os.Open(cfg.SpamBlocklistFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := blocklist.ReadBlocklist(file); err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.SpamBlocklistFile, err)
+	}
+	return blocklist, nil
+}
+
+// trainSpam teaches the classifier a moderator's decision on the comment,
+// approved comments are ham. Rejected ones are neither, they may just be off
+// topic. Failures are logged, the decision stands without training.
+func trainSpam(ctx context.Context, store *repository.Store, comment *model.Comment) {
+	if comment.Status != model.CommentApproved && comment.Status != model.CommentSpam {
+		return
+	}
+
+	tokens := spam.Tokenize(commentText(comment))
+	if err := store.Spam.TrainSpam(ctx, comment.ID, tokens, comment.Status == model.CommentSpam); err != nil {
+		log.Printf("could not train spam filter with comment %d: %v", comment.ID, err)
+	}
+}
+
+// commentText is what spam checks read of a comment
+func commentText(comment *model.Comment) string {
+	return comment.Title + "\n" + comment.Body
+}
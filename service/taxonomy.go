@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxPostTags   = 10
+	maxNameLength = 64
+)
+
+type TaxonomyService struct {
+	ctx   context.Context
+	store *repository.Store
+	cfg   *blogRestApi.Config
+}
+
+func NewTaxonomyService(ctx context.Context, store *repository.Store, cfg *blogRestApi.Config) *TaxonomyService {
+	return &TaxonomyService{
+		ctx:   ctx,
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// GetTags returns every tag with its usage count, most used first
+func (s *TaxonomyService) GetTags() ([]model.TagCount, error) {
+	return s.store.Tag.GetTags(s.ctx)
+}
+
+func (s *TaxonomyService) GetTag(slug string) (*model.Tag, error) {
+	return s.store.Tag.GetTag(s.ctx, slug)
+}
+
+// RenameTag gives the tag a new name and slug. Renaming onto another tag's
+// slug is a conflict, merge the tags instead.
+func (s *TaxonomyService) RenameTag(slug, name string) (*model.Tag, error) {
+	tag, err := s.store.Tag.GetTag(s.ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	name, newSlug, err := normalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if newSlug != tag.Slug {
+		other, err := s.store.Tag.GetTag(s.ctx, newSlug)
+		if err == nil && other.ID != tag.ID {
+			return nil, errors.Wrapf(types.ErrConflict, "tag %s already exists", newSlug)
+		}
+		if err != nil && errors.Cause(err) != types.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	tag.Name, tag.Slug = name, newSlug
+	if err := s.store.Tag.UpdateTag(s.ctx, tag); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// MergeTags moves the posts of one tag to another and deletes the first
+func (s *TaxonomyService) MergeTags(slug, into string) (*model.Tag, error) {
+	from, err := s.store.Tag.GetTag(s.ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.store.Tag.GetTag(s.ctx, into)
+	if err != nil {
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil, errors.Wrapf(types.ErrBadRequest, "tag %s does not exist", into)
+		}
+		return nil, err
+	}
+
+	if from.ID == target.ID {
+		return nil, errors.Wrap(types.ErrBadRequest, "can't merge a tag into itself")
+	}
+
+	if err := s.store.Tag.MergeTags(s.ctx, from.ID, target.ID); err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+// GetCategories returns the category tree, siblings sorted by name
+func (s *TaxonomyService) GetCategories() ([]model.Category, error) {
+	categories, err := s.store.Category.GetCategories(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	children := map[uint][]model.Category{}
+	for _, category := range categories {
+		var parent uint
+		if category.ParentId != nil {
+			parent = *category.ParentId
+		}
+		children[parent] = append(children[parent], category)
+	}
+
+	var build func(parent uint) []model.Category
+	build = func(parent uint) []model.Category {
+		level := children[parent]
+		for i := range level {
+			level[i].Children = build(level[i].ID)
+		}
+		return level
+	}
+
+	tree := build(0)
+	if tree == nil {
+		tree = []model.Category{}
+	}
+	return tree, nil
+}
+
+func (s *TaxonomyService) CreateCategory(category model.Category) (*model.Category, error) {
+	name, slug, err := normalizeName(category.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.store.Category.GetCategories(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if findCategory(categories, func(c model.Category) bool { return c.Slug == slug }) != nil {
+		return nil, errors.Wrapf(types.ErrConflict, "category %s already exists", slug)
+	}
+
+	if category.ParentId != nil && *category.ParentId == 0 {
+		category.ParentId = nil
+	}
+	if category.ParentId != nil &&
+		findCategory(categories, func(c model.Category) bool { return c.ID == *category.ParentId }) == nil {
+		return nil, errors.Wrap(types.ErrBadRequest, "parent category does not exist")
+	}
+
+	created := model.Category{Name: name, Slug: slug, ParentId: category.ParentId}
+	if err := s.store.Category.CreateCategory(s.ctx, &created); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// DeleteCategory deletes a category without subcategories, its posts become uncategorised
+func (s *TaxonomyService) DeleteCategory(slug string) error {
+	categories, err := s.store.Category.GetCategories(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	category := findCategory(categories, func(c model.Category) bool { return c.Slug == slug })
+	if category == nil {
+		return types.ErrNotFound
+	}
+
+	if findCategory(categories, func(c model.Category) bool { return c.ParentId != nil && *c.ParentId == category.ID }) != nil {
+		return errors.Wrap(types.ErrConflict, "category has subcategories")
+	}
+
+	return s.store.Category.DeleteCategory(s.ctx, category.ID)
+}
+
+// normalizeName trims a tag or category name and derives its slug
+func normalizeName(name string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	slug := util.Slugify(name)
+
+	if slug == "" || utf8.RuneCountInString(name) > maxNameLength || len(slug) > maxNameLength {
+		return "", "", errors.Wrapf(types.ErrBadRequest, "invalid name %q", name)
+	}
+
+	return name, slug, nil
+}
+
+// resolveTags normalizes the names of a post's tags and saves the new ones
+func resolveTags(ctx context.Context, store *repository.Store, tags []model.Tag) ([]model.Tag, error) {
+	var named []model.Tag
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		name, slug, err := normalizeName(tag.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[slug] {
+			seen[slug] = true
+			named = append(named, model.Tag{Name: name, Slug: slug})
+		}
+	}
+
+	if len(named) > maxPostTags {
+		return nil, errors.Wrapf(types.ErrBadRequest, "a post can have at most %d tags", maxPostTags)
+	}
+
+	return store.Tag.SaveTags(ctx, named)
+}
+
+// checkCategory makes sure a post's category exists, 0 means no category
+func checkCategory(ctx context.Context, store *repository.Store, categoryId *uint) (*uint, error) {
+	if categoryId == nil || *categoryId == 0 {
+		return nil, nil
+	}
+
+	categories, err := store.Category.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if findCategory(categories, func(c model.Category) bool { return c.ID == *categoryId }) == nil {
+		return nil, errors.Wrap(types.ErrBadRequest, "category does not exist")
+	}
+
+	return categoryId, nil
+}
+
+// categorySubtree returns the ids of the category with the slug and of all
+// categories below it, nil if there is no such category
+func categorySubtree(ctx context.Context, store *repository.Store, slug string) ([]uint, error) {
+	categories, err := store.Category.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	root := findCategory(categories, func(c model.Category) bool { return c.Slug == slug })
+	if root == nil {
+		return nil, nil
+	}
+
+	ids := []uint{root.ID}
+	for i := 0; i < len(ids); i++ {
+		for _, c := range categories {
+			if c.ParentId != nil && *c.ParentId == ids[i] {
+				ids = append(ids, c.ID)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+func findCategory(categories []model.Category, match func(model.Category) bool) *model.Category {
+	for i := range categories {
+		if match(categories[i]) {
+			return &categories[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/lib/util"
+	"github.com/slavik22/blogRestApi/model"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThrottleError is returned when a sign-in attempt is refused because of
+// earlier failures
+type ThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf("too many failed sign-in attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// Cause lets errors.Cause map the error to types.ErrTooManyRequests
+func (e *ThrottleError) Cause() error {
+	return types.ErrTooManyRequests
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// comparePassword checks the password against the user's hash, or against a
+// dummy hash when there is no such user so both cases take the same time
+func comparePassword(user *model.User, password string) error {
+	if user == nil {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = util.HashPassword("not the password of any user")
+		})
+		_ = util.CheckPassword(password, dummyHash)
+		return types.ErrUnauthorized
+	}
+	return util.CheckPassword(password, user.Password)
+}
+
+func accountSubject(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// accountPolicy throttles the attempts at an account, or at its second factor
+func (s *UserService) accountPolicy() model.ThrottlePolicy {
+	return model.ThrottlePolicy{
+		Limit:   s.cfg.LoginMaxAttempts,
+		Window:  s.cfg.LoginLockout,
+		Backoff: s.cfg.LoginBackoff,
+	}
+}
+
+// ipPolicy throttles the attempts from a client IP. Many users may share it,
+// so it only counts failures, without backing off.
+func (s *UserService) ipPolicy() model.ThrottlePolicy {
+	return model.ThrottlePolicy{
+		Limit:  s.cfg.LoginMaxIPAttempts,
+		Window: s.cfg.LoginLockout,
+	}
+}
+
+// countAttempt counts the attempt against the subject before it is checked,
+// it is refused while the subject is locked out or backing off. Successful
+// attempts are forgiven or reset the throttle.
+func (s *UserService) countAttempt(subject string, policy model.ThrottlePolicy, now time.Time) error {
+	retryAfter, err := s.store.Login.CountAttempt(s.ctx, subject, policy, now)
+	if err != nil {
+		return err
+	}
+	if retryAfter > 0 {
+		return &ThrottleError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// forgiveAttempts uncounts the attempt against the subjects
+func (s *UserService) forgiveAttempts(subjects []string) error {
+	for _, subject := range subjects {
+		if err := s.store.Login.ForgiveAttempt(s.ctx, subject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLockouts lists the accounts and client IPs that are currently locked out
+func (s *UserService) GetLockouts() ([]model.LoginThrottle, error) {
+	return s.store.Login.GetLockouts(s.ctx, time.Now())
+}
+
+// ClearLockout lifts a lockout and forgets the failed attempts behind it
+func (s *UserService) ClearLockout(id uint) error {
+	return s.store.Login.DeleteThrottle(s.ctx, id)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/types"
+	"github.com/slavik22/blogRestApi/model"
+	"github.com/slavik22/blogRestApi/repository"
+	"log"
+	"time"
+)
+
+type TrashService struct {
+	ctx   context.Context
+	store *repository.Store
+	cfg   *blogRestApi.Config
+}
+
+func NewTrashService(ctx context.Context, store *repository.Store, cfg *blogRestApi.Config) *TrashService {
+	return &TrashService{
+		ctx:   ctx,
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// GetTrash returns the user's deleted posts and comments with when they are purged
+func (s *TrashService) GetTrash(userId uint) ([]model.TrashItem, error) {
+	items, err := s.store.Trash.GetTrash(s.ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		items[i].PurgeAt = items[i].DeletedAt.Add(s.cfg.TrashRetention)
+	}
+	return items, nil
+}
+
+// RestorePost takes the post out of the trash with the comments deleted along
+// with it, if the actor may manage the post
+func (s *TrashService) RestorePost(postId uint, actor Actor) (*model.Post, error) {
+	trashed, err := s.store.Trash.GetTrashedPost(s.ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canManagePost(actor, trashed) {
+		return nil, types.ErrForbidden
+	}
+
+	if err := s.store.Trash.RestorePost(s.ctx, trashed); err != nil {
+		return nil, err
+	}
+
+	post, err := s.store.Post.GetPost(s.ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	if post.Status == model.PostPublished {
+		logIndexError(s.store.Search.IndexPost(s.ctx, post), "restoring post", post.ID)
+		logIndexError(indexComments(s.ctx, s.store, model.CommentQuery{PostId: post.ID}), "restoring post", post.ID)
+	}
+	return post, nil
+}
+
+// RestoreComment takes the comment out of the trash if the actor may manage it
+func (s *TrashService) RestoreComment(commentId uint, actor Actor) (*model.Comment, error) {
+	trashed, err := s.store.Trash.GetTrashedComment(s.ctx, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canManageComment(actor, trashed) {
+		return nil, types.ErrForbidden
+	}
+
+	if err := s.store.Trash.RestoreComment(s.ctx, trashed); err != nil {
+		return nil, err
+	}
+
+	comment, err := s.store.Comment.GetComment(s.ctx, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	logIndexError(indexComment(s.ctx, s.store, comment), "restoring comment", comment.ID)
+	return comment, nil
+}
+
+// RestoreUser takes the account out of the trash with everything deleted
+// along with it. Its sessions stay revoked, the user signs in again.
+func (s *TrashService) RestoreUser(userId uint) error {
+	if err := s.store.Trash.RestoreUser(s.ctx, userId); err != nil {
+		return err
+	}
+
+	posts := model.PostQuery{AuthorId: userId}
+	logIndexError(indexPosts(s.ctx, s.store, posts, true), "restoring user", userId)
+	comments := model.CommentQuery{AuthorId: userId}
+	logIndexError(indexComments(s.ctx, s.store, comments), "restoring user", userId)
+	return nil
+}
+
+// Purge removes everything that went to the trash before the time for good
+func (s *TrashService) Purge(before time.Time) (*model.PurgeResult, error) {
+	return s.store.Trash.Purge(s.ctx, before)
+}
+
+// PurgeExpired removes what has been in the trash for longer than
+// TRASH_RETENTION. The scheduler runs it.
+func (s *TrashService) PurgeExpired() error {
+	result, err := s.Purge(time.Now().Add(-s.cfg.TrashRetention))
+	if err != nil {
+		return err
+	}
+
+	if result.Users+result.Posts+result.Comments > 0 {
+		log.Printf("purged %d users, %d posts and %d comments from the trash", result.Users, result.Posts, result.Comments)
+	}
+	return nil
+}
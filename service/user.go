@@ -2,44 +2,661 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/slavik22/blogRestApi"
+	"github.com/slavik22/blogRestApi/lib/mail"
+	"github.com/slavik22/blogRestApi/lib/oidc"
+	"github.com/slavik22/blogRestApi/lib/types"
 	"github.com/slavik22/blogRestApi/lib/util"
 	"github.com/slavik22/blogRestApi/model"
 	"github.com/slavik22/blogRestApi/repository"
+	"log"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// AuthTokens is the token pair handed out on sign-in and refresh. When the
+// user has two-factor authentication enabled, sign-in only returns MFAToken.
+type AuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	MFAToken     string
+}
+
+// Identity is the authenticated caller behind an access token
+type Identity struct {
+	UserId    uint
+	Role      model.Role
+	SessionId string
+	// Scopes is nil for sessions, personal access tokens are limited to it
+	Scopes []model.Permission
+}
+
+// Profile is the public view of a user
+type Profile struct {
+	ID        uint
+	Name      string
+	Bio       string
+	AvatarURL string
+	// PostCount counts the published posts only
+	PostCount int64
+	CreatedAt time.Time
+}
+
+// ProfileUpdate holds the profile fields a user may change
+type ProfileUpdate struct {
+	Name      string
+	Bio       string
+	AvatarURL string
+}
+
+const emailChangeTTL = 24 * time.Hour
+
 type UserService struct {
-	ctx   context.Context
-	store *repository.Store
+	ctx    context.Context
+	store  *repository.Store
+	cfg    *blogRestApi.Config
+	keys   *util.KeySet
+	mailer mail.Sender
+	oidc   *oidc.Client
 }
 
-func NewUserService(ctx context.Context, store *repository.Store) *UserService {
+func NewUserService(ctx context.Context, store *repository.Store, cfg *blogRestApi.Config, keys *util.KeySet, mailer mail.Sender, oidcClient *oidc.Client) *UserService {
 	return &UserService{
-		ctx:   ctx,
-		store: store,
+		ctx:    ctx,
+		store:  store,
+		cfg:    cfg,
+		keys:   keys,
+		mailer: mailer,
+		oidc:   oidcClient,
 	}
 }
 
+// CreateUser registers an unverified user and mails them a verification link
 func (s *UserService) CreateUser(user model.User) (uint, error) {
 	hashedPassword, err := util.HashPassword(user.Password)
 	if err != nil {
 		return 0, err
 	}
+	now := time.Now()
 	user.Password = hashedPassword
-	return s.store.User.CreateUser(s.ctx, &user)
+	user.Role = model.RoleAuthor
+	user.EmailVerifiedAt = nil
+	user.VerificationSentAt = &now
+
+	id, err := s.store.User.CreateUser(s.ctx, &user)
+	if err != nil {
+		return 0, err
+	}
+	user.ID = id
+
+	// The account exists at this point, a lost email can be sent again
+	if err := s.sendVerification(&user); err != nil {
+		log.Printf("could not send verification email to user %d: %v", id, err)
+	}
+
+	return id, nil
+}
+
+// VerifyEmail marks the address the verification link was issued for as verified
+func (s *UserService) VerifyEmail(token string) error {
+	value, err := util.Verify([]byte(s.cfg.LinkSecret), token)
+	if err != nil {
+		return errors.Wrap(types.ErrGone, "verification link is invalid or has expired")
+	}
+
+	var userId uint
+	var email string
+	if _, err := fmt.Sscanf(value, "verify:%d:%s", &userId, &email); err != nil {
+		return errors.Wrap(types.ErrGone, "verification link is invalid or has expired")
+	}
+
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		if errors.Cause(err) == types.ErrNotFound {
+			return errors.Wrap(types.ErrGone, "verification link is invalid or has expired")
+		}
+		return err
+	}
+
+	// The link was issued for an address the user no longer has
+	if user.Email != email {
+		return errors.Wrap(types.ErrGone, "verification link is invalid or has expired")
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	_, err = s.store.User.UpdateUser(s.ctx, user)
+	return err
 }
 
-func (s *UserService) SignIn(email, password string) (string, error) {
+// ResendVerification mails a new verification link, at most once per
+// VERIFICATION_RESEND_INTERVAL
+func (s *UserService) ResendVerification(userId uint) error {
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return errors.Wrap(types.ErrConflict, "email address is already verified")
+	}
+
+	now := time.Now()
+	if user.VerificationSentAt != nil && now.Sub(*user.VerificationSentAt) < s.cfg.VerificationResendInterval {
+		return errors.Wrap(types.ErrTooManyRequests, "verification email was sent recently")
+	}
+
+	user.VerificationSentAt = &now
+	if _, err := s.store.User.UpdateUser(s.ctx, user); err != nil {
+		return err
+	}
+
+	return s.sendVerification(user)
+}
+
+// SignIn checks the credentials and opens a new session. Failed attempts are
+// throttled per account and per client IP, and every kind of failure gets the
+// same answer so it does not tell whether the email has an account.
+func (s *UserService) SignIn(email, password, ip string) (*AuthTokens, error) {
+	now := time.Now()
+	subjects := []string{accountSubject(email)}
+	policies := []model.ThrottlePolicy{s.accountPolicy()}
+	if ip != "" {
+		subjects = append(subjects, ipSubject(ip))
+		policies = append(policies, s.ipPolicy())
+	}
+
+	for i, subject := range subjects {
+		if err := s.countAttempt(subject, policies[i], now); err != nil {
+			// The refused attempt doesn't count against the others
+			if forgiveErr := s.forgiveAttempts(subjects[:i]); forgiveErr != nil {
+				return nil, forgiveErr
+			}
+			return nil, err
+		}
+	}
+
 	user, err := s.store.User.GetUser(s.ctx, email)
 	if err != nil {
-		return "", err
+		if errors.Cause(err) != types.ErrNotFound {
+			return nil, err
+		}
+		user = nil
+	}
+
+	if err := comparePassword(user, password); err != nil {
+		return nil, errors.Wrap(types.ErrUnauthorized, "invalid credentials")
+	}
+
+	if err := s.store.Login.ResetThrottle(s.ctx, subjects[0]); err != nil {
+		return nil, err
+	}
+	if err := s.forgiveAttempts(subjects[1:]); err != nil {
+		return nil, err
+	}
+
+	return s.completeSignIn(user)
+}
+
+// completeSignIn opens a session for a user who has proven their identity, or
+// hands out an MFA challenge when the user has two-factor authentication enabled
+func (s *UserService) completeSignIn(user *model.User) (*AuthTokens, error) {
+	// The session is only opened by VerifyMFA once the second factor checks out
+	if user.TOTPEnabled {
+		mfaToken, err := s.keys.GenerateMFAToken(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &AuthTokens{MFAToken: mfaToken, ExpiresAt: time.Now().Add(util.MFATokenTTL)}, nil
 	}
 
-	err = util.CheckPassword(password, user.Password)
+	return s.openSession(user)
+}
 
+// openSession starts a new login session for the user and issues its first token pair
+func (s *UserService) openSession(user *model.User) (*AuthTokens, error) {
+	sessionId, err := util.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	session := model.Session{
+		ID:        sessionId,
+		UserId:    user.ID,
+		ExpiresAt: time.Now().Add(util.RefreshTokenTTL),
+	}
+	if err := s.store.Session.CreateSession(s.ctx, &session); err != nil {
+		return nil, errors.Wrap(err, "could not create session")
+	}
+
+	return s.issueTokens(&session, user)
+}
+
+// Refresh rotates the refresh token and issues a new token pair. Presenting a
+// refresh token that has already been used revokes the whole session.
+func (s *UserService) Refresh(refreshToken string) (*AuthTokens, error) {
+	token, err := s.store.Session.GetRefreshToken(s.ctx, util.HashToken(refreshToken))
+	if err != nil {
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil, types.ErrUnauthorized
+		}
+		return nil, err
+	}
+
+	session, err := s.store.Session.GetSession(s.ctx, token.SessionId)
+	if err != nil {
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil, types.ErrUnauthorized
+		}
+		return nil, err
+	}
+
+	if session.RevokedAt != nil {
+		return nil, types.ErrUnauthorized
+	}
+
+	if token.UsedAt != nil {
+		return nil, s.revokeReused(session.ID)
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return nil, types.ErrUnauthorized
+	}
+
+	fresh, err := s.store.Session.UseRefreshToken(s.ctx, token.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Someone else rotated this token in the meantime
+	if !fresh {
+		return nil, s.revokeReused(session.ID)
+	}
+
+	// Reload the user so role changes are picked up on refresh
+	user, err := s.store.User.GetUserById(s.ctx, session.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	session.ExpiresAt = time.Now().Add(util.RefreshTokenTTL)
+	if err := s.store.Session.UpdateSession(s.ctx, session); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(session, user)
+}
+
+// Logout revokes the session together with all of its tokens
+func (s *UserService) Logout(sessionId string) error {
+	return s.store.Session.RevokeSession(s.ctx, sessionId)
+}
+
+// Authenticate validates the access token and makes sure its session is still
+// alive. Personal access tokens are recognized by their prefix.
+func (s *UserService) Authenticate(accessToken string) (*Identity, error) {
+	if strings.HasPrefix(accessToken, PersonalTokenPrefix) {
+		return s.authenticatePersonalToken(accessToken)
+	}
+
+	claims, err := s.keys.ParseToken(accessToken)
+	if err != nil {
+		return nil, errors.Wrap(types.ErrUnauthorized, err.Error())
+	}
+
+	session, err := s.store.Session.GetSession(s.ctx, claims.SessionId)
+	if err != nil {
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil, errors.Wrap(types.ErrUnauthorized, "session not found")
+		}
+		return nil, err
+	}
+
+	if session.RevokedAt != nil || session.UserId != claims.UserId {
+		return nil, errors.Wrap(types.ErrUnauthorized, "session has been revoked")
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return nil, errors.Wrap(types.ErrUnauthorized, "session has expired")
+	}
+
+	return &Identity{UserId: claims.UserId, Role: model.Role(claims.Role), SessionId: session.ID}, nil
+}
+
+// GetUser returns the user by id
+func (s *UserService) GetUser(userId uint) (*model.User, error) {
+	return s.store.User.GetUserById(s.ctx, userId)
+}
+
+// GetProfile returns the public profile of the user
+func (s *UserService) GetProfile(userId uint) (*Profile, error) {
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.store.Post.CountPosts(s.ctx, model.PostQuery{AuthorId: userId, Status: model.PostPublished})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Profile{
+		ID:        user.ID,
+		Name:      user.Name,
+		Bio:       user.Bio,
+		AvatarURL: user.AvatarURL,
+		PostCount: count,
+		CreatedAt: user.CreatedAt,
+	}, nil
+}
+
+// UpdateProfile changes the name, bio and avatar of the user
+func (s *UserService) UpdateProfile(userId uint, update ProfileUpdate) (*model.User, error) {
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Name = update.Name
+	user.Bio = update.Bio
+	user.AvatarURL = update.AvatarURL
+
+	return s.store.User.UpdateUser(s.ctx, user)
+}
+
+// DeleteUser revokes all sessions of the user and moves the account to the trash
+func (s *UserService) DeleteUser(userId uint) error {
+	if err := s.store.Session.RevokeUserSessions(s.ctx, userId, ""); err != nil {
+		return err
+	}
+	if err := s.store.User.DeleteUser(s.ctx, userId); err != nil {
+		return err
+	}
+
+	logIndexError(s.store.Search.RemoveAuthor(s.ctx, userId), "deleting user", userId)
+	return nil
+}
+
+// ChangePassword sets a new password after checking the current one. All
+// other sessions of the user are revoked.
+func (s *UserService) ChangePassword(userId uint, currentPassword, newPassword, sessionId string) error {
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := util.CheckPassword(currentPassword, user.Password); err != nil {
+		return errors.Wrap(types.ErrForbidden, "current password is incorrect")
+	}
+
+	hashedPassword, err := util.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+
+	if _, err := s.store.User.UpdateUser(s.ctx, user); err != nil {
+		return err
+	}
+
+	return s.store.Session.RevokeUserSessions(s.ctx, userId, sessionId)
+}
+
+// RequestEmailChange mails a confirmation link to the new address. The email
+// is only changed once the link has been followed.
+func (s *UserService) RequestEmailChange(userId uint, newEmail, password string) error {
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := util.CheckPassword(password, user.Password); err != nil {
+		return errors.Wrap(types.ErrForbidden, "password is incorrect")
+	}
+
+	if err := s.checkEmailFree(newEmail); err != nil {
+		return err
+	}
+
+	// Only the latest link stays valid
+	if err := s.store.Token.DeleteUserTokens(s.ctx, userId, model.TokenEmailChange); err != nil {
+		return err
+	}
+
+	token, err := s.createUserToken(userId, model.TokenEmailChange, newEmail, emailChangeTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(s.ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Follow the link to confirm %s as your new email address:\n\n%s/api/v1/users/email/confirm?token=%s\n",
+			newEmail, s.cfg.AppBaseURL, url.QueryEscape(token)),
+	})
+}
+
+// ConfirmEmailChange applies the email change the token was issued for
+func (s *UserService) ConfirmEmailChange(token string) error {
+	userToken, err := s.useUserToken(model.TokenEmailChange, token)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkEmailFree(userToken.Data); err != nil {
+		return err
+	}
+
+	user, err := s.store.User.GetUserById(s.ctx, userToken.UserId)
+	if err != nil {
+		return err
+	}
+
+	// Following the link proves the user owns the new address
+	now := time.Now()
+	user.Email = userToken.Data
+	user.EmailVerifiedAt = &now
+	_, err = s.store.User.UpdateUser(s.ctx, user)
+	return err
+}
+
+// ForgotPassword mails a password reset link. Unknown addresses are silently
+// ignored so the endpoint cannot be used to find out who has an account.
+func (s *UserService) ForgotPassword(email string) error {
+	user, err := s.store.User.GetUser(s.ctx, email)
+	if err != nil {
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	// Only the latest link stays valid
+	if err := s.store.Token.DeleteUserTokens(s.ctx, user.ID, model.TokenPasswordReset); err != nil {
+		return err
+	}
+
+	token, err := s.createUserToken(user.ID, model.TokenPasswordReset, "", s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(s.ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Somebody asked to reset the password of your account. If it was not you, ignore this email.\n\n"+
+			"%s\n\nThe link expires in %s.\n",
+			s.passwordResetLink(token), s.cfg.PasswordResetTTL),
+	})
+}
+
+// passwordResetLink adds the token to PASSWORD_RESET_URL, NewManager checked
+// it parses
+func (s *UserService) passwordResetLink(token string) string {
+	link, _ := url.Parse(s.cfg.PasswordResetURL)
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword and
+// revokes every session of the user
+func (s *UserService) ResetPassword(token, newPassword string) error {
+	userToken, err := s.useUserToken(model.TokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.store.User.GetUserById(s.ctx, userToken.UserId)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := util.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+
+	if _, err := s.store.User.UpdateUser(s.ctx, user); err != nil {
+		return err
+	}
+
+	return s.store.Session.RevokeUserSessions(s.ctx, user.ID, "")
+}
+
+// SetRole changes the role of the user. The new role is embedded in the
+// user's tokens on their next refresh.
+func (s *UserService) SetRole(userId uint, role model.Role) error {
+	if !role.Valid() {
+		return types.ErrBadRequest
+	}
+
+	user, err := s.store.User.GetUserById(s.ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	user.Role = role
+	_, err = s.store.User.UpdateUser(s.ctx, user)
+	return err
+}
+
+// JWKS returns the public keys other services use to verify our tokens
+func (s *UserService) JWKS() util.JWKSet {
+	return s.keys.JWKS()
+}
+
+// sendVerification mails a signed link bound to the user's current address
+func (s *UserService) sendVerification(user *model.User) error {
+	token := util.Sign([]byte(s.cfg.LinkSecret), fmt.Sprintf("verify:%d:%s", user.ID, user.Email),
+		time.Now().Add(s.cfg.EmailVerificationTTL))
+
+	return s.mailer.Send(s.ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Follow the link to verify your email address:\n\n%s/api/v1/auth/verify?token=%s\n\nThe link expires in %s.\n",
+			s.cfg.AppBaseURL, url.QueryEscape(token), s.cfg.EmailVerificationTTL),
+	})
+}
+
+func (s *UserService) checkEmailFree(email string) error {
+	_, err := s.store.User.GetUser(s.ctx, email)
+	if err == nil {
+		return errors.Wrap(types.ErrConflict, "email is already taken")
+	}
+	if errors.Cause(err) != types.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// createUserToken stores a new single-use token and returns its plain value
+func (s *UserService) createUserToken(userId uint, purpose model.TokenPurpose, data string, ttl time.Duration) (string, error) {
+	token, err := util.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.store.Token.CreateUserToken(s.ctx, &model.UserToken{
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: util.HashToken(token),
+		Data:      data,
+		ExpiresAt: time.Now().Add(ttl),
+	})
 	if err != nil {
 		return "", err
 	}
 
-	return util.GenerateToken(user.ID)
+	return token, nil
+}
+
+// useUserToken redeems a single-use token. Unknown, expired and already used
+// tokens are all reported as types.ErrGone.
+func (s *UserService) useUserToken(purpose model.TokenPurpose, token string) (*model.UserToken, error) {
+	userToken, err := s.store.Token.GetUserToken(s.ctx, purpose, util.HashToken(token))
+	if err != nil {
+		if errors.Cause(err) == types.ErrNotFound {
+			return nil, types.ErrGone
+		}
+		return nil, err
+	}
+
+	if userToken.UsedAt != nil || time.Now().After(userToken.ExpiresAt) {
+		return nil, types.ErrGone
+	}
+
+	fresh, err := s.store.Token.UseUserToken(s.ctx, userToken.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, types.ErrGone
+	}
+
+	return userToken, nil
+}
+
+func (s *UserService) revokeReused(sessionId string) error {
+	if err := s.store.Session.RevokeSession(s.ctx, sessionId); err != nil {
+		return err
+	}
+	return errors.Wrap(types.ErrUnauthorized, "refresh token reuse detected")
+}
+
+func (s *UserService) issueTokens(session *model.Session, user *model.User) (*AuthTokens, error) {
+	accessToken, err := s.keys.GenerateToken(user.ID, string(user.Role), session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := util.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.Session.CreateRefreshToken(s.ctx, &model.RefreshToken{
+		SessionId: session.ID,
+		TokenHash: util.HashToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not store refresh token")
+	}
 
+	return &AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(util.AccessTokenTTL),
+	}, nil
 }